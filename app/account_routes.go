@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// largest archive accepted by the import form
+const maxImportSize = 64 << 20
+
+func (a *AppServer) handleAccountView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := r.URL.Path[len("/account/"):]
+
+	contextData := map[string]any{"user": user}
+
+	switch subpath {
+	case "":
+	case "export", "export/":
+		return a.handleAccountExport(c, w, r, user.Username)
+	case "import", "import/":
+		if r.Method != http.MethodPost {
+			return &HandlerError{
+				code:    http.StatusMethodNotAllowed,
+				message: "method not allowed",
+			}
+		}
+		if herr := a.handleAccountImport(c, w, r, user.Username); herr != nil {
+			return herr
+		}
+		contextData["imported"] = true
+	default:
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "address not found",
+		}
+	}
+
+	return a.RenderHtml(c, w, r, []string{"manager/account.html"}, contextData)
+}
+
+// sends the users archive as a zip download. it is written to a temporary file
+// first, once streaming starts a failed export could only end in a truncated zip
+func (a *AppServer) handleAccountExport(c context.Context, w http.ResponseWriter, r *http.Request, username string) *HandlerError {
+	archive, err := os.CreateTemp("", "account-export-*.zip")
+	if err != nil {
+		a.log(c).Error("account export failed", "username", username, "error", err)
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to export account",
+		}
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := storage.ExportAccount(c, a.storage, username, a.userImagesDir, archive); err != nil {
+		a.log(c).Error("account export failed", "username", username, "error", err)
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to export account",
+		}
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", username, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	// sets the content type and length
+	http.ServeContent(w, r, filename, time.Time{}, archive)
+	return nil
+}
+
+func (a *AppServer) handleAccountImport(c context.Context, w http.ResponseWriter, r *http.Request, username string) *HandlerError {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	archive, header, err := r.FormFile("archive")
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "choose an archive to import",
+		}
+	}
+	defer archive.Close()
+
+	err = storage.ImportAccount(storage.WithActor(c, username), a.storage, username, a.userImagesDir, archive, header.Size)
+	switch {
+	case errors.Is(err, storage.ErrAccountNotEmpty):
+		return &HandlerError{
+			code:    http.StatusConflict,
+			message: "archives can only be imported into an empty account",
+		}
+	case errors.Is(err, storage.ErrInvalidArchive):
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "the file is not a valid account archive",
+		}
+	case err != nil:
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to import archive",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// fails loading snapshots, part way through building an export
+type brokenSnapshots struct {
+	storage.Storage
+}
+
+func (s brokenSnapshots) GetResumeSnapshots(c context.Context, username string) ([]*data.ResumeSnapshot, error) {
+	return nil, errors.New("snapshots unavailable")
+}
+
+func TestAccountExport(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+	a.userImagesDir = t.TempDir()
+	handler := a.MakeHTTPHandler(a.handleAccountView)
+
+	export := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/account/export/", nil)
+		r.AddCookie(client.cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := export()
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" || w.Header().Get("Content-Length") == "" {
+		t.Fatalf("Got %d %v, Expected a zip download", w.Code, w.Header())
+	}
+	if _, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len())); err != nil {
+		t.Errorf("Got %v, Expected a readable archive", err)
+	}
+
+	a.storage = brokenSnapshots{a.storage}
+	w = export()
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Got %d %v, Expected a failed export to be reported instead of downloaded", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,392 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// the json api is served under this prefix, breaking changes get a new version
+const apiPrefix = "/api/v1/"
+
+// largest request body the api reads
+const maxAPIBody = 1 << 20
+
+type apiHandler func(c context.Context, w http.ResponseWriter, r *http.Request) *ApiError
+
+// adapts an api handler to net/http, a returned ApiError becomes the json response
+func (a *AppServer) MakeAPIHandler(f apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := f(r.Context(), w, r); err != nil {
+			a.writeAPIError(w, r, err)
+		}
+	}
+}
+
+// writes {"error": ...}. server errors are logged and their details kept from the client
+func (a *AppServer) writeAPIError(w http.ResponseWriter, r *http.Request, aerr *ApiError) {
+	if aerr.Status == 0 {
+		aerr.Status = http.StatusInternalServerError
+	}
+	if aerr.Code == "" {
+		aerr.Code = "internal_error"
+	}
+	if aerr.Status >= 500 {
+		a.log(r.Context()).Error("api error", "status", aerr.Status, "error", aerr.Message)
+		aerr.Message = "the error was logged, please try again later"
+	}
+
+	if written, ok := w.(interface{ Written() bool }); ok && written.Written() {
+		return
+	}
+	writeJSON(w, aerr.Status, map[string]*ApiError{"error": aerr})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodes a json request body into v, rejecting unknown fields
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) *ApiError {
+	if content_type := r.Header.Get("Content-Type"); content_type != "" && !strings.HasPrefix(content_type, "application/json") {
+		return &ApiError{Status: http.StatusUnsupportedMediaType, Code: "unsupported_media_type", Message: "request bodies must be application/json"}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var too_large *http.MaxBytesError
+		if errors.As(err, &too_large) {
+			return &ApiError{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large", Message: fmt.Sprintf("request bodies are limited to %d bytes", maxAPIBody)}
+		}
+		return &ApiError{Status: http.StatusBadRequest, Code: "invalid_json", Message: "request body is not valid json: " + err.Error()}
+	}
+	if decoder.Decode(&struct{}{}) != io.EOF {
+		return &ApiError{Status: http.StatusBadRequest, Code: "invalid_json", Message: "request body must be a single json object"}
+	}
+	return nil
+}
+
+func apiNotFound(what string) *ApiError {
+	return &ApiError{Status: http.StatusNotFound, Code: "not_found", Message: what + " not found"}
+}
+
+func apiInternal(err error) *ApiError {
+	return &ApiError{Status: http.StatusInternalServerError, Message: err.Error()}
+}
+
+func apiMethodNotAllowed(w http.ResponseWriter, allowed ...string) *ApiError {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	return &ApiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "use " + strings.Join(allowed, " or ")}
+}
+
+// maps storage errors to responses, what names the record for not found errors
+func apiStorageError(err error, what string) *ApiError {
+	var conflict *storage.ConflictError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return apiNotFound(what)
+	case errors.As(err, &conflict):
+		return &ApiError{
+			Status:  http.StatusConflict,
+			Code:    "version_conflict",
+			Message: fmt.Sprintf("%s was changed since version %d, read it again and reapply your changes", what, conflict.Version),
+		}
+	case errors.Is(err, storage.ErrInvalidCursor):
+		return &ApiError{Status: http.StatusBadRequest, Code: "invalid_cursor", Message: err.Error()}
+	}
+	return apiInternal(err)
+}
+
+// runs fn in one storage transaction so a request that fails part way through
+// leaves nothing behind, the error fn answers with is kept
+func (a *AppServer) apiAtomic(c context.Context, fn func(context.Context) *ApiError) *ApiError {
+	var herr *ApiError
+	err := a.storage.Atomic(c, func(c context.Context) error {
+		if herr = fn(c); herr != nil {
+			return herr
+		}
+		return nil
+	})
+	if herr != nil {
+		return herr
+	}
+	if err != nil {
+		return apiInternal(err)
+	}
+	return nil
+}
+
+type apiCallerKey struct{}
+
+// who sent an api request, token is nil when signed in with the session cookie
+// and user is nil for anonymous requests
+type apiCaller struct {
+	user  *data.User
+	token *data.ApiToken
+}
+
+// resolves the caller from an Authorization: Bearer token or the session cookie.
+// a token that is unknown, revoked or expired fails the request rather than
+// falling back to an anonymous one
+func (a *AppServer) apiAuthenticate(w http.ResponseWriter, r *http.Request) (*apiCaller, *ApiError) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		user, err := a.IsAuthenticated(r)
+		if err != nil {
+			return &apiCaller{}, nil
+		}
+		return &apiCaller{user: user}, nil
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	secret, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, &ApiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "send api tokens as Authorization: Bearer <token>"}
+	}
+
+	token, err := a.storage.GetApiTokenByHash(r.Context(), data.HashApiToken(strings.TrimSpace(secret)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &ApiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "the api token is unknown or was revoked"}
+	}
+	if err != nil {
+		return nil, apiInternal(err)
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, &ApiError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "the api token has expired"}
+	}
+	w.Header().Del("WWW-Authenticate")
+
+	// a failed update should not fail the request
+	if err := a.storage.TouchApiToken(r.Context(), token.Id, now); err != nil {
+		a.log(r.Context()).Warn("recording api token use failed", "token", token.Id, "error", err)
+	}
+	return &apiCaller{user: &token.User, token: token}, nil
+}
+
+func apiCallerFrom(r *http.Request) *apiCaller {
+	caller, ok := r.Context().Value(apiCallerKey{}).(*apiCaller)
+	if !ok {
+		return &apiCaller{}
+	}
+	return caller
+}
+
+// the signed in user, nil when the request is anonymous or its token
+// may not read entity
+func (a *AppServer) apiUser(r *http.Request, entity string) *data.User {
+	caller := apiCallerFrom(r)
+	if caller.token != nil && !caller.token.Allows(entity, false) {
+		return nil
+	}
+	return caller.user
+}
+
+// only the owner of the records under /users/{username}/ may change them,
+// and only with a token scoped to write entity
+func (a *AppServer) apiOwner(r *http.Request, username, entity string) (*data.User, *ApiError) {
+	caller := apiCallerFrom(r)
+	if caller.user == nil {
+		return nil, &ApiError{Status: http.StatusUnauthorized, Code: "unauthenticated", Message: "sign in or use an api token to make changes"}
+	}
+	if caller.user.Username != username {
+		return nil, &ApiError{Status: http.StatusForbidden, Code: "forbidden", Message: "records can only be changed by their owner"}
+	}
+	if caller.token != nil && !caller.token.Allows(entity, true) {
+		return nil, &ApiError{Status: http.StatusForbidden, Code: "insufficient_scope", Message: "the api token needs the " + entity + ":write scope"}
+	}
+	return caller.user, nil
+}
+
+// a collection of records owned by a user, /users/{username}/{collection}/{id}
+type apiCollection struct {
+	name   string // singular, used in messages
+	entity string // what api tokens are scoped to, see data.Token_entities
+	list   func(c context.Context, username string, page storage.Page) (any, string, error)
+	get    func(c context.Context, username string, id int) (any, error)
+	create func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User) (any, *ApiError)
+	update func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User, id int) (any, *ApiError)
+	delete func(c context.Context, owner data.User, id int) error
+}
+
+func (a *AppServer) apiCollections() map[string]apiCollection {
+	return map[string]apiCollection{
+		"projects":    a.apiProjects(),
+		"employments": a.apiEmployments(),
+		"hobbies":     a.apiHobbies(),
+		"stacks":      a.apiStacks(),
+	}
+}
+
+// routes /api/v1/ requests:
+//
+//	GET            /openapi.json
+//	GET POST       /graphql
+//	GET            /graphql/schema
+//	POST           /users
+//	GET PUT        /users/{username}
+//	GET            /users/{username}/resume
+//	GET PUT DELETE /users/{username}/profile
+//	GET POST       /users/{username}/{projects,employments,hobbies,stacks}
+//	GET PUT DELETE /users/{username}/{projects,employments,hobbies,stacks}/{id}
+func (a *AppServer) handleAPI(c context.Context, w http.ResponseWriter, r *http.Request) *ApiError {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix), "/"), "/")
+	if len(parts) == 1 && parts[0] == "openapi.json" {
+		return a.handleOpenAPI(c, w, r)
+	}
+
+	caller, herr := a.apiAuthenticate(w, r)
+	if herr != nil {
+		return herr
+	}
+	c = context.WithValue(c, apiCallerKey{}, caller)
+	r = r.WithContext(c)
+	if parts[0] == "graphql" && len(parts) <= 2 {
+		return a.handleGraphQL(c, w, r, strings.Join(parts[1:], "/"))
+	}
+	if parts[0] != "users" || len(parts) > 4 {
+		return apiNotFound("endpoint")
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			return apiMethodNotAllowed(w, http.MethodPost)
+		}
+		return a.apiCreateUser(c, w, r)
+	}
+
+	username := parts[1]
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			return a.apiGetUser(c, w, r, username)
+		case http.MethodPut:
+			return a.apiUpdateUser(c, w, r, username)
+		}
+		return apiMethodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+
+	switch parts[2] {
+	case "resume":
+		if len(parts) != 3 {
+			return apiNotFound("endpoint")
+		}
+		if r.Method != http.MethodGet {
+			return apiMethodNotAllowed(w, http.MethodGet)
+		}
+		return a.apiGetResume(c, w, r, username)
+	case "profile":
+		if len(parts) != 3 {
+			return apiNotFound("endpoint")
+		}
+		return a.apiProfile(c, w, r, username)
+	}
+
+	collection, ok := a.apiCollections()[parts[2]]
+	if !ok {
+		return apiNotFound("endpoint")
+	}
+	if len(parts) == 3 {
+		return a.apiCollection(c, w, r, username, collection)
+	}
+
+	id, err := strconv.Atoi(parts[3])
+	if err != nil || id <= 0 {
+		return apiNotFound(collection.name)
+	}
+	return a.apiRecord(c, w, r, username, collection, id)
+}
+
+// lists or creates records of a collection
+func (a *AppServer) apiCollection(c context.Context, w http.ResponseWriter, r *http.Request, username string, collection apiCollection) *ApiError {
+	switch r.Method {
+	case http.MethodGet:
+		if herr := a.apiUserExists(c, username); herr != nil {
+			return herr
+		}
+		items, next, err := collection.list(c, username, pageFromRequest(r))
+		if err != nil {
+			return apiStorageError(err, collection.name)
+		}
+		writeJSON(w, http.StatusOK, apiList{Items: items, Next_cursor: next})
+		return nil
+	case http.MethodPost:
+		owner, herr := a.apiOwner(r, username, collection.entity)
+		if herr != nil {
+			return herr
+		}
+		created, herr := collection.create(storage.WithActor(c, owner.Username), w, r, *owner)
+		if herr != nil {
+			return herr
+		}
+		writeJSON(w, http.StatusCreated, created)
+		return nil
+	}
+	return apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+}
+
+// reads, replaces or deletes a single record
+func (a *AppServer) apiRecord(c context.Context, w http.ResponseWriter, r *http.Request, username string, collection apiCollection, id int) *ApiError {
+	switch r.Method {
+	case http.MethodGet:
+		record, err := collection.get(c, username, id)
+		if err != nil {
+			return apiStorageError(err, collection.name)
+		}
+		writeJSON(w, http.StatusOK, record)
+		return nil
+	case http.MethodPut, http.MethodDelete:
+	default:
+		return apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+
+	owner, herr := a.apiOwner(r, username, collection.entity)
+	if herr != nil {
+		return herr
+	}
+	c = storage.WithActor(c, owner.Username)
+
+	// also makes sure the record belongs to the owner
+	if _, err := collection.get(c, username, id); err != nil {
+		return apiStorageError(err, collection.name)
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := collection.delete(c, *owner, id); err != nil {
+			return apiStorageError(err, collection.name)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	updated, herr := collection.update(c, w, r, *owner, id)
+	if herr != nil {
+		return herr
+	}
+	writeJSON(w, http.StatusOK, updated)
+	return nil
+}
+
+func (a *AppServer) apiUserExists(c context.Context, username string) *ApiError {
+	users, err := a.storage.GetUsers(c, map[string]string{"username": username})
+	if err != nil {
+		return apiInternal(err)
+	}
+	if len(users) == 0 {
+		return apiNotFound("user")
+	}
+	return nil
+}
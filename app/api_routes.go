@@ -0,0 +1,756 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+func (a *AppServer) apiCreateUser(c context.Context, w http.ResponseWriter, r *http.Request) *ApiError {
+	var in signupInput
+	if herr := decodeJSON(w, r, &in); herr != nil {
+		return herr
+	}
+	if herr := in.validate(); herr != nil {
+		return herr
+	}
+
+	taken := fieldErrors{}
+	for field, value := range map[string]string{"username": in.Username, "email": in.Email} {
+		users, err := a.storage.GetUsers(c, map[string]string{field: value})
+		if err != nil {
+			return apiInternal(err)
+		}
+		if len(users) > 0 {
+			taken.add(field, "is already taken")
+		}
+	}
+	if herr := taken.err(); herr != nil {
+		return herr
+	}
+
+	user, err := data.NewUser(in.Firstname, in.Lastname, in.Username, in.Email, in.Password, in.Phone, in.Bio, in.Country, in.Start_date)
+	if err != nil {
+		return apiInternal(err)
+	}
+	// new accounts are created on behalf of themselves
+	if err := a.storage.CreateUser(storage.WithActor(c, user.Username), *user); err != nil {
+		return apiInternal(err)
+	}
+
+	// the account exists either way, a failed email can be requested again
+	if err := a.sendVerificationEmail(c, *user); err != nil {
+		a.log(c).Error("sending verification email failed", "username", user.Username, "error", err)
+	}
+
+	created, err := a.storage.GetUsers(c, map[string]string{"username": user.Username})
+	if err != nil || len(created) == 0 {
+		return apiInternal(fmt.Errorf("reloading created user: %v", err))
+	}
+	w.Header().Set("Location", apiPrefix+"users/"+user.Username)
+	writeJSON(w, http.StatusCreated, newAPIUser(*created[0], true))
+	return nil
+}
+
+func (a *AppServer) apiGetUser(c context.Context, w http.ResponseWriter, r *http.Request, username string) *ApiError {
+	users, err := a.storage.GetUsers(c, map[string]string{"username": username})
+	if err != nil {
+		return apiInternal(err)
+	}
+	if len(users) == 0 {
+		return apiNotFound("user")
+	}
+
+	viewer := a.apiUser(r, "user")
+	writeJSON(w, http.StatusOK, newAPIUser(*users[0], viewer != nil && viewer.Username == username))
+	return nil
+}
+
+// replaces the users details and social links, credentials are changed elsewhere
+func (a *AppServer) apiUpdateUser(c context.Context, w http.ResponseWriter, r *http.Request, username string) *ApiError {
+	owner, herr := a.apiOwner(r, username, "user")
+	if herr != nil {
+		return herr
+	}
+	var in userInput
+	if herr := decodeJSON(w, r, &in); herr != nil {
+		return herr
+	}
+	if herr := in.validate(); herr != nil {
+		return herr
+	}
+
+	c = storage.WithActor(c, username)
+	user := *owner
+	user.Firstname = in.Firstname
+	user.Lastname = in.Lastname
+	user.Phone = in.Phone
+	user.Bio = in.Bio
+	user.Country = in.Country
+	user.Version = in.Version
+	user.SetSocials(in.Portfolio, in.Github, in.Linkedin, in.Twitter)
+
+	// a failed socials write must not keep the new version, a retry would conflict
+	var users []*data.User
+	herr = a.apiAtomic(c, func(c context.Context) *ApiError {
+		if err := a.storage.UpdateUser(c, user); err != nil {
+			return apiStorageError(err, "user")
+		}
+		if err := a.storage.SetUserSocials(c, user); err != nil {
+			return apiInternal(err)
+		}
+
+		var err error
+		users, err = a.storage.GetUsers(c, map[string]string{"username": username})
+		if err != nil || len(users) == 0 {
+			return apiInternal(fmt.Errorf("reloading updated user: %v", err))
+		}
+		return nil
+	})
+	if herr != nil {
+		return herr
+	}
+	writeJSON(w, http.StatusOK, newAPIUser(*users[0], true))
+	return nil
+}
+
+// the whole resume in one response, loaded in a fixed number of queries
+func (a *AppServer) apiGetResume(c context.Context, w http.ResponseWriter, r *http.Request, username string) *ApiError {
+	resume, err := storage.LoadResume(c, a.storage, username)
+	if err != nil {
+		return apiStorageError(err, "user")
+	}
+
+	viewer := a.apiUser(r, "user")
+	writeJSON(w, http.StatusOK, newAPIResume(*resume, viewer != nil && viewer.Username == username))
+	a.emitProfileViewed(c, r, username)
+	return nil
+}
+
+// a user has at most one profile, PUT creates it the first time
+func (a *AppServer) apiProfile(c context.Context, w http.ResponseWriter, r *http.Request, username string) *ApiError {
+	if r.Method == http.MethodGet {
+		profile, err := a.storage.GetProfile(c, username)
+		if err != nil {
+			return apiStorageError(err, "profile")
+		}
+		writeJSON(w, http.StatusOK, newAPIProfile(*profile))
+		a.emitProfileViewed(c, r, username)
+		return nil
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		return apiMethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+
+	owner, herr := a.apiOwner(r, username, "profile")
+	if herr != nil {
+		return herr
+	}
+	c = storage.WithActor(c, username)
+
+	current, err := a.storage.GetProfile(c, username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return apiInternal(err)
+	}
+
+	if r.Method == http.MethodDelete {
+		if current == nil {
+			return apiNotFound("profile")
+		}
+		if err := a.storage.DeleteProfile(c, *current); err != nil {
+			return apiInternal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	var in profileInput
+	if herr := decodeJSON(w, r, &in); herr != nil {
+		return herr
+	}
+	if herr := in.validate(current != nil); herr != nil {
+		return herr
+	}
+
+	status := http.StatusOK
+	profile := data.Profile{User: resumeOwner(*owner), Role: in.Role, About: in.About, Version: in.Version}
+	if current == nil {
+		status = http.StatusCreated
+		err = a.storage.CreateProfile(c, profile)
+	} else {
+		err = a.storage.UpdateProfile(c, profile)
+	}
+	if err != nil {
+		return apiStorageError(err, "profile")
+	}
+
+	saved, err := a.storage.GetProfile(c, username)
+	if err != nil {
+		return apiInternal(err)
+	}
+	writeJSON(w, status, newAPIProfile(*saved))
+	return nil
+}
+
+// owner reference stored on records, storage looks users up by username
+func resumeOwner(u data.User) data.User {
+	return data.User{Id: u.Id, Username: u.Username}
+}
+
+// loads stacks of the user by id, reporting unknown ids as a field error
+func (a *AppServer) apiOwnedStacks(c context.Context, username string, ids []int) ([]data.TechStack, *ApiError) {
+	stacks := []data.TechStack{}
+	for _, id := range ids {
+		found, err := a.storage.GetTechStacks(c, map[string]string{"id": fmt.Sprint(id), "username": username})
+		if err != nil {
+			return nil, apiInternal(err)
+		}
+		if len(found) == 0 {
+			return nil, fieldErrors{"stack_ids": fmt.Sprintf("stack %d does not exist", id)}.err()
+		}
+		stacks = append(stacks, *found[0])
+	}
+	return stacks, nil
+}
+
+// stacks in wanted that are not linked yet
+func unlinkedStacks(linked, wanted []data.TechStack) []data.TechStack {
+	have := map[int]bool{}
+	for _, t := range linked {
+		have[t.Id] = true
+	}
+	missing := []data.TechStack{}
+	for _, t := range wanted {
+		if !have[t.Id] {
+			have[t.Id] = true
+			missing = append(missing, t)
+		}
+	}
+	return missing
+}
+
+func derefStacks(stacks []*data.TechStack) []data.TechStack {
+	list := []data.TechStack{}
+	for _, t := range stacks {
+		list = append(list, *t)
+	}
+	return list
+}
+
+// projects
+
+func (a *AppServer) apiProjects() apiCollection {
+	return apiCollection{
+		name:   "project",
+		entity: "projects",
+		list: func(c context.Context, username string, page storage.Page) (any, string, error) {
+			projects, next, err := a.storage.GetProjects(c, map[string]string{"username": username}, page)
+			if err != nil {
+				return nil, "", err
+			}
+			// one stack query per project, pages are at most storage.MaxPageSize long
+			items := []apiProject{}
+			for _, p := range projects {
+				if err := a.attachProjectStacks(c, p); err != nil {
+					return nil, "", err
+				}
+				items = append(items, newAPIProject(*p))
+			}
+			return items, next, nil
+		},
+		get: func(c context.Context, username string, id int) (any, error) {
+			project, err := a.loadProject(c, username, id)
+			if err != nil {
+				return nil, err
+			}
+			return newAPIProject(*project), nil
+		},
+		create: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User) (any, *ApiError) {
+			var in projectInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			start, end, herr := in.validate(false)
+			if herr != nil {
+				return nil, herr
+			}
+			stacks, herr := a.apiOwnedStacks(c, owner.Username, in.Stack_ids)
+			if herr != nil {
+				return nil, herr
+			}
+
+			duration, _ := data.GetWorkDuration(start, end)
+			project := data.Project{
+				User:        resumeOwner(owner),
+				Name:        in.Name,
+				Duration:    duration,
+				Status:      in.Status,
+				Start_date:  start,
+				End_date:    end,
+				Github:      in.Github,
+				Prod_link:   in.Prod_link,
+				Description: in.Description,
+				Created_on:  time.Now(),
+				Updated_on:  time.Now(),
+			}
+			// created, reloaded and linked in one transaction so a failure leaves no
+			// half created project and the reload can not pick up another one
+			var linked any
+			herr = a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.CreateProject(c, project); err != nil {
+					return apiInternal(err)
+				}
+
+				created, _, err := a.storage.GetProjects(c, map[string]string{"name": in.Name, "username": owner.Username}, storage.Page{Sort: "-id", Limit: 1})
+				if err != nil || len(created) == 0 {
+					return apiInternal(fmt.Errorf("reloading created project: %v", err))
+				}
+				var herr *ApiError
+				linked, herr = a.linkProjectStacks(c, owner.Username, *created[0], stacks)
+				return herr
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			a.emit(c, owner.Username, data.Event_project_added, linked)
+			return linked, nil
+		},
+		update: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User, id int) (any, *ApiError) {
+			var in projectInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			start, end, herr := in.validate(true)
+			if herr != nil {
+				return nil, herr
+			}
+			stacks, herr := a.apiOwnedStacks(c, owner.Username, in.Stack_ids)
+			if herr != nil {
+				return nil, herr
+			}
+
+			project, err := a.loadProject(c, owner.Username, id)
+			if err != nil {
+				return nil, apiStorageError(err, "project")
+			}
+			project.Name = in.Name
+			project.Status = in.Status
+			project.Github = in.Github
+			project.Prod_link = in.Prod_link
+			project.Description = in.Description
+			project.Start_date = start
+			project.End_date = end
+			project.Duration, _ = data.GetWorkDuration(start, end)
+			project.Version = in.Version
+			// a failed link must not keep the new version
+			var linked any
+			herr = a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.UpdateProject(c, *project); err != nil {
+					return apiStorageError(err, "project")
+				}
+				var herr *ApiError
+				linked, herr = a.linkProjectStacks(c, owner.Username, *project, stacks)
+				return herr
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			return linked, nil
+		},
+		delete: func(c context.Context, owner data.User, id int) error {
+			return a.storage.DeleteProject(c, id)
+		},
+	}
+}
+
+// loads a project of the user with its stacks, sql.ErrNoRows when there is none
+func (a *AppServer) loadProject(c context.Context, username string, id int) (*data.Project, error) {
+	projects, _, err := a.storage.GetProjects(c, map[string]string{"id": fmt.Sprint(id), "username": username}, storage.Page{})
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return projects[0], a.attachProjectStacks(c, projects[0])
+}
+
+func (a *AppServer) attachProjectStacks(c context.Context, p *data.Project) error {
+	stacks, err := a.storage.GetProjectTechStacks(c, map[string]string{"project_id": fmt.Sprint(p.Id)})
+	if err != nil {
+		return err
+	}
+	p.Stack = derefStacks(stacks)
+	return nil
+}
+
+// links the stacks the project does not have yet and returns the stored project
+func (a *AppServer) linkProjectStacks(c context.Context, username string, project data.Project, stacks []data.TechStack) (any, *ApiError) {
+	linked, err := a.storage.GetProjectTechStacks(c, map[string]string{"project_id": fmt.Sprint(project.Id)})
+	if err != nil {
+		return nil, apiInternal(err)
+	}
+	for _, t := range unlinkedStacks(derefStacks(linked), stacks) {
+		if err := a.storage.AddTechStackToProject(c, t, project); err != nil {
+			return nil, apiInternal(err)
+		}
+	}
+
+	saved, err := a.loadProject(c, username, project.Id)
+	if err != nil {
+		return nil, apiInternal(err)
+	}
+	return newAPIProject(*saved), nil
+}
+
+// employments
+
+func (a *AppServer) apiEmployments() apiCollection {
+	return apiCollection{
+		name:   "employment",
+		entity: "employments",
+		list: func(c context.Context, username string, page storage.Page) (any, string, error) {
+			employments, next, err := a.storage.GetEmployments(c, map[string]string{"username": username}, page)
+			if err != nil {
+				return nil, "", err
+			}
+			// one stack query per employment, pages are at most storage.MaxPageSize long
+			items := []apiEmployment{}
+			for _, e := range employments {
+				if err := a.attachEmploymentStacks(c, e); err != nil {
+					return nil, "", err
+				}
+				items = append(items, newAPIEmployment(*e))
+			}
+			return items, next, nil
+		},
+		get: func(c context.Context, username string, id int) (any, error) {
+			employment, err := a.loadEmployment(c, username, id)
+			if err != nil {
+				return nil, err
+			}
+			return newAPIEmployment(*employment), nil
+		},
+		create: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User) (any, *ApiError) {
+			var in employmentInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			start, end, herr := in.validate(false)
+			if herr != nil {
+				return nil, herr
+			}
+			stacks, herr := a.apiOwnedStacks(c, owner.Username, in.Stack_ids)
+			if herr != nil {
+				return nil, herr
+			}
+
+			duration, _ := data.GetWorkDuration(start, end)
+			employment := data.Employment{
+				User:        resumeOwner(owner),
+				Name:        in.Name,
+				Employee:    in.Employee,
+				Duration:    duration,
+				Status:      in.Status,
+				Start_date:  start,
+				End_date:    end,
+				Prod_link:   in.Prod_link,
+				Description: in.Description,
+				Created_on:  time.Now(),
+				Updated_on:  time.Now(),
+			}
+			// see the projects create
+			var linked any
+			herr = a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.CreateEmployment(c, employment); err != nil {
+					return apiInternal(err)
+				}
+
+				created, _, err := a.storage.GetEmployments(c, map[string]string{"name": in.Name, "username": owner.Username}, storage.Page{Sort: "-id", Limit: 1})
+				if err != nil || len(created) == 0 {
+					return apiInternal(fmt.Errorf("reloading created employment: %v", err))
+				}
+				var herr *ApiError
+				linked, herr = a.linkEmploymentStacks(c, owner.Username, *created[0], stacks)
+				return herr
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			return linked, nil
+		},
+		update: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User, id int) (any, *ApiError) {
+			var in employmentInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			start, end, herr := in.validate(true)
+			if herr != nil {
+				return nil, herr
+			}
+			stacks, herr := a.apiOwnedStacks(c, owner.Username, in.Stack_ids)
+			if herr != nil {
+				return nil, herr
+			}
+
+			employment, err := a.loadEmployment(c, owner.Username, id)
+			if err != nil {
+				return nil, apiStorageError(err, "employment")
+			}
+			employment.Name = in.Name
+			employment.Employee = in.Employee
+			employment.Status = in.Status
+			employment.Prod_link = in.Prod_link
+			employment.Description = in.Description
+			employment.Start_date = start
+			employment.End_date = end
+			employment.Duration, _ = data.GetWorkDuration(start, end)
+			employment.Version = in.Version
+			// a failed link must not keep the new version
+			var linked any
+			herr = a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.UpdateEmployment(c, *employment); err != nil {
+					return apiStorageError(err, "employment")
+				}
+				var herr *ApiError
+				linked, herr = a.linkEmploymentStacks(c, owner.Username, *employment, stacks)
+				return herr
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			return linked, nil
+		},
+		delete: func(c context.Context, owner data.User, id int) error {
+			return a.storage.DeleteEmployment(c, id)
+		},
+	}
+}
+
+// loads an employment of the user with its stacks, sql.ErrNoRows when there is none
+func (a *AppServer) loadEmployment(c context.Context, username string, id int) (*data.Employment, error) {
+	employments, _, err := a.storage.GetEmployments(c, map[string]string{"id": fmt.Sprint(id), "username": username}, storage.Page{})
+	if err != nil {
+		return nil, err
+	}
+	if len(employments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return employments[0], a.attachEmploymentStacks(c, employments[0])
+}
+
+func (a *AppServer) attachEmploymentStacks(c context.Context, e *data.Employment) error {
+	stacks, err := a.storage.GetEmploymentTechStacks(c, map[string]string{"employment_id": fmt.Sprint(e.Id)})
+	if err != nil {
+		return err
+	}
+	e.Stack = derefStacks(stacks)
+	return nil
+}
+
+// links the stacks the employment does not have yet and returns the stored employment
+func (a *AppServer) linkEmploymentStacks(c context.Context, username string, employment data.Employment, stacks []data.TechStack) (any, *ApiError) {
+	linked, err := a.storage.GetEmploymentTechStacks(c, map[string]string{"employment_id": fmt.Sprint(employment.Id)})
+	if err != nil {
+		return nil, apiInternal(err)
+	}
+	for _, t := range unlinkedStacks(derefStacks(linked), stacks) {
+		// employments are linked through their id only
+		if err := a.storage.AddTechStackToEmployment(c, t, data.Project{Id: employment.Id}); err != nil {
+			return nil, apiInternal(err)
+		}
+	}
+
+	saved, err := a.loadEmployment(c, username, employment.Id)
+	if err != nil {
+		return nil, apiInternal(err)
+	}
+	return newAPIEmployment(*saved), nil
+}
+
+// hobbies
+
+func (a *AppServer) apiHobbies() apiCollection {
+	load := func(c context.Context, keys map[string]string, page storage.Page) (*data.Hobby, error) {
+		hobbies, _, err := a.storage.GetHobbies(c, keys, page)
+		if err != nil {
+			return nil, err
+		}
+		if len(hobbies) == 0 {
+			return nil, sql.ErrNoRows
+		}
+		return hobbies[0], nil
+	}
+
+	return apiCollection{
+		name:   "hobby",
+		entity: "hobbies",
+		list: func(c context.Context, username string, page storage.Page) (any, string, error) {
+			hobbies, next, err := a.storage.GetHobbies(c, map[string]string{"username": username}, page)
+			if err != nil {
+				return nil, "", err
+			}
+			items := []apiHobby{}
+			for _, h := range hobbies {
+				items = append(items, newAPIHobby(*h))
+			}
+			return items, next, nil
+		},
+		get: func(c context.Context, username string, id int) (any, error) {
+			hobby, err := load(c, map[string]string{"id": fmt.Sprint(id), "username": username}, storage.Page{})
+			if err != nil {
+				return nil, err
+			}
+			return newAPIHobby(*hobby), nil
+		},
+		create: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User) (any, *ApiError) {
+			var in nameInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			if herr := in.validate(false); herr != nil {
+				return nil, herr
+			}
+			// see the projects create
+			var created *data.Hobby
+			herr := a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.CreateHobby(c, *resumeOwner(owner).NewHobby(in.Name)); err != nil {
+					return apiInternal(err)
+				}
+
+				var err error
+				created, err = load(c, map[string]string{"name": in.Name, "username": owner.Username}, storage.Page{Sort: "-id", Limit: 1})
+				if err != nil {
+					return apiInternal(fmt.Errorf("reloading created hobby: %v", err))
+				}
+				return nil
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			return newAPIHobby(*created), nil
+		},
+		update: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User, id int) (any, *ApiError) {
+			var in nameInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			if herr := in.validate(true); herr != nil {
+				return nil, herr
+			}
+			hobby := data.Hobby{Id: id, User: resumeOwner(owner), Name: in.Name, Version: in.Version}
+			if err := a.storage.UpdateHobby(c, hobby); err != nil {
+				return nil, apiStorageError(err, "hobby")
+			}
+
+			saved, err := load(c, map[string]string{"id": fmt.Sprint(id), "username": owner.Username}, storage.Page{})
+			if err != nil {
+				return nil, apiInternal(err)
+			}
+			return newAPIHobby(*saved), nil
+		},
+		delete: func(c context.Context, owner data.User, id int) error {
+			return a.storage.DeleteHobby(c, id)
+		},
+	}
+}
+
+// stacks
+
+func (a *AppServer) apiStacks() apiCollection {
+	// the newest matching stack, sql.ErrNoRows when there is none
+	load := func(c context.Context, keys map[string]string) (*data.TechStack, error) {
+		stacks, err := a.storage.GetTechStacks(c, keys)
+		if err != nil {
+			return nil, err
+		}
+		var newest *data.TechStack
+		for _, t := range stacks {
+			if newest == nil || t.Id > newest.Id {
+				newest = t
+			}
+		}
+		if newest == nil {
+			return nil, sql.ErrNoRows
+		}
+		return newest, nil
+	}
+	one := func(t data.TechStack) apiStack {
+		return newAPIStacks([]data.TechStack{t})[0]
+	}
+
+	return apiCollection{
+		name:   "stack",
+		entity: "stacks",
+		// stacks are few per user and listed in a single page
+		list: func(c context.Context, username string, page storage.Page) (any, string, error) {
+			stacks, err := a.storage.GetTechStacks(c, map[string]string{"username": username})
+			if err != nil {
+				return nil, "", err
+			}
+			return newAPIStacks(derefStacks(stacks)), "", nil
+		},
+		get: func(c context.Context, username string, id int) (any, error) {
+			stack, err := load(c, map[string]string{"id": fmt.Sprint(id), "username": username})
+			if err != nil {
+				return nil, err
+			}
+			return one(*stack), nil
+		},
+		create: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User) (any, *ApiError) {
+			var in nameInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			if herr := in.validate(false); herr != nil {
+				return nil, herr
+			}
+			// see the projects create
+			var created *data.TechStack
+			herr := a.apiAtomic(c, func(c context.Context) *ApiError {
+				if err := a.storage.CreateTechStack(c, *resumeOwner(owner).NewTechStack(in.Name)); err != nil {
+					return apiInternal(err)
+				}
+
+				var err error
+				created, err = load(c, map[string]string{"name": in.Name, "username": owner.Username})
+				if err != nil {
+					return apiInternal(fmt.Errorf("reloading created stack: %v", err))
+				}
+				return nil
+			})
+			if herr != nil {
+				return nil, herr
+			}
+			return one(*created), nil
+		},
+		update: func(c context.Context, w http.ResponseWriter, r *http.Request, owner data.User, id int) (any, *ApiError) {
+			var in nameInput
+			if herr := decodeJSON(w, r, &in); herr != nil {
+				return nil, herr
+			}
+			if herr := in.validate(true); herr != nil {
+				return nil, herr
+			}
+			stack := data.TechStack{Id: id, User: resumeOwner(owner), Name: in.Name, Version: in.Version}
+			if err := a.storage.UpdateTechStack(c, stack); err != nil {
+				return nil, apiStorageError(err, "stack")
+			}
+
+			saved, err := load(c, map[string]string{"id": fmt.Sprint(id), "username": owner.Username})
+			if err != nil {
+				return nil, apiInternal(err)
+			}
+			return one(*saved), nil
+		},
+		delete: func(c context.Context, owner data.User, id int) error {
+			return a.storage.DeleteTechStack(c, id)
+		},
+	}
+}
@@ -0,0 +1,373 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/webhooks"
+)
+
+type apiClient struct {
+	t       *testing.T
+	handler http.Handler
+	cookie  *http.Cookie
+	token   string // sent as a bearer token when set
+}
+
+// sends a json request and decodes the response body into out when given
+func (c *apiClient) do(method, path, body string, out any) *httptest.ResponseRecorder {
+	c.t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.cookie != nil {
+		r.AddCookie(c.cookie)
+	}
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, r)
+
+	if out != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			c.t.Fatalf("%s %s: %v in %s", method, path, err, w.Body.String())
+		}
+	}
+	return w
+}
+
+func newAPITestServer(t *testing.T) *AppServer {
+	s, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUpDB(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return &AppServer{
+		storage:         s,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		sessionDuration: time.Hour,
+		mailer:          &mailer.Outbox{},
+		baseURL:         "http://resumes.test",
+		templateDir:     "../Templates",
+	}
+}
+
+// creates an account through the api and signs it in
+func signedInClient(t *testing.T, a *AppServer, username string) *apiClient {
+	client := &apiClient{t: t, handler: a.MakeAPIHandler(a.handleAPI)}
+
+	body := `{"username": "` + username + `", "email": "` + username + `@example.com", "password": "correct horse",
+		"firstname": "Ada", "country": "Uganda", "start_date": "2015-01-02"}`
+	if w := client.do(http.MethodPost, "/api/v1/users", body, nil); w.Code != http.StatusCreated {
+		t.Fatalf("Got %d %s, Expected the account to be created", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	if err := a.Login(context.Background(), username, "correct horse", w); err != nil {
+		t.Fatal(err)
+	}
+	client.cookie = w.Result().Cookies()[0]
+	return client
+}
+
+func TestAPIValidation(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+
+	var failed struct{ Error ApiError }
+	w := client.do(http.MethodPost, "/api/v1/users", `{"username": "x", "email": "nope", "password": "short"}`, &failed)
+	if w.Code != http.StatusUnprocessableEntity || failed.Error.Code != "validation_failed" {
+		t.Fatalf("Got %d %s, Expected a validation error", w.Code, w.Body.String())
+	}
+	for _, field := range []string{"username", "email", "password", "country", "start_date"} {
+		if failed.Error.Fields[field] == "" {
+			t.Errorf("Got %v, Expected an error for %s", failed.Error.Fields, field)
+		}
+	}
+
+	failed.Error = ApiError{}
+	client.do(http.MethodPost, "/api/v1/users", `{"username": "ada", "email": "ada@example.com", "password": "correct horse", "country": "Uganda", "start_date": "2015-01-02"}`, &failed)
+	if failed.Error.Fields["username"] != "is already taken" || failed.Error.Fields["email"] != "is already taken" {
+		t.Errorf("Got %v, Expected the username and email to be taken", failed.Error.Fields)
+	}
+
+	failed.Error = ApiError{}
+	w = client.do(http.MethodPost, "/api/v1/users/ada/projects", `{"name": "api", "color": "red"}`, &failed)
+	if w.Code != http.StatusBadRequest || failed.Error.Code != "invalid_json" {
+		t.Errorf("Got %d %s, Expected unknown fields to be rejected", w.Code, w.Body.String())
+	}
+
+	failed.Error = ApiError{}
+	w = client.do(http.MethodPost, "/api/v1/users/ada/projects", `{"name": "api", "github": "ftp://host", "start_date": "2024-02-01", "end_date": "2024-01-01"}`, &failed)
+	if w.Code != http.StatusUnprocessableEntity || failed.Error.Fields["github"] == "" || failed.Error.Fields["end_date"] == "" || failed.Error.Fields["description"] == "" {
+		t.Errorf("Got %d %v, Expected field errors for github, end_date and description", w.Code, failed.Error.Fields)
+	}
+
+	if w = client.do(http.MethodPatch, "/api/v1/users/ada/projects", "", nil); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") == "" {
+		t.Errorf("Got %d, Expected 405 with an Allow header", w.Code)
+	}
+	if w = client.do(http.MethodGet, "/api/v1/users/ada/awards", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Got %d, Expected unknown collections to be not found", w.Code)
+	}
+}
+
+// fails linking stacks to projects, after the project was saved
+type brokenStackLinks struct {
+	storage.Storage
+}
+
+func (s brokenStackLinks) AddTechStackToProject(c context.Context, t data.TechStack, p data.Project) error {
+	return errors.New("stack links unavailable")
+}
+
+func TestAPIProjectLifecycle(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+
+	var stack apiStack
+	if w := client.do(http.MethodPost, "/api/v1/users/ada/stacks", `{"name": "Go"}`, &stack); w.Code != http.StatusCreated || stack.Id == 0 {
+		t.Fatalf("Got %d %s, Expected the stack to be created", w.Code, w.Body.String())
+	}
+
+	var project apiProject
+	body := `{"name": "resume api", "description": "json api", "github": "https://github.com/ada/api", "start_date": "2024-01-01", "stack_ids": [` + strconv.Itoa(stack.Id) + `]}`
+
+	// a project whose stacks can not be linked is not created, a retry does not duplicate it
+	working := a.storage
+	a.storage = brokenStackLinks{working}
+	if w := client.do(http.MethodPost, "/api/v1/users/ada/projects", body, nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("Got %d, Expected the failed link to be reported", w.Code)
+	}
+	a.storage = working
+
+	if w := client.do(http.MethodPost, "/api/v1/users/ada/projects", body, &project); w.Code != http.StatusCreated {
+		t.Fatalf("Got %d %s, Expected the project to be created", w.Code, w.Body.String())
+	}
+	if project.Id == 0 || project.Version != 1 || project.Start_date != "2024-01-01" || len(project.Stack) != 1 || project.Stack[0].Name != "Go" {
+		t.Errorf("Got %+v, Expected the created project with its stack", project)
+	}
+
+	var list struct {
+		Items []apiProject
+	}
+	client.do(http.MethodGet, "/api/v1/users/ada/projects", "", &list)
+	if len(list.Items) != 1 || list.Items[0].Id != project.Id {
+		t.Errorf("Got %+v, Expected the project to be listed", list.Items)
+	}
+
+	path := "/api/v1/users/ada/projects/" + strconv.Itoa(project.Id)
+	if w := client.do(http.MethodPut, path, `{"name": "renamed", "description": "json api", "version": 7}`, nil); w.Code != http.StatusConflict {
+		t.Errorf("Got %d %s, Expected a stale version to conflict", w.Code, w.Body.String())
+	}
+	var updated apiProject
+	if w := client.do(http.MethodPut, path, `{"name": "renamed", "description": "json api", "version": 1}`, &updated); w.Code != http.StatusOK {
+		t.Fatalf("Got %d %s, Expected the update to succeed", w.Code, w.Body.String())
+	}
+	if updated.Name != "renamed" || updated.Version != 2 || len(updated.Stack) != 1 {
+		t.Errorf("Got %+v, Expected the renamed project at version 2", updated)
+	}
+
+	// anyone may read, only the owner may write
+	anonymous := &apiClient{t: t, handler: client.handler}
+	var resume apiResume
+	if w := anonymous.do(http.MethodGet, "/api/v1/users/ada/resume", "", &resume); w.Code != http.StatusOK {
+		t.Fatalf("Got %d %s, Expected the resume", w.Code, w.Body.String())
+	}
+	if len(resume.Projects) != 1 || len(resume.Stacks) != 1 || resume.User.Email != "" {
+		t.Errorf("Got %+v, Expected the public resume without contact details", resume)
+	}
+	if w := anonymous.do(http.MethodDelete, path, "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Got %d, Expected anonymous deletes to be refused", w.Code)
+	}
+	other := signedInClient(t, a, "grace")
+	if w := other.do(http.MethodDelete, path, "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Got %d, Expected other users to be refused", w.Code)
+	}
+	if w := other.do(http.MethodGet, "/api/v1/users/grace/projects/"+strconv.Itoa(project.Id), "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Got %d, Expected records of other users to be hidden", w.Code)
+	}
+
+	if w := client.do(http.MethodDelete, path, "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Got %d %s, Expected the project to be deleted", w.Code, w.Body.String())
+	}
+	var failed struct{ Error ApiError }
+	if w := client.do(http.MethodGet, path, "", &failed); w.Code != http.StatusNotFound || failed.Error.Code != "not_found" {
+		t.Errorf("Got %d %s, Expected the deleted project to be gone", w.Code, w.Body.String())
+	}
+}
+
+// fails saving social links, after the users details were saved
+type brokenSocials struct {
+	storage.Storage
+}
+
+func (s brokenSocials) SetUserSocials(c context.Context, u data.User) error {
+	return errors.New("socials unavailable")
+}
+
+func TestAPIUserAndProfile(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+
+	var user apiUser
+	client.do(http.MethodGet, "/api/v1/users/ada", "", &user)
+	if user.Email != "ada@example.com" || user.Version != 1 {
+		t.Fatalf("Got %+v, Expected the user to see their own email", user)
+	}
+	if strings.Contains(client.do(http.MethodGet, "/api/v1/users/ada", "", nil).Body.String(), "password") {
+		t.Error("Expected credentials to never be returned")
+	}
+
+	body := `{"firstname": "Ada", "lastname": "Lovelace", "country": "UK", "github": "https://github.com/ada", "version": 1}`
+	if w := client.do(http.MethodPut, "/api/v1/users/ada", body, &user); w.Code != http.StatusOK || user.Lastname != "Lovelace" || user.Github != "https://github.com/ada" || user.Version != 2 {
+		t.Errorf("Got %d %+v, Expected the details and socials to be saved", w.Code, user)
+	}
+
+	// a failed socials write leaves the details and their version as they were
+	working := a.storage
+	a.storage = brokenSocials{working}
+	body = `{"firstname": "Ada", "lastname": "Byron", "country": "UK", "version": 2}`
+	if w := client.do(http.MethodPut, "/api/v1/users/ada", body, nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("Got %d, Expected the failed socials write to be reported", w.Code)
+	}
+	a.storage = working
+	if w := client.do(http.MethodPut, "/api/v1/users/ada", body, &user); w.Code != http.StatusOK || user.Lastname != "Byron" || user.Version != 3 {
+		t.Errorf("Got %d %+v, Expected the retry to succeed with the same version", w.Code, user)
+	}
+
+	var profile apiProfile
+	if w := client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "analytical engines"}`, &profile); w.Code != http.StatusCreated {
+		t.Fatalf("Got %d %s, Expected the profile to be created", w.Code, w.Body.String())
+	}
+	var failed struct{ Error ApiError }
+	if w := client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "notes"}`, &failed); w.Code != http.StatusUnprocessableEntity || failed.Error.Fields["version"] == "" {
+		t.Errorf("Got %d %s, Expected updates to require a version", w.Code, w.Body.String())
+	}
+	if w := client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "notes", "version": 1}`, &profile); w.Code != http.StatusOK || profile.About != "notes" {
+		t.Errorf("Got %d %+v, Expected the profile to be updated", w.Code, profile)
+	}
+	if w := client.do(http.MethodDelete, "/api/v1/users/ada/profile", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Got %d, Expected the profile to be deleted", w.Code)
+	}
+	if w := client.do(http.MethodGet, "/api/v1/users/ada/profile", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Got %d, Expected no profile after deleting it", w.Code)
+	}
+	if w := client.do(http.MethodGet, "/api/v1/users/nobody/hobbies", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Got %d, Expected listings of unknown users to be not found", w.Code)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+
+	users, _ := a.storage.GetUsers(context.Background(), map[string]string{"username": "ada"})
+	newToken := func(expires_on time.Time, scopes ...string) *apiClient {
+		token, secret, err := users[0].NewApiToken("script", scopes, expires_on)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.storage.CreateApiToken(context.Background(), *token); err != nil {
+			t.Fatal(err)
+		}
+		return &apiClient{t: t, handler: client.handler, token: secret}
+	}
+
+	writer := newToken(time.Time{}, "projects:write")
+	var project apiProject
+	if w := writer.do(http.MethodPost, "/api/v1/users/ada/projects", `{"name": "cli", "description": "made by a script"}`, &project); w.Code != http.StatusCreated {
+		t.Fatalf("Got %d %s, Expected the token to create projects", w.Code, w.Body.String())
+	}
+	tokens, _ := a.storage.GetApiTokens(context.Background(), "ada")
+	if len(tokens) != 1 || tokens[0].Last_used.IsZero() {
+		t.Errorf("Got %+v, Expected the token use to be recorded", tokens)
+	}
+
+	var failed struct{ Error ApiError }
+	if w := writer.do(http.MethodPost, "/api/v1/users/ada/hobbies", `{"name": "chess"}`, &failed); w.Code != http.StatusForbidden || failed.Error.Code != "insufficient_scope" {
+		t.Errorf("Got %d %s, Expected writes outside the token scopes to be refused", w.Code, w.Body.String())
+	}
+	var user apiUser
+	writer.do(http.MethodGet, "/api/v1/users/ada", "", &user)
+	if user.Email != "" {
+		t.Error("Expected the email to need the user:read scope")
+	}
+	newToken(time.Time{}, "user:read").do(http.MethodGet, "/api/v1/users/ada", "", &user)
+	if user.Email != "ada@example.com" {
+		t.Errorf("Got %+v, Expected user:read to show the email", user)
+	}
+
+	expired := newToken(time.Now().Add(-time.Minute), "projects:write")
+	unknown := &apiClient{t: t, handler: client.handler, token: "rg_unknown"}
+	for _, c := range []*apiClient{expired, unknown} {
+		w := c.do(http.MethodGet, "/api/v1/users/ada/projects", "", nil)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Got %d, Expected invalid tokens to be refused even for public reads", w.Code)
+		}
+	}
+
+	if err := a.storage.DeleteApiToken(context.Background(), "ada", tokens[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if w := writer.do(http.MethodDelete, "/api/v1/users/ada/projects/"+strconv.Itoa(project.Id), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Got %d, Expected revoked tokens to be refused", w.Code)
+	}
+}
+
+func TestAPIWebhookEvents(t *testing.T) {
+	a := newAPITestServer(t)
+	a.webhooks = webhooks.NewDispatcher(a.storage, webhooks.NewClient(time.Second, nil), a.logger)
+	client := signedInClient(t, a, "ada")
+
+	received := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(webhooks.EventHeader)
+	}))
+	defer receiver.Close()
+
+	users, _ := a.storage.GetUsers(context.Background(), map[string]string{"username": "ada"})
+	webhook, _ := users[0].NewWebhook(receiver.URL, []string{data.Event_project_added, data.Event_profile_viewed})
+	if err := a.storage.CreateWebhook(context.Background(), *webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "engines"}`, nil)
+	client.do(http.MethodGet, "/api/v1/users/ada/resume", "", nil)
+	client.do(http.MethodPost, "/api/v1/users/ada/projects", `{"name": "api", "description": "json api"}`, nil)
+	anonymous := &apiClient{t: t, handler: client.handler}
+	anonymous.do(http.MethodGet, "/api/v1/users/ada/profile", "", nil)
+
+	if sent, err := a.webhooks.DeliverDue(context.Background()); err != nil || sent != 2 {
+		t.Fatalf("Got %d %v, Expected the new project and the visitors view to be sent", sent, err)
+	}
+	if first, second := <-received, <-received; first != data.Event_project_added || second != data.Event_profile_viewed {
+		t.Errorf("Got %s and %s, Expected project.added then profile.viewed", first, second)
+	}
+
+	// further views within the interval are coalesced into the sent event
+	anonymous.do(http.MethodGet, "/api/v1/users/ada/profile", "", nil)
+	anonymous.do(http.MethodGet, "/api/v1/users/ada/resume", "", nil)
+	if sent, err := a.webhooks.DeliverDue(context.Background()); err != nil || sent != 0 {
+		t.Errorf("Got %d %v, Expected repeated views to not queue deliveries", sent, err)
+	}
+	if !a.profileViews.allow("ada", time.Now().Add(profileViewedInterval), profileViewedInterval) {
+		t.Errorf("Expected views to be sent again after the interval")
+	}
+}
@@ -0,0 +1,438 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// resources returned by the json api. they are kept apart from the data types so
+// credentials and internal columns never leak into responses
+
+// contact details are only included for the user themselves
+type apiUser struct {
+	Username  string `json:"username"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Bio       string `json:"bio"`
+	Country   string `json:"country"`
+	Portfolio string `json:"portfolio"`
+	Github    string `json:"github"`
+	Linkedin  string `json:"linkedin"`
+	Twitter   string `json:"twitter"`
+	Version   int    `json:"version"`
+}
+
+type apiProfile struct {
+	Id      int    `json:"id"`
+	Role    string `json:"role"`
+	About   string `json:"about"`
+	Views   int    `json:"views"`
+	Version int    `json:"version"`
+}
+
+type apiStack struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+type apiHobby struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+// dates are yyyy-mm-dd, empty when unknown
+type apiProject struct {
+	Id          int        `json:"id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Github      string     `json:"github"`
+	Prod_link   string     `json:"prod_link"`
+	Description string     `json:"description"`
+	Start_date  string     `json:"start_date"`
+	End_date    string     `json:"end_date"`
+	Stack       []apiStack `json:"stack"`
+	Created_on  time.Time  `json:"created_on"`
+	Updated_on  time.Time  `json:"updated_on"`
+	Version     int        `json:"version"`
+}
+
+type apiEmployment struct {
+	Id          int        `json:"id"`
+	Name        string     `json:"name"`
+	Employee    string     `json:"employee"`
+	Status      string     `json:"status"`
+	Prod_link   string     `json:"prod_link"`
+	Description string     `json:"description"`
+	Start_date  string     `json:"start_date"`
+	End_date    string     `json:"end_date"`
+	Stack       []apiStack `json:"stack"`
+	Created_on  time.Time  `json:"created_on"`
+	Updated_on  time.Time  `json:"updated_on"`
+	Version     int        `json:"version"`
+}
+
+type apiResume struct {
+	User        apiUser         `json:"user"`
+	Profile     *apiProfile     `json:"profile"`
+	Projects    []apiProject    `json:"projects"`
+	Employments []apiEmployment `json:"employments"`
+	Hobbies     []apiHobby      `json:"hobbies"`
+	Stacks      []apiStack      `json:"stacks"`
+}
+
+// a page of a listing, next_cursor is passed as ?cursor= for the following page
+type apiList struct {
+	Items       any    `json:"items"`
+	Next_cursor string `json:"next_cursor,omitempty"`
+}
+
+const apiDateLayout = "2006-01-02"
+
+func apiDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(apiDateLayout)
+}
+
+func newAPIUser(u data.User, self bool) apiUser {
+	user := apiUser{
+		Username:  u.Username,
+		Firstname: u.Firstname,
+		Lastname:  u.Lastname,
+		Bio:       u.Bio,
+		Country:   u.Country,
+		Portfolio: u.Portfolio,
+		Github:    u.Github,
+		Linkedin:  u.Linkedin,
+		Twitter:   u.Twitter,
+		Version:   u.Version,
+	}
+	if self {
+		user.Email = u.Email
+		user.Phone = u.Phone
+	}
+	return user
+}
+
+func newAPIProfile(p data.Profile) apiProfile {
+	return apiProfile{Id: p.Id, Role: p.Role, About: p.About, Views: p.Views, Version: p.Version}
+}
+
+func newAPIStacks(stacks []data.TechStack) []apiStack {
+	list := []apiStack{}
+	for _, t := range stacks {
+		list = append(list, apiStack{Id: t.Id, Name: t.Name, Version: t.Version})
+	}
+	return list
+}
+
+func newAPIHobby(h data.Hobby) apiHobby {
+	return apiHobby{Id: h.Id, Name: h.Name, Version: h.Version}
+}
+
+func newAPIProject(p data.Project) apiProject {
+	return apiProject{
+		Id:          p.Id,
+		Name:        p.Name,
+		Status:      p.Status,
+		Github:      p.Github,
+		Prod_link:   p.Prod_link,
+		Description: p.Description,
+		Start_date:  apiDate(p.Start_date),
+		End_date:    apiDate(p.End_date),
+		Stack:       newAPIStacks(p.Stack),
+		Created_on:  p.Created_on,
+		Updated_on:  p.Updated_on,
+		Version:     p.Version,
+	}
+}
+
+func newAPIEmployment(e data.Employment) apiEmployment {
+	return apiEmployment{
+		Id:          e.Id,
+		Name:        e.Name,
+		Employee:    e.Employee,
+		Status:      e.Status,
+		Prod_link:   e.Prod_link,
+		Description: e.Description,
+		Start_date:  apiDate(e.Start_date),
+		End_date:    apiDate(e.End_date),
+		Stack:       newAPIStacks(e.Stack),
+		Created_on:  e.Created_on,
+		Updated_on:  e.Updated_on,
+		Version:     e.Version,
+	}
+}
+
+func newAPIResume(r data.Resume, self bool) apiResume {
+	resume := apiResume{
+		User:        newAPIUser(r.User, self),
+		Projects:    []apiProject{},
+		Employments: []apiEmployment{},
+		Hobbies:     []apiHobby{},
+		Stacks:      newAPIStacks(r.Stacks),
+	}
+	if r.Profile != nil {
+		profile := newAPIProfile(*r.Profile)
+		resume.Profile = &profile
+	}
+	for _, p := range r.Projects {
+		resume.Projects = append(resume.Projects, newAPIProject(p))
+	}
+	for _, e := range r.Employments {
+		resume.Employments = append(resume.Employments, newAPIEmployment(e))
+	}
+	for _, h := range r.Hobbies {
+		resume.Hobbies = append(resume.Hobbies, newAPIHobby(h))
+	}
+	return resume
+}
+
+// request bodies. version is the version the client read, required when updating
+
+type signupInput struct {
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Firstname  string `json:"firstname"`
+	Lastname   string `json:"lastname"`
+	Phone      string `json:"phone"`
+	Bio        string `json:"bio"`
+	Country    string `json:"country"`
+	Start_date string `json:"start_date"`
+}
+
+type userInput struct {
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	Phone     string `json:"phone"`
+	Bio       string `json:"bio"`
+	Country   string `json:"country"`
+	Portfolio string `json:"portfolio"`
+	Github    string `json:"github"`
+	Linkedin  string `json:"linkedin"`
+	Twitter   string `json:"twitter"`
+	Version   int    `json:"version"`
+}
+
+type profileInput struct {
+	Role    string `json:"role"`
+	About   string `json:"about"`
+	Version int    `json:"version"`
+}
+
+// stack_ids links stacks of the same user, links are only ever added
+type projectInput struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Github      string `json:"github"`
+	Prod_link   string `json:"prod_link"`
+	Description string `json:"description"`
+	Start_date  string `json:"start_date"`
+	End_date    string `json:"end_date"`
+	Stack_ids   []int  `json:"stack_ids"`
+	Version     int    `json:"version"`
+}
+
+type employmentInput struct {
+	Name        string `json:"name"`
+	Employee    string `json:"employee"`
+	Status      string `json:"status"`
+	Prod_link   string `json:"prod_link"`
+	Description string `json:"description"`
+	Start_date  string `json:"start_date"`
+	End_date    string `json:"end_date"`
+	Stack_ids   []int  `json:"stack_ids"`
+	Version     int    `json:"version"`
+}
+
+// hobbies and stacks only have a name
+type nameInput struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+// longest value of the VARCHAR(255) columns
+const maxFieldLength = 255
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+
+// collects what is wrong with each field of a request body
+type fieldErrors map[string]string
+
+// the first problem found for a field is kept
+func (f fieldErrors) add(field, format string, args ...any) {
+	if _, ok := f[field]; !ok {
+		f[field] = fmt.Sprintf(format, args...)
+	}
+}
+
+func (f fieldErrors) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		f.add(field, "is required")
+	}
+}
+
+func (f fieldErrors) maxLength(field, value string, n int) {
+	if len(value) > n {
+		f.add(field, "must be at most %d characters", n)
+	}
+}
+
+// empty values are allowed, use required as well when they are not
+func (f fieldErrors) url(field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.add(field, "must be an http or https url")
+	}
+	f.maxLength(field, value, maxFieldLength)
+}
+
+// parses a yyyy-mm-dd date, empty is the zero time
+func (f fieldErrors) date(field, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(apiDateLayout, value)
+	if err != nil {
+		f.add(field, "must be a date like 2024-01-31")
+	}
+	return t
+}
+
+func (f fieldErrors) version(version int) {
+	if version <= 0 {
+		f.add("version", "is required when updating, use the version last read")
+	}
+}
+
+// the validation error response, nil when every field is valid
+func (f fieldErrors) err() *ApiError {
+	if len(f) == 0 {
+		return nil
+	}
+	return &ApiError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "validation_failed",
+		Message: "some fields are invalid",
+		Fields:  f,
+	}
+}
+
+func (in signupInput) validate() *ApiError {
+	f := fieldErrors{}
+	if !usernamePattern.MatchString(in.Username) {
+		f.add("username", "must be 3 to 50 letters, digits, dots, dashes or underscores")
+	}
+	if _, err := mail.ParseAddress(in.Email); err != nil || !strings.Contains(in.Email, "@") {
+		f.add("email", "must be an email address")
+	}
+	f.maxLength("email", in.Email, maxFieldLength)
+	if len(in.Password) < 8 {
+		f.add("password", "must be at least 8 characters")
+	}
+	f.maxLength("password", in.Password, 72) // bcrypt ignores the rest
+	f.required("country", in.Country)
+	f.required("start_date", in.Start_date)
+	f.date("start_date", in.Start_date)
+	f.validateDetails(in.Firstname, in.Lastname, in.Phone, in.Country)
+	return f.err()
+}
+
+func (f fieldErrors) validateDetails(firstname, lastname, phone, country string) {
+	f.maxLength("firstname", firstname, maxFieldLength)
+	f.maxLength("lastname", lastname, maxFieldLength)
+	f.maxLength("phone", phone, 20)
+	f.maxLength("country", country, 100)
+}
+
+func (in userInput) validate() *ApiError {
+	f := fieldErrors{}
+	f.version(in.Version)
+	f.required("country", in.Country)
+	f.validateDetails(in.Firstname, in.Lastname, in.Phone, in.Country)
+	f.url("portfolio", in.Portfolio)
+	f.url("github", in.Github)
+	f.url("linkedin", in.Linkedin)
+	f.url("twitter", in.Twitter)
+	return f.err()
+}
+
+func (in profileInput) validate(updating bool) *ApiError {
+	f := fieldErrors{}
+	if updating {
+		f.version(in.Version)
+	}
+	f.required("role", in.Role)
+	f.maxLength("role", in.Role, maxFieldLength)
+	f.required("about", in.About)
+	return f.err()
+}
+
+// returns the parsed dates with the validation error
+func (in projectInput) validate(updating bool) (time.Time, time.Time, *ApiError) {
+	f := fieldErrors{}
+	if updating {
+		f.version(in.Version)
+	}
+	f.required("name", in.Name)
+	f.maxLength("name", in.Name, maxFieldLength)
+	f.maxLength("status", in.Status, maxFieldLength)
+	f.url("github", in.Github)
+	f.url("prod_link", in.Prod_link)
+	f.required("description", in.Description)
+	f.maxLength("description", in.Description, maxFieldLength)
+	start, end := f.dateRange(in.Start_date, in.End_date)
+	return start, end, f.err()
+}
+
+func (in employmentInput) validate(updating bool) (time.Time, time.Time, *ApiError) {
+	f := fieldErrors{}
+	if updating {
+		f.version(in.Version)
+	}
+	f.required("name", in.Name)
+	f.maxLength("name", in.Name, maxFieldLength)
+	f.required("employee", in.Employee)
+	f.maxLength("employee", in.Employee, maxFieldLength)
+	f.maxLength("status", in.Status, maxFieldLength)
+	f.url("prod_link", in.Prod_link)
+	f.required("description", in.Description)
+	f.maxLength("description", in.Description, maxFieldLength)
+	start, end := f.dateRange(in.Start_date, in.End_date)
+	return start, end, f.err()
+}
+
+func (f fieldErrors) dateRange(start_date, end_date string) (time.Time, time.Time) {
+	start := f.date("start_date", start_date)
+	end := f.date("end_date", end_date)
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		f.add("end_date", "must not be before start_date")
+	}
+	return start, end
+}
+
+func (in nameInput) validate(updating bool) *ApiError {
+	f := fieldErrors{}
+	if updating {
+		f.version(in.Version)
+	}
+	f.required("name", in.Name)
+	f.maxLength("name", in.Name, maxFieldLength)
+	return f.err()
+}
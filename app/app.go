@@ -1,12 +1,16 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 )
 
-func (a *AppServer) Run() error {
+// Run serves until ctx is cancelled, then stops accepting connections, gives
+// in-flight requests the shutdown timeout to finish and closes the storage
+func (a *AppServer) Run(ctx context.Context) error {
 	sm := http.NewServeMux()
 	server := &http.Server{
 		Addr:           fmt.Sprintf(":%s", a.port),
@@ -16,21 +20,67 @@ func (a *AppServer) Run() error {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	registerStaticRoutes(sm)
+	a.registerStaticRoutes(sm)
+	a.registerHealthRoutes(sm)
+	a.registerMetricsRoutes(sm)
 	a.registerRoutes(sm)
+	a.registerMetrics()
 
-	fmt.Printf("Running server on port %s...\n", a.port)
-	return server.ListenAndServe()
+	go a.purgeTrash(ctx, time.Hour)
+	go a.webhooks.Run(ctx, webhookPollInterval)
 
+	serve_err := make(chan error, 1)
+	go func() {
+		a.logger.Info("running server", "port", a.port)
+		serve_err <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serve_err:
+		// could not listen
+		return errors.Join(err, a.storage.Close())
+	case <-ctx.Done():
+	}
+
+	a.draining.Store(true)
+	a.logger.Info("shutting down, waiting for requests to finish", "timeout", a.shutdownTimeout)
+
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	shutdown_err := server.Shutdown(shutdown_ctx)
+	a.background.Wait()
+	return errors.Join(shutdown_err, a.storage.Close())
 }
 
+// pages go through the middleware chain, static files and probes do not
 func (a *AppServer) registerRoutes(sm *http.ServeMux) {
-	sm.HandleFunc("/", MakeHTTPHandler(a.handleHomeView))
-	sm.HandleFunc("/auth/", MakeHTTPHandler(a.handleAuthView))
-	sm.HandleFunc("/landing/", MakeHTTPHandler(a.handleLandingView))
+	routes := http.NewServeMux()
+	sm.Handle("/", chain(routes, withRequestID, traceRequest, a.accessLog, a.recoverPanic))
+
+	// every page is counted and timed under its pattern, see http_requests_total
+	handle := func(pattern string, f httpHandler) {
+		routes.Handle(pattern, instrument(pattern, a.MakeHTTPHandler(f)))
+	}
+
+	handle("/", a.handleHomeView)
+	handle("/auth/", a.handleAuthView)
+	handle("/landing/", a.handleLandingView)
+	handle("/profiles/", a.handleProfilesView)
+	handle("/search/", a.handleSearchView)
+	handle("/trash/", a.handleTrashView)
+	handle("/history/", a.handleHistoryView)
+	handle("/snapshots/", a.handleSnapshotsView)
+	handle("/projects/", a.handleProjectsView)
+	handle("/account/", a.handleAccountView)
+	handle("/tokens/", a.handleTokensView)
+	handle("/webhooks/", a.handleWebhooksView)
+
+	// the json api answers with ApiError bodies instead of error pages
+	routes.Handle(apiPrefix, instrument(apiPrefix, a.MakeAPIHandler(a.handleAPI)))
 }
 
-func registerStaticRoutes(sm *http.ServeMux) {
+func (a *AppServer) registerStaticRoutes(sm *http.ServeMux) {
 	staticfileserver := http.FileServer(http.Dir("./static/"))
 
 	sm.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +89,7 @@ func registerStaticRoutes(sm *http.ServeMux) {
 	})
 
 	// server media files
-	mediafileserver := http.FileServer(http.Dir("./media/"))
+	mediafileserver := http.FileServer(http.Dir(a.mediaDir))
 	sm.HandleFunc("/media/", func(w http.ResponseWriter, r *http.Request) {
 		fs := http.StripPrefix("/media", mediafileserver)
 		fs.ServeHTTP(w, r)
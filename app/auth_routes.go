@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
 )
 
 func (a *AppServer) handleAuthView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
@@ -19,7 +20,17 @@ func (a *AppServer) handleAuthView(c context.Context, w http.ResponseWriter, r *
 		return a.handleSignUp(c, w, r)
 	case "logout", "logout/":
 		return a.handleLogout(c, w, r)
+	case "verify/resend", "verify/resend/":
+		return a.handleVerifyResend(c, w, r)
+	case "password/forgot", "password/forgot/":
+		return a.handleForgotPassword(c, w, r)
 	default:
+		if token, ok := strings.CutPrefix(subpath, "verify/"); ok && token != "" {
+			return a.handleVerifyEmail(c, w, r, strings.TrimSuffix(token, "/"))
+		}
+		if token, ok := strings.CutPrefix(subpath, "password/reset/"); ok && token != "" {
+			return a.handleResetPassword(c, w, r, strings.TrimSuffix(token, "/"))
+		}
 		return &HandlerError{
 			code:    http.StatusNotFound,
 			message: "address not found",
@@ -49,7 +60,7 @@ func (a *AppServer) handleLogin(c context.Context, w http.ResponseWriter, r *htt
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		err := a.Login(username, password, w)
+		err := a.Login(c, username, password, w)
 		if err != nil {
 			contextData["error_message"] = "Invalid username/password."
 			http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
@@ -135,14 +146,17 @@ func (a *AppServer) handleSignUp(c context.Context, w http.ResponseWriter, r *ht
 			}
 		}
 
+		// new accounts are created on behalf of themselves
+		c = storage.WithActor(c, user.Username)
+
 		// save user data to database
-		dbWriteErr := a.storage.CreateUser(*user)
+		dbWriteErr := a.storage.CreateUser(c, *user)
 		if dbWriteErr != nil {
 			contextData["error_message"] = "Username/Email Not available."
 			return a.RenderHtml(c, w, r, []string{"auth/signup.html"}, contextData)
 		}
 
-		err = a.HandleImageUpload(*user, r)
+		err = a.HandleImageUpload(c, *user, r)
 		if err != nil {
 			return &HandlerError{
 				code:    http.StatusInternalServerError,
@@ -151,6 +165,11 @@ func (a *AppServer) handleSignUp(c context.Context, w http.ResponseWriter, r *ht
 		}
 
 		// send verification link
+		if err := a.sendVerificationEmail(c, *user); err != nil {
+			a.log(c).Error("sending verification email failed", "username", user.Username, "error", err)
+			contextData["success_message"] = "Account created. The activation link could not be sent, sign in to request a new one."
+			return a.RenderHtml(c, w, r, []string{"auth/login.html"}, contextData)
+		}
 
 		contextData["success_message"] = "Activation link sent to your email"
 		return a.RenderHtml(c, w, r, []string{"auth/login.html"}, contextData)
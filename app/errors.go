@@ -0,0 +1,93 @@
+package app
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"regexp"
+)
+
+// headings of the error pages, other codes show the status text
+var errorTitles = map[int]string{
+	http.StatusForbidden:           "Access denied",
+	http.StatusNotFound:            "Page not found",
+	http.StatusInternalServerError: "Something went wrong",
+}
+
+// where htmx error fragments are swapped in when a request does not name a target.
+// forms name their own with hx-headers='{"X-Error-Target": "#form-errors"}'
+const defaultErrorTarget = "#app-errors"
+
+const errorTargetHeader = "X-Error-Target"
+
+// css id selectors only, the value is echoed in a response header
+var errorTargetPattern = regexp.MustCompile(`^#[A-Za-z][A-Za-z0-9_-]*$`)
+
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+func errorTarget(r *http.Request) string {
+	if target := r.Header.Get(errorTargetHeader); errorTargetPattern.MatchString(target) {
+		return target
+	}
+	return defaultErrorTarget
+}
+
+// responds with the handler error unless the response was already started:
+// a page in the layout for full page loads, a fragment swapped into the error
+// target for htmx requests. server errors are logged and their details kept from the client
+func (a *AppServer) writeError(w http.ResponseWriter, r *http.Request, herr *HandlerError) {
+	if herr.code == 0 {
+		herr.code = http.StatusInternalServerError
+	}
+	message := herr.message
+	if herr.code >= 500 {
+		a.log(r.Context()).Error("handler error", "status", herr.code, "error", herr.message)
+		message = "The error was logged, please try again later."
+	}
+
+	if written, ok := w.(interface{ Written() bool }); ok && written.Written() {
+		return
+	}
+
+	title, ok := errorTitles[herr.code]
+	if !ok {
+		title = http.StatusText(herr.code)
+	}
+	contextData := map[string]any{
+		"code":       herr.code,
+		"title":      title,
+		"message":    message,
+		"request_id": RequestID(r.Context()),
+	}
+
+	// rendered to a buffer first so a template failure can still send the error
+	var page bytes.Buffer
+	var err error
+	if isHTMX(r) {
+		var tmpl *template.Template
+		tmpl, err = template.ParseFiles(filepath.Join(a.templateDir, "partials/_error.html"))
+		if err == nil {
+			err = tmpl.ExecuteTemplate(&page, "error", contextData)
+		}
+		w.Header().Set("HX-Retarget", errorTarget(r))
+		w.Header().Set("HX-Reswap", "innerHTML")
+	} else {
+		var tmpl *template.Template
+		tmpl, err = a.loadTemplates([]string{"utils/error.html"})
+		if err == nil {
+			err = tmpl.Execute(&page, contextData)
+		}
+	}
+	if err != nil {
+		a.log(r.Context()).Error("error page failed to render", "error", err)
+		http.Error(w, message, herr.code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(herr.code)
+	w.Write(page.Bytes())
+}
@@ -0,0 +1,299 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/graphql"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+const (
+	// Query.user.projects.stack.name is 4 deep
+	graphQLMaxDepth = 5
+	// every field costs 1 and loading a user costs graphQLUserCost more, about
+	// enough for ten users with their whole resume
+	graphQLMaxCost  = 500
+	graphQLUserCost = 10
+)
+
+var (
+	graphQLOnce   sync.Once
+	graphQLSchema *graphql.Schema
+)
+
+// loads each users resume at most once per query, every relation of a user is read
+// from it so a query costs the same number of storage calls however many projects,
+// employments and stacks it selects
+type resumeLoader struct {
+	a       *AppServer
+	r       *http.Request
+	resumes map[string]*apiResume
+	viewed  map[string]bool
+}
+
+type resumeLoaderKey struct{}
+
+func loaderFrom(c context.Context) *resumeLoader {
+	return c.Value(resumeLoaderKey{}).(*resumeLoader)
+}
+
+// nil when there is no such user. contact details are only kept for the user
+// themselves, as in the rest of the api
+func (l *resumeLoader) resume(c context.Context, username string) (*apiResume, error) {
+	if resume, ok := l.resumes[username]; ok {
+		return resume, nil
+	}
+
+	loaded, err := storage.LoadResume(c, l.a.storage, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		l.resumes[username] = nil
+		return nil, nil
+	}
+	if err != nil {
+		l.a.log(c).Error("graphql resume load failed", "username", username, "error", err)
+		return nil, errors.New("unable to load the user, please try again later")
+	}
+
+	viewer := l.a.apiUser(l.r, "user")
+	resume := newAPIResume(*loaded, viewer != nil && viewer.Username == username)
+	l.resumes[username] = &resume
+	return &resume, nil
+}
+
+// resolves a field of a user from their loaded resume
+func userRelation(f func(*apiResume) any) graphql.Resolver {
+	return func(c context.Context, source any, args map[string]any) (any, error) {
+		resume, err := loaderFrom(c).resume(c, source.(*apiUser).Username)
+		if err != nil || resume == nil {
+			return nil, err
+		}
+		return f(resume), nil
+	}
+}
+
+// resolves a field from the api type of its source
+func resolve[T any](f func(T) any) graphql.Resolver {
+	return func(c context.Context, source any, args map[string]any) (any, error) {
+		return f(source.(T)), nil
+	}
+}
+
+// empty strings are unknown values in the api types
+func optional(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func timestamp(t time.Time) any {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// the schema of the resume graph, see /api/v1/graphql/schema for it as SDL
+func newGraphQLSchema() (*graphql.Schema, error) {
+	stack := &graphql.Object{
+		Name:        "Stack",
+		Description: "A technology used in projects and employments.",
+		Fields: map[string]*graphql.Field{
+			"id":      {Type: "ID!", Resolve: resolve(func(s apiStack) any { return s.Id })},
+			"name":    {Type: "String!", Resolve: resolve(func(s apiStack) any { return s.Name })},
+			"version": {Type: "Int!", Resolve: resolve(func(s apiStack) any { return s.Version })},
+		},
+	}
+
+	hobby := &graphql.Object{
+		Name: "Hobby",
+		Fields: map[string]*graphql.Field{
+			"id":      {Type: "ID!", Resolve: resolve(func(h apiHobby) any { return h.Id })},
+			"name":    {Type: "String!", Resolve: resolve(func(h apiHobby) any { return h.Name })},
+			"version": {Type: "Int!", Resolve: resolve(func(h apiHobby) any { return h.Version })},
+		},
+	}
+
+	profile := &graphql.Object{
+		Name: "Profile",
+		Fields: map[string]*graphql.Field{
+			"id":      {Type: "ID!", Resolve: resolve(func(p *apiProfile) any { return p.Id })},
+			"role":    {Type: "String!", Resolve: resolve(func(p *apiProfile) any { return p.Role })},
+			"about":   {Type: "String!", Resolve: resolve(func(p *apiProfile) any { return p.About })},
+			"views":   {Type: "Int!", Resolve: resolve(func(p *apiProfile) any { return p.Views })},
+			"version": {Type: "Int!", Resolve: resolve(func(p *apiProfile) any { return p.Version })},
+		},
+	}
+
+	project := &graphql.Object{
+		Name: "Project",
+		Fields: map[string]*graphql.Field{
+			"id":          {Type: "ID!", Resolve: resolve(func(p apiProject) any { return p.Id })},
+			"name":        {Type: "String!", Resolve: resolve(func(p apiProject) any { return p.Name })},
+			"status":      {Type: "String!", Resolve: resolve(func(p apiProject) any { return p.Status })},
+			"github":      {Type: "String!", Resolve: resolve(func(p apiProject) any { return p.Github })},
+			"prodLink":    {Type: "String!", Resolve: resolve(func(p apiProject) any { return p.Prod_link })},
+			"description": {Type: "String!", Resolve: resolve(func(p apiProject) any { return p.Description })},
+			"startDate":   {Type: "String", Description: "yyyy-mm-dd", Resolve: resolve(func(p apiProject) any { return optional(p.Start_date) })},
+			"endDate":     {Type: "String", Description: "yyyy-mm-dd, null while ongoing", Resolve: resolve(func(p apiProject) any { return optional(p.End_date) })},
+			"stack":       {Type: "[Stack!]!", Resolve: resolve(func(p apiProject) any { return p.Stack })},
+			"createdOn":   {Type: "String!", Resolve: resolve(func(p apiProject) any { return timestamp(p.Created_on) })},
+			"updatedOn":   {Type: "String!", Resolve: resolve(func(p apiProject) any { return timestamp(p.Updated_on) })},
+			"version":     {Type: "Int!", Resolve: resolve(func(p apiProject) any { return p.Version })},
+		},
+	}
+
+	employment := &graphql.Object{
+		Name: "Employment",
+		Fields: map[string]*graphql.Field{
+			"id":          {Type: "ID!", Resolve: resolve(func(e apiEmployment) any { return e.Id })},
+			"name":        {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return e.Name })},
+			"employee":    {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return e.Employee })},
+			"status":      {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return e.Status })},
+			"prodLink":    {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return e.Prod_link })},
+			"description": {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return e.Description })},
+			"startDate":   {Type: "String", Description: "yyyy-mm-dd", Resolve: resolve(func(e apiEmployment) any { return optional(e.Start_date) })},
+			"endDate":     {Type: "String", Description: "yyyy-mm-dd, null while ongoing", Resolve: resolve(func(e apiEmployment) any { return optional(e.End_date) })},
+			"stack":       {Type: "[Stack!]!", Resolve: resolve(func(e apiEmployment) any { return e.Stack })},
+			"createdOn":   {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return timestamp(e.Created_on) })},
+			"updatedOn":   {Type: "String!", Resolve: resolve(func(e apiEmployment) any { return timestamp(e.Updated_on) })},
+			"version":     {Type: "Int!", Resolve: resolve(func(e apiEmployment) any { return e.Version })},
+		},
+	}
+
+	user := &graphql.Object{
+		Name:        "User",
+		Description: "A user and their resume.",
+		Fields: map[string]*graphql.Field{
+			"username":  {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Username })},
+			"firstname": {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Firstname })},
+			"lastname":  {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Lastname })},
+			"email":     {Type: "String", Description: "Only shown to the user themselves.", Resolve: resolve(func(u *apiUser) any { return optional(u.Email) })},
+			"phone":     {Type: "String", Description: "Only shown to the user themselves.", Resolve: resolve(func(u *apiUser) any { return optional(u.Phone) })},
+			"bio":       {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Bio })},
+			"country":   {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Country })},
+			"portfolio": {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Portfolio })},
+			"github":    {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Github })},
+			"linkedin":  {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Linkedin })},
+			"twitter":   {Type: "String!", Resolve: resolve(func(u *apiUser) any { return u.Twitter })},
+			"version":   {Type: "Int!", Resolve: resolve(func(u *apiUser) any { return u.Version })},
+
+			"profile": {Type: "Profile", Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				l := loaderFrom(c)
+				resume, err := l.resume(c, source.(*apiUser).Username)
+				if err != nil || resume == nil || resume.Profile == nil {
+					return nil, err
+				}
+				// counted once per query, as a GET of the profile would be
+				if username := resume.User.Username; !l.viewed[username] {
+					l.viewed[username] = true
+					l.a.emitProfileViewed(c, l.r, username)
+				}
+				return resume.Profile, nil
+			}},
+			"projects":    {Type: "[Project!]!", Resolve: userRelation(func(r *apiResume) any { return r.Projects })},
+			"employments": {Type: "[Employment!]!", Resolve: userRelation(func(r *apiResume) any { return r.Employments })},
+			"hobbies":     {Type: "[Hobby!]!", Resolve: userRelation(func(r *apiResume) any { return r.Hobbies })},
+			"stacks":      {Type: "[Stack!]!", Resolve: userRelation(func(r *apiResume) any { return r.Stacks })},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: map[string]*graphql.Field{
+			"user": {
+				Type:        "User",
+				Description: "null when there is no such user.",
+				Args:        map[string]string{"username": "String!"},
+				Cost:        graphQLUserCost,
+				Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+					resume, err := loaderFrom(c).resume(c, args["username"].(string))
+					if err != nil || resume == nil {
+						return nil, err
+					}
+					return &resume.User, nil
+				},
+			},
+		},
+	}
+
+	s, err := graphql.NewSchema(query, user, profile, project, employment, hobby, stack)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxDepth = graphQLMaxDepth
+	s.MaxCost = graphQLMaxCost
+	return s, nil
+}
+
+// routes /api/v1/graphql requests:
+//
+//	GET POST /graphql          a query as ?query=&operationName=&variables= or a json body
+//	GET      /graphql/schema   the schema as SDL
+func (a *AppServer) handleGraphQL(c context.Context, w http.ResponseWriter, r *http.Request, subpath string) *ApiError {
+	graphQLOnce.Do(func() {
+		var err error
+		if graphQLSchema, err = newGraphQLSchema(); err != nil {
+			panic(err)
+		}
+	})
+
+	switch subpath {
+	case "":
+	case "schema":
+		if r.Method != http.MethodGet {
+			return apiMethodNotAllowed(w, http.MethodGet)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(graphQLSchema.String()))
+		return nil
+	default:
+		return apiNotFound("endpoint")
+	}
+
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return &ApiError{Status: http.StatusBadRequest, Code: "invalid_json", Message: "variables are not a valid json object: " + err.Error()}
+			}
+		}
+	case http.MethodPost:
+		if herr := decodeJSON(w, r, &req); herr != nil {
+			return herr
+		}
+	default:
+		return apiMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+	if req.Query == "" {
+		return &ApiError{Status: http.StatusBadRequest, Code: "missing_query", Message: "send a graphql query as query"}
+	}
+
+	c, span := tracing.Start(c, "graphql.Execute", tracing.String("graphql.operation", req.OperationName))
+	defer span.End()
+
+	c = context.WithValue(c, resumeLoaderKey{}, &resumeLoader{
+		a:       a,
+		r:       r,
+		resumes: map[string]*apiResume{},
+		viewed:  map[string]bool{},
+	})
+	res := graphQLSchema.Execute(c, req, nil)
+
+	// invalid queries are client errors, errors of fields still answer with the rest of the data
+	status := http.StatusOK
+	if !res.Executed() {
+		status = http.StatusBadRequest
+	}
+	span.SetAttributes(tracing.Int("graphql.errors", len(res.Errors)))
+	writeJSON(w, status, res)
+	return nil
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// counts the storage calls a graphql query makes
+type countingStorage struct {
+	storage.Storage
+	aggregates int
+}
+
+func (s *countingStorage) LoadResumeAggregate(c context.Context, user_id int) (*data.Resume, error) {
+	s.aggregates++
+	return s.Storage.LoadResumeAggregate(c, user_id)
+}
+
+type graphQLResult struct {
+	Data   map[string]any
+	Errors []struct {
+		Message string
+		Path    []any
+	}
+}
+
+func (c *apiClient) graphQL(query string, variables map[string]any, out *graphQLResult) int {
+	c.t.Helper()
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	return c.do(http.MethodPost, "/api/v1/graphql", string(body), out).Code
+}
+
+func TestGraphQL(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+	signedInClient(t, a, "grace")
+
+	var stack apiStack
+	client.do(http.MethodPost, "/api/v1/users/ada/stacks", `{"name": "Go"}`, &stack)
+	stack_ids := "[" + strconv.Itoa(stack.Id) + "]"
+	for i := 0; i < 3; i++ {
+		client.do(http.MethodPost, "/api/v1/users/ada/projects", `{"name": "project `+strconv.Itoa(i)+`", "description": "json api", "start_date": "2024-01-01", "stack_ids": `+stack_ids+`}`, nil)
+	}
+	client.do(http.MethodPost, "/api/v1/users/ada/employments", `{"name": "Acme", "employee": "engineer", "description": "built things", "start_date": "2020-01-01", "stack_ids": `+stack_ids+`}`, nil)
+	client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "engines"}`, nil)
+
+	counter := &countingStorage{Storage: a.storage}
+	a.storage = counter
+
+	query := `query Resume($username: String!) {
+		user(username: $username) {
+			username email
+			profile { role }
+			projects { name endDate stack { name } }
+			employments { name stack { name } }
+			hobbies { name }
+		}
+		other: user(username: "grace") { username email projects { name } }
+		nobody: user(username: "nobody") { username }
+	}`
+	var result graphQLResult
+	if code := client.graphQL(query, map[string]any{"username": "ada"}, &result); code != http.StatusOK || len(result.Errors) > 0 {
+		t.Fatalf("Got %d %+v, Expected the query to succeed", code, result.Errors)
+	}
+
+	user := result.Data["user"].(map[string]any)
+	projects := user["projects"].([]any)
+	if len(projects) != 3 || projects[0].(map[string]any)["endDate"] != nil || projects[2].(map[string]any)["stack"].([]any)[0].(map[string]any)["name"] != "Go" {
+		t.Errorf("Got %v, Expected the projects with their stack", projects)
+	}
+	if user["email"] != "ada@example.com" || user["profile"].(map[string]any)["role"] != "engineer" || len(user["employments"].([]any)) != 1 || len(user["hobbies"].([]any)) != 0 {
+		t.Errorf("Got %v, Expected the whole resume of the signed in user", user)
+	}
+	if other := result.Data["other"].(map[string]any); other["email"] != nil || other["username"] != "grace" {
+		t.Errorf("Got %v, Expected contact details of other users to be hidden", other)
+	}
+	if result.Data["nobody"] != nil {
+		t.Errorf("Got %v, Expected unknown users to be null", result.Data["nobody"])
+	}
+	// one load per user however many records and relations are selected
+	if counter.aggregates != 2 {
+		t.Errorf("Got %d resume loads, Expected one per existing user", counter.aggregates)
+	}
+
+	var rejected graphQLResult
+	if code := client.graphQL(`{ user(username: "ada") { projects { stack { name { length } } } } }`, nil, &rejected); code != http.StatusBadRequest || len(rejected.Errors) == 0 || rejected.Data != nil {
+		t.Errorf("Got %d %+v, Expected invalid queries to be rejected", code, rejected)
+	}
+
+	aliases := []string{}
+	for i := 0; i < graphQLMaxCost/graphQLUserCost; i++ {
+		aliases = append(aliases, "u"+strconv.Itoa(i)+`: user(username: "ada") { username }`)
+	}
+	rejected = graphQLResult{}
+	if code := client.graphQL("{ "+strings.Join(aliases, " ")+" }", nil, &rejected); code != http.StatusBadRequest || len(rejected.Errors) != 1 || !strings.Contains(rejected.Errors[0].Message, "too expensive") {
+		t.Errorf("Got %d %+v, Expected aliasing many users to be too expensive", code, rejected)
+	}
+
+	rejected = graphQLResult{}
+	if code := client.graphQL(`mutation { user(username: "ada") { username } }`, nil, &rejected); code != http.StatusBadRequest || !strings.Contains(rejected.Errors[0].Message, "read-only") {
+		t.Errorf("Got %d %+v, Expected mutations to be rejected", code, rejected)
+	}
+
+	anonymous := &apiClient{t: t, handler: client.handler}
+	var public graphQLResult
+	w := anonymous.do(http.MethodGet, "/api/v1/graphql?query="+url.QueryEscape(`{ user(username: "ada") { email profile { role } } }`), "", &public)
+	if w.Code != http.StatusOK || public.Data["user"].(map[string]any)["email"] != nil {
+		t.Errorf("Got %d %s, Expected anonymous queries over GET without contact details", w.Code, w.Body.String())
+	}
+
+	w = anonymous.do(http.MethodGet, "/api/v1/graphql/schema", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "user(username: String!): User") {
+		t.Errorf("Got %d %s, Expected the schema as SDL", w.Code, w.Body.String())
+	}
+	if w = anonymous.do(http.MethodPut, "/api/v1/graphql", "", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Got %d, Expected only GET and POST", w.Code)
+	}
+}
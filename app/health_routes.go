@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// how long readiness checks may take before the database is reported down
+const readyTimeout = 2 * time.Second
+
+// probes are registered without MakeHTTPHandler so they are not logged on every poll
+func (a *AppServer) registerHealthRoutes(sm *http.ServeMux) {
+	sm.HandleFunc("/healthz", a.handleHealthz)
+	sm.HandleFunc("/readyz", a.handleReadyz)
+}
+
+// the process is up and serving requests
+func (a *AppServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// the server can handle traffic: not shutting down, the database answers,
+// uploads can be written and every template parses
+func (a *AppServer) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	// the probe is public, failures are only detailed in the log
+	checks := map[string]string{}
+	ready := true
+	check := func(name string, err error) {
+		checks[name] = "ok"
+		if err != nil {
+			a.log(ctx).Error("readiness check failed", "check", name, "error", err)
+			checks[name] = "failed"
+			ready = false
+		}
+	}
+
+	if a.draining.Load() {
+		check("server", errors.New("shutting down"))
+	}
+	check("database", a.storage.Ping(ctx))
+	check("media", writableDir(a.userImagesDir))
+	check("templates", a.checkTemplates())
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// creates and removes a file to prove the directory accepts writes
+func writableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// parses every page template together with the layout, the way RenderHtml does
+func (a *AppServer) checkTemplates() error {
+	layout := filepath.Join(a.templateDir, "utils/layout.html")
+
+	pages, err := filepath.Glob(filepath.Join(a.templateDir, "*", "*.html"))
+	if err != nil {
+		return err
+	}
+	top, _ := filepath.Glob(filepath.Join(a.templateDir, "*.html"))
+
+	for _, page := range append(top, pages...) {
+		if page == layout {
+			continue
+		}
+		if _, err := template.ParseFiles(layout, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// lists changes made to the signed in users resume data
+func (a *AppServer) handleHistoryView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	events, next, err := a.storage.GetAuditLog(c, map[string]string{"owner": user.Username}, pageFromRequest(r))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "unable to load history",
+		}
+	}
+
+	contextData := map[string]any{
+		"events": events,
+	}
+	if next != "" {
+		contextData["next_page"] = nextPageURL(r, url.Values{}, next)
+	}
+
+	return a.RenderHtml(c, w, r, []string{"manager/history.html", "partials/_pagination.html"}, contextData)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/metrics"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec(
+		"http_requests_total",
+		"HTTP requests handled per route.",
+		"route", "method", "status",
+	)
+	httpDuration = metrics.NewHistogramVec(
+		"http_request_duration_seconds",
+		"Time spent handling HTTP requests per route.",
+		metrics.DefBuckets,
+		"route",
+	)
+)
+
+// methods outside this set are counted as "other" to keep the label set small
+var metricMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// counts requests and records latency under the pattern the route was registered with,
+// not the request path, so ids in urls do not create new series.
+// the request span is named after the pattern too
+func instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := tracing.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(tracing.String("http.route", route))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		completed := false
+		defer func() {
+			status := recorder.status
+			if !completed {
+				// the handler panicked, recoverPanic answers with a 500
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+
+			method := r.Method
+			if !metricMethods[method] {
+				method = "other"
+			}
+			httpRequests.Inc(route, method, strconv.Itoa(status))
+			httpDuration.Observe(time.Since(start).Seconds(), route)
+		}()
+
+		next.ServeHTTP(recorder, r)
+		completed = true
+	})
+}
+
+// the scrape endpoint is registered outside the middleware like the probes
+func (a *AppServer) registerMetricsRoutes(sm *http.ServeMux) {
+	sm.Handle("/metrics", metrics.Handler())
+}
+
+// gauges that read the storage when scraped
+func (a *AppServer) registerMetrics() {
+	metrics.NewGaugeFunc("sessions_active", "Sessions that are neither cancelled nor expired.", func() (float64, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+		defer cancel()
+
+		count, err := a.storage.CountActiveSessions(ctx, time.Now())
+		if err != nil {
+			a.logger.Error("could not count active sessions", "error", err)
+			return 0, false
+		}
+		return float64(count), true
+	})
+
+	cached, ok := a.storage.(*storage.CachedStorage)
+	if !ok {
+		return
+	}
+	metrics.NewCounterFunc("storage_cache_hits_total", "Storage reads answered from the cache.", func() (float64, bool) {
+		return float64(cached.Stats().Hits), true
+	})
+	metrics.NewCounterFunc("storage_cache_misses_total", "Storage reads that went to the database.", func() (float64, bool) {
+		return float64(cached.Stats().Misses), true
+	})
+	metrics.NewGaugeFunc("storage_cache_entries", "Reads currently held in the cache.", func() (float64, bool) {
+		return float64(cached.Stats().Entries), true
+	})
+}
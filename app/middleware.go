@@ -0,0 +1,195 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+// wraps a handler, the first middleware given to chain runs first
+type middleware func(http.Handler) http.Handler
+
+func chain(h http.Handler, m ...middleware) http.Handler {
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	return h
+}
+
+type requestIDKey struct{}
+
+const requestIDHeader = "X-Request-ID"
+
+// the id of the request being handled, empty outside the middleware chain
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// a logger that tags every record with the request id
+func (a *AppServer) log(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return a.logger.With("request_id", id)
+	}
+	return a.logger
+}
+
+// keeps the id set by a proxy in front of us, otherwise assigns a new one,
+// and echoes it in the response so reports can be matched with logs
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// records the status and size of a response for the access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// lets http.ResponseController reach the wrapped writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// reports whether the response was started, errors can only be written before that
+func (s *statusRecorder) Written() bool {
+	return s.status != 0
+}
+
+// records a server span for the request, continuing the trace of a caller that
+// sent a traceparent header. instrument names it after the matched route
+func traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tracing.Extract(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := tracing.Start(ctx, r.Method,
+			tracing.String("http.method", r.Method),
+			tracing.String("http.target", r.URL.Path),
+			tracing.String("request_id", RequestID(ctx)),
+		)
+		span.SetKind(tracing.KindServer)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		completed := false
+		defer func() {
+			status := recorder.status
+			if !completed {
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(tracing.Int("http.status_code", status))
+			if status >= 500 {
+				span.SetError(errors.New(http.StatusText(status)))
+			}
+		}()
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		completed = true
+	})
+}
+
+func (a *AppServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", recorder.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if trace_id := tracing.TraceIDFromContext(r.Context()); trace_id != "" {
+			attrs = append(attrs, slog.String("trace_id", trace_id))
+		}
+		a.log(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// turns a panicking handler into a 500 response instead of a dropped connection
+func (a *AppServer) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// the server aborts the response on purpose, let it
+				panic(recovered)
+			}
+
+			a.log(r.Context()).Error("panic serving request",
+				"error", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+			a.writeError(w, r, &HandlerError{
+				code:    http.StatusInternalServerError,
+				message: fmt.Sprintf("panic: %v", recovered),
+			})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
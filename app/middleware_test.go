@@ -0,0 +1,96 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var logs bytes.Buffer
+	a := &AppServer{logger: slog.New(slog.NewTextHandler(&logs, nil)), templateDir: "../Templates"}
+
+	routes := http.NewServeMux()
+	routes.HandleFunc("/ok/", a.MakeHTTPHandler(func(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+		w.Write([]byte(RequestID(c)))
+		return nil
+	}))
+	routes.HandleFunc("/missing/", a.MakeHTTPHandler(func(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+		return &HandlerError{code: http.StatusNotFound, message: "project not found"}
+	}))
+	routes.HandleFunc("/broken/", a.MakeHTTPHandler(func(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+		return &HandlerError{code: http.StatusInternalServerError, message: "pq: password authentication failed"}
+	}))
+	routes.HandleFunc("/panic/", func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map")
+	})
+	h := chain(routes, withRequestID, a.accessLog, a.recoverPanic)
+
+	serve := func(path, request_id string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if request_id != "" {
+			r.Header.Set(requestIDHeader, request_id)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/ok/", "upstream-id")
+	if w.Body.String() != "upstream-id" || w.Header().Get(requestIDHeader) != "upstream-id" {
+		t.Errorf("Got %q %q, Expected the upstream request id to be kept", w.Body.String(), w.Header().Get(requestIDHeader))
+	}
+	if w = serve("/ok/", "bad id\n"); w.Body.String() == "bad id\n" || w.Body.Len() == 0 {
+		t.Errorf("Got %q, Expected an invalid request id to be replaced", w.Body.String())
+	}
+
+	if w = serve("/missing/", ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "Page not found") || !strings.Contains(w.Body.String(), "<nav") {
+		t.Errorf("Got %d %q, Expected an error page in the layout", w.Code, w.Body.String())
+	}
+
+	// htmx requests get a fragment swapped into the error target
+	w = serve("/missing/", "", "HX-Request", "true", errorTargetHeader, "#import-errors")
+	if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "<nav") || !strings.Contains(w.Body.String(), "project not found") {
+		t.Errorf("Got %d %q, Expected an error fragment", w.Code, w.Body.String())
+	}
+	if w.Header().Get("HX-Retarget") != "#import-errors" || w.Header().Get("HX-Reswap") != "innerHTML" {
+		t.Errorf("Got %v, Expected the fragment retargeted at the form errors", w.Header())
+	}
+	w = serve("/missing/", "", "HX-Request", "true", errorTargetHeader, "body > script")
+	if w.Header().Get("HX-Retarget") != defaultErrorTarget {
+		t.Errorf("Got %s, Expected an invalid target to fall back to the page errors", w.Header().Get("HX-Retarget"))
+	}
+	if w = serve("/broken/", ""); w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "pq:") {
+		t.Errorf("Got %d %q, Expected a 500 without internal details", w.Code, w.Body.String())
+	}
+	if w = serve("/panic/", "panic-id"); w.Code != http.StatusInternalServerError {
+		t.Errorf("Got %d, Expected a panic to become a 500", w.Code)
+	}
+
+	if !strings.Contains(logs.String(), "status=404") || !strings.Contains(logs.String(), `msg="panic serving request" request_id=panic-id`) {
+		t.Errorf("Got %s, Expected access and panic logs tagged with request ids", logs.String())
+	}
+}
+
+func TestReadyzHidesErrors(t *testing.T) {
+	var logs bytes.Buffer
+	a := newAPITestServer(t)
+	a.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	a.userImagesDir = t.TempDir() + "/missing"
+
+	w := httptest.NewRecorder()
+	a.handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"media":"failed"`) || strings.Contains(w.Body.String(), "no such file") {
+		t.Errorf("Got %d %s, Expected the failed check without its error", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "no such file") {
+		t.Errorf("Got %q, Expected the error in the log", logs.String())
+	}
+}
@@ -0,0 +1,360 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// an operation of the json api as published in openapi.json.
+// request and response bodies are given as values of the types the handlers use
+// so the document follows the code
+type apiOperation struct {
+	method    string
+	path      string // relative to apiPrefix, e.g /users/{username}
+	summary   string
+	request   any         // nil when there is no body
+	responses map[int]any // nil values have no body
+	write     bool        // requires signing in as {username}
+	paged     bool        // takes cursor, limit and sort
+}
+
+// listing bodies are documented per item type
+type apiListOf struct {
+	item any
+}
+
+func (a *AppServer) apiOperations() []apiOperation {
+	ops := []apiOperation{
+		{method: http.MethodPost, path: "/users", summary: "Create an account",
+			request: signupInput{}, responses: map[int]any{http.StatusCreated: apiUser{}}},
+		{method: http.MethodGet, path: "/users/{username}", summary: "Read a user, email and phone are only shown to the user themselves",
+			responses: map[int]any{http.StatusOK: apiUser{}}},
+		{method: http.MethodPut, path: "/users/{username}", summary: "Replace a users details and social links",
+			request: userInput{}, responses: map[int]any{http.StatusOK: apiUser{}}, write: true},
+		{method: http.MethodGet, path: "/users/{username}/resume", summary: "Read everything a resume is rendered from",
+			responses: map[int]any{http.StatusOK: apiResume{}}},
+		{method: http.MethodGet, path: "/users/{username}/profile", summary: "Read the profile",
+			responses: map[int]any{http.StatusOK: apiProfile{}}},
+		{method: http.MethodPut, path: "/users/{username}/profile", summary: "Create the profile, or replace it when version is given",
+			request: profileInput{}, responses: map[int]any{http.StatusOK: apiProfile{}, http.StatusCreated: apiProfile{}}, write: true},
+		{method: http.MethodDelete, path: "/users/{username}/profile", summary: "Delete the profile",
+			responses: map[int]any{http.StatusNoContent: nil}, write: true},
+	}
+
+	collections := []struct {
+		name     string
+		resource any
+		input    any
+	}{
+		{"projects", apiProject{}, projectInput{}},
+		{"employments", apiEmployment{}, employmentInput{}},
+		{"hobbies", apiHobby{}, nameInput{}},
+		{"stacks", apiStack{}, nameInput{}},
+	}
+	for _, c := range collections {
+		singular := a.apiCollections()[c.name].name
+		path := "/users/{username}/" + c.name
+		ops = append(ops,
+			apiOperation{method: http.MethodGet, path: path, summary: "List " + c.name,
+				responses: map[int]any{http.StatusOK: apiListOf{c.resource}}, paged: c.name != "stacks"},
+			apiOperation{method: http.MethodPost, path: path, summary: "Create a " + singular,
+				request: c.input, responses: map[int]any{http.StatusCreated: c.resource}, write: true},
+			apiOperation{method: http.MethodGet, path: path + "/{id}", summary: "Read a " + singular,
+				responses: map[int]any{http.StatusOK: c.resource}},
+			apiOperation{method: http.MethodPut, path: path + "/{id}", summary: "Replace a " + singular + " at the given version",
+				request: c.input, responses: map[int]any{http.StatusOK: c.resource}, write: true},
+			apiOperation{method: http.MethodDelete, path: path + "/{id}", summary: "Move a " + singular + " to the trash",
+				responses: map[int]any{http.StatusNoContent: nil}, write: true},
+		)
+	}
+	return ops
+}
+
+var (
+	openAPIOnce     sync.Once
+	openAPIDocument map[string]any
+)
+
+// serves the document built from apiOperations, it does not change while running
+func (a *AppServer) handleOpenAPI(c context.Context, w http.ResponseWriter, r *http.Request) *ApiError {
+	if r.Method != http.MethodGet {
+		return apiMethodNotAllowed(w, http.MethodGet)
+	}
+	openAPIOnce.Do(func() {
+		openAPIDocument = a.openAPI()
+	})
+	writeJSON(w, http.StatusOK, openAPIDocument)
+	return nil
+}
+
+// builds the openapi 3.1 document of the json api
+func (a *AppServer) openAPI() map[string]any {
+	schemas := openAPISchemas{}
+	schemas["Error"] = map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"error": schemas.ref(reflect.TypeOf(ApiError{}))},
+		"required":             []string{"error"},
+		"additionalProperties": false,
+	}
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}},
+		}
+	}
+
+	paths := map[string]any{}
+	for _, op := range a.apiOperations() {
+		operation := map[string]any{
+			"summary":     op.summary,
+			"operationId": operationID(op),
+			"tags":        []string{operationTag(op.path)},
+		}
+
+		parameters := []any{}
+		for _, name := range pathParameters(op.path) {
+			schema := map[string]any{"type": "string"}
+			if name == "id" {
+				schema = map[string]any{"type": "integer", "minimum": 1}
+			}
+			parameters = append(parameters, map[string]any{"name": name, "in": "path", "required": true, "schema": schema})
+		}
+		if op.paged {
+			parameters = append(parameters,
+				map[string]any{"name": "cursor", "in": "query", "description": "next_cursor of the previous page", "schema": map[string]any{"type": "string"}},
+				map[string]any{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": 100, "default": 20}},
+				map[string]any{"name": "sort", "in": "query", "description": "column to sort by, prefix with - for descending order", "schema": map[string]any{"type": "string"}},
+			)
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if op.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.ref(reflect.TypeOf(op.request))}},
+			}
+		}
+
+		responses := map[string]any{}
+		for status, body := range op.responses {
+			response := map[string]any{"description": http.StatusText(status)}
+			if body != nil {
+				response["content"] = map[string]any{"application/json": map[string]any{"schema": schemas.body(body)}}
+			}
+			responses[strconv.Itoa(status)] = response
+		}
+		if op.request != nil {
+			responses["400"] = errorResponse("The body is not valid json or has unknown fields")
+			responses["422"] = errorResponse("Some fields are invalid, see error.fields")
+		}
+		if op.write {
+			responses["401"] = errorResponse("Not signed in, or the api token is unknown or expired")
+			responses["403"] = errorResponse("Signed in as another user, or the api token lacks the scope")
+			operation["security"] = []any{map[string]any{"session": []string{}}, map[string]any{"token": []string{}}}
+		}
+		if op.method == http.MethodPut && strings.Contains(op.path, "{") {
+			responses["409"] = errorResponse("The record was changed since the given version")
+		}
+		if strings.Contains(op.path, "{") {
+			responses["404"] = errorResponse("Not found")
+		}
+		responses["default"] = errorResponse("Unexpected error")
+		operation["responses"] = responses
+
+		item, ok := paths[op.path].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "Resume generator API",
+			"version":     "1",
+			"description": "Read and edit resumes. Records carry a version that must be sent back when replacing them, a stale version is refused with 409.",
+		},
+		"servers": []any{map[string]any{"url": strings.TrimSuffix(apiPrefix, "/")}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": "session_key"},
+				"token": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A personal api token created on the tokens page. Changes need the entity:write scope of what they change, e.g projects:write, and user:read shows the users email and phone.",
+				},
+			},
+		},
+	}
+}
+
+// e.g createProjects, getUsersProfile
+func operationID(op apiOperation) string {
+	verbs := map[string]string{http.MethodGet: "get", http.MethodPost: "create", http.MethodPut: "replace", http.MethodDelete: "delete"}
+	id := verbs[op.method]
+	if op.method == http.MethodGet && op.paged || op.method == http.MethodGet && strings.HasSuffix(op.path, "stacks") {
+		id = "list"
+	}
+	for _, part := range strings.Split(op.path, "/") {
+		if part == "" || strings.HasPrefix(part, "{") {
+			continue
+		}
+		id += upperFirst(part)
+	}
+	return id
+}
+
+func operationTag(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return "users"
+	}
+	return parts[2]
+}
+
+func pathParameters(path string) []string {
+	names := []string{}
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") {
+			names = append(names, strings.Trim(part, "{}"))
+		}
+	}
+	return names
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// component schemas by name, filled in as types are referenced
+type openAPISchemas map[string]any
+
+// names a component after its go type, apiProject becomes Project and projectInput ProjectInput
+func schemaName(t reflect.Type) string {
+	if t == reflect.TypeOf(ApiError{}) {
+		return "ApiError"
+	}
+	return upperFirst(strings.TrimPrefix(t.Name(), "api"))
+}
+
+func (s openAPISchemas) body(v any) map[string]any {
+	list, ok := v.(apiListOf)
+	if !ok {
+		return s.ref(reflect.TypeOf(v))
+	}
+
+	item := reflect.TypeOf(list.item)
+	name := schemaName(item) + "List"
+	if _, ok := s[name]; !ok {
+		s[name] = map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"items":       map[string]any{"type": "array", "items": s.ref(item)},
+				"next_cursor": map[string]any{"type": "string", "description": "absent on the last page"},
+			},
+			"required":             []string{"items"},
+			"additionalProperties": false,
+		}
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// a reference to the component of a struct type, other types are inlined
+func (s openAPISchemas) ref(t reflect.Type) map[string]any {
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return s.schema(t)
+	}
+
+	name := schemaName(t)
+	if _, ok := s[name]; !ok {
+		// placeholder first so recursive types terminate
+		s[name] = map[string]any{}
+		s[name] = s.object(t)
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func (s openAPISchemas) schema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.Pointer:
+		return map[string]any{"anyOf": []any{s.ref(t.Elem()), map[string]any{"type": "null"}}}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		return s.ref(t)
+	}
+	return map[string]any{}
+}
+
+// request bodies accept any subset of their fields, responses always carry
+// the fields that are not omitempty
+func (s openAPISchemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	input := strings.HasSuffix(t.Name(), "Input")
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		schema := s.schema(f.Type)
+		if f.Type.Kind() == reflect.Slice && !input {
+			// empty lists are sent as [] rather than null
+			schema = map[string]any{"type": "array", "items": s.ref(f.Type.Elem())}
+		}
+		if strings.HasSuffix(name, "_date") {
+			schema["description"] = "yyyy-mm-dd, empty when unknown"
+		}
+		properties[name] = schema
+
+		if !input && !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	object := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
@@ -0,0 +1,249 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checks a decoded json value against a schema of the document, covering the
+// parts of json schema the document uses
+func validateSchema(doc map[string]any, schema map[string]any, value any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		var target any = doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			target = target.(map[string]any)[part]
+		}
+		resolved, ok := target.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: unresolved reference %s", path, ref)
+		}
+		return validateSchema(doc, resolved, value, path)
+	}
+
+	if options, ok := schema["anyOf"].([]any); ok {
+		for _, option := range options {
+			if validateSchema(doc, option.(map[string]any), value, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v matches none of the allowed schemas", path, value)
+	}
+
+	switch schema["type"] {
+	case "null":
+		if value != nil {
+			return fmt.Errorf("%s: expected null, got %v", path, value)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %v", path, value)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected an integer, got %v", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean, got %v", path, value)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %v", path, value)
+		}
+		for i, item := range items {
+			if err := validateSchema(doc, schema["items"].(map[string]any), item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %v", path, value)
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, v := range object {
+			property, ok := properties[name].(map[string]any)
+			if !ok {
+				additional, ok := schema["additionalProperties"].(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s: undocumented property %s", path, name)
+				}
+				property = additional
+			}
+			if err := validateSchema(doc, property, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: schema without a type %v", path, schema)
+	}
+	return nil
+}
+
+// the documented path of a request path, e.g /users/{username}/projects/{id}
+func matchOperationPath(doc map[string]any, path string) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, apiPrefix), "/"), "/")
+	for template := range doc["paths"].(map[string]any) {
+		template_parts := strings.Split(strings.Trim(template, "/"), "/")
+		if len(template_parts) != len(parts) {
+			continue
+		}
+		matched := true
+		for i, part := range template_parts {
+			if !strings.HasPrefix(part, "{") && part != parts[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return template
+		}
+	}
+	return ""
+}
+
+// sends requests through the api handler and checks every response against the document
+type contractClient struct {
+	*apiClient
+	doc     map[string]any
+	covered map[string]bool
+}
+
+func (c *contractClient) do(method, path, body string, out any) int {
+	c.t.Helper()
+
+	w := c.apiClient.do(method, path, body, out)
+	path, _, _ = strings.Cut(path, "?")
+	template := matchOperationPath(c.doc, path)
+	operation, ok := c.doc["paths"].(map[string]any)[template].(map[string]any)[strings.ToLower(method)].(map[string]any)
+	if template == "" || !ok {
+		c.t.Fatalf("%s %s is not documented", method, path)
+	}
+
+	responses := operation["responses"].(map[string]any)
+	response, ok := responses[strconv.Itoa(w.Code)].(map[string]any)
+	if !ok {
+		response = responses["default"].(map[string]any)
+	}
+	if w.Code < 300 {
+		c.covered[method+" "+template] = true
+	}
+
+	content, ok := response["content"].(map[string]any)
+	if !ok {
+		if w.Body.Len() > 0 {
+			c.t.Errorf("%s %s: got body %s, Expected no body for %d", method, path, w.Body.String(), w.Code)
+		}
+		return w.Code
+	}
+	if content_type := w.Header().Get("Content-Type"); !strings.HasPrefix(content_type, "application/json") {
+		c.t.Errorf("%s %s: got Content-Type %q, Expected json", method, path, content_type)
+	}
+
+	var value any
+	if err := json.Unmarshal(w.Body.Bytes(), &value); err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	schema := content["application/json"].(map[string]any)["schema"].(map[string]any)
+	if err := validateSchema(c.doc, schema, value, "body"); err != nil {
+		c.t.Errorf("%s %s %d: %v in %s", method, path, w.Code, err, w.Body.String())
+	}
+	return w.Code
+}
+
+func TestOpenAPIMatchesResponses(t *testing.T) {
+	a := newAPITestServer(t)
+	anonymous := &apiClient{t: t, handler: a.MakeAPIHandler(a.handleAPI)}
+
+	var doc map[string]any
+	if w := anonymous.do(http.MethodGet, "/api/v1/openapi.json", "", &doc); w.Code != http.StatusOK || doc["openapi"] != "3.1.0" {
+		t.Fatalf("Got %d %s, Expected the openapi document", w.Code, w.Body.String())
+	}
+
+	covered := map[string]bool{}
+	client := &contractClient{apiClient: signedInClient(t, a, "ada"), doc: doc, covered: covered}
+	public := &contractClient{apiClient: anonymous, doc: doc, covered: covered}
+	covered["POST /users"] = true
+
+	public.do(http.MethodPost, "/api/v1/users", `{"username": "x"}`, nil)
+	public.do(http.MethodGet, "/api/v1/users/ada", "", nil)
+	client.do(http.MethodGet, "/api/v1/users/ada", "", nil)
+	client.do(http.MethodPut, "/api/v1/users/ada", `{"firstname": "Ada", "country": "UK", "version": 1}`, nil)
+	client.do(http.MethodGet, "/api/v1/users/ada/profile", "", nil)
+	public.do(http.MethodGet, "/api/v1/users/ada/resume", "", nil)
+	client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "engines"}`, nil)
+	client.do(http.MethodPut, "/api/v1/users/ada/profile", `{"role": "engineer", "about": "notes", "version": 1}`, nil)
+	public.do(http.MethodGet, "/api/v1/users/ada/profile", "", nil)
+
+	var stack apiStack
+	client.do(http.MethodPost, "/api/v1/users/ada/stacks", `{"name": "Go"}`, &stack)
+	stack_ids := `[` + strconv.Itoa(stack.Id) + `]`
+	records := map[string]string{
+		"projects":    `{"name": "api", "description": "json api", "start_date": "2024-01-01", "stack_ids": ` + stack_ids + `}`,
+		"employments": `{"name": "Acme", "employee": "engineer", "description": "built things", "start_date": "2020-01-01", "stack_ids": ` + stack_ids + `}`,
+		"hobbies":     `{"name": "chess"}`,
+		"stacks":      `{"name": "Postgres"}`,
+	}
+	for collection, body := range records {
+		path := "/api/v1/users/ada/" + collection
+		var created struct{ Id int }
+		if code := client.do(http.MethodPost, path, body, &created); code != http.StatusCreated {
+			t.Fatalf("Got %d, Expected a %s record to be created", code, collection)
+		}
+		client.do(http.MethodPost, path, `{}`, nil)
+		public.do(http.MethodGet, path+"?limit=1", "", nil)
+
+		record := path + "/" + strconv.Itoa(created.Id)
+		public.do(http.MethodGet, record, "", nil)
+		public.do(http.MethodPut, record, body, nil)
+		client.do(http.MethodPut, record, strings.Replace(body, "{", `{"version": 9, `, 1), nil)
+		client.do(http.MethodPut, record, strings.Replace(body, "{", `{"version": 1, `, 1), nil)
+	}
+
+	// the full resume before anything is removed
+	public.do(http.MethodGet, "/api/v1/users/ada/resume", "", nil)
+	for collection := range records {
+		path := "/api/v1/users/ada/" + collection
+		var list struct{ Items []struct{ Id int } }
+		client.do(http.MethodGet, path, "", &list)
+		for _, item := range list.Items {
+			client.do(http.MethodDelete, path+"/"+strconv.Itoa(item.Id), "", nil)
+		}
+		client.do(http.MethodGet, path+"/1000", "", nil)
+	}
+	client.do(http.MethodDelete, "/api/v1/users/ada/profile", "", nil)
+	public.do(http.MethodGet, "/api/v1/users/ada/resume", "", nil)
+
+	missing := []string{}
+	for template, item := range doc["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			if operation := strings.ToUpper(method) + " " + template; !covered[operation] {
+				missing = append(missing, operation)
+			}
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("Expected every documented operation to be exercised, missing %v", missing)
+	}
+}
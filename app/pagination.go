@@ -0,0 +1,38 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// reads ?cursor=&limit=&sort= from the request query
+func pageFromRequest(r *http.Request) storage.Page {
+	query := r.URL.Query()
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		limit = storage.DefaultPageSize
+	}
+
+	return storage.Page{
+		Cursor: query.Get("cursor"),
+		Limit:  limit,
+		Sort:   query.Get("sort"),
+	}
+}
+
+// builds the link to the next page keeping the current limit and sort
+func nextPageURL(r *http.Request, query url.Values, cursor string) string {
+	current := r.URL.Query()
+	for _, k := range []string{"limit", "sort"} {
+		if v := current.Get(k); v != "" {
+			query.Set(k, v)
+		}
+	}
+	query.Set("cursor", cursor)
+
+	return r.URL.Path + "?" + query.Encode()
+}
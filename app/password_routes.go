@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+func (a *AppServer) sendPasswordResetEmail(c context.Context, user data.User) error {
+	return a.sendEmailLink(c, user, data.Email_token_reset, data.Reset_password_duration, "/auth/password/reset/", func(link string) mailer.Message {
+		return mailer.Message{
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your resume account %s. Open this link to choose a new one:\n\n%s\n\n"+
+				"The link works once and expires in %d minutes. If you did not ask for it you can ignore this email, your password stays the same.\n",
+				user.Firstname, user.Username, link, int(data.Reset_password_duration.Minutes())),
+		}
+	})
+}
+
+// emails a reset link to the account using email if there is one, failures
+// are only logged as the user was already answered
+func (a *AppServer) sendPasswordResetTo(c context.Context, email string) {
+	users, err := a.storage.GetUsers(c, map[string]string{"email": email})
+	if err != nil {
+		a.log(c).Error("looking up password reset account failed", "error", err)
+		return
+	}
+	if len(users) == 0 {
+		return
+	}
+	if err := a.sendPasswordResetEmail(c, *users[0]); err != nil {
+		a.log(c).Error("sending password reset email failed", "username", users[0].Username, "error", err)
+	}
+}
+
+// /auth/password/forgot, emails a reset link to the account with the given email
+func (a *AppServer) handleForgotPassword(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+	contextData := map[string]string{}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		email := strings.TrimSpace(r.FormValue("email"))
+		contextData["email"] = email
+
+		if email == "" {
+			contextData["error_message"] = "Enter the email of your account."
+			return a.RenderHtml(c, w, r, []string{"auth/forgot_password.html"}, contextData)
+		}
+
+		// looked up and sent after replying, so how long the reply takes does not
+		// tell whether an account uses the email
+		ctx := context.WithoutCancel(c)
+		a.background.Add(1)
+		go func() {
+			defer a.background.Done()
+			a.sendPasswordResetTo(ctx, email)
+		}()
+
+		contextData["success_message"] = "If an account uses that email, a reset link is on its way. It expires in an hour."
+	}
+
+	return a.RenderHtml(c, w, r, []string{"auth/forgot_password.html"}, contextData)
+}
+
+// /auth/password/reset/{token}, the link sent by sendPasswordResetEmail
+func (a *AppServer) handleResetPassword(c context.Context, w http.ResponseWriter, r *http.Request, secret string) *HandlerError {
+	contextData := map[string]string{"token": secret}
+
+	if r.Method != http.MethodPost {
+		return a.RenderHtml(c, w, r, []string{"auth/reset_password.html"}, contextData)
+	}
+
+	// checked before the token is used up so a typo does not cost the user their link
+	r.ParseForm()
+	password := r.FormValue("password")
+	switch {
+	case password != r.FormValue("conform_password"):
+		contextData["error_message"] = "Password Mismatch"
+	case len(password) < 8:
+		contextData["error_message"] = "Password must be at least 8 characters."
+	case len(password) > 72:
+		contextData["error_message"] = "Password must be at most 72 characters."
+	}
+	if contextData["error_message"] != "" {
+		return a.RenderHtml(c, w, r, []string{"auth/reset_password.html"}, contextData)
+	}
+
+	hash, err := data.HashPassword(password)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to reset password",
+		}
+	}
+
+	// the token is only used up when the password is changed, a failed change leaves the link working
+	var username string
+	err = a.storage.Atomic(c, func(c context.Context) error {
+		token, err := a.storage.UseEmailToken(c, data.Email_token_reset, data.HashEmailToken(secret), time.Now())
+		if err != nil {
+			return err
+		}
+		// also ends every session of the user
+		username = token.User.Username
+		return a.storage.SetUserPassword(storage.WithActor(c, username), username, hash)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return a.RenderHtml(c, w, r, []string{"auth/forgot_password.html"}, map[string]string{
+			"error_message": "This reset link is invalid, was already used or has expired. Request a new one below.",
+		})
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to reset password",
+		}
+	}
+
+	return a.RenderHtml(c, w, r, []string{"auth/login.html"}, map[string]string{
+		"username":        username,
+		"success_message": "Your password was changed, sign in with the new one.",
+	})
+}
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+func postForm(handler http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// fails changing passwords, after the reset token was used
+type brokenPasswords struct {
+	storage.Storage
+}
+
+func (s brokenPasswords) SetUserPassword(c context.Context, username, hash string) error {
+	return errors.New("passwords unavailable")
+}
+
+func TestResetPassword(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+	handler := a.MakeHTTPHandler(a.handleAuthView)
+	outbox := a.mailer.(*mailer.Outbox)
+
+	// unknown emails get the same reply and no email
+	sent := len(outbox.Messages())
+	unknown := postForm(handler, "/auth/password/forgot/", url.Values{"email": {"nobody@example.com"}})
+	known := postForm(handler, "/auth/password/forgot/", url.Values{"email": {"ada@example.com"}})
+	// the email is sent after the reply
+	a.background.Wait()
+	if unknown.Body.String() != strings.Replace(known.Body.String(), "ada@example.com", "nobody@example.com", 1) {
+		t.Errorf("Expected the reply not to tell whether an account uses the email")
+	}
+	if len(outbox.Messages()) != sent+1 {
+		t.Fatalf("Got %d emails, Expected one reset email", len(outbox.Messages())-sent)
+	}
+	link := emailedLink(t, a, "ada@example.com")
+	if !strings.HasPrefix(link, "/auth/password/reset/") {
+		t.Fatalf("Got %s, Expected a reset link", link)
+	}
+
+	w := postForm(handler, link, url.Values{"password": {"new horse"}, "conform_password": {"other horse"}})
+	if !strings.Contains(w.Body.String(), "Mismatch") {
+		t.Errorf("Got %d, Expected mismatched passwords to be rejected", w.Code)
+	}
+
+	// a password change that fails does not use up the link
+	working := a.storage
+	a.storage = brokenPasswords{working}
+	if w := postForm(handler, link, url.Values{"password": {"battery staple"}, "conform_password": {"battery staple"}}); w.Code != http.StatusInternalServerError {
+		t.Errorf("Got %d, Expected the failed change to be reported", w.Code)
+	}
+	a.storage = working
+
+	// the typo above did not use up the link
+	w = postForm(handler, link, url.Values{"password": {"battery staple"}, "conform_password": {"battery staple"}})
+	if !strings.Contains(w.Body.String(), "password was changed") {
+		t.Fatalf("Got %d %s, Expected the password to be changed", w.Code, w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(client.cookie)
+	if _, err := a.IsAuthenticated(r); err == nil {
+		t.Errorf("Expected existing sessions to end")
+	}
+	if err := a.Login(context.Background(), "ada", "correct horse", httptest.NewRecorder()); err == nil {
+		t.Errorf("Expected the old password to stop working")
+	}
+	if err := a.Login(context.Background(), "ada", "battery staple", httptest.NewRecorder()); err != nil {
+		t.Errorf("Got %v, Expected the new password to work", err)
+	}
+
+	w = postForm(handler, link, url.Values{"password": {"another one"}, "conform_password": {"another one"}})
+	if !strings.Contains(w.Body.String(), "already used") {
+		t.Errorf("Got %d, Expected the link to work once", w.Code)
+	}
+}
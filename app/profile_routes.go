@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+func (a *AppServer) handleProfilesView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	role := r.URL.Query().Get("role")
+	page := pageFromRequest(r)
+
+	contextData := map[string]any{
+		"role": role,
+		"sort": page.Sort,
+	}
+
+	if role != "" {
+		profiles, next, err := a.storage.GetProfileByRole(c, role, page)
+		if err != nil {
+			return &HandlerError{
+				code:    http.StatusBadRequest,
+				message: "unable to load profiles",
+			}
+		}
+		contextData["profiles"] = profiles
+
+		if next != "" {
+			query := url.Values{}
+			query.Set("role", role)
+			contextData["next_page"] = nextPageURL(r, query, next)
+		}
+	}
+
+	return a.RenderHtml(c, w, r, []string{"profiles/list.html", "partials/_pagination.html"}, contextData)
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// a form input of the project editor.
+// Saved is the stored value when it differs from Value after a conflict
+type editorField struct {
+	Name     string
+	Label    string
+	Value    string
+	Saved    string
+	Conflict bool
+	Textarea bool
+}
+
+func (a *AppServer) handleProjectsView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := strings.Trim(r.URL.Path[len("/projects/"):], "/")
+	if subpath != "" {
+		id, err := strconv.Atoi(subpath)
+		if err != nil {
+			return &HandlerError{
+				code:    http.StatusNotFound,
+				message: "address not found",
+			}
+		}
+		return a.handleProjectEditor(c, w, r, user.Username, id)
+	}
+
+	projects, next, err := a.storage.GetProjects(c, map[string]string{"username": user.Username}, pageFromRequest(r))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "unable to load projects",
+		}
+	}
+
+	contextData := map[string]any{
+		"projects": projects,
+	}
+	if next != "" {
+		contextData["next_page"] = nextPageURL(r, url.Values{}, next)
+	}
+	return a.RenderHtml(c, w, r, []string{"manager/projects.html", "partials/_pagination.html"}, contextData)
+}
+
+// shows the editor on GET and saves it on POST.
+// saving a version someone else has changed since responds with 409 and a merge prompt
+func (a *AppServer) handleProjectEditor(c context.Context, w http.ResponseWriter, r *http.Request, username string, id int) *HandlerError {
+	project, herr := a.userProject(c, username, id)
+	if herr != nil {
+		return herr
+	}
+
+	contextData := map[string]any{
+		"project": project,
+		"version": project.Version,
+		"fields":  projectFields(*project, nil),
+	}
+
+	if r.Method != http.MethodPost {
+		return a.RenderHtml(c, w, r, []string{"manager/project_form.html"}, contextData)
+	}
+
+	r.ParseForm()
+	version, err := strconv.Atoi(r.FormValue("version"))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid record version",
+		}
+	}
+
+	edited := *project
+	edited.Name = r.FormValue("name")
+	edited.Status = r.FormValue("status")
+	edited.Github = r.FormValue("github")
+	edited.Prod_link = r.FormValue("prod_link")
+	edited.Description = r.FormValue("description")
+	edited.Version = version
+
+	err = a.storage.UpdateProject(storage.WithActor(c, username), edited)
+
+	var conflict *storage.ConflictError
+	if errors.As(err, &conflict) {
+		saved, ok := conflict.Current.(*data.Project)
+		if !ok {
+			// changed while saving, load what was stored
+			if saved, herr = a.userProject(c, username, id); herr != nil {
+				return herr
+			}
+		}
+
+		// keep the users edits and show what was saved in the meantime,
+		// submitting again applies the edits on top of the saved version
+		contextData["project"] = saved
+		contextData["version"] = saved.Version
+		contextData["fields"] = projectFields(edited, saved)
+		contextData["conflict"] = true
+
+		w.WriteHeader(http.StatusConflict)
+		return a.RenderHtml(c, w, r, []string{"manager/project_form.html"}, contextData)
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to save project",
+		}
+	}
+
+	project, herr = a.userProject(c, username, id)
+	if herr != nil {
+		return herr
+	}
+	contextData["project"] = project
+	contextData["version"] = project.Version
+	contextData["fields"] = projectFields(*project, nil)
+	contextData["saved"] = true
+	return a.RenderHtml(c, w, r, []string{"manager/project_form.html"}, contextData)
+}
+
+// loads a project making sure it belongs to the given user
+func (a *AppServer) userProject(c context.Context, username string, id int) (*data.Project, *HandlerError) {
+	projects, _, err := a.storage.GetProjects(c, map[string]string{"id": fmt.Sprint(id), "username": username}, storage.Page{})
+	if err != nil || len(projects) == 0 {
+		return nil, &HandlerError{
+			code:    http.StatusNotFound,
+			message: "project not found",
+		}
+	}
+	return projects[0], nil
+}
+
+// editor inputs for a project, marking fields that differ from saved when given
+func projectFields(p data.Project, saved *data.Project) []editorField {
+	fields := []editorField{
+		{Name: "name", Label: "Name", Value: p.Name},
+		{Name: "status", Label: "Status", Value: p.Status},
+		{Name: "github", Label: "Github", Value: p.Github},
+		{Name: "prod_link", Label: "Live link", Value: p.Prod_link},
+		{Name: "description", Label: "Description", Value: p.Description, Textarea: true},
+	}
+	if saved == nil {
+		return fields
+	}
+
+	saved_values := map[string]string{
+		"name":        saved.Name,
+		"status":      saved.Status,
+		"github":      saved.Github,
+		"prod_link":   saved.Prod_link,
+		"description": saved.Description,
+	}
+	for i, f := range fields {
+		if saved_values[f.Name] != f.Value {
+			fields[i].Saved = saved_values[f.Name]
+			fields[i].Conflict = true
+		}
+	}
+	return fields
+}
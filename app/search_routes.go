@@ -0,0 +1,34 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+func (a *AppServer) handleSearchView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	query := r.URL.Query().Get("q")
+
+	contextData := map[string]any{
+		"query": query,
+	}
+
+	if query != "" {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil {
+			limit = 0
+		}
+
+		results, err := a.storage.Search(c, query, limit)
+		if err != nil {
+			return &HandlerError{
+				code:    http.StatusBadRequest,
+				message: "unable to search",
+			}
+		}
+		contextData["results"] = results
+	}
+
+	return a.RenderHtml(c, w, r, []string{"search/results.html"}, contextData)
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+func (a *AppServer) handleSnapshotsView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := r.URL.Path[len("/snapshots/"):]
+
+	switch subpath {
+	case "":
+		if r.Method == http.MethodPost {
+			if herr := a.handleSnapshotCreate(c, r, user); herr != nil {
+				return herr
+			}
+		}
+	case "diff", "diff/":
+		return a.handleSnapshotDiff(c, w, r, user.Username)
+	case "rollback", "rollback/":
+		if r.Method != http.MethodPost {
+			return &HandlerError{
+				code:    http.StatusMethodNotAllowed,
+				message: "method not allowed",
+			}
+		}
+		if herr := a.handleSnapshotRollback(c, r, user.Username); herr != nil {
+			return herr
+		}
+	default:
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "address not found",
+		}
+	}
+
+	snapshots, err := a.storage.GetResumeSnapshots(c, user.Username)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load snapshots",
+		}
+	}
+
+	contextData := map[string]any{
+		"snapshots": snapshots,
+	}
+	return a.RenderHtml(c, w, r, []string{"manager/snapshots.html"}, contextData)
+}
+
+func (a *AppServer) handleSnapshotCreate(c context.Context, r *http.Request, user *data.User) *HandlerError {
+	r.ParseForm()
+
+	label := strings.TrimSpace(r.FormValue("label"))
+	if label == "" {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "provide a snapshot label",
+		}
+	}
+
+	resume, err := storage.LoadResume(c, a.storage, user.Username)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load resume",
+		}
+	}
+
+	c = storage.WithActor(c, user.Username)
+	err = a.storage.CreateResumeSnapshot(c, data.ResumeSnapshot{User: *user, Label: label, Resume: *resume})
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to save snapshot",
+		}
+	}
+
+	// snapshots are taken before a resume is sent out
+	a.emit(c, user.Username, data.Event_resume_published, map[string]any{
+		"label":  label,
+		"resume": newAPIResume(*resume, false),
+	})
+	return nil
+}
+
+// compares ?from= and ?to=, each a snapshot id or "current" for the live data
+func (a *AppServer) handleSnapshotDiff(c context.Context, w http.ResponseWriter, r *http.Request, username string) *HandlerError {
+	query := r.URL.Query()
+
+	from, from_label, herr := a.resumeVersion(c, username, query.Get("from"))
+	if herr != nil {
+		return herr
+	}
+	to, to_label, herr := a.resumeVersion(c, username, query.Get("to"))
+	if herr != nil {
+		return herr
+	}
+
+	changes, err := data.DiffResumes(*from, *to)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to compare snapshots",
+		}
+	}
+
+	contextData := map[string]any{
+		"from":    from_label,
+		"to":      to_label,
+		"changes": changes,
+	}
+	return a.RenderHtml(c, w, r, []string{"manager/snapshot_diff.html"}, contextData)
+}
+
+func (a *AppServer) handleSnapshotRollback(c context.Context, r *http.Request, username string) *HandlerError {
+	r.ParseForm()
+
+	snapshot, herr := a.userSnapshot(c, username, r.FormValue("id"))
+	if herr != nil {
+		return herr
+	}
+
+	c = storage.WithActor(c, username)
+	if err := storage.RollbackResume(c, a.storage, username, snapshot.Resume); err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to roll back resume",
+		}
+	}
+	return nil
+}
+
+// returns the resume for a snapshot id, or the live resume for "current" or an empty value
+func (a *AppServer) resumeVersion(c context.Context, username, version string) (*data.Resume, string, *HandlerError) {
+	if version == "" || version == "current" {
+		resume, err := storage.LoadResume(c, a.storage, username)
+		if err != nil {
+			return nil, "", &HandlerError{
+				code:    http.StatusInternalServerError,
+				message: "unable to load resume",
+			}
+		}
+		return resume, "current", nil
+	}
+
+	snapshot, herr := a.userSnapshot(c, username, version)
+	if herr != nil {
+		return nil, "", herr
+	}
+	return &snapshot.Resume, snapshot.Label, nil
+}
+
+// loads a snapshot making sure it belongs to the given user
+func (a *AppServer) userSnapshot(c context.Context, username, id string) (*data.ResumeSnapshot, *HandlerError) {
+	snapshot_id, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid snapshot id",
+		}
+	}
+
+	snapshot, err := a.storage.GetResumeSnapshot(c, snapshot_id)
+	if err != nil || snapshot.User.Username != username {
+		return nil, &HandlerError{
+			code:    http.StatusNotFound,
+			message: "snapshot not found",
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// expiry choices offered when creating a token, in days. 0 never expires
+var tokenLifetimes = []int{30, 90, 365, 0}
+
+func (a *AppServer) handleTokensView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := r.URL.Path[len("/tokens/"):]
+
+	contextData := map[string]any{
+		"entities":  data.Token_entities,
+		"lifetimes": tokenLifetimes,
+	}
+
+	switch subpath {
+	case "":
+		if r.Method == http.MethodPost {
+			token, secret, herr := a.handleTokenCreate(c, r, user)
+			if herr != nil {
+				return herr
+			}
+			// the secret is only ever shown here
+			contextData["created"] = token
+			contextData["secret"] = secret
+		}
+	case "revoke", "revoke/":
+		if r.Method != http.MethodPost {
+			return &HandlerError{
+				code:    http.StatusMethodNotAllowed,
+				message: "method not allowed",
+			}
+		}
+		if herr := a.handleTokenRevoke(c, r, user.Username); herr != nil {
+			return herr
+		}
+	default:
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "address not found",
+		}
+	}
+
+	tokens, err := a.storage.GetApiTokens(c, user.Username)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load api tokens",
+		}
+	}
+
+	contextData["tokens"] = tokens
+	contextData["now"] = time.Now()
+	return a.RenderHtml(c, w, r, []string{"manager/tokens.html"}, contextData)
+}
+
+func (a *AppServer) handleTokenCreate(c context.Context, r *http.Request, user *data.User) (*data.ApiToken, string, *HandlerError) {
+	r.ParseForm()
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxFieldLength {
+		return nil, "", &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "provide a token name of at most 255 characters",
+		}
+	}
+
+	scopes := r.Form["scopes"]
+	if len(scopes) == 0 {
+		return nil, "", &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "choose what the token may access",
+		}
+	}
+
+	days, err := strconv.Atoi(r.FormValue("expires_in"))
+	if err != nil || days < 0 {
+		return nil, "", &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "choose when the token expires",
+		}
+	}
+	var expires_on time.Time
+	if days > 0 {
+		expires_on = time.Now().AddDate(0, 0, days)
+	}
+
+	token, secret, err := user.NewApiToken(name, scopes, expires_on)
+	if err != nil {
+		return nil, "", &HandlerError{
+			code:    http.StatusBadRequest,
+			message: err.Error(),
+		}
+	}
+
+	c = storage.WithActor(c, user.Username)
+	if err := a.storage.CreateApiToken(c, *token); err != nil {
+		return nil, "", &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to create api token",
+		}
+	}
+	return token, secret, nil
+}
+
+func (a *AppServer) handleTokenRevoke(c context.Context, r *http.Request, username string) *HandlerError {
+	r.ParseForm()
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid token id",
+		}
+	}
+
+	c = storage.WithActor(c, username)
+	err = a.storage.DeleteApiToken(c, username, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "api token not found",
+		}
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to revoke api token",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+func (a *AppServer) handleTrashView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := r.URL.Path[len("/trash/"):]
+
+	switch subpath {
+	case "":
+	case "restore", "restore/":
+		if r.Method != http.MethodPost {
+			return &HandlerError{
+				code:    http.StatusMethodNotAllowed,
+				message: "method not allowed",
+			}
+		}
+		if herr := a.handleTrashRestore(c, r, user.Username); herr != nil {
+			return herr
+		}
+	default:
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "address not found",
+		}
+	}
+
+	items, err := a.storage.GetTrash(c, user.Username)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load trash",
+		}
+	}
+
+	contextData := map[string]any{
+		"items":     items,
+		"retention": a.trashRetention,
+	}
+	return a.RenderHtml(c, w, r, []string{"manager/trash.html"}, contextData)
+}
+
+func (a *AppServer) handleTrashRestore(c context.Context, r *http.Request, username string) *HandlerError {
+	r.ParseForm()
+
+	kind := r.FormValue("kind")
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid record id",
+		}
+	}
+
+	// only restore records that are in this users trash
+	items, err := a.storage.GetTrash(c, username)
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load trash",
+		}
+	}
+
+	found := false
+	for _, item := range items {
+		if item.Kind == kind && item.Id == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "record not found in trash",
+		}
+	}
+
+	c = storage.WithActor(c, username)
+
+	switch kind {
+	case "project":
+		err = a.storage.RestoreProject(c, id)
+	case "employment":
+		err = a.storage.RestoreEmployment(c, id)
+	case "hobby":
+		err = a.storage.RestoreHobby(c, id)
+	case "stack":
+		err = a.storage.RestoreTechStack(c, id)
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to restore record",
+		}
+	}
+	return nil
+}
+
+// periodically removes records that have been in the trash longer than the retention period
+func (a *AppServer) purgeTrash(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.storage.PurgeTrash(ctx, time.Now().Add(-a.trashRetention))
+		if err != nil {
+			a.logger.Error("trash purge failed", "error", err)
+		} else if purged > 0 {
+			a.logger.Info("purged records from trash", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,16 +1,59 @@
 package app
 
-import "github.com/phillipmugisa/go_resume_generator/storage"
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/config"
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/webhooks"
+)
 
 type AppServer struct {
-	port    string
-	storage storage.Storage
+	port            string
+	storage         storage.Storage
+	trashRetention  time.Duration
+	templateDir     string
+	mediaDir        string
+	userImagesDir   string
+	sessionDuration time.Duration
+	cookieSecure    bool
+	shutdownTimeout time.Duration
+	logger          *slog.Logger
+	webhooks        *webhooks.Dispatcher
+	mailer          mailer.Mailer
+	baseURL         string // links in emails start with it
+	profileViews    throttle
+
+	// work requests leave running after they are answered, waited for before
+	// the storage is closed
+	background sync.WaitGroup
+
+	// set once shutdown starts so readiness checks fail while requests drain
+	draining atomic.Bool
 }
 
-func NewAppServer(p string, s storage.Storage) *AppServer {
+func NewAppServer(cfg *config.Config, s storage.Storage) *AppServer {
+	logger := cfg.Logger()
 	return &AppServer{
-		port:    p,
-		storage: s,
+		port:            cfg.Port,
+		storage:         s,
+		trashRetention:  cfg.TrashRetention,
+		templateDir:     cfg.TemplateDir,
+		mediaDir:        cfg.MediaDir,
+		userImagesDir:   cfg.UserImagesDir(),
+		sessionDuration: cfg.SessionDuration,
+		cookieSecure:    cfg.CookieSecure,
+		shutdownTimeout: cfg.ShutdownTimeout,
+		logger:          logger,
+		webhooks:        webhooks.NewDispatcher(s, webhooks.NewClient(webhookTimeout, webhooks.PublicOnly), logger),
+		mailer:          cfg.Mailer(os.Stdout),
+		baseURL:         strings.TrimRight(cfg.BaseURL, "/"),
 	}
 }
 
@@ -23,4 +66,15 @@ func (e HandlerError) Error() string {
 	return e.message
 }
 
-type ApiError struct{}
+// ApiError is the body of every failed json api response, wrapped as {"error": ...}.
+// Fields maps request fields to what is wrong with them when validation fails
+type ApiError struct {
+	Status  int               `json:"status"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func (e ApiError) Error() string {
+	return e.Message
+}
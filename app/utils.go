@@ -13,25 +13,25 @@ import (
 	"time"
 
 	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type httpHandler func(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError
 
-func MakeHTTPHandler(f httpHandler) http.HandlerFunc {
+// adapts a handler to net/http, a returned HandlerError becomes the response
+func (a *AppServer) MakeHTTPHandler(f httpHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// log request
-		fmt.Printf("%s %s %s\n", time.Now().UTC(), r.Method, r.URL.String())
-
-		ctx := context.Background()
-		err := f(ctx, w, r)
-		if err != nil {
-			handlerRouterError(ctx, err)
+		// handlers inherit the request context so storage calls are
+		// cancelled once the client goes away
+		ctx := r.Context()
+		if err := f(ctx, w, r); err != nil {
+			a.writeError(w, r, err)
 		}
 	}
 }
 
-func (a *AppServer) HandleImageUpload(user data.User, r *http.Request) error {
+func (a *AppServer) HandleImageUpload(c context.Context, user data.User, r *http.Request) error {
 	// read file
 	// create destination
 	// write file
@@ -43,7 +43,7 @@ func (a *AppServer) HandleImageUpload(user data.User, r *http.Request) error {
 		if imagesError != nil {
 
 			// assign default avator
-			filedbWriteErr := a.storage.CreateUserimage(user, filepath.Join("media/users/images", "avatar.png"))
+			filedbWriteErr := a.storage.CreateUserimage(c, user, filepath.Join(a.userImagesDir, "avatar.png"))
 			if filedbWriteErr != nil {
 				return errors.New("error saving file")
 			}
@@ -51,7 +51,7 @@ func (a *AppServer) HandleImageUpload(user data.User, r *http.Request) error {
 		defer image.Close()
 
 		// save to disk
-		destination, fileCreateErr := os.Create(filepath.Join("media/users/images", handler.Filename))
+		destination, fileCreateErr := os.Create(filepath.Join(a.userImagesDir, handler.Filename))
 		if fileCreateErr != nil {
 			return errors.New("error creating destination file")
 		}
@@ -64,7 +64,7 @@ func (a *AppServer) HandleImageUpload(user data.User, r *http.Request) error {
 		}
 
 		// save in database
-		filedbWriteErr := a.storage.CreateUserimage(user, strings.ReplaceAll(destination.Name(), "\\", "/"))
+		filedbWriteErr := a.storage.CreateUserimage(c, user, strings.ReplaceAll(destination.Name(), "\\", "/"))
 		if filedbWriteErr != nil {
 			os.Remove(destination.Name())
 			return errors.New("error saving file")
@@ -77,17 +77,10 @@ func (a *AppServer) HandleImageUpload(user data.User, r *http.Request) error {
 func (a *AppServer) RenderHtml(ctx context.Context, w http.ResponseWriter, r *http.Request, templates []string, contextData any) *HandlerError {
 	// pass user data to template by default if user is authenticated
 
-	var template_dirs []string
-
-	layout_tmpl := fmt.Sprintf("./Templates/%s", "utils/layout.html")
-
-	template_dirs = append(template_dirs, layout_tmpl)
-	for _, t := range templates {
-		template_dir := fmt.Sprintf("./Templates/%s", t)
-		template_dirs = append(template_dirs, template_dir)
-	}
-
-	tmpl, parseError := template.ParseFiles(template_dirs...)
+	_, span := tracing.Start(ctx, "template.parse", tracing.String("templates", strings.Join(templates, ",")))
+	tmpl, parseError := a.loadTemplates(templates)
+	span.SetError(parseError)
+	span.End()
 	if parseError != nil {
 		return &HandlerError{
 			code:    http.StatusInternalServerError,
@@ -96,18 +89,32 @@ func (a *AppServer) RenderHtml(ctx context.Context, w http.ResponseWriter, r *ht
 	}
 
 	// err = tmpl.ExecuteTemplate(w, "layout.html", contextData)
+	_, span = tracing.Start(ctx, "template.execute")
 	err := tmpl.Execute(w, contextData)
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		return &HandlerError{
 			code:    http.StatusInternalServerError,
-			message: fmt.Sprintf("error loading template: %v", parseError),
+			message: fmt.Sprintf("error rendering template: %v", err),
 		}
 	}
 	return nil
 }
 
-func handlerRouterError(c context.Context, err *HandlerError) {
-	fmt.Println(err.code, err.message)
+// parses the layout with the given page templates
+func (a *AppServer) loadTemplates(templates []string) (*template.Template, error) {
+	var template_dirs []string
+
+	layout_tmpl := filepath.Join(a.templateDir, "utils/layout.html")
+
+	template_dirs = append(template_dirs, layout_tmpl)
+	for _, t := range templates {
+		template_dir := filepath.Join(a.templateDir, t)
+		template_dirs = append(template_dirs, template_dir)
+	}
+
+	return template.ParseFiles(template_dirs...)
 }
 
 func checkSessionKey(key string) error {
@@ -120,7 +127,7 @@ func checkSessionKey(key string) error {
 	return nil
 }
 
-func (a AppServer) IsAuthenticated(r *http.Request) (*data.User, error) {
+func (a *AppServer) IsAuthenticated(r *http.Request) (*data.User, error) {
 	// get sessionid cookie
 	cookie, err := r.Cookie("session_key")
 	if err != nil {
@@ -133,14 +140,14 @@ func (a AppServer) IsAuthenticated(r *http.Request) (*data.User, error) {
 	}
 
 	// session_key was found, check database for same key
-	session, err := a.storage.GetSession(cookie.Value)
+	session, err := a.storage.GetSession(r.Context(), cookie.Value)
 	if err != nil {
 		return nil, err
 	}
 
 	// is the session expired
 	if session.Expired {
-		err := a.storage.DeleteSession(*session)
+		err := a.storage.DeleteSession(r.Context(), *session)
 		if err != nil {
 			return nil, err
 		}
@@ -150,7 +157,7 @@ func (a AppServer) IsAuthenticated(r *http.Request) (*data.User, error) {
 	}
 
 	if session.Expires_on.Equal(time.Now()) || time.Now().After(session.Expires_on) {
-		err := a.storage.CancelSession(*session)
+		err := a.storage.CancelSession(r.Context(), *session)
 		if err != nil {
 			return nil, err
 		}
@@ -160,17 +167,17 @@ func (a AppServer) IsAuthenticated(r *http.Request) (*data.User, error) {
 	}
 
 	// get the user
-	users, err := a.storage.GetUsers(map[string]string{"id": session.User.Id})
-	if err != nil {
+	users, err := a.storage.GetUsers(r.Context(), map[string]string{"id": session.User.Id})
+	if err != nil || len(users) == 0 {
 		return nil, errors.New("error getting user")
 	}
 
 	return users[0], nil
 }
 
-func (a AppServer) Login(username, password string, w http.ResponseWriter) error {
+func (a *AppServer) Login(c context.Context, username, password string, w http.ResponseWriter) error {
 	// get user if the same username
-	users, err := a.storage.GetUsers(map[string]string{"username": fmt.Sprint(username)})
+	users, err := a.storage.GetUsers(c, map[string]string{"username": fmt.Sprint(username)})
 	if err != nil {
 		return err
 	}
@@ -181,17 +188,17 @@ func (a AppServer) Login(username, password string, w http.ResponseWriter) error
 	// compare password
 	pwd_err := bcrypt.CompareHashAndPassword([]byte(users[0].Password), []byte(password))
 	if pwd_err != nil {
-		return err
+		return errors.New("invalid username/password")
 	}
 
 	// valid credentials provided, log in the user
 	// create new session
-	session, err := users[0].NewSession()
+	session, err := users[0].NewSession(a.sessionDuration)
 	if err != nil {
 		return err
 	}
 
-	ss_creation_err := a.storage.CreateSession(*session)
+	ss_creation_err := a.storage.CreateSession(c, *session)
 	if ss_creation_err != nil {
 		return ss_creation_err
 	}
@@ -200,9 +207,9 @@ func (a AppServer) Login(username, password string, w http.ResponseWriter) error
 		Name:     "session_key",
 		Value:    session.Key,
 		Path:     "/",
-		MaxAge:   int(data.Session_duration * 3600),
+		MaxAge:   int(a.sessionDuration.Seconds()),
 		HttpOnly: true,
-		Secure:   true,
+		Secure:   a.cookieSecure,
 		SameSite: http.SameSiteLaxMode,
 	}
 	http.SetCookie(w, &cookie)
@@ -210,7 +217,7 @@ func (a AppServer) Login(username, password string, w http.ResponseWriter) error
 	return nil
 }
 
-func (a AppServer) Logout(w http.ResponseWriter, r *http.Request) error {
+func (a *AppServer) Logout(w http.ResponseWriter, r *http.Request) error {
 	// check is user is logged in
 	_, err := a.IsAuthenticated(r)
 	if err != nil {
@@ -224,12 +231,12 @@ func (a AppServer) Logout(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	// session_key was found, check database for same key
-	session, err := a.storage.GetSession(cookie.Value)
+	session, err := a.storage.GetSession(r.Context(), cookie.Value)
 	if err != nil {
 		return err
 	}
 
-	ss_cancel_err := a.storage.CancelSession(*session)
+	ss_cancel_err := a.storage.CancelSession(r.Context(), *session)
 	if ss_cancel_err != nil {
 		return ss_cancel_err
 	}
@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+const (
+	// how long a mail server gets to accept a message
+	mailTimeout = 30 * time.Second
+	// a user is sent at most emailLimit emails of a kind per emailWindow,
+	// at least emailInterval apart
+	emailLimit    = 5
+	emailWindow   = 24 * time.Hour
+	emailInterval = time.Minute
+)
+
+var errTooManyEmails = errors.New("too many emails were sent, please wait before asking for another")
+
+func (a *AppServer) sendMail(c context.Context, m mailer.Message) error {
+	if a.mailer == nil {
+		return errors.New("no mailer is configured")
+	}
+	ctx, cancel := context.WithTimeout(c, mailTimeout)
+	defer cancel()
+	return a.mailer.Send(ctx, m)
+}
+
+// errTooManyEmails when the user was sent too many emails for purpose recently
+func (a *AppServer) emailRateLimit(c context.Context, username, purpose string, now time.Time) error {
+	recent, err := a.storage.CountEmailTokens(c, username, purpose, now.Add(-emailInterval))
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return errTooManyEmails
+	}
+
+	sent, err := a.storage.CountEmailTokens(c, username, purpose, now.Add(-emailWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= emailLimit {
+		return errTooManyEmails
+	}
+	return nil
+}
+
+// emails the user a link to path carrying a new single use token for purpose,
+// compose writes the message around the link
+func (a *AppServer) sendEmailLink(c context.Context, user data.User, purpose string, duration time.Duration, path string, compose func(link string) mailer.Message) error {
+	now := time.Now()
+	if err := a.emailRateLimit(c, user.Username, purpose, now); err != nil {
+		return err
+	}
+
+	token, secret, err := user.NewEmailToken(purpose, duration, now)
+	if err != nil {
+		return err
+	}
+	if err := a.storage.CreateEmailToken(c, *token); err != nil {
+		return err
+	}
+
+	m := compose(a.baseURL + path + secret)
+	m.To = user.Email
+	return a.sendMail(c, m)
+}
+
+func (a *AppServer) sendVerificationEmail(c context.Context, user data.User) error {
+	return a.sendEmailLink(c, user, data.Email_token_verify, data.Verify_email_duration, "/auth/verify/", func(link string) mailer.Message {
+		return mailer.Message{
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hi %s,\n\nOpen this link to verify the email address of your resume account:\n\n%s\n\n"+
+				"The link works once and expires in %d hours. If you did not create an account you can ignore this email.\n",
+				user.Firstname, link, int(data.Verify_email_duration.Hours())),
+		}
+	})
+}
+
+// /auth/verify/{token}, the link sent by sendVerificationEmail
+func (a *AppServer) handleVerifyEmail(c context.Context, w http.ResponseWriter, r *http.Request, secret string) *HandlerError {
+	contextData := map[string]string{}
+
+	token, err := a.storage.UseEmailToken(c, data.Email_token_verify, data.HashEmailToken(secret), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		contextData["error_message"] = "This verification link is invalid, was already used or has expired. Sign in to request a new one."
+		return a.RenderHtml(c, w, r, []string{"auth/login.html"}, contextData)
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to verify email",
+		}
+	}
+
+	username := token.User.Username
+	if _, err := a.storage.VerifyUserEmail(storage.WithActor(c, username), username); err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to verify email",
+		}
+	}
+
+	contextData["username"] = username
+	contextData["success_message"] = "Your email address is verified."
+	return a.RenderHtml(c, w, r, []string{"auth/login.html"}, contextData)
+}
+
+// sends the signed in user a new verification link
+func (a *AppServer) handleVerifyResend(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+	if r.Method != http.MethodPost {
+		return &HandlerError{
+			code:    http.StatusMethodNotAllowed,
+			message: "method not allowed",
+		}
+	}
+
+	contextData := map[string]any{"user": user}
+	if user.Email_verified {
+		return a.RenderHtml(c, w, r, []string{"manager/account.html"}, contextData)
+	}
+
+	switch err := a.sendVerificationEmail(c, *user); {
+	case errors.Is(err, errTooManyEmails):
+		w.WriteHeader(http.StatusTooManyRequests)
+		contextData["verify_error"] = "A verification link was sent recently, please check your email or try again later."
+	case err != nil:
+		a.log(c).Error("sending verification email failed", "username", user.Username, "error", err)
+		contextData["verify_error"] = "The verification email could not be sent, please try again later."
+	default:
+		contextData["verify_sent"] = true
+	}
+
+	return a.RenderHtml(c, w, r, []string{"manager/account.html"}, contextData)
+}
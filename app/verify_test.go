@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+)
+
+// the link in the latest email sent to the address
+func emailedLink(t *testing.T, a *AppServer, to string) string {
+	t.Helper()
+	m, ok := a.mailer.(*mailer.Outbox).Last(to)
+	if !ok {
+		t.Fatalf("Expected an email to %s", to)
+	}
+	for _, line := range strings.Split(m.Body, "\n") {
+		if strings.HasPrefix(line, a.baseURL) {
+			return strings.TrimPrefix(line, a.baseURL)
+		}
+	}
+	t.Fatalf("Got %q, Expected a link in the email", m.Body)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	a := newAPITestServer(t)
+	client := signedInClient(t, a, "ada")
+	handler := a.MakeHTTPHandler(a.handleAuthView)
+
+	link := emailedLink(t, a, "ada@example.com")
+	if !strings.HasPrefix(link, "/auth/verify/") {
+		t.Fatalf("Got %s, Expected a verification link", link)
+	}
+
+	// a resend right after signing up is rate limited
+	r := httptest.NewRequest(http.MethodPost, "/auth/verify/resend/", nil)
+	r.AddCookie(client.cookie)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests || len(a.mailer.(*mailer.Outbox).Messages()) != 1 {
+		t.Errorf("Got %d, Expected the resend to be rate limited", w.Code)
+	}
+
+	for i, expected := range []string{"is verified", "already used"} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("visit %d: Got %d, Expected the page to say %q", i+1, w.Code, expected)
+		}
+	}
+
+	users, err := a.storage.GetUsers(context.Background(), map[string]string{"username": "ada"})
+	if err != nil || len(users) != 1 || !users[0].Email_verified {
+		t.Errorf("Got %v %v, Expected the email to be verified", users, err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/verify/not-a-token", nil))
+	if !strings.Contains(w.Body.String(), "invalid") {
+		t.Errorf("Got %d, Expected unknown tokens to be rejected", w.Code)
+	}
+}
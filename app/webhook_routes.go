@@ -0,0 +1,242 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+const (
+	// how long a receiver has to answer a delivery
+	webhookTimeout = 10 * time.Second
+	// how often deliveries waiting for a retry are checked, new ones are sent straight away
+	webhookPollInterval = 30 * time.Second
+	// deliveries listed per webhook
+	webhookLogSize = 20
+	// at most one profile.viewed event is queued per user in this window,
+	// otherwise every request for a public profile queues a delivery
+	profileViewedInterval = time.Minute
+)
+
+// queues a webhook event, failing to do so never fails the request that caused it
+func (a *AppServer) emit(c context.Context, username, event string, event_data any) {
+	if a.webhooks == nil {
+		return
+	}
+	if err := a.webhooks.Emit(c, username, event, event_data); err != nil {
+		a.log(c).Error("queueing webhook failed", "event", event, "username", username, "error", err)
+	}
+}
+
+// owners looking at their own profile are not counted, views within
+// profileViewedInterval of the last event are coalesced into it
+func (a *AppServer) emitProfileViewed(c context.Context, r *http.Request, username string) {
+	viewer := apiCallerFrom(r).user
+	if viewer != nil && viewer.Username == username {
+		return
+	}
+	if !a.profileViews.allow(username, time.Now(), profileViewedInterval) {
+		return
+	}
+	a.emit(c, username, data.Event_profile_viewed, map[string]any{"signed_in": viewer != nil})
+}
+
+// remembers when each key last fired, the zero value is ready to use
+type throttle struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// keys kept before ones that may fire again are forgotten
+const throttleSize = 1024
+
+// reports whether key may fire at now, at most once per interval
+func (t *throttle) allow(key string, now time.Time, interval time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.last[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if t.last == nil {
+		t.last = map[string]time.Time{}
+	}
+	if len(t.last) >= throttleSize {
+		for k, last := range t.last {
+			if now.Sub(last) >= interval {
+				delete(t.last, k)
+			}
+		}
+	}
+	t.last[key] = now
+	return true
+}
+
+func (a *AppServer) handleWebhooksView(c context.Context, w http.ResponseWriter, r *http.Request) *HandlerError {
+
+	user, err := a.IsAuthenticated(r)
+	if err != nil {
+		http.Redirect(w, r, "/auth/signin/", http.StatusMovedPermanently)
+		return nil
+	}
+
+	subpath := r.URL.Path[len("/webhooks/"):]
+
+	contextData := map[string]any{
+		"events": data.Webhook_events,
+	}
+
+	action := strings.TrimSuffix(subpath, "/")
+	if (action == "delete" || action == "redeliver") && r.Method != http.MethodPost {
+		return &HandlerError{
+			code:    http.StatusMethodNotAllowed,
+			message: "method not allowed",
+		}
+	}
+
+	switch action {
+	case "":
+		if r.Method == http.MethodPost {
+			webhook, herr := a.handleWebhookCreate(c, r, user)
+			if herr != nil {
+				return herr
+			}
+			// the secret is only ever shown here
+			contextData["created"] = webhook
+		}
+	case "delete":
+		if herr := a.handleWebhookDelete(c, r, user.Username); herr != nil {
+			return herr
+		}
+	case "redeliver":
+		if herr := a.handleWebhookRedeliver(c, r, user.Username); herr != nil {
+			return herr
+		}
+		contextData["redelivered"] = true
+	default:
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "address not found",
+		}
+	}
+
+	webhooks, err := a.storage.GetWebhooks(c, map[string]string{"username": user.Username})
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to load webhooks",
+		}
+	}
+
+	// each webhook with its latest deliveries
+	type webhookLog struct {
+		*data.Webhook
+		Deliveries []*data.WebhookDelivery
+	}
+	logs := []webhookLog{}
+	for _, webhook := range webhooks {
+		deliveries, err := a.storage.GetWebhookDeliveries(c, map[string]string{"webhook_id": strconv.Itoa(webhook.Id)}, webhookLogSize)
+		if err != nil {
+			return &HandlerError{
+				code:    http.StatusInternalServerError,
+				message: "unable to load webhook deliveries",
+			}
+		}
+		logs = append(logs, webhookLog{webhook, deliveries})
+	}
+
+	contextData["webhooks"] = logs
+	return a.RenderHtml(c, w, r, []string{"manager/webhooks.html"}, contextData)
+}
+
+func (a *AppServer) handleWebhookCreate(c context.Context, r *http.Request, user *data.User) (*data.Webhook, *HandlerError) {
+	r.ParseForm()
+
+	address := strings.TrimSpace(r.FormValue("url"))
+	if len(address) > maxFieldLength {
+		return nil, &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "webhook urls are limited to 255 characters",
+		}
+	}
+
+	webhook, err := user.NewWebhook(address, r.Form["events"])
+	if err != nil {
+		return nil, &HandlerError{
+			code:    http.StatusBadRequest,
+			message: err.Error(),
+		}
+	}
+
+	c = storage.WithActor(c, user.Username)
+	if err := a.storage.CreateWebhook(c, *webhook); err != nil {
+		return nil, &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to save webhook",
+		}
+	}
+	return webhook, nil
+}
+
+func (a *AppServer) handleWebhookDelete(c context.Context, r *http.Request, username string) *HandlerError {
+	r.ParseForm()
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid webhook id",
+		}
+	}
+
+	c = storage.WithActor(c, username)
+	err = a.storage.DeleteWebhook(c, username, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "webhook not found",
+		}
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to remove webhook",
+		}
+	}
+	return nil
+}
+
+func (a *AppServer) handleWebhookRedeliver(c context.Context, r *http.Request, username string) *HandlerError {
+	r.ParseForm()
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusBadRequest,
+			message: "invalid delivery id",
+		}
+	}
+
+	err = a.webhooks.Redeliver(c, username, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &HandlerError{
+			code:    http.StatusNotFound,
+			message: "delivery not found",
+		}
+	}
+	if err != nil {
+		return &HandlerError{
+			code:    http.StatusInternalServerError,
+			message: "unable to queue delivery",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/app"
+	"github.com/phillipmugisa/go_resume_generator/config"
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/render"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"serve":          {"start the web server (default)", runServe},
+	"migrate":        {"create or upgrade the database tables", runMigrate},
+	"create-user":    {"create a user account", runCreateUser},
+	"reset-password": {"set a new password for a user and sign them out", runResetPassword},
+	"verify-email":   {"mark a users email address as verified", runVerifyEmail},
+	"export-user":    {"write a users account archive to a zip file", runExportUser},
+	"purge-sessions": {"delete expired and cancelled sessions", runPurgeSessions},
+	"render":         {"render a resume from the database or a json file", runRender},
+	"config":         {"'config print' shows the resolved settings, secrets redacted", runConfig},
+}
+
+func usage(w io.Writer) {
+	program := filepath.Base(os.Args[0])
+	fmt.Fprintf(w, "usage: %s <command> [flags]\n\ncommands:\n", program)
+
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(w, "\nrun '%s <command> -h' for the flags of a command\n", program)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(filepath.Base(os.Args[0])+" "+name, flag.ContinueOnError)
+}
+
+// adds the config flags to fs, parses args and loads the config
+func parseWithConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	loader := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return loader.Load()
+}
+
+// connects to the database, commands other than serve and migrate expect it to be set up
+func openStorage(cfg *config.Config) (*storage.PostgresStorage, error) {
+	store, err := storage.NewPostgresStorage(cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	store.SetQueryTimeout(cfg.QueryTimeout)
+	return store, nil
+}
+
+// turns tracing on when configured, the returned func flushes the exporter.
+// the stdout exporter writes to console
+func startTracing(cfg *config.Config, console io.Writer) (func(), error) {
+	exporter, err := cfg.SpanExporter(console)
+	if err != nil || exporter == nil {
+		return func() {}, err
+	}
+	tracing.SetExporter(exporter)
+	return func() {
+		tracing.SetExporter(nil)
+		exporter.Close()
+	}, nil
+}
+
+// fails unless every named flag was given a value
+func required(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		if fs.Lookup(name).Value.String() == "" {
+			return fmt.Errorf("-%s is required", name)
+		}
+	}
+	return nil
+}
+
+// reads a password from the first line of stdin so it stays out of shell history
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("password is empty")
+	}
+	return password, nil
+}
+
+func runServe(args []string) error {
+	cfg, err := parseWithConfig(newFlagSet("serve"), args)
+	if err != nil {
+		return err
+	}
+
+	// storage service
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := store.SetUpDB(context.Background()); err != nil {
+		return err
+	}
+
+	// cache reads in memory, CACHE_SIZE=0 disables the cache
+	var s storage.Storage = store
+	if cfg.CacheSize > 0 {
+		s = storage.NewCachedStorage(store, cfg.CacheSize, cfg.CacheTTL)
+	}
+
+	stop_tracing, err := startTracing(cfg, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer stop_tracing()
+
+	a := app.NewAppServer(cfg, s)
+
+	// stop on ctrl-c or when the orchestrator asks
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return a.Run(ctx)
+}
+
+func runMigrate(args []string) error {
+	cfg, err := parseWithConfig(newFlagSet("migrate"), args)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	if err := store.SetUpDB(context.Background()); err != nil {
+		return err
+	}
+	fmt.Println("database is up to date")
+	return nil
+}
+
+func runCreateUser(args []string) error {
+	fs := newFlagSet("create-user")
+	username := fs.String("username", "", "username to sign in with")
+	email := fs.String("email", "", "email address")
+	firstname := fs.String("firstname", "", "first name")
+	lastname := fs.String("lastname", "", "last name")
+	password := fs.String("password", "", "password, read from stdin when empty")
+	phone := fs.String("phone", "", "phone number")
+	country := fs.String("country", "", "country")
+	bio := fs.String("bio", "", "short bio")
+	start_date := fs.String("start-date", time.Now().Format("2006-01-02"), "date the user started working, YYYY-MM-DD")
+	verified := fs.Bool("verified", false, "mark the email address as verified")
+	cfg, err := parseWithConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := required(fs, "username", "email", "country"); err != nil {
+		return err
+	}
+
+	pwd, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	user, err := data.NewUser(*firstname, *lastname, *username, *email, pwd, *phone, *bio, *country, *start_date)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	c := storage.WithActor(context.Background(), *username)
+
+	if users, err := store.GetUsers(c, map[string]string{"username": *username}); err != nil || len(users) > 0 {
+		if err == nil {
+			err = fmt.Errorf("user %s already exists", *username)
+		}
+		return err
+	}
+	if err := store.CreateUser(c, *user); err != nil {
+		return err
+	}
+	if *verified {
+		if _, err := store.VerifyUserEmail(c, *username); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("created user %s\n", *username)
+	return nil
+}
+
+func runResetPassword(args []string) error {
+	fs := newFlagSet("reset-password")
+	username := fs.String("username", "", "user whose password is replaced")
+	password := fs.String("password", "", "new password, read from stdin when empty")
+	cfg, err := parseWithConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := required(fs, "username"); err != nil {
+		return err
+	}
+
+	pwd, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	hash, err := data.HashPassword(pwd)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	if err := store.SetUserPassword(context.Background(), *username, hash); err != nil {
+		return err
+	}
+
+	fmt.Printf("password of %s was reset, their sessions were ended\n", *username)
+	return nil
+}
+
+func runVerifyEmail(args []string) error {
+	fs := newFlagSet("verify-email")
+	username := fs.String("username", "", "user whose email is verified")
+	cfg, err := parseWithConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := required(fs, "username"); err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	users, err := store.VerifyUserEmail(context.Background(), *username)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("user %s not found", *username)
+	}
+
+	fmt.Printf("verified %s\n", users[0].Email)
+	return nil
+}
+
+func runExportUser(args []string) error {
+	fs := newFlagSet("export-user")
+	username := fs.String("username", "", "user to export")
+	out := fs.String("out", "", "archive to write, defaults to <username>.zip")
+	cfg, err := parseWithConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := required(fs, "username"); err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = *username + ".zip"
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := storage.ExportAccount(context.Background(), store, *username, cfg.UserImagesDir(), f); err != nil {
+		f.Close()
+		os.Remove(*out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s\n", *out)
+	return nil
+}
+
+func runPurgeSessions(args []string) error {
+	fs := newFlagSet("purge-sessions")
+	all := fs.Bool("all", false, "also delete sessions that are still valid, signing everyone out")
+	cfg, err := parseWithConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	before := time.Now()
+	if *all {
+		before = time.Now().AddDate(100, 0, 0)
+	}
+
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+	purged, err := store.PurgeSessions(context.Background(), before)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("deleted %d sessions\n", purged)
+	return nil
+}
+
+func runRender(args []string) error {
+	fs := newFlagSet("render")
+	username := fs.String("username", "", "user whose resume is rendered")
+	input := fs.String("input", "", "resume json file rendered without the database, - for stdin")
+	theme := fs.String("theme", render.DefaultTheme, "one of "+strings.Join(render.Themes(), ", "))
+	format := fs.String("format", "", "one of "+strings.Join(render.Formats, ", ")+", guessed from -out when empty")
+	out := fs.String("out", "-", "file to write, - for stdout")
+	// the config is only loaded when rendering from the database
+	loader := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*username == "") == (*input == "") {
+		return errors.New("give either -username or -input")
+	}
+
+	if *input != "" {
+		resume, err := readResumeFile(*input)
+		if err != nil {
+			return err
+		}
+		return writeRendered(context.Background(), resume, *theme, *format, *out)
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return err
+	}
+	store, err := openStorage(cfg)
+	if err != nil {
+		return err
+	}
+
+	// traces go to stderr so they do not mix with a resume written to stdout
+	stop_tracing, err := startTracing(cfg, os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer stop_tracing()
+
+	ctx, span := tracing.Start(context.Background(), "render-command", tracing.String("username", *username))
+	defer span.End()
+
+	resume, err := storage.LoadResume(ctx, store, *username)
+	if err != nil {
+		return err
+	}
+
+	return writeRendered(ctx, *resume, *theme, *format, *out)
+}
+
+// reads a resume json file, - reads stdin
+func readResumeFile(path string) (data.Resume, error) {
+	if path == "-" {
+		return render.ReadResume(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return data.Resume{}, err
+	}
+	defer f.Close()
+	return render.ReadResume(f)
+}
+
+// renders into out, removing a partly written file when rendering fails
+func writeRendered(ctx context.Context, resume data.Resume, theme, format, out string) error {
+	if format == "" {
+		format = render.FormatFromPath(out)
+	}
+	if format == "" {
+		format = "html"
+	}
+
+	if out == "-" {
+		return render.RenderContext(ctx, os.Stdout, resume, theme, format)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := render.RenderContext(ctx, f, resume, theme, format); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	return f.Close()
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: config print [flags]")
+	}
+
+	cfg, err := parseWithConfig(newFlagSet("config print"), args[1:])
+	if cfg != nil {
+		cfg.Print(os.Stdout)
+	}
+	return err
+}
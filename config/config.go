@@ -0,0 +1,414 @@
+// Package config loads the settings of the server and cli.
+//
+// Every setting has a default and is overridden, in order, by a json config file,
+// the environment (a .env file is read when present) and command line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/mailer"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+// env names the variable, key the config file entry and flag the command line flag.
+// secret values are redacted when printed
+type Config struct {
+	Port            string        `env:"PORT" key:"port" flag:"port" help:"port the web server listens on"`
+	DatabaseURL     string        `env:"DATABASE_URL" key:"database_url" flag:"database-url" secret:"true" help:"postgres url or key=value connection string, built from POSTGRES_* when empty"`
+	QueryTimeout    time.Duration `env:"DB_QUERY_TIMEOUT" key:"db_query_timeout" flag:"db-query-timeout" help:"longest a single database call may run, 0 for no limit"`
+	MediaDir        string        `env:"MEDIA_DIR" key:"media_dir" flag:"media-dir" help:"directory uploads are stored in and served from at /media/"`
+	TemplateDir     string        `env:"TEMPLATE_DIR" key:"template_dir" flag:"template-dir" help:"directory of the html templates"`
+	SessionDuration time.Duration `env:"SESSION_DURATION" key:"session_duration" flag:"session-duration" help:"how long a sign in lasts"`
+	CookieSecure    bool          `env:"COOKIE_SECURE" key:"cookie_secure" flag:"cookie-secure" help:"only send the session cookie over https"`
+	CacheSize       int           `env:"CACHE_SIZE" key:"cache_size" flag:"cache-size" help:"storage reads kept in memory, 0 disables the cache"`
+	CacheTTL        time.Duration `env:"CACHE_TTL" key:"cache_ttl" flag:"cache-ttl" help:"how long cached reads are served"`
+	TrashRetention  time.Duration `env:"TRASH_RETENTION" key:"trash_retention" flag:"trash-retention" help:"how long deleted records stay in the trash"`
+	LogFormat       string        `env:"LOG_FORMAT" key:"log_format" flag:"log-format" help:"text or json"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" key:"shutdown_timeout" flag:"shutdown-timeout" help:"how long in-flight requests get to finish when the server stops"`
+	TraceExporter   string        `env:"TRACE_EXPORTER" key:"trace_exporter" flag:"trace-exporter" help:"where request traces are written: none, stdout or otlp-file"`
+	TraceFile       string        `env:"TRACE_FILE" key:"trace_file" flag:"trace-file" help:"file the otlp-file exporter appends traces to"`
+	BaseURL         string        `env:"BASE_URL" key:"base_url" flag:"base-url" help:"address the site is reached at, links in emails start with it"`
+	MailTransport   string        `env:"MAIL_TRANSPORT" key:"mail_transport" flag:"mail-transport" help:"how emails are sent: stdout, file or smtp"`
+	MailFrom        string        `env:"MAIL_FROM" key:"mail_from" flag:"mail-from" help:"sender of emails, an address or Name <address>"`
+	MailFile        string        `env:"MAIL_FILE" key:"mail_file" flag:"mail-file" help:"file the file transport appends emails to"`
+	SMTPAddr        string        `env:"SMTP_ADDR" key:"smtp_addr" flag:"smtp-addr" help:"host:port of the smtp server"`
+	SMTPUsername    string        `env:"SMTP_USERNAME" key:"smtp_username" flag:"smtp-username" help:"smtp user, no authentication when empty"`
+	SMTPPassword    string        `env:"SMTP_PASSWORD" key:"smtp_password" flag:"smtp-password" secret:"true" help:"smtp password"`
+}
+
+func Default() Config {
+	return Config{
+		Port:            "8080",
+		QueryTimeout:    storage.DefaultQueryTimeout,
+		MediaDir:        "media",
+		TemplateDir:     "Templates",
+		SessionDuration: data.Session_duration,
+		CookieSecure:    true,
+		CacheSize:       storage.DefaultCacheSize,
+		CacheTTL:        storage.DefaultCacheTTL,
+		TrashRetention:  data.Trash_retention,
+		LogFormat:       "text",
+		ShutdownTimeout: 15 * time.Second,
+		TraceExporter:   "none",
+		TraceFile:       "traces.jsonl",
+		BaseURL:         "http://localhost:8080",
+		MailTransport:   "stdout",
+		MailFrom:        "Resume Generator <no-reply@localhost>",
+		MailFile:        "mail.log",
+	}
+}
+
+// a logger writing to stdout in the configured format
+func (c *Config) Logger() *slog.Logger {
+	if c.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stdout, nil))
+}
+
+// the configured trace exporter, nil when tracing is off.
+// the stdout exporter writes to console
+func (c *Config) SpanExporter(console io.Writer) (tracing.Exporter, error) {
+	switch c.TraceExporter {
+	case "stdout":
+		return tracing.NewTextExporter(console), nil
+	case "otlp-file":
+		return tracing.OpenOTLPFile(c.TraceFile)
+	}
+	return nil, nil
+}
+
+// the configured mail transport, the stdout transport writes to console
+func (c *Config) Mailer(console io.Writer) mailer.Mailer {
+	switch c.MailTransport {
+	case "smtp":
+		return &mailer.SMTP{Addr: c.SMTPAddr, Username: c.SMTPUsername, Password: c.SMTPPassword, From: c.MailFrom}
+	case "file":
+		return mailer.NewFile(c.MailFile, c.MailFrom)
+	}
+	return mailer.NewWriter(console, c.MailFrom)
+}
+
+// where uploaded user images are written
+func (c *Config) UserImagesDir() string {
+	return filepath.Join(c.MediaDir, "users", "images")
+}
+
+// a field of Config and its tags
+type setting struct {
+	index  int
+	env    string
+	key    string
+	flag   string
+	help   string
+	secret bool
+}
+
+func settings() []setting {
+	t := reflect.TypeOf(Config{})
+
+	list := []setting{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		list = append(list, setting{
+			index:  i,
+			env:    f.Tag.Get("env"),
+			key:    f.Tag.Get("key"),
+			flag:   f.Tag.Get("flag"),
+			help:   f.Tag.Get("help"),
+			secret: f.Tag.Get("secret") == "true",
+		})
+	}
+	return list
+}
+
+func (c *Config) set(s setting, value string) error {
+	v := reflect.ValueOf(c).Elem().Field(s.index)
+
+	var err error
+	switch v.Interface().(type) {
+	case time.Duration:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			v.SetInt(int64(d))
+		}
+	case int:
+		var n int
+		if n, err = strconv.Atoi(value); err == nil {
+			v.SetInt(int64(n))
+		}
+	case bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			v.SetBool(b)
+		}
+	default:
+		v.SetString(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", s.env, value)
+	}
+	return nil
+}
+
+func (c *Config) get(s setting) string {
+	return fmt.Sprint(reflect.ValueOf(c).Elem().Field(s.index).Interface())
+}
+
+// Loader collects the flags and config file given on the command line
+type Loader struct {
+	file  string
+	flags map[string]string // env name to value
+	order []string
+}
+
+// RegisterFlags adds -config and a flag per setting to fs, call Load after parsing
+func RegisterFlags(fs *flag.FlagSet) *Loader {
+	l := &Loader{flags: map[string]string{}}
+	fs.StringVar(&l.file, "config", "", "json config file, defaults to CONFIG_FILE")
+
+	for _, s := range settings() {
+		s := s
+		record := func(value string) error {
+			if _, ok := l.flags[s.env]; !ok {
+				l.order = append(l.order, s.env)
+			}
+			l.flags[s.env] = value
+			return nil
+		}
+
+		usage := fmt.Sprintf("%s (%s)", s.help, s.env)
+		// bool flags may be given without a value e.g -cookie-secure
+		if _, ok := reflect.ValueOf(Config{}).Field(s.index).Interface().(bool); ok {
+			fs.BoolFunc(s.flag, usage, record)
+			continue
+		}
+		fs.Func(s.flag, usage, record)
+	}
+	return l
+}
+
+// Load resolves every setting and validates the result.
+// the config is returned with validation errors so it can still be printed
+func (l *Loader) Load() (*Config, error) {
+	// .env is optional, variables that are already set win
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	c := Default()
+
+	file := l.file
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings() {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := c.set(s, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// older deployments configure postgres with separate variables
+	if c.DatabaseURL == "" && os.Getenv("POSTGRES_HOST") != "" {
+		c.DatabaseURL = storage.PostgresDSNFromEnv()
+	}
+
+	by_env := map[string]setting{}
+	for _, s := range settings() {
+		by_env[s.env] = s
+	}
+	for _, env := range l.order {
+		if err := c.set(by_env[env], l.flags[env]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, c.Validate()
+}
+
+// reads a json object keyed by the settings key tags
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// numbers are kept as written, as float64 large ones would print as 1e+06
+	values := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("%s: unexpected data after the settings", path)
+	}
+
+	by_key := map[string]setting{}
+	for _, s := range settings() {
+		by_key[s.key] = s
+	}
+	for key, value := range values {
+		s, ok := by_key[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if err := c.set(s, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	problems := []error{}
+	invalid := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("PORT: %q is not a port number", c.Port)
+	}
+	if err := validateDSN(c.DatabaseURL); err != nil {
+		invalid("DATABASE_URL: %v", err)
+	}
+	if c.QueryTimeout < 0 {
+		invalid("DB_QUERY_TIMEOUT: can not be negative")
+	}
+	if info, err := os.Stat(c.MediaDir); err != nil || !info.IsDir() {
+		invalid("MEDIA_DIR: %q is not a directory", c.MediaDir)
+	}
+	if info, err := os.Stat(filepath.Join(c.TemplateDir, "utils", "layout.html")); err != nil || info.IsDir() {
+		invalid("TEMPLATE_DIR: %q does not contain utils/layout.html", c.TemplateDir)
+	}
+	if c.SessionDuration < time.Minute {
+		invalid("SESSION_DURATION: must be at least a minute")
+	}
+	if c.CacheSize < 0 {
+		invalid("CACHE_SIZE: can not be negative")
+	}
+	if c.CacheSize > 0 && c.CacheTTL <= 0 {
+		invalid("CACHE_TTL: must be positive when the cache is enabled")
+	}
+	if c.TrashRetention <= 0 {
+		invalid("TRASH_RETENTION: must be positive")
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		invalid("LOG_FORMAT: %q is not text or json", c.LogFormat)
+	}
+	if c.ShutdownTimeout <= 0 {
+		invalid("SHUTDOWN_TIMEOUT: must be positive")
+	}
+	switch c.TraceExporter {
+	case "none", "stdout":
+	case "otlp-file":
+		if c.TraceFile == "" {
+			invalid("TRACE_FILE: must be set for the otlp-file exporter")
+		}
+	default:
+		invalid("TRACE_EXPORTER: %q is not none, stdout or otlp-file", c.TraceExporter)
+	}
+
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		invalid("BASE_URL: %q is not an http or https url", c.BaseURL)
+	}
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		invalid("MAIL_FROM: %q is not an email address", c.MailFrom)
+	}
+	switch c.MailTransport {
+	case "stdout":
+	case "file":
+		if c.MailFile == "" {
+			invalid("MAIL_FILE: must be set for the file transport")
+		}
+	case "smtp":
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			invalid("SMTP_ADDR: %q is not a host:port address", c.SMTPAddr)
+		}
+	default:
+		invalid("MAIL_TRANSPORT: %q is not stdout, file or smtp", c.MailTransport)
+	}
+
+	return errors.Join(problems...)
+}
+
+func validateDSN(dsn string) error {
+	if dsn == "" {
+		return errors.New("not set")
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return errors.New("not a valid url")
+		}
+		if u.Host == "" {
+			return errors.New("url has no host")
+		}
+		return nil
+	}
+
+	for _, pair := range strings.Fields(dsn) {
+		if !strings.Contains(pair, "=") {
+			return fmt.Errorf("%q is not a key=value pair", pair)
+		}
+	}
+	return nil
+}
+
+// Print writes the settings in .env format with secrets redacted
+func (c *Config) Print(w io.Writer) {
+	for _, s := range settings() {
+		value := c.get(s)
+		if s.secret {
+			value = redact(value)
+		}
+		fmt.Fprintf(w, "%s=%s\n", s.env, value)
+	}
+}
+
+var passwordPair = regexp.MustCompile(`(password=)\S*`)
+
+// hides the password of a connection string, other secrets entirely
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		return u.Redacted()
+	}
+	if strings.Contains(value, "password=") {
+		return passwordPair.ReplaceAllString(value, "${1}xxxxx")
+	}
+	return "xxxxx"
+}
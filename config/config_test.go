@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a directory with the media and template dirs validation expects
+func testDirs(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	media := filepath.Join(dir, "media")
+	templates := filepath.Join(dir, "Templates")
+	os.MkdirAll(media, 0755)
+	os.MkdirAll(filepath.Join(templates, "utils"), 0755)
+	os.WriteFile(filepath.Join(templates, "utils", "layout.html"), []byte(""), 0644)
+	return media, templates
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	media, templates := testDirs(t)
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(file, []byte(`{"port": 9000, "session_duration": "1h", "cache_size": 10, "media_dir": "`+media+`", "template_dir": "`+templates+`"}`), 0644)
+
+	t.Setenv("DATABASE_URL", "postgres://app:secret@db:5432/resumes")
+	t.Setenv("SESSION_DURATION", "2h")
+	t.Setenv("CACHE_SIZE", "20")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := RegisterFlags(fs)
+	if err := fs.Parse([]string{"-config", file, "-cache-size", "30", "-cookie-secure=false"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// file over defaults, env over file, flags over env
+	if cfg.Port != "9000" || cfg.SessionDuration != 2*time.Hour || cfg.CacheSize != 30 || cfg.CookieSecure {
+		t.Errorf("Got %+v, Expected file, env and flag values applied in order", cfg)
+	}
+	if cfg.QueryTimeout != Default().QueryTimeout {
+		t.Errorf("Got %v, Expected the default query timeout", cfg.QueryTimeout)
+	}
+
+	var out bytes.Buffer
+	cfg.Print(&out)
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), "DATABASE_URL=postgres://app:xxxxx@db:5432/resumes") {
+		t.Errorf("Got %s, Expected the database password redacted", out.String())
+	}
+}
+
+func TestLoadFileNumbers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(file, []byte(`{"port": 8080, "cache_size": 1000000}`), 0644)
+
+	cfg := Default()
+	if err := cfg.loadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "8080" || cfg.CacheSize != 1000000 {
+		t.Errorf("Got port %s cache size %d, Expected the numbers as written", cfg.Port, cfg.CacheSize)
+	}
+
+	os.WriteFile(file, []byte(`{"port": 8080} {}`), 0644)
+	if err := cfg.loadFile(file); err == nil {
+		t.Errorf("Expected data after the settings to be rejected")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Port = "http"
+	cfg.DatabaseURL = "host=db password"
+	cfg.MediaDir = filepath.Join(t.TempDir(), "missing")
+	cfg.TemplateDir = t.TempDir()
+	cfg.SessionDuration = time.Second
+	cfg.CacheTTL = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, name := range []string{"PORT", "DATABASE_URL", "MEDIA_DIR", "TEMPLATE_DIR", "SESSION_DURATION", "CACHE_TTL"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("Got %v, Expected %s to be reported", err, name)
+		}
+	}
+
+	media, templates := testDirs(t)
+	cfg = Default()
+	cfg.DatabaseURL = "host=db port=5432 user=app password=secret dbname=resumes"
+	cfg.MediaDir = media
+	cfg.TemplateDir = templates
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Got %v, Expected the defaults with a database to be valid", err)
+	}
+	if redact(cfg.DatabaseURL) != "host=db port=5432 user=app password=xxxxx dbname=resumes" {
+		t.Errorf("Got %s, Expected the password redacted", redact(cfg.DatabaseURL))
+	}
+}
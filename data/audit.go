@@ -0,0 +1,16 @@
+package data
+
+import "time"
+
+// a single change to a users resume data
+type AuditEvent struct {
+	Id         int       `json:"id"`
+	Actor      string    `json:"actor"` // username that made the change or "system"
+	Owner      string    `json:"owner"` // username whose data changed
+	Entity     string    `json:"entity"`
+	Entity_id  int       `json:"entity_id"`
+	Action     string    `json:"action"`
+	Before     string    `json:"before"` // json, empty for creates
+	After      string    `json:"after"`  // json, empty for deletes
+	Created_on time.Time `json:"created_on"`
+}
@@ -2,10 +2,16 @@ package data
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
 	"time"
 )
 
+// default for config SESSION_DURATION
 const Session_duration = time.Hour * 24 * 3 // 3 days
 
 type Session struct {
@@ -16,7 +22,7 @@ type Session struct {
 	Expired    bool
 }
 
-func (u User) NewSession() (*Session, error) {
+func (u User) NewSession(duration time.Duration) (*Session, error) {
 	key, err := generateSessionKey(30)
 	if err != nil {
 		return nil, err
@@ -25,7 +31,7 @@ func (u User) NewSession() (*Session, error) {
 		Id:         "",
 		User:       u,
 		Key:        key,
-		Expires_on: time.Now().Add(Session_duration),
+		Expires_on: time.Now().Add(duration),
 		Expired:    false,
 	}, nil
 }
@@ -43,3 +49,121 @@ func generateSessionKey(length int) (string, error) {
 
 	return sessionKey, nil
 }
+
+// how long deleted records stay in the trash before being purged, default for config TRASH_RETENTION
+const Trash_retention = time.Hour * 24 * 30 // 30 days
+
+// personal access tokens for the json api. the secret is shown once when the
+// token is created, only its hash is stored
+type ApiToken struct {
+	Id         int
+	User       User
+	Name       string
+	Prefix     string    // start of the secret, shown to tell tokens apart
+	Hash       string    // see HashApiToken
+	Scopes     []string  // e.g "projects:write", see Token_entities
+	Expires_on time.Time // zero for tokens that do not expire
+	Last_used  time.Time // zero until the token is first used
+	Created_on time.Time
+}
+
+// what a token can be scoped to, each with read or write access
+var Token_entities = []string{"user", "profile", "projects", "employments", "hobbies", "stacks"}
+
+// prefix of every token secret, makes leaked tokens easy to search for
+const Token_prefix = "rg_"
+
+// creates a token for the user, returning it along with the secret to give to the user
+func (u User) NewApiToken(name string, scopes []string, expires_on time.Time) (*ApiToken, string, error) {
+	for _, scope := range scopes {
+		if !ValidTokenScope(scope) {
+			return nil, "", errors.New("unknown token scope " + scope)
+		}
+	}
+
+	key, err := generateSessionKey(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := Token_prefix + strings.TrimRight(key, "=")
+
+	return &ApiToken{
+		User:       u,
+		Name:       name,
+		Prefix:     secret[:len(Token_prefix)+6],
+		Hash:       HashApiToken(secret),
+		Scopes:     scopes,
+		Expires_on: expires_on,
+	}, secret, nil
+}
+
+// tokens are long and random so a fast hash is enough, unlike passwords
+func HashApiToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// scopes have the form entity:read or entity:write
+func ValidTokenScope(scope string) bool {
+	entity, access, _ := strings.Cut(scope, ":")
+	return slices.Contains(Token_entities, entity) && (access == "read" || access == "write")
+}
+
+func (t ApiToken) Expired(now time.Time) bool {
+	return !t.Expires_on.IsZero() && !now.Before(t.Expires_on)
+}
+
+// write access includes read access
+func (t ApiToken) Allows(entity string, write bool) bool {
+	if slices.Contains(t.Scopes, entity+":write") {
+		return true
+	}
+	return !write && slices.Contains(t.Scopes, entity+":read")
+}
+
+// what single use tokens sent by email are for
+const (
+	Email_token_verify = "verify_email"
+	Email_token_reset  = "reset_password"
+)
+
+// how long an emailed verification link works
+const Verify_email_duration = time.Hour * 48
+
+// how long an emailed password reset link works
+const Reset_password_duration = time.Hour
+
+// single use tokens sent to users by email, e.g in verification links. like api
+// tokens only the hash of the secret is stored
+type EmailToken struct {
+	Id         int
+	User       User
+	Purpose    string // Email_token_verify or Email_token_reset
+	Hash       string // see HashEmailToken
+	Expires_on time.Time
+	Used_on    time.Time // zero until used
+	Created_on time.Time
+}
+
+// creates a token for the user valid for duration from now, returning it along
+// with the secret to send to the user
+func (u User) NewEmailToken(purpose string, duration time.Duration, now time.Time) (*EmailToken, string, error) {
+	key, err := generateSessionKey(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := strings.TrimRight(key, "=")
+
+	return &EmailToken{
+		User:       u,
+		Purpose:    purpose,
+		Hash:       HashEmailToken(secret),
+		Expires_on: now.Add(duration),
+		Created_on: now,
+	}, secret, nil
+}
+
+// hashed like api tokens, they are as long and random
+func HashEmailToken(secret string) string {
+	return HashApiToken(secret)
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// the data model a resume is rendered from
+type Resume struct {
+	User        User         `json:"user"`
+	Profile     *Profile     `json:"profile"`
+	Projects    []Project    `json:"projects"`
+	Employments []Employment `json:"employments"`
+	Hobbies     []Hobby      `json:"hobbies"`
+	Stacks      []TechStack  `json:"stacks"`
+}
+
+// a frozen copy of a users resume data
+type ResumeSnapshot struct {
+	Id         int       `json:"id"`
+	User       User      `json:"user"`
+	Label      string    `json:"label"`
+	Resume     Resume    `json:"resume"`
+	Created_on time.Time `json:"created_on"`
+}
+
+// a single field that differs between two resumes.
+// Path identifies the field e.g "projects[3].name"
+type FieldChange struct {
+	Path   string `json:"path"`
+	Before string `json:"before"` // empty when the field was added
+	After  string `json:"after"`  // empty when the field was removed
+}
+
+// returns the fields that differ between a and b ordered by path.
+// list items are matched by id so reordering is not reported as a change
+func DiffResumes(a, b Resume) ([]FieldChange, error) {
+	before, err := flattenResume(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := flattenResume(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	for path, value := range before {
+		if after_value, ok := after[path]; !ok || after_value != value {
+			changes = append(changes, FieldChange{Path: path, Before: value, After: after[path]})
+		}
+	}
+	for path, value := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, FieldChange{Path: path, After: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+func flattenResume(r Resume) (map[string]string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	flattenValue("", v, fields)
+	return fields, nil
+}
+
+// bookkeeping fields that do not change what a resume shows
+var diffIgnored = map[string]bool{
+	"created_on":   true,
+	"updated_on":   true,
+	"last_sign_in": true,
+	"views":        true,
+	"version":      true,
+}
+
+func flattenValue(path string, v any, fields map[string]string) {
+	switch e := v.(type) {
+	case map[string]any:
+		for k, val := range e {
+			// owner records are repeated on every item
+			if (k == "user" && path != "") || diffIgnored[k] {
+				continue
+			}
+			flattenValue(joinPath(path, k), val, fields)
+		}
+	case []any:
+		for i, val := range e {
+			key := fmt.Sprintf("%d", i)
+			if item, ok := val.(map[string]any); ok {
+				if id, ok := item["id"]; ok {
+					key = fmt.Sprint(id)
+				}
+			}
+			flattenValue(fmt.Sprintf("%s[%s]", path, key), val, fields)
+		}
+	case nil:
+		// absent values compare equal to missing fields
+	default:
+		fields[path] = fmt.Sprint(e)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// markers wrapped around matched terms in search snippets
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// a single ranked search hit
+type SearchResult struct {
+	Kind     string  `json:"kind"` // user, profile, project, employment, stack
+	Id       int     `json:"id"`
+	Username string  `json:"username"`
+	Title    string  `json:"title"`
+	Snippet  string  `json:"snippet"`
+	Rank     float64 `json:"rank"`
+}
+
+// returns the snippet escaped for html with matched terms wrapped in <mark>
+func (r SearchResult) Highlighted() template.HTML {
+	snippet := html.EscapeString(r.Snippet)
+	snippet = strings.ReplaceAll(snippet, HighlightStart, "<mark>")
+	snippet = strings.ReplaceAll(snippet, HighlightEnd, "</mark>")
+	return template.HTML(snippet)
+}
+
+// returns the snippet without highlight markers
+func (r SearchResult) PlainSnippet() string {
+	return strings.NewReplacer(HighlightStart, "", HighlightEnd, "").Replace(r.Snippet)
+}
@@ -32,6 +32,8 @@ type User struct {
 	Updated_on     time.Time `json:"updated_on"`
 	Last_sign_in   time.Time `json:"last_sign_in"`
 	Email_verified bool      `json:"email_verified"`
+
+	Version int `json:"version"` // incremented on every update, see storage.ConflictError
 }
 
 func (u User) String() string {
@@ -109,11 +111,13 @@ func (u *User) ValidateUser() error {
 
 // user Profile
 type Profile struct {
+	Id    int    `json:"id"`
 	User  User   `json:"user"`
 	Role  string `json:"role"`
 	About string `json:"about"`
 
-	Views int `json:"views"`
+	Views   int `json:"views"`
+	Version int `json:"version"`
 }
 
 func (u User) NewProfile(role, about string) (*Profile, error) {
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// events a webhook can subscribe to
+const (
+	Event_resume_published = "resume.published" // a snapshot was taken
+	Event_project_added    = "project.added"
+	Event_profile_viewed   = "profile.viewed" // read by someone other than its owner
+)
+
+var Webhook_events = []string{Event_resume_published, Event_project_added, Event_profile_viewed}
+
+// a url that receives signed json payloads when the users events happen
+type Webhook struct {
+	Id         int
+	User       User
+	Url        string
+	Secret     string // key of the payload signature, shown once when the webhook is created
+	Events     []string
+	Created_on time.Time
+}
+
+// states of a WebhookDelivery
+const (
+	Delivery_pending   = "pending"
+	Delivery_delivered = "delivered"
+	Delivery_failed    = "failed" // gave up after the last attempt
+)
+
+// a single payload sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	Id            int
+	Webhook_id    int
+	Event         string
+	Payload       string // json body, kept so it can be sent again
+	Status        string
+	Attempts      int
+	Response_code int    // of the last attempt, 0 when no response was received
+	Error         string // why the last attempt failed
+	Next_attempt  time.Time
+	Created_on    time.Time
+	Delivered_on  time.Time
+}
+
+func (u User) NewWebhook(address string, events []string) (*Webhook, error) {
+	target, err := url.Parse(address)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, errors.New("webhook url must be an http or https url")
+	}
+	if len(events) == 0 {
+		return nil, errors.New("choose at least one event")
+	}
+	for _, event := range events {
+		if !slices.Contains(Webhook_events, event) {
+			return nil, errors.New("unknown webhook event " + event)
+		}
+	}
+
+	secret, err := generateSessionKey(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		User:   u,
+		Url:    address,
+		Secret: secret,
+		Events: events,
+	}, nil
+}
+
+func (w Webhook) Subscribed(event string) bool {
+	return slices.Contains(w.Events, event)
+}
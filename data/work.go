@@ -6,9 +6,10 @@ import (
 
 // represents programming languages and tools
 type TechStack struct {
-	Id   int    `json:"id"`
-	User User   `json:"user"`
-	Name string `json:"name"`
+	Id      int    `json:"id"`
+	User    User   `json:"user"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
 }
 
 func (u User) NewTechStack(n string) *TechStack {
@@ -37,6 +38,7 @@ type Project struct {
 
 	Created_on time.Time `json:"created_on"`
 	Updated_on time.Time `json:"updated_on"`
+	Version    int       `json:"version"`
 }
 
 func (u User) NewProject(name, status, github, prod_link, description string, start, end string) (*Project, error) {
@@ -95,6 +97,7 @@ type Employment struct {
 
 	Created_on time.Time `json:"created_on"`
 	Updated_on time.Time `json:"updated_on"`
+	Version    int       `json:"version"`
 }
 
 func (e Employment) String() string {
@@ -138,9 +141,10 @@ func (e *Employment) AddStack(s TechStack) error {
 }
 
 type Hobby struct {
-	Id   int    `json:"id"`
-	User User   `json:"user"`
-	Name string `json:"name"`
+	Id      int    `json:"id"`
+	User    User   `json:"user"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
 }
 
 func (u User) NewHobby(n string) *Hobby {
@@ -153,3 +157,11 @@ func (u User) NewHobby(n string) *Hobby {
 func (h Hobby) String() string {
 	return h.Name
 }
+
+// a soft deleted record waiting to be restored or purged
+type TrashItem struct {
+	Kind       string    `json:"kind"` // user, project, employment, hobby, stack
+	Id         int       `json:"id"`
+	Name       string    `json:"name"`
+	Deleted_on time.Time `json:"deleted_on"`
+}
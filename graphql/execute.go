@@ -0,0 +1,403 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Error in a query or from a resolver, as returned in the errors of a Response
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// of the field that failed, response keys and list indexes
+	Path []any `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Request as sent by clients, in the body of a POST or the query of a GET
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	// accepted because clients send them, no extensions are supported
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Response to a request. Data is left out when the request is invalid and
+// null when a non-null field of the query type failed
+type Response struct {
+	Data   any      `json:"data"`
+	Errors []*Error `json:"errors,omitempty"`
+
+	executed bool
+}
+
+// Executed is false when the request was rejected before any field was resolved
+func (r *Response) Executed() bool {
+	return r.executed
+}
+
+func (r *Response) MarshalJSON() ([]byte, error) {
+	type response Response
+	if r.executed {
+		return json.Marshal((*response)(r))
+	}
+	return json.Marshal(struct {
+		Errors []*Error `json:"errors"`
+	}{r.Errors})
+}
+
+// Execute validates the request and resolves it starting with root as the
+// source of the fields of the query type. Errors of resolvers are returned
+// with the path of their field, which is null in the data
+func (s *Schema) Execute(ctx context.Context, req Request, root any) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{err}}
+	}
+
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{err}}
+	}
+	if op.kind != "query" {
+		return &Response{Errors: []*Error{{
+			Message:   fmt.Sprintf("Operation %q is not supported, the api is read-only.", op.kind),
+			Locations: []Location{op.loc},
+		}}}
+	}
+
+	if errs := s.validate(doc, op); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	variables, errs := coerceVariables(op, req.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{schema: s, doc: doc, variables: variables}
+	data, ok := e.selections(ctx, s.Query, root, op.selections, nil)
+	res := &Response{Errors: e.errors, executed: true}
+	if ok {
+		res.Data = data
+	}
+	return res
+}
+
+func selectOperation(doc *document, name string) (*operation, *Error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+func coerceVariables(op *operation, provided map[string]any) (map[string]any, []*Error) {
+	variables := map[string]any{}
+	errs := []*Error{}
+	for _, def := range op.variables {
+		v, ok := provided[def.name]
+		if !ok && def.def != nil {
+			// defaults were checked against the type in validation
+			variables[def.name], _ = coerceLiteral(def.typ, def.def, nil)
+			continue
+		}
+		if !ok {
+			if def.typ.nonNull {
+				errs = append(errs, &Error{
+					Message:   fmt.Sprintf("Variable \"$%s\" of required type %q was not provided.", def.name, def.typ),
+					Locations: []Location{def.loc},
+				})
+			}
+			continue
+		}
+
+		coerced, ok := coerceInput(def.typ, v)
+		if !ok {
+			errs = append(errs, &Error{
+				Message:   fmt.Sprintf("Variable \"$%s\" got invalid value %s, expected %q.", def.name, jsonText(v), def.typ),
+				Locations: []Location{def.loc},
+			})
+			continue
+		}
+		variables[def.name] = coerced
+	}
+	return variables, errs
+}
+
+func jsonText(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// a field selected under a response key, with the fields merged into it
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// the fields selected on an object, in the order they are first selected. fragments
+// are only expanded when their type condition matches, directives are evaluated when
+// variables are given
+func (s *Schema) collectFields(doc *document, object *Object, selections []selection, variables map[string]any, groups []*fieldGroup, visited map[string]bool) []*fieldGroup {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if !included(sel.directives, variables) {
+				continue
+			}
+			found := false
+			for _, g := range groups {
+				if g.key == sel.key() {
+					g.fields = append(g.fields, sel)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, &fieldGroup{key: sel.key(), fields: []*field{sel}})
+			}
+		case *inlineFragment:
+			if !included(sel.directives, variables) || (sel.typeCondition != "" && sel.typeCondition != object.Name) {
+				continue
+			}
+			groups = s.collectFields(doc, object, sel.selections, variables, groups, visited)
+		case *fragmentSpread:
+			f := doc.fragments[sel.name]
+			if visited[sel.name] || f == nil || !included(sel.directives, variables) || f.typeCondition != object.Name {
+				continue
+			}
+			visited[sel.name] = true
+			groups = s.collectFields(doc, object, f.selections, variables, groups, visited)
+		}
+	}
+	return groups
+}
+
+// evaluates @skip and @include, without variables every selection is included
+func included(directives []*directive, variables map[string]any) bool {
+	if variables == nil {
+		return true
+	}
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		condition := false
+		for _, arg := range d.arguments {
+			if arg.name == "if" {
+				v, _ := coerceLiteral(booleanType, arg.value, variables)
+				condition, _ = v.(bool)
+			}
+		}
+		if condition == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+var booleanType = &typeRef{name: "Boolean", nonNull: true}
+
+// the sub selections of every field in a group, merged
+func subselections(fields []*field) []selection {
+	if len(fields) == 1 {
+		return fields[0].selections
+	}
+	merged := []selection{}
+	for _, f := range fields {
+		merged = append(merged, f.selections...)
+	}
+	return merged
+}
+
+type executor struct {
+	schema    *Schema
+	doc       *document
+	variables map[string]any
+	errors    []*Error
+}
+
+func (e *executor) fail(f *field, path []any, format string, args ...any) {
+	e.errors = append(e.errors, &Error{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{f.loc},
+		Path:      append([]any{}, path...),
+	})
+}
+
+// resolves the selections on source, false when a non-null field failed and
+// the object has to be null
+func (e *executor) selections(ctx context.Context, object *Object, source any, selections []selection, path []any) (*orderedMap, bool) {
+	result := &orderedMap{values: map[string]any{}}
+	groups := e.schema.collectFields(e.doc, object, selections, e.variables, nil, map[string]bool{})
+
+	for _, g := range groups {
+		f := g.fields[0]
+		field_path := append(path, g.key)
+
+		if f.name == "__typename" {
+			result.set(g.key, object.Name)
+			continue
+		}
+
+		def := object.Fields[f.name]
+		value, err := e.resolve(ctx, object, def, f, source)
+		if err != nil {
+			e.fail(f, field_path, "%s", err.Error())
+			if def.typ.nonNull {
+				return nil, false
+			}
+			result.set(g.key, nil)
+			continue
+		}
+
+		completed, ok := e.complete(ctx, def.typ, g.fields, value, field_path)
+		if !ok {
+			return nil, false
+		}
+		result.set(g.key, completed)
+	}
+	return result, true
+}
+
+func (e *executor) resolve(ctx context.Context, object *Object, def *Field, f *field, source any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	args := map[string]any{}
+	for _, arg := range f.arguments {
+		v, ok := coerceLiteral(def.args[arg.name], arg.value, e.variables)
+		if !ok {
+			return nil, fmt.Errorf("Argument %q of %s.%s has an invalid value %s.", arg.name, object.Name, f.name, arg.value)
+		}
+		if arg.value.kind == valueVariable {
+			if _, ok := e.variables[arg.value.raw]; !ok {
+				continue
+			}
+		}
+		args[arg.name] = v
+	}
+	for name, typ := range def.args {
+		if _, ok := args[name]; !ok && typ.nonNull {
+			return nil, fmt.Errorf("Argument %q of required type %q was not provided.", name, typ)
+		}
+	}
+
+	if def.Resolve == nil {
+		if m, ok := source.(map[string]any); ok {
+			return m[f.name], nil
+		}
+		return nil, fmt.Errorf("Field %s.%s has no resolver.", object.Name, f.name)
+	}
+	return def.Resolve(ctx, source, args)
+}
+
+// turns a resolved value into the json value of typ, false when it is null
+// in a non-null position and the parent has to be null instead
+func (e *executor) complete(ctx context.Context, typ *typeRef, fields []*field, value any, path []any) (any, bool) {
+	if isNull(value) {
+		if typ.nonNull {
+			e.fail(fields[0], path, "Cannot return null for non-nullable field %s.", fields[0].name)
+			return nil, false
+		}
+		return nil, true
+	}
+
+	completed, ok := e.completeValue(ctx, typ, fields, value, path)
+	if !ok && !typ.nonNull {
+		// the error stops here
+		return nil, true
+	}
+	return completed, ok
+}
+
+func (e *executor) completeValue(ctx context.Context, typ *typeRef, fields []*field, value any, path []any) (any, bool) {
+	if typ.list != nil {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			e.fail(fields[0], path, "Expected a list for field %s.", fields[0].name)
+			return nil, false
+		}
+		items := make([]any, rv.Len())
+		for i := range items {
+			item, ok := e.complete(ctx, typ.list, fields, rv.Index(i).Interface(), append(path, i))
+			if !ok {
+				return nil, false
+			}
+			items[i] = item
+		}
+		return items, true
+	}
+
+	if serialize, ok := scalars[typ.name]; ok {
+		v, ok := serialize(value)
+		if !ok {
+			e.fail(fields[0], path, "%s cannot represent value %v.", typ.name, value)
+		}
+		return v, ok
+	}
+
+	m, ok := e.selections(ctx, e.schema.types[typ.name], value, subselections(fields), path)
+	return m, ok
+}
+
+// nil interfaces, pointers and maps are null, nil slices are empty lists
+func isNull(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// keeps fields in the order they were selected in the json output
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func (m *orderedMap) set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
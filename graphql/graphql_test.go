@@ -0,0 +1,162 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type person struct {
+	name    string
+	age     int
+	friends []*person
+}
+
+func newTestSchema(t *testing.T) *Schema {
+	ada := &person{name: "Ada", age: 36}
+	grace := &person{name: "Grace", age: 85, friends: []*person{ada}}
+	ada.friends = []*person{grace}
+	people := map[string]*person{"Ada": ada, "Grace": grace}
+
+	personType := &Object{
+		Name: "Person",
+		Fields: map[string]*Field{
+			"name": {Type: "String!", Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return source.(*person).name, nil
+			}},
+			"age": {Type: "Int", Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return source.(*person).age, nil
+			}},
+			"friends": {Type: "[Person!]!", Cost: 5, Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return source.(*person).friends, nil
+			}},
+			"secret": {Type: "String", Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return nil, errors.New("not allowed")
+			}},
+			"strict": {Type: "String!", Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return nil, nil
+			}},
+		},
+	}
+	query := &Object{
+		Name: "Query",
+		Fields: map[string]*Field{
+			"person": {Type: "Person", Args: map[string]string{"name": "String!"}, Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				return people[args["name"].(string)], nil
+			}},
+			"greeting": {Type: "String!", Args: map[string]string{"times": "Int"}, Resolve: func(c context.Context, source any, args map[string]any) (any, error) {
+				times, ok := args["times"].(int)
+				if !ok {
+					times = 1
+				}
+				return strings.Repeat("hi", times), nil
+			}},
+			"root": {Type: "String"},
+		},
+	}
+
+	s, err := NewSchema(query, personType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MaxDepth = 4
+	s.MaxCost = 30
+	return s
+}
+
+func TestExecute(t *testing.T) {
+	s := newTestSchema(t)
+
+	tests := []struct {
+		query     string
+		variables map[string]any
+		expected  string
+	}{
+		{`{ person(name: "Ada") { name age } }`, nil, `{"data":{"person":{"name":"Ada","age":36}}}`},
+		{`query ($n: String!) { p: person(name: $n) { __typename n: name } }`, map[string]any{"n": "Grace"}, `{"data":{"p":{"__typename":"Person","n":"Grace"}}}`},
+		{`{ person(name: "Nobody") { name } }`, nil, `{"data":{"person":null}}`},
+		{`{ person(name: "Ada") { ...parts friends { name } } } fragment parts on Person { name friends { age } }`, nil, `{"data":{"person":{"name":"Ada","friends":[{"age":85,"name":"Grace"}]}}}`},
+		{`query ($short: Boolean!) { person(name: "Ada") { name age @skip(if: $short) ... on Person @include(if: $short) { friends { name } } } }`, map[string]any{"short": true}, `{"data":{"person":{"name":"Ada","friends":[{"name":"Grace"}]}}}`},
+		{`query ($times: Int = 2) { greeting(times: $times) }`, nil, `{"data":{"greeting":"hihi"}}`},
+		{`query ($times: Int) { greeting(times: $times) }`, map[string]any{"times": 3.0}, `{"data":{"greeting":"hihihi"}}`},
+		{`{ root }`, nil, `{"data":{"root":"from the root value"}}`},
+		{`{ person(name: "Ada") { name secret } }`, nil, `{"data":{"person":{"name":"Ada","secret":null}},"errors":[{"message":"not allowed","locations":[{"line":1,"column":30}],"path":["person","secret"]}]}`},
+		// the failed non-null field makes its parent null
+		{`{ person(name: "Ada") { name strict } }`, nil, `{"data":{"person":null},"errors":[{"message":"Cannot return null for non-nullable field strict.","locations":[{"line":1,"column":30}],"path":["person","strict"]}]}`},
+		{`query One { greeting } query Two { root }`, nil, `{"errors":[{"message":"Must provide operation name if query contains multiple operations."}]}`},
+	}
+
+	for _, test := range tests {
+		res := s.Execute(context.Background(), Request{Query: test.query, Variables: test.variables}, map[string]any{"root": "from the root value"})
+		got, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.expected {
+			t.Errorf("%s\nGot      %s\nExpected %s", test.query, got, test.expected)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	s := newTestSchema(t)
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`{ person(name: "Ada") { name `, `Syntax Error: Expected Name, found end of document.`},
+		{`mutation { greeting }`, `Operation "mutation" is not supported, the api is read-only.`},
+		{`{ nobody }`, `Cannot query field "nobody" on type "Query".`},
+		{`{ person { name } }`, `Field "person" argument "name" of type "String!" is required, but it was not provided.`},
+		{`{ person(name: 5) { name } }`, `Expected value of type "String!", found 5.`},
+		{`{ person(name: "Ada", age: 1) { name } }`, `Unknown argument "age" on field "Query.person".`},
+		{`{ person(name: "Ada") }`, `Field "person" of type "Person" must have a selection of subfields.`},
+		{`{ greeting { length } }`, `Field "greeting" must not have a selection since type "String!" has no subfields.`},
+		{`{ person(name: $name) { name } }`, `Variable "$name" is not defined.`},
+		{`query ($name: String) { person(name: $name) { name } }`, `Variable "$name" of type "String" used in position expecting type "String!".`},
+		{`query ($unused: Int) { greeting }`, `Variable "$unused" is never used.`},
+		{`{ person(name: "Ada") { ...missing } }`, `Unknown fragment "missing".`},
+		{`{ person(name: "Ada") { ...a } } fragment a on Person { ...b } fragment b on Person { ...a }`, `Cannot spread fragment "a" within itself.`},
+		{`{ ...onPerson } fragment onPerson on Person { name }`, `Fragment cannot be spread here as objects of type "Query" can never be of type "Person".`},
+		{`{ person(name: "Ada") { x: name x: age } }`, `Fields "x" conflict because "name" and "age" are different fields. Use different aliases on the fields to fetch both if this was intentional.`},
+		{`{ greeting @cached }`, `Unknown directive "@cached".`},
+		{`{ person(name: "Ada") { friends { friends { friends { name } } } } }`, `Query is nested too deep, the maximum depth is 4.`},
+		{`{ a: person(name: "Ada") { friends { name } } b: person(name: "Ada") { friends { name } } c: person(name: "Ada") { friends { name } } d: person(name: "Ada") { friends { name } } e: person(name: "Ada") { friends { name } } }`, `Query is too expensive, the maximum cost is 30.`},
+	}
+
+	for _, test := range tests {
+		res := s.Execute(context.Background(), Request{Query: test.query}, nil)
+		if res.Executed() || res.Data != nil {
+			t.Errorf("%s: Expected the query to be rejected before execution", test.query)
+		}
+		if len(res.Errors) == 0 || res.Errors[0].Message != test.expected {
+			t.Errorf("%s\nGot      %v\nExpected %s", test.query, res.Errors, test.expected)
+		}
+	}
+
+	res := s.Execute(context.Background(), Request{Query: `query ($name: String!) { person(name: $name) { name } }`, Variables: map[string]any{"name": 5}}, nil)
+	if res.Executed() || len(res.Errors) != 1 || res.Errors[0].Message != `Variable "$name" got invalid value 5, expected "String!".` {
+		t.Errorf("Got %v, Expected the variable to be rejected", res.Errors)
+	}
+	if b, _ := json.Marshal(res); strings.Contains(string(b), `"data"`) {
+		t.Errorf("Got %s, Expected no data for a rejected request", b)
+	}
+}
+
+func TestSchemaString(t *testing.T) {
+	s := newTestSchema(t)
+	sdl := s.String()
+
+	for _, expected := range []string{"schema {\n  query: Query\n}", "type Person {\n  age: Int\n  friends: [Person!]!\n", "  person(name: String!): Person\n"} {
+		if !strings.Contains(sdl, expected) {
+			t.Errorf("Got\n%s\nExpected it to contain\n%s", sdl, expected)
+		}
+	}
+
+	if _, err := NewSchema(&Object{Name: "Query", Fields: map[string]*Field{"x": {Type: "Missing"}}}); err == nil {
+		t.Error("Expected fields of unknown types to be rejected")
+	}
+}
@@ -0,0 +1,599 @@
+package graphql
+
+import (
+	"strings"
+)
+
+// Location of a token in the query document, both counting from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// the parsed query document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []*variableDef
+	directives []*directive
+	selections []selection
+	loc        Location
+}
+
+type variableDef struct {
+	name string
+	typ  *typeRef
+	def  *value // nil without a default
+	loc  Location
+}
+
+// a type as written in variable definitions and schema fields, e.g [String!]!
+type typeRef struct {
+	name    string // empty for lists
+	list    *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.list != nil {
+		s = "[" + t.list.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// the named type at the bottom of lists and non-null wrappers
+func (t *typeRef) named() string {
+	if t.list != nil {
+		return t.list.named()
+	}
+	return t.name
+}
+
+type selection interface {
+	location() Location
+}
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+	loc        Location
+}
+
+// the key the field is returned under
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	loc        Location
+}
+
+type inlineFragment struct {
+	typeCondition string // empty applies to any type
+	directives    []*directive
+	selections    []selection
+	loc           Location
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	loc           Location
+}
+
+func (f *field) location() Location          { return f.loc }
+func (f *fragmentSpread) location() Location { return f.loc }
+func (f *inlineFragment) location() Location { return f.loc }
+
+type argument struct {
+	name  string
+	value *value
+	loc   Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	loc       Location
+}
+
+type valueKind int
+
+const (
+	valueVariable valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+// a literal or variable in the document
+type value struct {
+	kind   valueKind
+	raw    string // name of variables and enums, text of scalars
+	list   []*value
+	fields []*argument // of input objects
+	loc    Location
+}
+
+type parser struct {
+	lexer  *lexer
+	tok    token
+	tokens int
+}
+
+// largest number of tokens a document may have, bounds the work of parsing
+const maxTokens = 10000
+
+func parse(src string) (*document, *Error) {
+	p := &parser{lexer: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections, loc: selections[0].location()})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"), p.peek(tokenName, "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(tokenName, "fragment"):
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.fragments[f.name]; ok {
+				return nil, &Error{Message: `There can be only one fragment named "` + f.name + `".`, Locations: []Location{f.loc}}
+			}
+			doc.fragments[f.name] = f
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, &Error{Message: "Syntax Error: Document has no operation."}
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() *Error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	if p.tokens++; p.tokens > maxTokens {
+		return &Error{Message: "Syntax Error: Document is too large."}
+	}
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, v string) bool {
+	return p.tok.kind == kind && p.tok.value == v
+}
+
+func (p *parser) unexpected() *Error {
+	return p.lexer.errorf(p.tok.loc, "Unexpected %s.", p.tok)
+}
+
+// consumes the punctuator or keyword v
+func (p *parser) expect(kind tokenKind, v string) *Error {
+	if !p.peek(kind, v) {
+		return p.lexer.errorf(p.tok.loc, "Expected %q, found %s.", v, p.tok)
+	}
+	return p.advance()
+}
+
+// consumes the punctuator v when it is next
+func (p *parser) skip(v string) (bool, *Error) {
+	if !p.peek(tokenPunct, v) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) name() (string, *Error) {
+	if p.tok.kind != tokenName {
+		return "", p.lexer.errorf(p.tok.loc, "Expected Name, found %s.", p.tok)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*operation, *Error) {
+	op := &operation{kind: p.tok.value, loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err *Error
+	if p.tok.kind == tokenName {
+		if op.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek(tokenPunct, "(") {
+		if op.variables, err = p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+	}
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinitions() ([]*variableDef, *Error) {
+	if err := p.expect(tokenPunct, "("); err != nil {
+		return nil, err
+	}
+
+	defs := []*variableDef{}
+	for {
+		if done, err := p.skip(")"); err != nil || done {
+			return defs, err
+		}
+
+		def := &variableDef{loc: p.tok.loc}
+		if err := p.expect(tokenPunct, "$"); err != nil {
+			return nil, err
+		}
+		var err *Error
+		if def.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenPunct, ":"); err != nil {
+			return nil, err
+		}
+		if def.typ, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.skip("="); err != nil {
+			return nil, err
+		} else if ok {
+			if def.def, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := p.directives(); err != nil {
+			return nil, err
+		}
+		defs = append(defs, def)
+	}
+}
+
+func (p *parser) typeRef() (*typeRef, *Error) {
+	t := &typeRef{}
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if t.list, err = p.typeRef(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenPunct, "]"); err != nil {
+			return nil, err
+		}
+	} else if t.name, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	ok, err := p.skip("!")
+	t.nonNull = ok
+	return t, err
+}
+
+func (p *parser) directives() ([]*directive, *Error) {
+	directives := []*directive{}
+	for p.peek(tokenPunct, "@") {
+		d := &directive{loc: p.tok.loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err *Error
+		if d.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		if d.arguments, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		directives = append(directives, d)
+	}
+	return directives, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*argument, *Error) {
+	args := []*argument{}
+	if ok, err := p.skip("("); err != nil || !ok {
+		return args, err
+	}
+
+	for {
+		if done, err := p.skip(")"); err != nil || done {
+			return args, err
+		}
+		arg, err := p.argument(constant)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+}
+
+func (p *parser) argument(constant bool) (*argument, *Error) {
+	arg := &argument{loc: p.tok.loc}
+	var err *Error
+	if arg.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenPunct, ":"); err != nil {
+		return nil, err
+	}
+	if arg.value, err = p.value(constant); err != nil {
+		return nil, err
+	}
+	return arg, nil
+}
+
+// constant values are not allowed to refer to variables, e.g defaults of variables
+func (p *parser) value(constant bool) (*value, *Error) {
+	v := &value{loc: p.tok.loc, raw: p.tok.value}
+
+	switch p.tok.kind {
+	case tokenInt:
+		v.kind = valueInt
+	case tokenFloat:
+		v.kind = valueFloat
+	case tokenString:
+		v.kind = valueString
+	case tokenName:
+		switch p.tok.value {
+		case "true", "false":
+			v.kind = valueBoolean
+		case "null":
+			v.kind = valueNull
+		default:
+			v.kind = valueEnum
+		}
+	case tokenPunct:
+		switch p.tok.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			v.kind = valueVariable
+			var err *Error
+			v.raw, err = p.name()
+			return v, err
+		case "[":
+			v.kind = valueList
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for {
+				if done, err := p.skip("]"); err != nil || done {
+					return v, err
+				}
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.list = append(v.list, item)
+			}
+		case "{":
+			v.kind = valueObject
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			for {
+				if done, err := p.skip("}"); err != nil || done {
+					return v, err
+				}
+				f, err := p.argument(constant)
+				if err != nil {
+					return nil, err
+				}
+				v.fields = append(v.fields, f)
+			}
+		}
+		return nil, p.unexpected()
+	default:
+		return nil, p.unexpected()
+	}
+	return v, p.advance()
+}
+
+func (p *parser) selectionSet() ([]selection, *Error) {
+	if err := p.expect(tokenPunct, "{"); err != nil {
+		return nil, err
+	}
+
+	selections := []selection{}
+	for {
+		if done, err := p.skip("}"); err != nil {
+			return nil, err
+		} else if done {
+			if len(selections) == 0 {
+				return nil, p.lexer.errorf(p.tok.loc, "Expected a selection, found \"}\".")
+			}
+			return selections, nil
+		}
+
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+}
+
+func (p *parser) selection() (selection, *Error) {
+	loc := p.tok.loc
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		return p.fragmentSelection(loc)
+	}
+
+	f := &field{loc: loc}
+	var err *Error
+	if f.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		f.alias = f.name
+		if f.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if f.arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokenPunct, "{") {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// after "...", either a named fragment or an inline one
+func (p *parser) fragmentSelection(loc Location) (selection, *Error) {
+	if p.tok.kind == tokenName && p.tok.value != "on" {
+		spread := &fragmentSpread{name: p.tok.value, loc: loc}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var err *Error
+		spread.directives, err = p.directives()
+		return spread, err
+	}
+
+	inline := &inlineFragment{loc: loc}
+	var err *Error
+	if p.peek(tokenName, "on") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if inline.typeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if inline.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if inline.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return inline, nil
+}
+
+func (p *parser) fragment() (*fragment, *Error) {
+	f := &fragment{loc: p.tok.loc}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	var err *Error
+	if p.peek(tokenName, "on") {
+		return nil, p.unexpected()
+	}
+	if f.name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenName, "on"); err != nil {
+		return nil, err
+	}
+	if f.typeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if f.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// parses a type as written in schema definitions, e.g [Stack!]!
+func parseTypeRef(s string) (*typeRef, *Error) {
+	p := &parser{lexer: newLexer(s)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	t, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.unexpected()
+	}
+	return t, nil
+}
+
+// the text of a value, for error messages
+func (v *value) String() string {
+	switch v.kind {
+	case valueVariable:
+		return "$" + v.raw
+	case valueString:
+		return `"` + strings.ReplaceAll(v.raw, `"`, `\"`) + `"`
+	case valueList:
+		items := []string{}
+		for _, item := range v.list {
+			items = append(items, item.String())
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case valueObject:
+		fields := []string{}
+		for _, f := range v.fields {
+			fields = append(fields, f.name+": "+f.value.String())
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return v.raw
+}
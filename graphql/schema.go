@@ -0,0 +1,341 @@
+// Package graphql runs read-only GraphQL queries against a schema of go resolvers.
+//
+// It supports the parts of the language a read api needs: queries with
+// variables, aliases, fragments and the @skip and @include directives over
+// object types and the built in scalars. Mutations, subscriptions,
+// interfaces, unions, enums, input objects and introspection beyond
+// __typename are not supported, the schema is published as SDL instead.
+//
+// Queries are validated before anything is resolved and rejected when they
+// nest deeper than Schema.MaxDepth or cost more than Schema.MaxCost
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the built in scalars, the only leaf types
+var scalars = map[string]func(v any) (any, bool){
+	"String":  serializeString,
+	"ID":      serializeID,
+	"Int":     serializeInt,
+	"Float":   serializeFloat,
+	"Boolean": serializeBoolean,
+}
+
+// Resolver returns the value of a field on source, the value returned by the
+// parent field, or the root value for fields of the query type
+type Resolver func(ctx context.Context, source any, args map[string]any) (any, error)
+
+// Field of an object type
+type Field struct {
+	// in schema notation, e.g "[Stack!]!"
+	Type        string
+	Description string
+	// argument names to their types, only scalars and lists of them
+	Args map[string]string
+	// added to the cost of a query each time the field is selected, on top of 1.
+	// set it on fields that load from storage
+	Cost int
+	// nil reads the key of the field name when source is a map[string]any
+	Resolve Resolver
+
+	typ  *typeRef
+	args map[string]*typeRef
+}
+
+// Object type with named fields
+type Object struct {
+	Name        string
+	Description string
+	Fields      map[string]*Field
+}
+
+// Schema of a read-only api, all queries start at the Query type
+type Schema struct {
+	Query *Object
+	// deepest nesting of fields allowed, 0 for no limit
+	MaxDepth int
+	// highest total cost of the fields of a query allowed, 0 for no limit
+	MaxCost int
+
+	types map[string]*Object
+	order []string
+}
+
+// checks the types of every field are known and their notation is valid.
+// types lists the objects reachable from query
+func NewSchema(query *Object, types ...*Object) (*Schema, error) {
+	s := &Schema{Query: query, types: map[string]*Object{}}
+	for _, object := range append([]*Object{query}, types...) {
+		if _, ok := s.types[object.Name]; ok {
+			return nil, fmt.Errorf("graphql: type %s is defined twice", object.Name)
+		}
+		if _, ok := scalars[object.Name]; ok {
+			return nil, fmt.Errorf("graphql: type %s is a built in scalar", object.Name)
+		}
+		s.types[object.Name] = object
+		s.order = append(s.order, object.Name)
+	}
+
+	for _, object := range s.types {
+		for name, f := range object.Fields {
+			typ, err := parseTypeRef(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("graphql: field %s.%s has an invalid type %q", object.Name, name, f.Type)
+			}
+			if !s.isScalar(typ.named()) && s.types[typ.named()] == nil {
+				return nil, fmt.Errorf("graphql: field %s.%s has an unknown type %s", object.Name, name, typ.named())
+			}
+			f.typ = typ
+
+			f.args = map[string]*typeRef{}
+			for arg, arg_type := range f.Args {
+				typ, err := parseTypeRef(arg_type)
+				if err != nil || !s.isScalar(typ.named()) {
+					return nil, fmt.Errorf("graphql: argument %s of %s.%s must be a scalar type, got %q", arg, object.Name, name, arg_type)
+				}
+				f.args[arg] = typ
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) isScalar(name string) bool {
+	_, ok := scalars[name]
+	return ok
+}
+
+// the schema in the GraphQL schema definition language
+func (s *Schema) String() string {
+	var b strings.Builder
+	b.WriteString("schema {\n  query: " + s.Query.Name + "\n}\n")
+
+	for _, name := range s.order {
+		object := s.types[name]
+		b.WriteString("\n")
+		writeDescription(&b, "", object.Description)
+		b.WriteString("type " + object.Name + " {\n")
+
+		names := make([]string, 0, len(object.Fields))
+		for name := range object.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			f := object.Fields[name]
+			writeDescription(&b, "  ", f.Description)
+			b.WriteString("  " + name)
+			if len(f.args) > 0 {
+				args := []string{}
+				for arg, typ := range f.args {
+					args = append(args, arg+": "+typ.String())
+				}
+				sort.Strings(args)
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.typ.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description == "" {
+		return
+	}
+	b.WriteString(indent + strconv.Quote(description) + "\n")
+}
+
+// serializers turn resolved go values into json values of the scalar
+
+func serializeString(v any) (any, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return nil, false
+}
+
+func serializeID(v any) (any, bool) {
+	if s, ok := serializeString(v); ok {
+		return s, true
+	}
+	if n, ok := serializeInt(v); ok {
+		return strconv.Itoa(n.(int)), true
+	}
+	return nil, false
+}
+
+func serializeInt(v any) (any, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := rv.Uint(); n <= math.MaxInt32 {
+			return int(n), true
+		}
+	}
+	return nil, false
+}
+
+func serializeFloat(v any) (any, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return f, true
+		}
+	}
+	if n, ok := serializeInt(v); ok {
+		return float64(n.(int)), true
+	}
+	return nil, false
+}
+
+func serializeBoolean(v any) (any, bool) {
+	b, ok := v.(bool)
+	return b, ok
+}
+
+// coerces an input value of a scalar, from a literal or decoded json variable
+func coerceScalar(name string, v any) (any, bool) {
+	switch name {
+	case "String":
+		s, ok := v.(string)
+		return s, ok
+	case "ID":
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case int:
+			return strconv.Itoa(v), true
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return strconv.FormatInt(int64(v), 10), true
+			}
+		}
+	case "Int":
+		switch v := v.(type) {
+		case int:
+			return v, v >= math.MinInt32 && v <= math.MaxInt32
+		case float64:
+			if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int(v), true
+			}
+		}
+	case "Float":
+		switch v := v.(type) {
+		case int:
+			return float64(v), true
+		case float64:
+			return v, true
+		}
+	case "Boolean":
+		b, ok := v.(bool)
+		return b, ok
+	}
+	return nil, false
+}
+
+// coerces a json decoded variable value to typ
+func coerceInput(typ *typeRef, v any) (any, bool) {
+	if v == nil {
+		return nil, !typ.nonNull
+	}
+	if typ.list != nil {
+		items, ok := v.([]any)
+		if !ok {
+			// a single value is accepted for a list of one
+			item, ok := coerceInput(typ.list, v)
+			return []any{item}, ok
+		}
+		coerced := make([]any, len(items))
+		for i, item := range items {
+			if coerced[i], ok = coerceInput(typ.list, item); !ok {
+				return nil, false
+			}
+		}
+		return coerced, true
+	}
+	return coerceScalar(typ.name, v)
+}
+
+// coerces a literal in the document to typ, variables must already be coerced
+func coerceLiteral(typ *typeRef, v *value, variables map[string]any) (any, bool) {
+	switch v.kind {
+	case valueVariable:
+		value, ok := variables[v.raw]
+		if !ok || value == nil {
+			return nil, !typ.nonNull
+		}
+		return value, true
+	case valueNull:
+		return nil, !typ.nonNull
+	}
+
+	if typ.list != nil {
+		if v.kind != valueList {
+			item, ok := coerceLiteral(typ.list, v, variables)
+			return []any{item}, ok
+		}
+		items := make([]any, len(v.list))
+		for i, item := range v.list {
+			var ok bool
+			if items[i], ok = coerceLiteral(typ.list, item, variables); !ok {
+				return nil, false
+			}
+		}
+		return items, true
+	}
+
+	switch v.kind {
+	case valueInt:
+		n, err := strconv.ParseInt(v.raw, 10, 32)
+		if err != nil {
+			return nil, false
+		}
+		return coerceScalar(typ.name, int(n))
+	case valueFloat:
+		f, err := strconv.ParseFloat(v.raw, 64)
+		if err != nil {
+			return nil, false
+		}
+		return coerceScalar(typ.name, f)
+	case valueString:
+		if typ.name == "ID" || typ.name == "String" {
+			return v.raw, true
+		}
+	case valueBoolean:
+		return coerceScalar(typ.name, v.raw == "true")
+	}
+	return nil, false
+}
+
+// whether a variable of type from can be used where type to is expected
+func compatible(from, to *typeRef) bool {
+	if to.nonNull && !from.nonNull {
+		return false
+	}
+	if (from.list == nil) != (to.list == nil) {
+		return false
+	}
+	if from.list != nil {
+		return compatible(from.list, to.list)
+	}
+	return from.name == to.name
+}
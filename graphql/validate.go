@@ -0,0 +1,329 @@
+package graphql
+
+import (
+	"fmt"
+	"sort"
+)
+
+// checks an operation against the schema before anything is resolved
+type validator struct {
+	schema *Schema
+	doc    *document
+	op     *operation
+
+	variables map[string]*variableDef
+	used      map[string]bool
+	errs      []*Error
+	seen      map[string]bool
+
+	cost int
+	// set once the depth or cost limit is exceeded, there is no point looking further
+	exceeded bool
+}
+
+func (s *Schema) validate(doc *document, op *operation) []*Error {
+	v := &validator{
+		schema:    s,
+		doc:       doc,
+		op:        op,
+		variables: map[string]*variableDef{},
+		used:      map[string]bool{},
+		seen:      map[string]bool{},
+	}
+
+	v.fragments()
+	v.variableDefinitions()
+	v.directives(op.directives)
+	if len(v.errs) > 0 {
+		// fragment cycles would make the walk below endless
+		return v.errs
+	}
+
+	v.selections(s.Query, op.selections, 1)
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	for _, def := range op.variables {
+		if !v.used[def.name] {
+			v.fail(def.loc, "Variable \"$%s\" is never used.", def.name)
+		}
+	}
+	v.conflicts(s.Query, op.selections)
+	return v.errs
+}
+
+// adds an error once, the same fragment may be walked many times
+func (v *validator) fail(loc Location, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	key := fmt.Sprintf("%d:%d:%s", loc.Line, loc.Column, message)
+	if v.seen[key] {
+		return
+	}
+	v.seen[key] = true
+	v.errs = append(v.errs, &Error{Message: message, Locations: []Location{loc}})
+}
+
+func (v *validator) fragments() {
+	names := make([]string, 0, len(v.doc.fragments))
+	for name := range v.doc.fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := v.doc.fragments[name]
+		if v.schema.types[f.typeCondition] == nil {
+			v.fail(f.loc, "Unknown type %q.", f.typeCondition)
+		}
+		if v.cyclic(f.selections, map[string]bool{name: true}) {
+			v.fail(f.loc, "Cannot spread fragment %q within itself.", name)
+		}
+	}
+}
+
+// whether selections spread a fragment already on the path
+func (v *validator) cyclic(selections []selection, path map[string]bool) bool {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *field:
+			if v.cyclic(sel.selections, path) {
+				return true
+			}
+		case *inlineFragment:
+			if v.cyclic(sel.selections, path) {
+				return true
+			}
+		case *fragmentSpread:
+			if path[sel.name] {
+				return true
+			}
+			f := v.doc.fragments[sel.name]
+			if f == nil {
+				continue
+			}
+			path[sel.name] = true
+			cyclic := v.cyclic(f.selections, path)
+			delete(path, sel.name)
+			if cyclic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *validator) variableDefinitions() {
+	for _, def := range v.op.variables {
+		if _, ok := v.variables[def.name]; ok {
+			v.fail(def.loc, "There can be only one variable named \"$%s\".", def.name)
+			continue
+		}
+		v.variables[def.name] = def
+
+		if !v.schema.isScalar(def.typ.named()) {
+			v.fail(def.loc, "Variable \"$%s\" cannot be non-input type %q.", def.name, def.typ)
+			continue
+		}
+		if def.def != nil {
+			if _, ok := coerceLiteral(def.typ, def.def, nil); !ok {
+				v.fail(def.def.loc, "Variable \"$%s\" of type %q has invalid default value %s.", def.name, def.typ, def.def)
+			}
+		}
+	}
+}
+
+func (v *validator) directives(directives []*directive) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			v.fail(d.loc, "Unknown directive \"@%s\".", d.name)
+			continue
+		}
+		found := false
+		for _, arg := range d.arguments {
+			if arg.name != "if" {
+				v.fail(arg.loc, "Unknown argument %q on directive \"@%s\".", arg.name, d.name)
+				continue
+			}
+			found = true
+			v.value(booleanType, arg.value)
+		}
+		if !found {
+			v.fail(d.loc, "Directive \"@%s\" argument \"if\" of type \"Boolean!\" is required, but it was not provided.", d.name)
+		}
+	}
+}
+
+// checks a value can be used where typ is expected
+func (v *validator) value(typ *typeRef, val *value) {
+	switch {
+	case val.kind == valueVariable:
+		def := v.variables[val.raw]
+		if def == nil {
+			v.fail(val.loc, "Variable \"$%s\" is not defined.", val.raw)
+			return
+		}
+		v.used[val.raw] = true
+
+		from := def.typ
+		if def.def != nil && def.def.kind != valueNull && !from.nonNull {
+			// a default makes a nullable variable safe to use in a non-null position
+			from = &typeRef{name: from.name, list: from.list, nonNull: true}
+		}
+		if !compatible(from, typ) {
+			v.fail(val.loc, "Variable \"$%s\" of type %q used in position expecting type %q.", val.raw, def.typ, typ)
+		}
+	case val.kind == valueNull:
+		if typ.nonNull {
+			v.fail(val.loc, "Expected value of type %q, found null.", typ)
+		}
+	case typ.list != nil && val.kind == valueList:
+		for _, item := range val.list {
+			v.value(typ.list, item)
+		}
+	case typ.list != nil:
+		v.value(typ.list, val)
+	default:
+		if _, ok := coerceLiteral(typ, val, nil); !ok {
+			v.fail(val.loc, "Expected value of type %q, found %s.", typ, val)
+		}
+	}
+}
+
+func (v *validator) selections(object *Object, selections []selection, depth int) {
+	for _, sel := range selections {
+		if v.exceeded {
+			return
+		}
+
+		switch sel := sel.(type) {
+		case *field:
+			v.field(object, sel, depth)
+		case *inlineFragment:
+			v.directives(sel.directives)
+			if sel.typeCondition != "" && !v.typeCondition(sel.loc, object, sel.typeCondition) {
+				continue
+			}
+			v.selections(object, sel.selections, depth)
+		case *fragmentSpread:
+			v.directives(sel.directives)
+			f := v.doc.fragments[sel.name]
+			if f == nil {
+				v.fail(sel.loc, "Unknown fragment %q.", sel.name)
+				continue
+			}
+			if !v.typeCondition(sel.loc, object, f.typeCondition) {
+				continue
+			}
+			v.directives(f.directives)
+			v.selections(object, f.selections, depth)
+		}
+	}
+}
+
+// there are no interfaces or unions, fragments apply to exactly one type
+func (v *validator) typeCondition(loc Location, object *Object, condition string) bool {
+	if v.schema.types[condition] == nil {
+		v.fail(loc, "Unknown type %q.", condition)
+		return false
+	}
+	if condition != object.Name {
+		v.fail(loc, "Fragment cannot be spread here as objects of type %q can never be of type %q.", object.Name, condition)
+		return false
+	}
+	return true
+}
+
+func (v *validator) field(object *Object, f *field, depth int) {
+	v.directives(f.directives)
+
+	if max := v.schema.MaxDepth; max > 0 && depth > max {
+		v.fail(f.loc, "Query is nested too deep, the maximum depth is %d.", max)
+		v.exceeded = true
+		return
+	}
+
+	if f.name == "__typename" {
+		v.cost++
+		if len(f.arguments) > 0 {
+			v.fail(f.arguments[0].loc, "Unknown argument %q on field \"%s.__typename\".", f.arguments[0].name, object.Name)
+		}
+		if len(f.selections) > 0 {
+			v.fail(f.loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+		}
+		return
+	}
+
+	def := object.Fields[f.name]
+	if def == nil {
+		v.fail(f.loc, "Cannot query field %q on type %q.", f.name, object.Name)
+		return
+	}
+
+	v.cost += 1 + def.Cost
+	if max := v.schema.MaxCost; max > 0 && v.cost > max {
+		v.fail(f.loc, "Query is too expensive, the maximum cost is %d.", max)
+		v.exceeded = true
+		return
+	}
+
+	provided := map[string]bool{}
+	for _, arg := range f.arguments {
+		typ := def.args[arg.name]
+		if typ == nil {
+			v.fail(arg.loc, "Unknown argument %q on field \"%s.%s\".", arg.name, object.Name, f.name)
+			continue
+		}
+		if provided[arg.name] {
+			v.fail(arg.loc, "There can be only one argument named %q.", arg.name)
+			continue
+		}
+		provided[arg.name] = true
+		v.value(typ, arg.value)
+	}
+	for name, typ := range def.args {
+		if typ.nonNull && !provided[name] {
+			v.fail(f.loc, "Field %q argument %q of type %q is required, but it was not provided.", f.name, name, typ)
+		}
+	}
+
+	child := v.schema.types[def.typ.named()]
+	switch {
+	case child == nil && len(f.selections) > 0:
+		v.fail(f.loc, "Field %q must not have a selection since type %q has no subfields.", f.name, def.typ)
+	case child != nil && len(f.selections) == 0:
+		v.fail(f.loc, "Field %q of type %q must have a selection of subfields.", f.name, def.typ)
+	case child != nil:
+		v.selections(child, f.selections, depth+1)
+	}
+}
+
+// fields returned under the same key must be the same field with the same arguments
+func (v *validator) conflicts(object *Object, selections []selection) {
+	groups := v.schema.collectFields(v.doc, object, selections, nil, nil, map[string]bool{})
+	for _, g := range groups {
+		first := g.fields[0]
+		for _, f := range g.fields[1:] {
+			if f.name != first.name {
+				v.fail(f.loc, "Fields %q conflict because %q and %q are different fields. Use different aliases on the fields to fetch both if this was intentional.", g.key, first.name, f.name)
+			} else if argumentsText(f.arguments) != argumentsText(first.arguments) {
+				v.fail(f.loc, "Fields %q conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.", g.key)
+			}
+		}
+
+		if def := object.Fields[first.name]; def != nil {
+			if child := v.schema.types[def.typ.named()]; child != nil {
+				v.conflicts(child, subselections(g.fields))
+			}
+		}
+	}
+}
+
+func argumentsText(args []*argument) string {
+	texts := []string{}
+	for _, arg := range args {
+		texts = append(texts, arg.name+":"+arg.value.String())
+	}
+	sort.Strings(texts)
+	return fmt.Sprint(texts)
+}
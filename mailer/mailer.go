@@ -0,0 +1,238 @@
+// Package mailer sends the emails of the app, such as account verification links.
+//
+// SMTP delivers through a mail server. Writer and File print messages instead,
+// for development, and Outbox keeps them in memory for tests
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends messages, implementations are safe for concurrent use
+type Mailer interface {
+	Send(c context.Context, m Message) error
+}
+
+var ErrInvalidHeader = errors.New("mail headers can not contain line breaks")
+
+// formats m as an RFC 5322 message sent by from at now
+func (m Message) Bytes(from string, now time.Time) ([]byte, error) {
+	for _, header := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes(), nil
+}
+
+// the bare address of a "Name <address>" mailbox
+func address(mailbox string) (string, error) {
+	parsed, err := mail.ParseAddress(mailbox)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Address, nil
+}
+
+// SMTP sends through a mail server, upgrading to TLS when the server offers it.
+// credentials are only sent over TLS or to localhost
+type SMTP struct {
+	Addr     string // host:port
+	Username string // no authentication when empty
+	Password string
+	From     string
+}
+
+func (s *SMTP) Send(c context.Context, m Message) error {
+	msg, err := m.Bytes(s.From, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := address(s.From)
+	if err != nil {
+		return fmt.Errorf("mail from: %w", err)
+	}
+	to, err := address(m.To)
+	if err != nil {
+		return fmt.Errorf("mail to: %w", err)
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(c, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := c.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Writer prints messages, e.g to stdout while developing
+type Writer struct {
+	from string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func NewWriter(w io.Writer, from string) *Writer {
+	return &Writer{from: from, w: w}
+}
+
+func (wm *Writer) Send(c context.Context, m Message) error {
+	msg, err := m.Bytes(wm.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return writeMessage(wm.w, msg)
+}
+
+// messages are separated by a line of dashes
+func writeMessage(w io.Writer, msg []byte) error {
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	_, err := fmt.Fprintf(w, "%s\n%s\n", strings.Repeat("-", 72), msg)
+	return err
+}
+
+// File appends messages to a file, opened for each message so it can be
+// rotated or removed while the server runs
+type File struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFile(path, from string) *File {
+	return &File{path: path, from: from}
+}
+
+func (f *File) Send(c context.Context, m Message) error {
+	msg, err := m.Bytes(f.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(file, msg); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Outbox keeps sent messages in memory, for tests
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (o *Outbox) Send(c context.Context, m Message) error {
+	if _, err := m.Bytes("outbox@localhost", time.Now()); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, m)
+	return nil
+}
+
+// the messages sent so far, oldest first
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message{}, o.messages...)
+}
+
+// the latest message sent to the address, false when there is none
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
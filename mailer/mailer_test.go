@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a stand-in smtp server accepting one message, the commands and data it got are sent on the channel
+func smtpServer(t *testing.T) (string, chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lines := []string{}
+		reader := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		reply("220 localhost ready")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				received <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			switch command := strings.ToUpper(strings.Fields(line + " x")[0]); command {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				reply("235 authenticated")
+			case "DATA":
+				reply("354 go ahead")
+				for {
+					data, _ := reader.ReadString('\n')
+					if data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTP(t *testing.T) {
+	addr, received := smtpServer(t)
+	s := &SMTP{Addr: addr, Username: "app", Password: "secret", From: "Resumes <no-reply@example.com>"}
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Send(c, Message{To: "ada@example.com", Subject: "Verify your email", Body: "Open this link\nhttp://localhost/auth/verify/abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Join(<-received, "\n")
+	for _, expected := range []string{"AUTH PLAIN", "MAIL FROM:<no-reply@example.com>", "RCPT TO:<ada@example.com>", "Subject: Verify your email", "http://localhost/auth/verify/abc"} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("Got\n%s\nExpected it to contain %q", lines, expected)
+		}
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	if _, err := (Message{To: "ada@example.com\r\nBcc: eve@example.com", Subject: "hi"}).Bytes("app@example.com", time.Now()); err != ErrInvalidHeader {
+		t.Errorf("Got %v, Expected line breaks in headers to be rejected", err)
+	}
+
+	var out bytes.Buffer
+	if err := NewWriter(&out, "app@example.com").Send(context.Background(), Message{To: "ada@example.com", Subject: "hi", Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "To: ada@example.com\n") || !strings.HasSuffix(out.String(), "hello\n\n") {
+		t.Errorf("Got %q, Expected the message to be printed", out.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "mail.log")
+	f := NewFile(path, "app@example.com")
+	for i := 0; i < 2; i++ {
+		if err := f.Send(context.Background(), Message{To: "ada@example.com", Subject: "hi", Body: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content, _ := os.ReadFile(path)
+	if strings.Count(string(content), "Subject: hi") != 2 {
+		t.Errorf("Got %q, Expected both messages in the file", content)
+	}
+}
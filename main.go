@@ -1,32 +1,39 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-
-	"github.com/joho/godotenv"
-	"github.com/phillipmugisa/go_resume_generator/app"
-	"github.com/phillipmugisa/go_resume_generator/storage"
+	"strings"
 )
 
 func main() {
 
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("err loading: %v", err)
+	// without a subcommand the web server is started
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	PORT := os.Getenv("PORT")
-	// storage service
-	store, err := storage.NewPostgresStorage()
-	if err != nil {
-		log.Fatal(err)
+	if name == "help" {
+		usage(os.Stdout)
+		return
 	}
 
-	if err := store.SetUpDB(); err != nil {
-		log.Fatal(err)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
 	}
 
-	a := app.NewAppServer(PORT, store)
-	log.Fatal(a.Run())
+	err := cmd.run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,277 @@
+// Package metrics keeps counters, histograms and gauges in memory and serves
+// them in the Prometheus text exposition format, nothing else needs to run.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// latency buckets in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds collectors by name
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]collector{}}
+}
+
+// the registry the package level constructors register with
+var Default = NewRegistry()
+
+// adds c, replacing a collector of the same name
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[c.name()] = c
+}
+
+// WriteText writes every collector sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := []string{}
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := []collector{}
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.Unlock()
+
+	b := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(b)
+	}
+	return b.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// serves the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// label values of a series, joined to key maps
+type series struct {
+	values []string
+}
+
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// renders {a="x",b="y"} with extra pairs appended, empty without labels
+func labelString(names, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// CounterVec counts events per label values
+type CounterVec struct {
+	metric string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	counts map[string]float64
+	series map[string]series
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metric: name, help: help, labels: labels, counts: map[string]float64{}, series: map[string]series{}}
+	Default.register(c)
+	return c
+}
+
+func (c *CounterVec) name() string { return c.metric }
+
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := seriesKey(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = series{values: append([]string(nil), values...)}
+	}
+	c.counts[key] += v
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.metric, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metric, labelString(c.labels, c.series[key].values), formatFloat(c.counts[key]))
+	}
+}
+
+// HistogramVec observes values into cumulative buckets per label values
+type HistogramVec struct {
+	metric  string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{metric: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) name() string { return h.metric }
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := seriesKey(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.metric, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, labelString(h.labels, s.values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, labelString(h.labels, s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, labelString(h.labels, s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, labelString(h.labels, s.values), s.count)
+	}
+}
+
+// GaugeFunc reads its value when scraped, ok false leaves the gauge out
+type GaugeFunc struct {
+	metric string
+	help   string
+	value  func() (float64, bool)
+}
+
+// registers with Default, replacing an earlier gauge of the same name
+func NewGaugeFunc(name, help string, value func() (float64, bool)) *GaugeFunc {
+	g := &GaugeFunc{metric: name, help: help, value: value}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metric }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	v, ok := g.value()
+	if !ok {
+		return
+	}
+	writeHeader(w, g.metric, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metric, formatFloat(v))
+}
+
+// CounterFunc reads an ever increasing value when scraped
+type CounterFunc struct {
+	GaugeFunc
+}
+
+func NewCounterFunc(name, help string, value func() (float64, bool)) *CounterFunc {
+	c := &CounterFunc{GaugeFunc{metric: name, help: help, value: value}}
+	Default.register(c)
+	return c
+}
+
+func (c *CounterFunc) write(w io.Writer) {
+	v, ok := c.value()
+	if !ok {
+		return
+	}
+	writeHeader(w, c.metric, c.help, "counter")
+	fmt.Fprintf(w, "%s %s\n", c.metric, formatFloat(v))
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
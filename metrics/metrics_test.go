@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Requests.", "route", "status")
+	requests.Inc("/projects/", "200")
+	requests.Add(2, "/projects/", "200")
+	requests.Inc("/a\"b/", "500")
+
+	latency := NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/")
+	latency.Observe(0.5, "/")
+	latency.Observe(3, "/")
+
+	NewGaugeFunc("test_sessions", "Sessions.", func() (float64, bool) { return 4, true })
+	NewGaugeFunc("test_missing", "Left out.", func() (float64, bool) { return 0, false })
+
+	var out bytes.Buffer
+	if err := Default.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="/projects/",status="200"} 3`,
+		`test_requests_total{route="/a\"b/",status="500"} 1`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{route="/",le="0.1"} 1`,
+		`test_latency_seconds_bucket{route="/",le="1"} 2`,
+		`test_latency_seconds_bucket{route="/",le="+Inf"} 3`,
+		`test_latency_seconds_sum{route="/"} 3.55`,
+		`test_latency_seconds_count{route="/"} 3`,
+		"# TYPE test_sessions gauge",
+		"test_sessions 4",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, text)
+		}
+	}
+	if strings.Contains(text, "test_missing") {
+		t.Errorf("gauge without a value was written")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type %q", ct)
+	}
+}
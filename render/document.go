@@ -0,0 +1,121 @@
+package render
+
+import (
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// what every format renders, built once from a resume so formats agree on content
+type document struct {
+	Name     string
+	Headline string
+	Contact  []string
+	About    string
+	Sections []section
+}
+
+type section struct {
+	Title string
+	Items []item
+}
+
+type item struct {
+	Heading string
+	Meta    string // dates, status and links on one line
+	Body    string
+	Tags    []string
+}
+
+func newDocument(resume data.Resume) document {
+	u := resume.User
+
+	doc := document{
+		Name:    strings.TrimSpace(u.Firstname + " " + u.Lastname),
+		About:   u.Bio,
+		Contact: nonEmpty(u.Email, u.Phone, u.Country, u.Portfolio, u.Github, u.Linkedin, u.Twitter),
+	}
+	if doc.Name == "" {
+		doc.Name = u.Username
+	}
+	if resume.Profile != nil {
+		doc.Headline = resume.Profile.Role
+		if resume.Profile.About != "" {
+			doc.About = resume.Profile.About
+		}
+	}
+
+	if len(resume.Employments) > 0 {
+		s := section{Title: "Experience"}
+		for _, e := range resume.Employments {
+			heading := e.Name
+			if e.Employee != "" {
+				heading = e.Employee + ", " + e.Name
+			}
+			s.Items = append(s.Items, item{
+				Heading: heading,
+				Meta:    strings.Join(nonEmpty(period(e.Start_date, e.End_date), e.Prod_link), " | "),
+				Body:    e.Description,
+				Tags:    stackNames(e.Stack),
+			})
+		}
+		doc.Sections = append(doc.Sections, s)
+	}
+
+	if len(resume.Projects) > 0 {
+		s := section{Title: "Projects"}
+		for _, p := range resume.Projects {
+			s.Items = append(s.Items, item{
+				Heading: p.Name,
+				Meta:    strings.Join(nonEmpty(period(p.Start_date, p.End_date), p.Status, p.Github, p.Prod_link), " | "),
+				Body:    p.Description,
+				Tags:    stackNames(p.Stack),
+			})
+		}
+		doc.Sections = append(doc.Sections, s)
+	}
+
+	if len(resume.Stacks) > 0 {
+		doc.Sections = append(doc.Sections, section{Title: "Skills", Items: []item{{Tags: stackNames(resume.Stacks)}}})
+	}
+
+	if len(resume.Hobbies) > 0 {
+		names := []string{}
+		for _, h := range resume.Hobbies {
+			names = append(names, h.Name)
+		}
+		doc.Sections = append(doc.Sections, section{Title: "Hobbies", Items: []item{{Tags: names}}})
+	}
+
+	return doc
+}
+
+// e.g "Jan 2020 - present", empty when the start is unknown
+func period(start, end time.Time) string {
+	if start.IsZero() {
+		return ""
+	}
+	if end.IsZero() {
+		return start.Format("Jan 2006") + " - present"
+	}
+	return start.Format("Jan 2006") + " - " + end.Format("Jan 2006")
+}
+
+func stackNames(stacks []data.TechStack) []string {
+	names := []string{}
+	for _, t := range stacks {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func nonEmpty(values ...string) []string {
+	kept := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,43 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+var ErrInvalidResume = errors.New("invalid resume")
+
+// ReadResume decodes a resume written by hand or by the json format.
+// unknown fields are rejected so typos in checked in files are caught
+func ReadResume(r io.Reader) (data.Resume, error) {
+	var resume data.Resume
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&resume); err != nil {
+		return resume, fmt.Errorf("%w: %v", ErrInvalidResume, err)
+	}
+	if decoder.More() {
+		return resume, fmt.Errorf("%w: unexpected data after the resume", ErrInvalidResume)
+	}
+
+	u := resume.User
+	if u.Firstname == "" && u.Lastname == "" && u.Username == "" {
+		return resume, fmt.Errorf("%w: user needs a firstname, lastname or username", ErrInvalidResume)
+	}
+	for i, p := range resume.Projects {
+		if p.Name == "" {
+			return resume, fmt.Errorf("%w: project %d has no name", ErrInvalidResume, i+1)
+		}
+	}
+	for i, e := range resume.Employments {
+		if e.Name == "" {
+			return resume, fmt.Errorf("%w: employment %d has no name", ErrInvalidResume, i+1)
+		}
+	}
+	return resume, nil
+}
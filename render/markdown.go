@@ -0,0 +1,52 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func renderMarkdown(w io.Writer, doc document) error {
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintf(b, "# %s\n\n", markdownEscape(doc.Name))
+	if doc.Headline != "" {
+		fmt.Fprintf(b, "**%s**\n\n", markdownEscape(doc.Headline))
+	}
+	if len(doc.Contact) > 0 {
+		fmt.Fprintf(b, "%s\n\n", markdownEscape(strings.Join(doc.Contact, " · ")))
+	}
+	if doc.About != "" {
+		fmt.Fprintf(b, "%s\n\n", markdownEscape(doc.About))
+	}
+
+	for _, s := range doc.Sections {
+		fmt.Fprintf(b, "## %s\n\n", s.Title)
+		for _, i := range s.Items {
+			if i.Heading != "" {
+				fmt.Fprintf(b, "### %s\n\n", markdownEscape(i.Heading))
+			}
+			if i.Meta != "" {
+				fmt.Fprintf(b, "_%s_\n\n", markdownEscape(i.Meta))
+			}
+			if i.Body != "" {
+				fmt.Fprintf(b, "%s\n\n", markdownEscape(i.Body))
+			}
+			if len(i.Tags) > 0 {
+				fmt.Fprintf(b, "%s\n\n", markdownEscape(strings.Join(i.Tags, ", ")))
+			}
+		}
+	}
+
+	return b.Flush()
+}
+
+// escapes characters markdown would read as formatting
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "#", `\#`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`,
+)
+
+func markdownEscape(s string) string {
+	return markdownEscaper.Replace(s)
+}
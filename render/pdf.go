@@ -0,0 +1,167 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// a4 in points
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 56.0
+)
+
+// a line of text placed on a page
+type pdfLine struct {
+	text string
+	bold bool
+	size float64
+	gap  float64 // extra space above the line
+}
+
+// renders the document as a text only pdf using the standard fonts,
+// so no font files or external tools are needed
+func renderPDF(w io.Writer, doc document, t theme) error {
+	size := t.pdfSize
+	lines := []pdfLine{}
+	add := func(text string, bold bool, size, gap float64) {
+		for i, l := range wrapText(text, size) {
+			if i > 0 {
+				gap = 0
+			}
+			lines = append(lines, pdfLine{text: l, bold: bold, size: size, gap: gap})
+		}
+	}
+
+	add(doc.Name, true, size*2, 0)
+	if doc.Headline != "" {
+		add(doc.Headline, false, size*1.2, 0)
+	}
+	if len(doc.Contact) > 0 {
+		add(strings.Join(doc.Contact, " | "), false, size*0.9, size*0.4)
+	}
+	if doc.About != "" {
+		add(doc.About, false, size, size)
+	}
+	for _, s := range doc.Sections {
+		add(strings.ToUpper(s.Title), true, size*1.2, size*1.2)
+		for _, i := range s.Items {
+			if i.Heading != "" {
+				add(i.Heading, true, size, size*0.6)
+			}
+			if i.Meta != "" {
+				add(i.Meta, false, size*0.9, 0)
+			}
+			if i.Body != "" {
+				add(i.Body, false, size, size*0.2)
+			}
+			if len(i.Tags) > 0 {
+				add(strings.Join(i.Tags, ", "), false, size*0.9, size*0.2)
+			}
+		}
+	}
+
+	// lay the lines out on pages
+	pages := []*bytes.Buffer{new(bytes.Buffer)}
+	y := pdfPageHeight - pdfMargin
+	for _, l := range lines {
+		step := l.gap + l.size*1.35
+		if y-step < pdfMargin {
+			pages = append(pages, new(bytes.Buffer))
+			y = pdfPageHeight - pdfMargin
+			step = l.size * 1.35
+		}
+		y -= step
+
+		font := "F1"
+		if l.bold {
+			font = "F2"
+		}
+		fmt.Fprintf(pages[len(pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, l.size, pdfMargin, y, pdfEscape(l.text))
+	}
+
+	return writePDF(w, pages, t.pdfFont, t.pdfBoldFont)
+}
+
+// writes the pdf objects: catalog, page tree, two fonts then a page and its content per page
+func writePDF(w io.Writer, pages []*bytes.Buffer, font, bold_font string) error {
+	var out bytes.Buffer
+	offsets := []int{}
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	kids := []string{}
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+i*2))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font))
+	object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", bold_font))
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// splits text into lines that fit the page, estimating the width of a character
+// as half the font size which holds for the standard fonts on average
+func wrapText(text string, size float64) []string {
+	max_chars := int((pdfPageWidth - 2*pdfMargin) / (size * 0.5))
+
+	lines := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			if line != "" && len(line)+1+len(word) > max_chars {
+				lines = append(lines, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// escapes a pdf string literal, characters outside latin-1 can not be shown by
+// the standard fonts and are replaced
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,147 @@
+// Package render turns a resume into a file in one of several formats and themes.
+// It needs neither the database nor the web server.
+package render
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/metrics"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+// formats a resume can be rendered to
+var Formats = []string{"html", "md", "pdf", "json"}
+
+const DefaultTheme = "classic"
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrUnknownTheme  = errors.New("unknown theme")
+)
+
+var renderDuration = metrics.NewHistogramVec(
+	"render_duration_seconds",
+	"Time spent rendering resumes.",
+	metrics.DefBuckets,
+	"format", "theme",
+)
+
+//go:embed themes/*.html
+var themeFiles embed.FS
+
+// settings of a theme for formats without stylesheets
+type theme struct {
+	pdfFont     string // one of the standard pdf fonts
+	pdfBoldFont string
+	pdfSize     float64
+}
+
+var themes = map[string]theme{
+	"classic": {pdfFont: "Times-Roman", pdfBoldFont: "Times-Bold", pdfSize: 11},
+	"modern":  {pdfFont: "Helvetica", pdfBoldFont: "Helvetica-Bold", pdfSize: 10},
+}
+
+// names of the available themes, sorted
+func Themes() []string {
+	names := []string{}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// guesses the format from a file extension, empty when unknown
+func FormatFromPath(path string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if ext == "markdown" {
+		ext = "md"
+	}
+	if ext == "htm" {
+		ext = "html"
+	}
+	for _, f := range Formats {
+		if f == ext {
+			return f
+		}
+	}
+	return ""
+}
+
+// Render writes the resume to w in the given theme and format,
+// an empty theme uses DefaultTheme.
+func Render(w io.Writer, resume data.Resume, theme_name, format string) error {
+	return RenderContext(context.Background(), w, resume, theme_name, format)
+}
+
+// RenderContext is Render recording its steps as spans of the trace in ctx
+func RenderContext(ctx context.Context, w io.Writer, resume data.Resume, theme_name, format string) error {
+	if theme_name == "" {
+		theme_name = DefaultTheme
+	}
+	t, ok := themes[theme_name]
+	if !ok {
+		return fmt.Errorf("%w %q, choose one of %s", ErrUnknownTheme, theme_name, strings.Join(Themes(), ", "))
+	}
+
+	// never render credentials whatever the caller loaded
+	resume.User.Password = ""
+
+	ctx, span := tracing.Start(ctx, "render", tracing.String("format", format), tracing.String("theme", theme_name))
+	defer span.End()
+
+	start := time.Now()
+	err := render(ctx, w, resume, theme_name, t, format)
+	if !errors.Is(err, ErrUnknownFormat) {
+		renderDuration.Observe(time.Since(start).Seconds(), format, theme_name)
+	}
+	span.SetError(err)
+	return err
+}
+
+func render(ctx context.Context, w io.Writer, resume data.Resume, theme_name string, t theme, format string) error {
+	if format == "json" {
+		_, span := tracing.Start(ctx, "render.json")
+		defer span.End()
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(resume)
+	}
+
+	write, ok := map[string]func(document) error{
+		"html": func(doc document) error { return renderHTML(w, doc, theme_name) },
+		"md":   func(doc document) error { return renderMarkdown(w, doc) },
+		"pdf":  func(doc document) error { return renderPDF(w, doc, t) },
+	}[format]
+	if !ok {
+		return fmt.Errorf("%w %q, choose one of %s", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+
+	_, span := tracing.Start(ctx, "render.document")
+	doc := newDocument(resume)
+	span.End()
+
+	_, span = tracing.Start(ctx, "render."+format)
+	defer span.End()
+	return write(doc)
+}
+
+func renderHTML(w io.Writer, doc document, theme_name string) error {
+	tmpl, err := template.ParseFS(themeFiles, "themes/"+theme_name+".html")
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, doc)
+}
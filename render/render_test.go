@@ -0,0 +1,100 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+func testResume() data.Resume {
+	return data.Resume{
+		User:    data.User{Firstname: "phillip", Lastname: "mugisa", Username: "phillipmugisa", Email: "test@gmail.com", Password: "hash"},
+		Profile: &data.Profile{Role: "backend developer", About: "writes <go>"},
+		Projects: []data.Project{
+			{Name: "resume generator", Status: "active", Start_date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Description: "builds (pdf) resumes", Stack: []data.TechStack{{Name: "go"}}},
+		},
+		Employments: []data.Employment{{Name: "acme", Employee: "developer", Description: strings.Repeat("long description ", 400)}},
+		Hobbies:     []data.Hobby{{Name: "chess"}},
+		Stacks:      []data.TechStack{{Name: "go"}},
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, theme := range Themes() {
+		for _, format := range Formats {
+			var out bytes.Buffer
+			if err := Render(&out, testResume(), theme, format); err != nil {
+				t.Fatalf("%s %s: %v", theme, format, err)
+			}
+			if strings.Contains(out.String(), "hash") {
+				t.Errorf("%s %s: Expected the password to be left out", theme, format)
+			}
+		}
+	}
+
+	var html bytes.Buffer
+	Render(&html, testResume(), "", "html")
+	if !strings.Contains(html.String(), "writes &lt;go&gt;") || !strings.Contains(html.String(), "Jan 2023 - present") {
+		t.Errorf("Got %s, Expected escaped about and project period", html.String())
+	}
+
+	var md bytes.Buffer
+	Render(&md, testResume(), "", "md")
+	if !strings.HasPrefix(md.String(), "# phillip mugisa\n") || !strings.Contains(md.String(), "## Projects") {
+		t.Errorf("Got %s, Expected a markdown resume", md.String())
+	}
+
+	var pdf bytes.Buffer
+	Render(&pdf, testResume(), "", "pdf")
+	if !strings.HasPrefix(pdf.String(), "%PDF-1.4") || !strings.HasSuffix(pdf.String(), "%%EOF\n") {
+		t.Errorf("Expected a complete pdf")
+	}
+	if !strings.Contains(pdf.String(), `builds \(pdf\) resumes`) || strings.Contains(pdf.String(), "/Count 1 ") {
+		t.Errorf("Expected escaped text over several pages")
+	}
+
+	if err := Render(&bytes.Buffer{}, testResume(), "missing", "html"); !errors.Is(err, ErrUnknownTheme) {
+		t.Errorf("Got %v, Expected ErrUnknownTheme", err)
+	}
+	if err := Render(&bytes.Buffer{}, testResume(), "", "docx"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Got %v, Expected ErrUnknownFormat", err)
+	}
+}
+
+func TestFormatFromPath(t *testing.T) {
+	for path, format := range map[string]string{"cv.PDF": "pdf", "cv.markdown": "md", "cv.htm": "html", "cv.docx": "", "cv": ""} {
+		if got := FormatFromPath(path); got != format {
+			t.Errorf("%s: Got %q, Expected %q", path, got, format)
+		}
+	}
+}
+
+func TestReadResume(t *testing.T) {
+	// the json format reads back
+	var out bytes.Buffer
+	if err := Render(&out, testResume(), "", "json"); err != nil {
+		t.Fatal(err)
+	}
+	resume, err := ReadResume(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume.User.Firstname != "phillip" || len(resume.Projects) != 1 || resume.Projects[0].Stack[0].Name != "go" {
+		t.Errorf("Got %+v, Expected the rendered resume", resume)
+	}
+
+	for _, input := range []string{
+		`{"user": {"firstname": "phillip"}, "projcts": []}`,
+		`{"user": {}}`,
+		`{"user": {"firstname": "phillip"}, "projects": [{"status": "active"}]}`,
+		`{"user": {"firstname": "phillip"}} {}`,
+	} {
+		if _, err := ReadResume(strings.NewReader(input)); !errors.Is(err, ErrInvalidResume) {
+			t.Errorf("%s: Got %v, Expected ErrInvalidResume", input, err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// columns selected when loading users, in scanUsers order
+const userColumns = "id, username, firstname, lastname, email, bio, phone, country, password, version, " +
+	"COALESCE(portfolio, ''), COALESCE(github, ''), COALESCE(linkedin, ''), COALESCE(twitter, ''), COALESCE(email_verified, FALSE)"
+
+// loads the users with the given ids in a single query, keyed by id
+func usersByID(ctx context.Context, db querier, user_ids []int) (map[int]*data.User, error) {
+	users := map[int]*data.User{}
+
+	seen := map[int]bool{}
+	placeholders := []string{}
+	args := []any{}
+	for _, id := range user_ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	if len(args) == 0 {
+		return users, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM Users WHERE id IN (%s) AND deleted_on IS NULL", userColumns, strings.Join(placeholders, ", "))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := scanUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range records {
+		id, err := strconv.Atoi(u.Id)
+		if err != nil {
+			return nil, err
+		}
+		users[id] = u
+	}
+	return users, nil
+}
+
+// sets the owner of each record, user_ids[i] is the owner of record i
+func attachUsers(ctx context.Context, db querier, user_ids []int, attach func(i int, u data.User)) error {
+	users, err := usersByID(ctx, db, user_ids)
+	if err != nil {
+		return err
+	}
+	for i, id := range user_ids {
+		if u, ok := users[id]; ok {
+			attach(i, *u)
+		}
+	}
+	return nil
+}
+
+// scans rows selected with projectColumns, returning the owner id of each project
+func scanProjectRows(rows *sql.Rows) ([]*data.Project, []int, error) {
+	defer rows.Close()
+
+	var (
+		projects []*data.Project
+		user_ids []int
+	)
+	for rows.Next() {
+		project := new(data.Project)
+		var user_id int
+		err := rows.Scan(
+			&project.Id,
+			&user_id,
+			&project.Name,
+			&project.Duration,
+			&project.Start_date,
+			&project.End_date,
+			&project.Status,
+			&project.Github,
+			&project.Prod_link,
+			&project.Description,
+			&project.Created_on,
+			&project.Updated_on,
+			&project.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		projects = append(projects, project)
+		user_ids = append(user_ids, user_id)
+	}
+	return projects, user_ids, rows.Err()
+}
+
+// scans rows selected with employmentColumns, returning the owner id of each employment
+func scanEmploymentRows(rows *sql.Rows) ([]*data.Employment, []int, error) {
+	defer rows.Close()
+
+	var (
+		employments []*data.Employment
+		user_ids    []int
+	)
+	for rows.Next() {
+		employment := new(data.Employment)
+		var user_id int
+		err := rows.Scan(
+			&employment.Id,
+			&user_id,
+			&employment.Name,
+			&employment.Employee,
+			&employment.Start_date,
+			&employment.End_date,
+			&employment.Status,
+			&employment.Prod_link,
+			&employment.Duration,
+			&employment.Description,
+			&employment.Created_on,
+			&employment.Updated_on,
+			&employment.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		employments = append(employments, employment)
+		user_ids = append(user_ids, user_id)
+	}
+	return employments, user_ids, rows.Err()
+}
+
+// scans rows selected with stackColumns
+func scanTechStackRows(rows *sql.Rows) ([]*data.TechStack, []int, error) {
+	defer rows.Close()
+
+	var (
+		stacks   []*data.TechStack
+		user_ids []int
+	)
+	for rows.Next() {
+		stack := new(data.TechStack)
+		var user_id int
+		if err := rows.Scan(&stack.Id, &user_id, &stack.Name, &stack.Version); err != nil {
+			return nil, nil, err
+		}
+		stacks = append(stacks, stack)
+		user_ids = append(user_ids, user_id)
+	}
+	return stacks, user_ids, rows.Err()
+}
+
+// scans rows selected with hobbyColumns
+func scanHobbyRows(rows *sql.Rows) ([]*data.Hobby, []int, error) {
+	defer rows.Close()
+
+	var (
+		hobbies  []*data.Hobby
+		user_ids []int
+	)
+	for rows.Next() {
+		hobby := new(data.Hobby)
+		var user_id int
+		if err := rows.Scan(&hobby.Id, &user_id, &hobby.Name, &hobby.Version); err != nil {
+			return nil, nil, err
+		}
+		hobbies = append(hobbies, hobby)
+		user_ids = append(user_ids, user_id)
+	}
+	return hobbies, user_ids, rows.Err()
+}
+
+// scans rows selected with profileColumns
+func scanProfileRows(rows *sql.Rows) ([]*data.Profile, []int, error) {
+	defer rows.Close()
+
+	var (
+		profiles []*data.Profile
+		user_ids []int
+	)
+	for rows.Next() {
+		profile := new(data.Profile)
+		var user_id int
+		err := rows.Scan(
+			&profile.Id,
+			&user_id,
+			&profile.Role,
+			&profile.About,
+			&profile.Views,
+			&profile.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		profiles = append(profiles, profile)
+		user_ids = append(user_ids, user_id)
+	}
+	return profiles, user_ids, rows.Err()
+}
+
+// loads a users whole resume in a fixed number of queries whatever its size.
+// both backends share it, the sql is understood by postgres and sqlite
+func loadResumeAggregate(ctx context.Context, db querier, user_id int) (*data.Resume, error) {
+	rows, err := db.QueryContext(ctx, "SELECT "+userColumns+" FROM Users WHERE id = $1 AND deleted_on IS NULL", user_id)
+	if err != nil {
+		return nil, err
+	}
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	resume := &data.Resume{
+		User:        *users[0],
+		Projects:    []data.Project{},
+		Employments: []data.Employment{},
+		Hobbies:     []data.Hobby{},
+		Stacks:      []data.TechStack{},
+	}
+	resume.User.Password = ""
+	owner := resumeOwner(resume.User)
+
+	// profile
+	rows, err = db.QueryContext(ctx, "SELECT "+profileColumns+" FROM Profiles WHERE user_id = $1", user_id)
+	if err != nil {
+		return nil, err
+	}
+	profiles, _, err := scanProfileRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) > 0 {
+		profiles[0].User = owner
+		resume.Profile = profiles[0]
+	}
+
+	// stacks linked to projects and employments, keyed by record id
+	project_stacks, err := linkedStacks(ctx, db, "SELECT l.project_id, t.id, t.name, t.version FROM ProjectTechStacks l JOIN TechStacks t ON t.id = l.techstack_id JOIN Projects p ON p.id = l.project_id WHERE p.user_id = $1 AND t.deleted_on IS NULL ORDER BY t.id", user_id, owner)
+	if err != nil {
+		return nil, err
+	}
+	employment_stacks, err := linkedStacks(ctx, db, "SELECT l.employment_id, t.id, t.name, t.version FROM EmploymentTechStacks l JOIN TechStacks t ON t.id = l.techstack_id JOIN Employments e ON e.id = l.employment_id WHERE e.user_id = $1 AND t.deleted_on IS NULL ORDER BY t.id", user_id, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT "+projectColumns+" FROM Projects WHERE user_id = $1 AND deleted_on IS NULL ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+	projects, _, err := scanProjectRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		p.User = owner
+		p.Stack = project_stacks[p.Id]
+		if p.Stack == nil {
+			p.Stack = []data.TechStack{}
+		}
+		resume.Projects = append(resume.Projects, *p)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT "+employmentColumns+" FROM Employments WHERE user_id = $1 AND deleted_on IS NULL ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+	employments, _, err := scanEmploymentRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range employments {
+		e.User = owner
+		e.Stack = employment_stacks[e.Id]
+		if e.Stack == nil {
+			e.Stack = []data.TechStack{}
+		}
+		resume.Employments = append(resume.Employments, *e)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT "+hobbyColumns+" FROM Hobbies WHERE user_id = $1 AND deleted_on IS NULL ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+	hobbies, _, err := scanHobbyRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hobbies {
+		h.User = owner
+		resume.Hobbies = append(resume.Hobbies, *h)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks WHERE user_id = $1 AND deleted_on IS NULL ORDER BY id", user_id)
+	if err != nil {
+		return nil, err
+	}
+	stacks, _, err := scanTechStackRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	resume.Stacks = resumeStacks(stacks, owner)
+
+	return resume, nil
+}
+
+// runs a query returning record id, stack id, name and version rows
+func linkedStacks(ctx context.Context, db querier, query string, user_id int, owner data.User) (map[int][]data.TechStack, error) {
+	rows, err := db.QueryContext(ctx, query, user_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	linked := map[int][]data.TechStack{}
+	for rows.Next() {
+		var record_id int
+		stack := data.TechStack{User: owner}
+		if err := rows.Scan(&record_id, &stack.Id, &stack.Name, &stack.Version); err != nil {
+			return nil, err
+		}
+		linked[record_id] = append(linked[record_id], stack)
+	}
+	return linked, rows.Err()
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// creates a user with projects and employments each linked to a few stacks
+func seedResume(tb testing.TB, s Storage, records int) *data.User {
+	c := context.Background()
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		tb.Fatal(err)
+	}
+	profile, _ := user.NewProfile("backend developer", "writes go")
+	s.CreateProfile(c, *profile)
+
+	for i := 0; i < 5; i++ {
+		s.CreateTechStack(c, *user.NewTechStack(fmt.Sprintf("stack %d", i)))
+	}
+	for i := 0; i < records; i++ {
+		s.CreateProject(c, data.Project{User: *user, Name: fmt.Sprintf("project %d", i), Description: "a project"})
+		s.CreateEmployment(c, data.Employment{User: *user, Name: fmt.Sprintf("employment %d", i), Description: "a job"})
+		s.CreateHobby(c, *user.NewHobby(fmt.Sprintf("hobby %d", i)))
+	}
+
+	keys := map[string]string{"username": user.Username}
+	stacks, _ := s.GetTechStacks(c, keys)
+	projects, _, _ := s.GetProjects(c, keys, Page{Limit: MaxPageSize})
+	employments, _, _ := s.GetEmployments(c, keys, Page{Limit: MaxPageSize})
+	for i, p := range projects {
+		s.AddTechStackToProject(c, *stacks[i%len(stacks)], *p)
+		s.AddTechStackToProject(c, *stacks[(i+1)%len(stacks)], *p)
+	}
+	for i, e := range employments {
+		s.AddTechStackToEmployment(c, *stacks[i%len(stacks)], data.Project{Id: e.Id})
+	}
+	return user
+}
+
+// loads a resume through the listing methods, one stack query per record
+func loadResumeByListing(c context.Context, s Storage, username string) (*data.Resume, error) {
+	users, err := s.GetUsers(c, map[string]string{"username": username})
+	if err != nil {
+		return nil, err
+	}
+
+	resume := &data.Resume{User: *users[0]}
+	resume.User.Password = ""
+	owner := resumeOwner(resume.User)
+
+	if profile, err := s.GetProfile(c, username); err == nil {
+		profile.User = owner
+		resume.Profile = profile
+	}
+
+	keys := map[string]string{"username": username}
+
+	projects, _, err := s.GetProjects(c, keys, Page{Limit: MaxPageSize})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		stacks, err := s.GetProjectTechStacks(c, map[string]string{"project_id": strconv.Itoa(p.Id)})
+		if err != nil {
+			return nil, err
+		}
+		p.User = owner
+		p.Stack = resumeStacks(stacks, owner)
+		resume.Projects = append(resume.Projects, *p)
+	}
+
+	employments, _, err := s.GetEmployments(c, keys, Page{Limit: MaxPageSize})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range employments {
+		stacks, err := s.GetEmploymentTechStacks(c, map[string]string{"employment_id": strconv.Itoa(e.Id)})
+		if err != nil {
+			return nil, err
+		}
+		e.User = owner
+		e.Stack = resumeStacks(stacks, owner)
+		resume.Employments = append(resume.Employments, *e)
+	}
+
+	hobbies, _, err := s.GetHobbies(c, keys, Page{Limit: MaxPageSize})
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hobbies {
+		h.User = owner
+		resume.Hobbies = append(resume.Hobbies, *h)
+	}
+
+	stacks, err := s.GetTechStacks(c, keys)
+	if err != nil {
+		return nil, err
+	}
+	resume.Stacks = resumeStacks(stacks, owner)
+
+	return resume, nil
+}
+
+func newSeededStorage(tb testing.TB, records int) (*MemoryStorage, *data.User) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := s.SetUpDB(context.Background()); err != nil {
+		tb.Fatal(err)
+	}
+	return s, seedResume(tb, s, records)
+}
+
+func TestLoadResumeAggregate(t *testing.T) {
+	s, user := newSeededStorage(t, 10)
+	c := context.Background()
+
+	aggregate, err := LoadResume(c, s, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := loadResumeByListing(c, s, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(aggregate.Projects) != 10 || len(aggregate.Projects[0].Stack) != 2 || len(aggregate.Employments[0].Stack) != 1 {
+		t.Fatalf("Got %d projects, Expected 10 projects with linked stacks", len(aggregate.Projects))
+	}
+
+	changes, err := data.DiffResumes(*listed, *aggregate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Got %v, Expected aggregate to match listing results", changes)
+	}
+}
+
+func BenchmarkLoadResume(b *testing.B) {
+	s, user := newSeededStorage(b, 50)
+	c := context.Background()
+
+	user_id, _ := s.getUserID(c, user.Username)
+
+	b.Run("aggregate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := s.LoadResumeAggregate(c, user_id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("listing", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := loadResumeByListing(c, s, user.Username); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// format of archives written by ExportAccount
+const ArchiveVersion = 1
+
+// limits on what an archive may unpack to
+const (
+	maxArchiveFile   = 32 << 20  // largest single file
+	maxArchiveSize   = 256 << 20 // all files together
+	maxArchiveImages = 100
+)
+
+var (
+	ErrInvalidArchive  = errors.New("invalid account archive")
+	ErrAccountNotEmpty = errors.New("account already has resume data")
+)
+
+type archiveManifest struct {
+	Version     int       `json:"version"`
+	Username    string    `json:"username"`
+	Exported_on time.Time `json:"exported_on"`
+}
+
+// ExportAccount writes a zip archive of everything a user owns: a json file per
+// entity and their uploaded images read from media_dir.
+// passwords are not exported, the archive is restored into an existing account
+func ExportAccount(c context.Context, s Storage, username, media_dir string, w io.Writer) error {
+	resume, err := LoadResume(c, s, username)
+	if err != nil {
+		return err
+	}
+	snapshots, err := s.GetResumeSnapshots(c, username)
+	if err != nil {
+		return err
+	}
+	images, err := s.GetUserImages(c, username)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		// snapshot owners are loaded with their password
+		snapshot.User = resumeOwner(snapshot.User)
+	}
+
+	archive := zip.NewWriter(w)
+
+	entries := []struct {
+		name  string
+		value any
+	}{
+		{"manifest.json", archiveManifest{Version: ArchiveVersion, Username: username, Exported_on: time.Now()}},
+		{"user.json", resume.User},
+		{"profile.json", resume.Profile},
+		{"projects.json", resume.Projects},
+		{"employments.json", resume.Employments},
+		{"hobbies.json", resume.Hobbies},
+		{"stacks.json", resume.Stacks},
+		{"snapshots.json", snapshots},
+	}
+	for _, e := range entries {
+		if err := writeArchiveJSON(archive, e.name, e.value); err != nil {
+			return err
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, image := range images {
+		name := filepath.Base(image)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if err := writeArchiveFile(archive, "images/"+name, filepath.Join(media_dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, value any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func writeArchiveFile(archive *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// missing uploads are skipped rather than failing the whole export
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, src)
+	return err
+}
+
+// ImportAccount restores an archive written by ExportAccount into the account of
+// username, which must not have any resume data yet. Records get new ids, images
+// are copied into media_dir. Records are created in one transaction and the
+// copied images removed again if the import fails, so a failed import can be retried.
+func ImportAccount(c context.Context, s Storage, username, media_dir string, r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return ErrInvalidArchive
+	}
+	if err := checkArchiveLimits(archive.File); err != nil {
+		return err
+	}
+	budget := &archiveBudget{remaining: maxArchiveSize}
+
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	var manifest archiveManifest
+	if err := readArchiveJSON(files, "manifest.json", &manifest, budget); err != nil {
+		return err
+	}
+	if manifest.Version != ArchiveVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, manifest.Version)
+	}
+
+	var (
+		archived  data.Resume
+		snapshots []*data.ResumeSnapshot
+	)
+	for name, v := range map[string]any{
+		"user.json":        &archived.User,
+		"profile.json":     &archived.Profile,
+		"projects.json":    &archived.Projects,
+		"employments.json": &archived.Employments,
+		"hobbies.json":     &archived.Hobbies,
+		"stacks.json":      &archived.Stacks,
+		"snapshots.json":   &snapshots,
+	} {
+		if err := readArchiveJSON(files, name, v, budget); err != nil {
+			return err
+		}
+	}
+
+	images, err := unpackImages(archive.File, media_dir, budget)
+	if err != nil {
+		return err
+	}
+
+	err = s.Atomic(c, func(c context.Context) error {
+		return importRecords(c, s, username, archived, snapshots, images)
+	})
+	if err != nil {
+		for _, path := range images {
+			os.Remove(path)
+		}
+	}
+	return err
+}
+
+// rejects archives whose entries claim to unpack past the limits, the sizes are
+// checked again while reading as headers can lie
+func checkArchiveLimits(files []*zip.File) error {
+	images := 0
+	var total uint64
+	for _, f := range files {
+		if isArchiveImage(f.Name) {
+			images++
+		}
+		total += f.UncompressedSize64
+	}
+	if images > maxArchiveImages {
+		return fmt.Errorf("%w: more than %d images", ErrInvalidArchive, maxArchiveImages)
+	}
+	if total > maxArchiveSize {
+		return fmt.Errorf("%w: unpacks to more than %d bytes", ErrInvalidArchive, maxArchiveSize)
+	}
+	return nil
+}
+
+func isArchiveImage(name string) bool {
+	dir, file := filepath.Split(name)
+	return dir == "images/" && file != ""
+}
+
+// creates the archived records, c runs in the imports transaction
+func importRecords(c context.Context, s Storage, username string, archived data.Resume, snapshots []*data.ResumeSnapshot, images []string) error {
+	current, err := LoadResume(c, s, username)
+	if err != nil {
+		return err
+	}
+	if current.Profile != nil || len(current.Projects) > 0 || len(current.Employments) > 0 || len(current.Hobbies) > 0 || len(current.Stacks) > 0 {
+		return ErrAccountNotEmpty
+	}
+	owner := resumeOwner(current.User)
+
+	// user details, the accounts credentials are kept
+	user := archived.User
+	user.Username = username
+	user.Version = current.User.Version
+	if err := s.UpdateUser(c, user); err != nil {
+		return err
+	}
+	if err := s.SetUserSocials(c, user); err != nil {
+		return err
+	}
+
+	if archived.Profile != nil {
+		profile := *archived.Profile
+		profile.User = owner
+		if err := s.CreateProfile(c, profile); err != nil {
+			return err
+		}
+	}
+
+	// archived stack ids to the ids of the created stacks
+	stack_ids := map[int]int{}
+	for _, t := range archived.Stacks {
+		t.User = owner
+		if err := s.CreateTechStack(c, t); err != nil {
+			return err
+		}
+		created, err := s.GetTechStacks(c, map[string]string{"name": t.Name, "username": username})
+		if err != nil {
+			return err
+		}
+		stack_ids[t.Id] = latestId(created)
+	}
+
+	for _, p := range archived.Projects {
+		p.User = owner
+		if err := s.CreateProject(c, p); err != nil {
+			return err
+		}
+		created, _, err := s.GetProjects(c, map[string]string{"name": p.Name, "username": username}, Page{Sort: "-id", Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(created) == 0 {
+			return ErrInvalidArchive
+		}
+		for _, t := range missingStacks(nil, p.Stack, stack_ids) {
+			if err := s.AddTechStackToProject(c, t, *created[0]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range archived.Employments {
+		e.User = owner
+		if err := s.CreateEmployment(c, e); err != nil {
+			return err
+		}
+		created, _, err := s.GetEmployments(c, map[string]string{"name": e.Name, "username": username}, Page{Sort: "-id", Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(created) == 0 {
+			return ErrInvalidArchive
+		}
+		for _, t := range missingStacks(nil, e.Stack, stack_ids) {
+			if err := s.AddTechStackToEmployment(c, t, data.Project{Id: created[0].Id}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, h := range archived.Hobbies {
+		h.User = owner
+		if err := s.CreateHobby(c, h); err != nil {
+			return err
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		snapshot.User = owner
+		if err := s.CreateResumeSnapshot(c, *snapshot); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range images {
+		if err := s.CreateUserimage(c, owner, filepath.ToSlash(path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// counts the bytes unpacked from an archive against maxArchiveSize
+type archiveBudget struct {
+	remaining int64
+}
+
+// copies one archive file to dst, failing when it is larger than maxArchiveFile
+// or the budget runs out
+func (b *archiveBudget) copy(dst io.Writer, f *zip.File) error {
+	src, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+	}
+	defer src.Close()
+
+	limit := min(maxArchiveFile, b.remaining)
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	b.remaining -= n
+	if err == nil && n > limit {
+		err = fmt.Errorf("%w: %s is too large", ErrInvalidArchive, f.Name)
+	}
+	return err
+}
+
+func readArchiveJSON(files map[string]*zip.File, name string, v any, budget *archiveBudget) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%w: missing %s", ErrInvalidArchive, name)
+	}
+
+	var content bytes.Buffer
+	if err := budget.copy(&content, f); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content.Bytes(), v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+	}
+	return nil
+}
+
+// copies archived images into media_dir under new names so existing uploads are
+// not replaced, returning their paths. nothing is left behind when one fails
+func unpackImages(files []*zip.File, media_dir string, budget *archiveBudget) ([]string, error) {
+	paths := []string{}
+	for _, f := range files {
+		if !isArchiveImage(f.Name) {
+			continue
+		}
+
+		path := filepath.Join(media_dir, GenerateRecordId()+filepath.Ext(f.Name))
+		if err := copyArchiveFile(f, path, budget); err != nil {
+			for _, p := range paths {
+				os.Remove(p)
+			}
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func copyArchiveFile(f *zip.File, path string, budget *archiveBudget) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = budget.copy(dst, f)
+	if close_err := dst.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
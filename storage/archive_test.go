@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+func TestExportImportAccount(t *testing.T) {
+	c := context.Background()
+
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateProfile(c, data.Profile{User: *user, Role: "backend developer", About: "writes go"})
+	s.CreateHobby(c, *user.NewHobby("chess"))
+	s.CreateTechStack(c, *user.NewTechStack("go"))
+	s.CreateProject(c, data.Project{User: *user, Name: "resume generator", Status: "active", Description: "builds resumes"})
+	s.CreateEmployment(c, data.Employment{User: *user, Name: "acme", Employee: "developer", Status: "ended"})
+
+	stacks, _ := s.GetTechStacks(c, map[string]string{"username": user.Username})
+	projects, _, _ := s.GetProjects(c, map[string]string{"username": user.Username}, Page{})
+	employments, _, _ := s.GetEmployments(c, map[string]string{"username": user.Username}, Page{})
+	s.AddTechStackToProject(c, *stacks[0], *projects[0])
+	s.AddTechStackToEmployment(c, *stacks[0], data.Project{Id: employments[0].Id})
+
+	media_dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(media_dir, "avatar.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateUserimage(c, *user, "media/users/images/avatar.png")
+
+	original, _ := LoadResume(c, s, user.Username)
+	s.CreateResumeSnapshot(c, data.ResumeSnapshot{User: *user, Label: "client a", Resume: *original})
+
+	var archive bytes.Buffer
+	if err := ExportAccount(c, s, user.Username, media_dir, &archive); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(archive.String(), user.Password) {
+		t.Fatal("Expected the archive to leave out the password")
+	}
+
+	// restore into a fresh account on another storage
+	target, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+	restored_user := newTestUser("new", "user", "restored", "restored@gmail.com", "otherpassword", "", "", "", "2020-01-01")
+	if err := target.CreateUser(c, *restored_user); err != nil {
+		t.Fatal(err)
+	}
+
+	restored_media := t.TempDir()
+
+	// an import failing partway leaves nothing behind and can be retried
+	if _, err := target.db.Exec("CREATE TRIGGER hobbies_down BEFORE INSERT ON Hobbies BEGIN SELECT RAISE(ABORT, 'hobbies unavailable'); END"); err != nil {
+		t.Fatal(err)
+	}
+	reader := bytes.NewReader(archive.Bytes())
+	if err := ImportAccount(c, target, restored_user.Username, restored_media, reader, reader.Size()); err == nil {
+		t.Fatal("Expected the import to fail")
+	}
+	partial, _ := LoadResume(c, target, restored_user.Username)
+	unpacked, _ := os.ReadDir(restored_media)
+	if partial.Profile != nil || len(partial.Stacks) != 0 || len(partial.Projects) != 0 || len(unpacked) != 0 {
+		t.Errorf("Got %+v and %d files, Expected a failed import to leave nothing", partial, len(unpacked))
+	}
+	if _, err := target.db.Exec("DROP TRIGGER hobbies_down"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader = bytes.NewReader(archive.Bytes())
+	if err := ImportAccount(c, target, restored_user.Username, restored_media, reader, reader.Size()); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := LoadResume(c, target, restored_user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.User.Firstname != "phillip" || restored.User.Email != "restored@gmail.com" {
+		t.Errorf("Got %+v, Expected archived details with the accounts email", restored.User)
+	}
+	if restored.Profile == nil || restored.Profile.Role != "backend developer" {
+		t.Errorf("Got %+v, Expected the archived profile", restored.Profile)
+	}
+	if len(restored.Projects) != 1 || len(restored.Projects[0].Stack) != 1 || restored.Projects[0].Stack[0].Name != "go" {
+		t.Errorf("Got %+v, Expected the project with its linked stack", restored.Projects)
+	}
+	if len(restored.Employments) != 1 || len(restored.Employments[0].Stack) != 1 {
+		t.Errorf("Got %+v, Expected the employment with its linked stack", restored.Employments)
+	}
+	if len(restored.Hobbies) != 1 || len(restored.Stacks) != 1 {
+		t.Errorf("Got %d hobbies and %d stacks, Expected 1 of each", len(restored.Hobbies), len(restored.Stacks))
+	}
+
+	snapshots, _ := target.GetResumeSnapshots(c, restored_user.Username)
+	if len(snapshots) != 1 || snapshots[0].Label != "client a" || len(snapshots[0].Resume.Projects) != 1 {
+		t.Errorf("Got %+v, Expected the archived snapshot", snapshots)
+	}
+
+	images, _ := target.GetUserImages(c, restored_user.Username)
+	if len(images) != 1 {
+		t.Fatalf("Got %v, Expected one restored image", images)
+	}
+	if content, err := os.ReadFile(images[0]); err != nil || string(content) != "png" {
+		t.Errorf("Got %q %v, Expected the archived image content", content, err)
+	}
+
+	// importing twice would duplicate everything
+	reader = bytes.NewReader(archive.Bytes())
+	if err := ImportAccount(c, target, restored_user.Username, restored_media, reader, reader.Size()); !errors.Is(err, ErrAccountNotEmpty) {
+		t.Errorf("Got %v, Expected ErrAccountNotEmpty", err)
+	}
+
+	// archives unpacking to too many or too large files are refused
+	var many bytes.Buffer
+	z := zip.NewWriter(&many)
+	for i := 0; i <= maxArchiveImages; i++ {
+		f, _ := z.Create(fmt.Sprintf("images/%d.png", i))
+		f.Write([]byte("png"))
+	}
+	z.Close()
+	reader = bytes.NewReader(many.Bytes())
+	if err := ImportAccount(c, target, restored_user.Username, restored_media, reader, reader.Size()); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Got %v, Expected too many images to be refused", err)
+	}
+
+	var budget bytes.Buffer
+	z = zip.NewWriter(&budget)
+	f, _ := z.Create("manifest.json")
+	f.Write(bytes.Repeat([]byte(" "), 1<<20))
+	z.Close()
+	archived, _ := zip.NewReader(bytes.NewReader(budget.Bytes()), int64(budget.Len()))
+	if err := (&archiveBudget{remaining: 1 << 10}).copy(io.Discard, archived.File[0]); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Got %v, Expected files past the budget to be refused", err)
+	}
+
+	reader = bytes.NewReader([]byte("not a zip"))
+	if err := ImportAccount(c, target, restored_user.Username, restored_media, reader, reader.Size()); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("Got %v, Expected ErrInvalidArchive", err)
+	}
+}
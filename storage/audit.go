@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// audit actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// actor recorded when a change is not made on behalf of a user
+const SystemActor = "system"
+
+type actorKey struct{}
+
+// returns a context whose storage writes are attributed to the given actor
+func WithActor(c context.Context, actor string) context.Context {
+	return context.WithValue(c, actorKey{}, actor)
+}
+
+func actorFromContext(c context.Context) string {
+	actor, ok := c.Value(actorKey{}).(string)
+	if !ok || actor == "" {
+		return SystemActor
+	}
+	return actor
+}
+
+// appends an event to the AuditLog table, db should be the transaction of the
+// audited change so neither is kept without the other.
+// before and after are stored as json, pass nil when there is no state
+func recordAudit(ctx context.Context, db querier, action, entity string, entity_id int, owner string, before, after any) error {
+	before_json, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	after_json, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO AuditLog (actor, owner, entity, entity_id, action, before_data, after_data, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	_, err = db.ExecContext(ctx, query, actorFromContext(ctx), owner, entity, entity_id, action, before_json, after_json, time.Now())
+	return err
+}
+
+func auditJSON(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(auditSnapshot(v))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// strips credentials and nested owner records from what is written to the log
+func auditSnapshot(v any) any {
+	owner := func(u data.User) data.User {
+		return data.User{Id: u.Id, Username: u.Username}
+	}
+
+	switch e := v.(type) {
+	case data.User:
+		e.Password = ""
+		return e
+	case *data.User:
+		return auditSnapshot(*e)
+	case data.Profile:
+		e.User = owner(e.User)
+		return e
+	case *data.Profile:
+		return auditSnapshot(*e)
+	case data.Project:
+		e.User = owner(e.User)
+		return e
+	case *data.Project:
+		return auditSnapshot(*e)
+	case data.Employment:
+		e.User = owner(e.User)
+		return e
+	case *data.Employment:
+		return auditSnapshot(*e)
+	case data.Hobby:
+		e.User = owner(e.User)
+		return e
+	case *data.Hobby:
+		return auditSnapshot(*e)
+	case data.TechStack:
+		e.User = owner(e.User)
+		return e
+	case *data.TechStack:
+		return auditSnapshot(*e)
+	}
+	return v
+}
+
+// current social links of a user, recorded as the before state of updates
+func userSocials(ctx context.Context, db querier, user_id int) (map[string]string, error) {
+	var portfolio, github, linkedin, twitter sql.NullString
+	err := db.QueryRowContext(ctx, "SELECT portfolio, github, linkedin, twitter FROM Users WHERE id = $1", user_id).Scan(
+		&portfolio,
+		&github,
+		&linkedin,
+		&twitter,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"portfolio": portfolio.String,
+		"github":    github.String,
+		"linkedin":  linkedin.String,
+		"twitter":   twitter.String,
+	}, nil
+}
+
+// filters accepted by GetAuditLog
+var auditFilters = map[string]string{
+	"actor":     "actor = $%d",
+	"owner":     "owner = $%d",
+	"entity":    "entity = $%d",
+	"entity_id": "entity_id = $%d",
+	"action":    "action = $%d",
+}
+
+var auditSortKeys = []string{"id"}
+
+func auditSortValue(event *data.AuditEvent) (string, int) {
+	return "", event.Id
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]*data.AuditEvent, error) {
+	defer rows.Close()
+
+	events := []*data.AuditEvent{}
+	for rows.Next() {
+		event := new(data.AuditEvent)
+		err := rows.Scan(
+			&event.Id,
+			&event.Actor,
+			&event.Owner,
+			&event.Entity,
+			&event.Entity_id,
+			&event.Action,
+			&event.Before,
+			&event.After,
+			&event.Created_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+const auditColumns = "id, actor, owner, entity, entity_id, action, before_data, after_data, created_on"
+
+// newest events first unless another order was requested
+func auditPage(page Page) Page {
+	if page.Sort == "" {
+		page.Sort = "-id"
+	}
+	return page
+}
+
+func auditListQuery(keys map[string]string, page Page) (string, []any, error) {
+	query, args := filterClause(keys, auditFilters)
+	page_query, page_args, err := page.clause(auditSortKeys, "id", len(args), query != "")
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("SELECT %s FROM AuditLog%s%s", auditColumns, query, page_query), append(args, page_args...), nil
+}
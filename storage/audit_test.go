@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUpDB(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	c := WithActor(context.Background(), user.Username)
+
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateHobby(c, *user.NewHobby("chess")); err != nil {
+		t.Fatal(err)
+	}
+	hobbies, _, _ := s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	if err := s.DeleteHobby(context.Background(), hobbies[0].Id); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _, err := s.GetAuditLog(c, map[string]string{"owner": user.Username}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct{ action, entity, actor string }{
+		{AuditDelete, "hobby", SystemActor},
+		{AuditCreate, "hobby", user.Username},
+		{AuditCreate, "user", user.Username},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("Got %d events, Expected: %d", len(events), len(expected))
+	}
+	for i, e := range expected {
+		if events[i].Action != e.action || events[i].Entity != e.entity || events[i].Actor != e.actor {
+			t.Errorf("Got %s %s by %s, Expected: %s %s by %s", events[i].Action, events[i].Entity, events[i].Actor, e.action, e.entity, e.actor)
+		}
+	}
+
+	if events[0].Before == "" || events[0].After != "" {
+		t.Errorf("Got before %q after %q, Expected only before state for deletes", events[0].Before, events[0].After)
+	}
+	if strings.Contains(events[2].After, user.Password) {
+		t.Errorf("Expected password hash to be left out of the audit log")
+	}
+
+	// the log is append only
+	if _, err := s.db.Exec("DELETE FROM AuditLog"); err == nil {
+		t.Errorf("Expected deleting audit events to fail")
+	}
+}
+
+func TestAuditLogAtomic(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	// a change whose event can not be recorded is not made
+	if _, err := s.db.Exec("CREATE TRIGGER auditlog_down BEFORE INSERT ON AuditLog BEGIN SELECT RAISE(ABORT, 'audit log unavailable'); END"); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := s.GetUsers(c, map[string]string{"username": user.Username})
+	users[0].Bio = "changed"
+	if err := s.UpdateUser(c, *users[0]); err == nil {
+		t.Fatal("Expected the update to fail with the audit log")
+	}
+	if err := s.CreateHobby(c, *user.NewHobby("chess")); err == nil {
+		t.Fatal("Expected creating a hobby to fail with the audit log")
+	}
+
+	users, _ = s.GetUsers(c, map[string]string{"username": user.Username})
+	hobbies, _, _ := s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	if users[0].Bio != user.Bio || users[0].Version != 1 || len(hobbies) != 0 {
+		t.Errorf("Got bio %q version %d and %d hobbies, Expected the changes to be rolled back", users[0].Bio, users[0].Version, len(hobbies))
+	}
+}
+
+func TestSetUserPasswordAtomic(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := s.GetUsers(c, map[string]string{"username": user.Username})
+	session, _ := users[0].NewSession(time.Hour)
+	if err := s.CreateSession(c, *session); err != nil {
+		t.Fatal(err)
+	}
+
+	// the password stays when the sessions can not be ended
+	if _, err := s.db.Exec("CREATE TRIGGER sessions_stuck BEFORE DELETE ON Sessions BEGIN SELECT RAISE(ABORT, 'sessions unavailable'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserPassword(c, user.Username, "new hash"); err == nil {
+		t.Fatal("Expected the password change to fail")
+	}
+	users, _ = s.GetUsers(c, map[string]string{"username": user.Username})
+	if users[0].Password != user.Password {
+		t.Errorf("Expected the password to be unchanged")
+	}
+
+	if _, err := s.db.Exec("DROP TRIGGER sessions_stuck"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserPassword(c, user.Username, "new hash"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSession(c, session.Key); err == nil {
+		t.Errorf("Expected the session to end with the password change")
+	}
+}
@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+const (
+	DefaultCacheSize = 1000
+	DefaultCacheTTL  = 30 * time.Second
+)
+
+// groups cached reads are invalidated by
+const (
+	cacheUsers       = "users"
+	cacheProfiles    = "profiles"
+	cacheProjects    = "projects"
+	cacheEmployments = "employments"
+	cacheHobbies     = "hobbies"
+	cacheStacks      = "stacks"
+	cacheSnapshots   = "snapshots"
+	cacheSearch      = "search"
+	cacheResumes     = "resumes"
+)
+
+// hit and miss counts of a CachedStorage
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+type cacheEntry struct {
+	key     string
+	group   string
+	value   any
+	expires time.Time
+}
+
+// a fixed size least recently used cache whose entries expire after ttl
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (l *lruCache) get(key string) (any, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		l.misses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		l.remove(el)
+		l.misses.Add(1)
+		return nil, false
+	}
+
+	l.order.MoveToFront(el)
+	l.hits.Add(1)
+	return entry.value, true
+}
+
+func (l *lruCache) set(group, key string, value any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[key]; ok {
+		l.remove(el)
+	}
+
+	l.entries[key] = l.order.PushFront(&cacheEntry{
+		key:     key,
+		group:   group,
+		value:   value,
+		expires: time.Now().Add(l.ttl),
+	})
+
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+// drops every entry in the given groups, all entries when none are given
+func (l *lruCache) invalidate(groups ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	drop := map[string]bool{}
+	for _, g := range groups {
+		drop[g] = true
+	}
+
+	for el := l.order.Front(); el != nil; {
+		next := el.Next()
+		if len(groups) == 0 || drop[el.Value.(*cacheEntry).group] {
+			l.remove(el)
+		}
+		el = next
+	}
+}
+
+func (l *lruCache) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.entries, el.Value.(*cacheEntry).key)
+}
+
+func (l *lruCache) stats() CacheStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return CacheStats{
+		Hits:    l.hits.Load(),
+		Misses:  l.misses.Load(),
+		Entries: l.order.Len(),
+	}
+}
+
+// a listing result together with its next page cursor
+type cachedPage[T any] struct {
+	records []*T
+	next    string
+}
+
+// returns a cached value or loads and caches it, errors are not cached
+func cacheLoad[T any](c context.Context, l *lruCache, group, key string, load func() (T, error)) (T, error) {
+	// reads in a transaction may see changes that are rolled back
+	if inTransaction(c) {
+		return load()
+	}
+	if v, ok := l.get(key); ok {
+		return v.(T), nil
+	}
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	l.set(group, key, v)
+	return v, nil
+}
+
+func cacheKey(method string, args ...any) string {
+	// fmt prints maps with sorted keys so equal filters give equal keys
+	return fmt.Sprintf("%s%#v", method, args)
+}
+
+// copies records so callers can modify what they get without changing the cache
+func cloneRecords[T any](records []*T) []*T {
+	if records == nil {
+		return nil
+	}
+	clones := make([]*T, len(records))
+	for i, r := range records {
+		clones[i] = cloneRecord(r)
+	}
+	return clones
+}
+
+func cloneRecord[T any](record *T) *T {
+	if record == nil {
+		return nil
+	}
+	clone := *record
+	return &clone
+}
+
+// copies a resume and its lists, list items are values so they are copied too
+func cloneResume(r *data.Resume) *data.Resume {
+	if r == nil {
+		return nil
+	}
+	clone := *r
+	clone.Profile = cloneRecord(r.Profile)
+	clone.Projects = append([]data.Project{}, r.Projects...)
+	clone.Employments = append([]data.Employment{}, r.Employments...)
+	clone.Hobbies = append([]data.Hobby{}, r.Hobbies...)
+	clone.Stacks = append([]data.TechStack{}, r.Stacks...)
+	return &clone
+}
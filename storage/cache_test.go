@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCachedStorage(t *testing.T) {
+	store, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := store.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+	s := NewCachedStorage(store, 10, time.Minute)
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateHobby(c, *user.NewHobby("chess"))
+
+	keys := map[string]string{"username": user.Username}
+	hobbies, _, _ := s.GetHobbies(c, keys, Page{})
+	hobbies[0].Name = "changed by caller"
+
+	hobbies, _, _ = s.GetHobbies(c, keys, Page{})
+	if stats := s.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Got %+v, Expected 1 hit and 1 miss", stats)
+	}
+	if hobbies[0].Name != "chess" {
+		t.Errorf("Got %s, Expected cached records to be unaffected by callers", hobbies[0].Name)
+	}
+
+	// writes invalidate cached reads
+	s.CreateHobby(c, *user.NewHobby("hiking"))
+	hobbies, _, _ = s.GetHobbies(c, keys, Page{})
+	if len(hobbies) != 2 {
+		t.Errorf("Got %d hobbies, Expected: 2", len(hobbies))
+	}
+
+	// reads in a rolled back transaction are not cached
+	s.Atomic(c, func(c context.Context) error {
+		s.CreateHobby(c, *user.NewHobby("rolled back"))
+		s.GetHobbies(c, keys, Page{})
+		return errors.New("roll back")
+	})
+	hobbies, _, _ = s.GetHobbies(c, keys, Page{})
+	if len(hobbies) != 2 {
+		t.Errorf("Got %d hobbies, Expected the rolled back hobby to be gone", len(hobbies))
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	l := newLRUCache(2, time.Minute)
+	l.set("a", "1", 1)
+	l.set("a", "2", 2)
+	l.get("1")
+	l.set("b", "3", 3)
+
+	// least recently used entry is evicted
+	if _, ok := l.get("2"); ok {
+		t.Error("Expected entry 2 to be evicted")
+	}
+	if _, ok := l.get("1"); !ok {
+		t.Error("Expected entry 1 to be kept")
+	}
+
+	l.invalidate("b")
+	if _, ok := l.get("3"); ok {
+		t.Error("Expected group b to be invalidated")
+	}
+
+	l = newLRUCache(2, time.Millisecond)
+	l.set("a", "1", 1)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := l.get("1"); ok {
+		t.Error("Expected entry to expire")
+	}
+}
@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// CachedStorage wraps a Storage caching read results in memory.
+// Writes go to the wrapped storage and drop cached reads they may affect.
+// Sessions, API tokens, email tokens, webhooks, trash and the audit log are always read from the wrapped storage.
+type CachedStorage struct {
+	Storage
+	cache *lruCache
+}
+
+// size is the maximum number of cached results, each kept for at most ttl
+func NewCachedStorage(s Storage, size int, ttl time.Duration) *CachedStorage {
+	return &CachedStorage{
+		Storage: s,
+		cache:   newLRUCache(size, ttl),
+	}
+}
+
+func (s *CachedStorage) Stats() CacheStats {
+	return s.cache.stats()
+}
+
+// drops all cached reads
+func (s *CachedStorage) Flush() {
+	s.cache.invalidate()
+}
+
+// reads outside the transaction may cache what was stored before it committed,
+// so everything is dropped once it ends
+func (s *CachedStorage) Atomic(c context.Context, fn func(context.Context) error) error {
+	err := s.Storage.Atomic(c, fn)
+	s.cache.invalidate()
+	return err
+}
+
+// invalidates the given groups when a write succeeds.
+// user records are embedded in every other record so user writes flush everything.
+// whole resumes depend on every group and are dropped on any write
+func (s *CachedStorage) written(err error, groups ...string) error {
+	if err != nil {
+		return err
+	}
+	if len(groups) > 0 {
+		groups = append(groups, cacheResumes)
+	}
+	s.cache.invalidate(groups...)
+	return nil
+}
+
+// user data
+
+func (s *CachedStorage) GetUsers(c context.Context, keys map[string]string) ([]*data.User, error) {
+	users, err := cacheLoad(c, s.cache, cacheUsers, cacheKey("GetUsers", keys), func() ([]*data.User, error) {
+		return s.Storage.GetUsers(c, keys)
+	})
+	return cloneRecords(users), err
+}
+
+func (s *CachedStorage) CreateUser(c context.Context, u data.User) error {
+	return s.written(s.Storage.CreateUser(c, u))
+}
+
+func (s *CachedStorage) CreateUserimage(c context.Context, u data.User, filename string) error {
+	return s.written(s.Storage.CreateUserimage(c, u, filename))
+}
+
+func (s *CachedStorage) UpdateUser(c context.Context, u data.User) error {
+	return s.written(s.Storage.UpdateUser(c, u))
+}
+
+func (s *CachedStorage) DeleteUser(c context.Context, u data.User) error {
+	return s.written(s.Storage.DeleteUser(c, u))
+}
+
+func (s *CachedStorage) RestoreUser(c context.Context, username string) error {
+	return s.written(s.Storage.RestoreUser(c, username))
+}
+
+func (s *CachedStorage) SetUserPassword(c context.Context, username, password_hash string) error {
+	return s.written(s.Storage.SetUserPassword(c, username, password_hash), cacheUsers)
+}
+
+func (s *CachedStorage) VerifyUserEmail(c context.Context, username string) ([]*data.User, error) {
+	users, err := s.Storage.VerifyUserEmail(c, username)
+	return users, s.written(err)
+}
+
+func (s *CachedStorage) SetUserSocials(c context.Context, u data.User) error {
+	return s.written(s.Storage.SetUserSocials(c, u))
+}
+
+// profile
+
+func (s *CachedStorage) GetProfile(c context.Context, username string) (*data.Profile, error) {
+	profile, err := cacheLoad(c, s.cache, cacheProfiles, cacheKey("GetProfile", username), func() (*data.Profile, error) {
+		return s.Storage.GetProfile(c, username)
+	})
+	return cloneRecord(profile), err
+}
+
+func (s *CachedStorage) GetProfileByRole(c context.Context, role string, page Page) ([]*data.Profile, string, error) {
+	result, err := cacheLoad(c, s.cache, cacheProfiles, cacheKey("GetProfileByRole", role, page), func() (cachedPage[data.Profile], error) {
+		records, next, err := s.Storage.GetProfileByRole(c, role, page)
+		return cachedPage[data.Profile]{records, next}, err
+	})
+	return cloneRecords(result.records), result.next, err
+}
+
+func (s *CachedStorage) CreateProfile(c context.Context, p data.Profile) error {
+	return s.written(s.Storage.CreateProfile(c, p), cacheProfiles, cacheSearch)
+}
+
+func (s *CachedStorage) UpdateProfile(c context.Context, p data.Profile) error {
+	return s.written(s.Storage.UpdateProfile(c, p), cacheProfiles, cacheSearch)
+}
+
+func (s *CachedStorage) DeleteProfile(c context.Context, p data.Profile) error {
+	return s.written(s.Storage.DeleteProfile(c, p), cacheProfiles, cacheSearch)
+}
+
+// Projects
+
+func (s *CachedStorage) GetProjects(c context.Context, keys map[string]string, page Page) ([]*data.Project, string, error) {
+	result, err := cacheLoad(c, s.cache, cacheProjects, cacheKey("GetProjects", keys, page), func() (cachedPage[data.Project], error) {
+		records, next, err := s.Storage.GetProjects(c, keys, page)
+		return cachedPage[data.Project]{records, next}, err
+	})
+	return cloneRecords(result.records), result.next, err
+}
+
+func (s *CachedStorage) GetProjectsByTechStack(c context.Context, keys map[string]string) ([]*data.Project, error) {
+	projects, err := cacheLoad(c, s.cache, cacheProjects, cacheKey("GetProjectsByTechStack", keys), func() ([]*data.Project, error) {
+		return s.Storage.GetProjectsByTechStack(c, keys)
+	})
+	return cloneRecords(projects), err
+}
+
+func (s *CachedStorage) CreateProject(c context.Context, p data.Project) error {
+	return s.written(s.Storage.CreateProject(c, p), cacheProjects, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) UpdateProject(c context.Context, p data.Project) error {
+	return s.written(s.Storage.UpdateProject(c, p), cacheProjects, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) DeleteProject(c context.Context, id int) error {
+	return s.written(s.Storage.DeleteProject(c, id), cacheProjects, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) RestoreProject(c context.Context, id int) error {
+	return s.written(s.Storage.RestoreProject(c, id), cacheProjects, cacheStacks, cacheSearch)
+}
+
+// Employment
+
+func (s *CachedStorage) GetEmployments(c context.Context, keys map[string]string, page Page) ([]*data.Employment, string, error) {
+	result, err := cacheLoad(c, s.cache, cacheEmployments, cacheKey("GetEmployments", keys, page), func() (cachedPage[data.Employment], error) {
+		records, next, err := s.Storage.GetEmployments(c, keys, page)
+		return cachedPage[data.Employment]{records, next}, err
+	})
+	return cloneRecords(result.records), result.next, err
+}
+
+func (s *CachedStorage) GetEmploymentsByTechStack(c context.Context, keys map[string]string) ([]*data.Employment, error) {
+	employments, err := cacheLoad(c, s.cache, cacheEmployments, cacheKey("GetEmploymentsByTechStack", keys), func() ([]*data.Employment, error) {
+		return s.Storage.GetEmploymentsByTechStack(c, keys)
+	})
+	return cloneRecords(employments), err
+}
+
+func (s *CachedStorage) CreateEmployment(c context.Context, e data.Employment) error {
+	return s.written(s.Storage.CreateEmployment(c, e), cacheEmployments, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) UpdateEmployment(c context.Context, e data.Employment) error {
+	return s.written(s.Storage.UpdateEmployment(c, e), cacheEmployments, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) DeleteEmployment(c context.Context, id int) error {
+	return s.written(s.Storage.DeleteEmployment(c, id), cacheEmployments, cacheStacks, cacheSearch)
+}
+
+func (s *CachedStorage) RestoreEmployment(c context.Context, id int) error {
+	return s.written(s.Storage.RestoreEmployment(c, id), cacheEmployments, cacheStacks, cacheSearch)
+}
+
+// Hobby
+
+func (s *CachedStorage) GetHobbies(c context.Context, keys map[string]string, page Page) ([]*data.Hobby, string, error) {
+	result, err := cacheLoad(c, s.cache, cacheHobbies, cacheKey("GetHobbies", keys, page), func() (cachedPage[data.Hobby], error) {
+		records, next, err := s.Storage.GetHobbies(c, keys, page)
+		return cachedPage[data.Hobby]{records, next}, err
+	})
+	return cloneRecords(result.records), result.next, err
+}
+
+func (s *CachedStorage) CreateHobby(c context.Context, h data.Hobby) error {
+	return s.written(s.Storage.CreateHobby(c, h), cacheHobbies)
+}
+
+func (s *CachedStorage) UpdateHobby(c context.Context, h data.Hobby) error {
+	return s.written(s.Storage.UpdateHobby(c, h), cacheHobbies)
+}
+
+func (s *CachedStorage) DeleteHobby(c context.Context, id int) error {
+	return s.written(s.Storage.DeleteHobby(c, id), cacheHobbies)
+}
+
+func (s *CachedStorage) RestoreHobby(c context.Context, id int) error {
+	return s.written(s.Storage.RestoreHobby(c, id), cacheHobbies)
+}
+
+// TechStack, stacks are embedded in projects and employments
+
+func (s *CachedStorage) GetTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	stacks, err := cacheLoad(c, s.cache, cacheStacks, cacheKey("GetTechStacks", keys), func() ([]*data.TechStack, error) {
+		return s.Storage.GetTechStacks(c, keys)
+	})
+	return cloneRecords(stacks), err
+}
+
+func (s *CachedStorage) GetProjectTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	stacks, err := cacheLoad(c, s.cache, cacheStacks, cacheKey("GetProjectTechStacks", keys), func() ([]*data.TechStack, error) {
+		return s.Storage.GetProjectTechStacks(c, keys)
+	})
+	return cloneRecords(stacks), err
+}
+
+func (s *CachedStorage) GetEmploymentTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	stacks, err := cacheLoad(c, s.cache, cacheStacks, cacheKey("GetEmploymentTechStacks", keys), func() ([]*data.TechStack, error) {
+		return s.Storage.GetEmploymentTechStacks(c, keys)
+	})
+	return cloneRecords(stacks), err
+}
+
+func (s *CachedStorage) CreateTechStack(c context.Context, t data.TechStack) error {
+	return s.written(s.Storage.CreateTechStack(c, t), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+func (s *CachedStorage) AddTechStackToProject(c context.Context, t data.TechStack, p data.Project) error {
+	return s.written(s.Storage.AddTechStackToProject(c, t, p), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+func (s *CachedStorage) AddTechStackToEmployment(c context.Context, t data.TechStack, p data.Project) error {
+	return s.written(s.Storage.AddTechStackToEmployment(c, t, p), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+func (s *CachedStorage) UpdateTechStack(c context.Context, t data.TechStack) error {
+	return s.written(s.Storage.UpdateTechStack(c, t), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+func (s *CachedStorage) DeleteTechStack(c context.Context, id int) error {
+	return s.written(s.Storage.DeleteTechStack(c, id), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+func (s *CachedStorage) RestoreTechStack(c context.Context, id int) error {
+	return s.written(s.Storage.RestoreTechStack(c, id), cacheStacks, cacheProjects, cacheEmployments, cacheSearch)
+}
+
+// Trash
+
+func (s *CachedStorage) PurgeTrash(c context.Context, before time.Time) (int64, error) {
+	purged, err := s.Storage.PurgeTrash(c, before)
+	if purged > 0 {
+		s.cache.invalidate()
+	}
+	return purged, err
+}
+
+// Resume
+
+func (s *CachedStorage) LoadResumeAggregate(c context.Context, user_id int) (*data.Resume, error) {
+	resume, err := cacheLoad(c, s.cache, cacheResumes, cacheKey("LoadResumeAggregate", user_id), func() (*data.Resume, error) {
+		return s.Storage.LoadResumeAggregate(c, user_id)
+	})
+	return cloneResume(resume), err
+}
+
+// Snapshots
+
+func (s *CachedStorage) CreateResumeSnapshot(c context.Context, snapshot data.ResumeSnapshot) error {
+	return s.written(s.Storage.CreateResumeSnapshot(c, snapshot), cacheSnapshots)
+}
+
+func (s *CachedStorage) GetResumeSnapshots(c context.Context, username string) ([]*data.ResumeSnapshot, error) {
+	snapshots, err := cacheLoad(c, s.cache, cacheSnapshots, cacheKey("GetResumeSnapshots", username), func() ([]*data.ResumeSnapshot, error) {
+		return s.Storage.GetResumeSnapshots(c, username)
+	})
+	return cloneRecords(snapshots), err
+}
+
+func (s *CachedStorage) GetResumeSnapshot(c context.Context, id int) (*data.ResumeSnapshot, error) {
+	snapshot, err := cacheLoad(c, s.cache, cacheSnapshots, cacheKey("GetResumeSnapshot", id), func() (*data.ResumeSnapshot, error) {
+		return s.Storage.GetResumeSnapshot(c, id)
+	})
+	return cloneRecord(snapshot), err
+}
+
+// Search
+
+func (s *CachedStorage) Search(c context.Context, query string, limit int) ([]*data.SearchResult, error) {
+	results, err := cacheLoad(c, s.cache, cacheSearch, cacheKey("Search", query, limit), func() ([]*data.SearchResult, error) {
+		return s.Storage.Search(c, query, limit)
+	})
+	return cloneRecords(results), err
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// matches every ConflictError with errors.Is
+var ErrConflict = errors.New("record was changed since it was loaded")
+
+// ConflictError is returned by updates whose Version does not match the stored
+// record, meaning someone else saved it after the caller loaded it.
+type ConflictError struct {
+	Entity  string
+	Id      int
+	Version int // version the update was based on
+	Current any // stored record when known, reload it when nil
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s %d: %v", e.Entity, e.Id, ErrConflict)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// tables whose records carry a version
+var versionTables = []string{"Users", "Profiles", "Projects", "Employments", "Hobbies", "TechStacks"}
+
+// checks that an update guarded by "version = $n" changed a row.
+// no rows means the record was saved by someone else in the meantime
+func versionUpdated(result sql.Result, conflict *ConflictError) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return conflict
+	}
+	return nil
+}
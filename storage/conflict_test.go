@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+func TestUpdateConflict(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateProject(c, data.Project{User: *user, Name: "resume generator"})
+
+	projects, _, _ := s.GetProjects(c, map[string]string{"username": user.Username}, Page{})
+	if projects[0].Version != 1 {
+		t.Fatalf("Got version %d, Expected: 1", projects[0].Version)
+	}
+
+	// two tabs load the same version
+	first, second := *projects[0], *projects[0]
+
+	first.Name = "first tab"
+	if err := s.UpdateProject(c, first); err != nil {
+		t.Fatal(err)
+	}
+
+	second.Name = "second tab"
+	err = s.UpdateProject(c, second)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("Got %v, Expected a conflict", err)
+	}
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Current.(*data.Project).Name != "first tab" {
+		t.Errorf("Got %+v, Expected conflict with the saved record", conflict)
+	}
+
+	projects, _, _ = s.GetProjects(c, map[string]string{"username": user.Username}, Page{})
+	if projects[0].Name != "first tab" || projects[0].Version != 2 {
+		t.Errorf("Got %s version %d, Expected first tab version 2", projects[0].Name, projects[0].Version)
+	}
+}
@@ -1,9 +1,15 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -11,7 +17,9 @@ import (
 )
 
 type MemoryStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
+	fts          bool // fts5 module available
 }
 
 func NewMemoryStorage() (*MemoryStorage, error) {
@@ -21,12 +29,62 @@ func NewMemoryStorage() (*MemoryStorage, error) {
 	}
 	fmt.Println("Database Connection Successful...")
 	return &MemoryStorage{
-		db: db,
+		db:           db,
+		queryTimeout: queryTimeoutFromEnv(),
 	}, nil
 }
 
+// sets the maximum duration a single storage call may run for
+func (s *MemoryStorage) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
+// checks the database can be reached
+func (s *MemoryStorage) Ping(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "Ping")
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// closes the connection pool, waiting for running queries to finish
+func (s *MemoryStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *MemoryStorage) Atomic(c context.Context, fn func(context.Context) error) error {
+	return runAtomic(c, s.db, "memory", fn)
+}
+
+// method names the Storage method for metrics and tracing, empty for helpers
+func (s *MemoryStorage) queryContext(c context.Context, method string) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(c, s.queryTimeout, "memory", method)
+}
+
+// like queryContext for methods that write, see withTransaction
+func (s *MemoryStorage) writeContext(c context.Context, method string) (context.Context, func(*error), error) {
+	return withTransaction(c, s.db, s.queryTimeout, "memory", method)
+}
+
+// the transaction ctx runs in, otherwise the connection pool
+func (s *MemoryStorage) conn(ctx context.Context) querier {
+	return txConn(ctx, s.db)
+}
+
+// runs an INSERT and returns the id of the new row
+func (s *MemoryStorage) insert(ctx context.Context, query string, args ...any) (int, error) {
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
 func initMemDB() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", ":memory:")
+	// a plain :memory: database is private to a single connection, share one
+	// named in-memory database across the pool instead
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_foreign_keys=1", GenerateRecordId())
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, errors.New("couldnot connect to database")
 	}
@@ -39,44 +97,68 @@ func initMemDB() (*sql.DB, error) {
 }
 
 // create required tables in db: Users
-func (s *MemoryStorage) SetUpDB() error {
-	if err := s.createUserTable(); err != nil {
+func (s *MemoryStorage) SetUpDB(c context.Context) error {
+	if err := s.createUserTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createUserImageTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createProfileTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createSessionTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createProjectTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createEmploymentTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createTechStackTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createUserImageTable(); err != nil {
+	if err := s.createProjectTechStackTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProfileTable(); err != nil {
+	if err := s.createEmploymentTechStackTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createSessionTable(); err != nil {
+	if err := s.createHobbiesTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProjectTable(); err != nil {
+	if err := s.createAuditLogTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createEmploymentTable(); err != nil {
+	if err := s.createResumeSnapshotTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createTechStackTable(); err != nil {
+	if err := s.createApiTokenTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProjectTechStackTable(); err != nil {
+	if err := s.createEmailTokenTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createEmploymentTechStackTable(); err != nil {
+	if err := s.createWebhookTables(c); err != nil {
 		return err
 	}
 
-	if err := s.createHobbiesTable(); err != nil {
+	if err := s.createSearchIndex(c); err != nil {
 		return err
 	}
 
@@ -85,7 +167,10 @@ func (s *MemoryStorage) SetUpDB() error {
 
 // Users
 
-func (s *MemoryStorage) createUserTable() error {
+func (s *MemoryStorage) createUserTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Users (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		username VARCHAR(255) NOT NULL UNIQUE,
@@ -105,63 +190,55 @@ func (s *MemoryStorage) createUserTable() error {
 		portfolio VARCHAR(255) NULL,
 		github VARCHAR(255) NULL,
 		linkedin VARCHAR(255) NULL,
-		twitter VARCHAR(255) NULL
+		twitter VARCHAR(255) NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) createUserImageTable() error {
+func (s *MemoryStorage) createUserImageTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS UserImages (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		filename VARCHAR(255) NOT NULL UNIQUE,
 		user_id INT REFERENCES Users(id) ON DELETE CASCADE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) GetUsers(keywords map[string]string) ([]*data.User, error) {
-
-	id, ok := keywords["user_id"]
-	if !ok {
-		id = ""
-	}
-
-	username, ok := keywords["username"]
-	if !ok {
-		username = ""
-	}
-
-	email, ok := keywords["email"]
-	if !ok {
-		email = ""
-	}
-
-	var (
-		rows *sql.Rows
-		err  error
-	)
+func (s *MemoryStorage) GetUsers(c context.Context, keys map[string]string) ([]*data.User, error) {
+	// expects keys: id, username, email
+	ctx, cancel := s.queryContext(c, "GetUsers")
+	defer cancel()
 
-	if len(keywords) == 0 {
-		query := `SELECT username, firstname, lastname, email, bio, phone, country FROM Users`
-		rows, err = s.db.Query(query)
-	} else {
-		query := `SELECT username, firstname, lastname, email, bio, phone, country FROM Users WHERE username = $1 OR email = $2 OR id = $3`
-		rows, err = s.db.Query(query, username, email, id)
-	}
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"username": "username = $%d",
+		"email":    "email = $%d",
+	})
 
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+userColumns+" FROM Users"+notDeleted(query), args...)
 	if err != nil {
 		return nil, err
 	}
 	return scanUsers(rows)
 }
-func (s *MemoryStorage) CreateUser(u data.User) error {
+func (s *MemoryStorage) CreateUser(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
 	query := `INSERT INTO Users (username, firstname, lastname, email, password, phone, country, created_on, updated_on, bio, start_date, years_of_work)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
 
-	_, err := s.db.Exec(
+	id, err := s.insert(ctx,
 		query,
 		u.Username,
 		u.Firstname,
@@ -176,57 +253,232 @@ func (s *MemoryStorage) CreateUser(u data.User) error {
 		u.Start_date,
 		u.Years_of_work,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	u.Id = fmt.Sprintf("%d", id)
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "user", id, u.Username, nil, u)
 }
 
-func (s *MemoryStorage) CreateUserimage(u data.User, filaname string) error {
+func (s *MemoryStorage) CreateUserimage(c context.Context, u data.User, filaname string) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateUserimage")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(u.Username)
+	user_id, f_err := s.getUserID(ctx, u.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	query := `INSERT INTO UserImages (filename,user) VALUES ($1, $2);`
+	query := `INSERT INTO UserImages (filename, user_id) VALUES ($1, $2);`
 
-	_, err := s.db.Query(
+	id, err := s.insert(ctx,
 		query,
-		user_id,
 		filaname,
+		user_id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "user_image", id, u.Username, nil, map[string]string{"filename": filaname})
+}
+
+// returns the filenames of a users uploaded images, oldest first
+func (s *MemoryStorage) GetUserImages(c context.Context, username string) ([]string, error) {
+	ctx, cancel := s.queryContext(c, "GetUserImages")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT i.filename FROM UserImages i JOIN Users u ON u.id = i.user_id WHERE u.username = $1 ORDER BY i.id", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filenames := []string{}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames, rows.Err()
 }
 
-func (s *MemoryStorage) SetUserSocials(u data.User) error {
+func (s *MemoryStorage) SetUserSocials(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "SetUserSocials")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(u.Username)
+	user_id, f_err := s.getUserID(ctx, u.Username)
 	if f_err != nil {
 		return f_err
 	}
 
+	before, err := userSocials(ctx, s.conn(ctx), user_id)
+	if err != nil {
+		return err
+	}
+
 	q := "UPDATE Users SET portfolio = $1, github = $2, linkedin = $3, twitter = $4 WHERE id = $5"
 
-	_, err := s.db.Exec(q, u.Portfolio, u.Github, u.Linkedin, u.Twitter, user_id)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, u.Portfolio, u.Github, u.Linkedin, u.Twitter, user_id)
+	if err != nil {
+		return err
+	}
+
+	after := map[string]string{"portfolio": u.Portfolio, "github": u.Github, "linkedin": u.Linkedin, "twitter": u.Twitter}
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user_socials", user_id, u.Username, before, after)
+}
+
+// replaces a users password hash and signs them out everywhere,
+// the password change, the end of the sessions and the audit event happen together
+func (s *MemoryStorage) SetUserPassword(c context.Context, username, password_hash string) (err error) {
+	ctx, end, err := s.writeContext(c, "SetUserPassword")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx, "UPDATE Users SET password = $1 WHERE id = $2", password_hash, user_id)
+	if err != nil {
+		return err
+	}
+
+	// sessions started with the old password end
+	_, err = s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE user_id = $1", user_id)
+	if err != nil {
+		return err
+	}
+
+	// hashes are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user_password", user_id, username, nil, map[string]bool{"password_changed": true})
 }
 
-func (s *MemoryStorage) VerifyUserEmail(username string) ([]*data.User, error) {
+func (s *MemoryStorage) VerifyUserEmail(c context.Context, username string) (_ []*data.User, err error) {
+	ctx, end, err := s.writeContext(c, "VerifyUserEmail")
+	if err != nil {
+		return nil, err
+	}
+	defer end(&err)
+
 	query := `UPDATE Users SET email_verified = TRUE  WHERE username = $1`
-	_, err := s.db.Exec(query, username)
+	_, err = s.conn(ctx).ExecContext(ctx, query, username)
 	if err != nil {
 		return nil, err
 	}
-	return s.GetUsers(map[string]string{"username": username})
+	users, err := s.GetUsers(ctx, map[string]string{"username": username})
+	if err != nil || len(users) == 0 {
+		return users, err
+	}
+
+	user_id, _ := strconv.Atoi(users[0].Id)
+	audit_err := recordAudit(ctx, s.conn(ctx), AuditUpdate, "user", user_id, username, map[string]bool{"email_verified": false}, map[string]bool{"email_verified": true})
+	return users, audit_err
 }
 
-func (s *MemoryStorage) DeleteUser(u data.User) error {
-	query := `DELETE FROM Users WHERE username = $1`
-	_, err := s.db.Exec(query, u.Username)
-	return err
+// updates a users personal details, credentials are changed separately
+func (s *MemoryStorage) UpdateUser(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	users, err := s.GetUsers(ctx, map[string]string{"username": u.Username})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return sql.ErrNoRows
+	}
+
+	user_id, _ := strconv.Atoi(users[0].Id)
+	if users[0].Version != u.Version {
+		return &ConflictError{Entity: "user", Id: user_id, Version: u.Version, Current: users[0]}
+	}
+
+	u.Updated_on = time.Now()
+	q := `UPDATE Users SET firstname = $1, lastname = $2, bio = $3, phone = $4, country = $5, updated_on = $6, version = version + 1
+	WHERE username = $7 AND version = $8 AND deleted_on IS NULL`
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, u.Firstname, u.Lastname, u.Bio, u.Phone, u.Country, u.Updated_on, u.Username, u.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "user", Id: user_id, Version: u.Version}); err != nil {
+		return err
+	}
+
+	u.Version++
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user", user_id, u.Username, users[0], u)
+}
+
+func (s *MemoryStorage) DeleteUser(c context.Context, u data.User) (err error) {
+	// moves the account to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, u.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `UPDATE Users SET deleted_on = $1 WHERE username = $2 AND deleted_on IS NULL`
+	_, err = s.conn(ctx).ExecContext(ctx, query, time.Now(), u.Username)
+	if err != nil {
+		return err
+	}
+
+	// a trashed account is signed out everywhere
+	_, err = s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE user_id = $1", user_id)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "user", user_id, u.Username, u, nil)
+}
+
+func (s *MemoryStorage) RestoreUser(c context.Context, username string) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	query := `UPDATE Users SET deleted_on = NULL WHERE username = $1`
+	_, err = s.conn(ctx).ExecContext(ctx, query, username)
+	if err != nil {
+		return err
+	}
+
+	user_id, err := s.getUserID(ctx, username)
+	if err != nil {
+		return err
+	}
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "user", user_id, username, nil, map[string]string{"username": username})
 }
 
-func (s *MemoryStorage) getUserID(username string) (int, error) {
+func (s *MemoryStorage) getUserID(c context.Context, username string) (int, error) {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	var user_id int
-	f_err := s.db.QueryRow("SELECT id FROM Users WHERE username = $1", username).Scan(&user_id)
+	f_err := s.conn(ctx).QueryRowContext(ctx, "SELECT id FROM Users WHERE username = $1 AND deleted_on IS NULL", username).Scan(&user_id)
 	if f_err != nil {
 		return 0, f_err
 	}
@@ -237,100 +489,173 @@ func (s *MemoryStorage) getUserID(username string) (int, error) {
 
 // Profile
 
-func (s *MemoryStorage) createProfileTable() error {
+func (s *MemoryStorage) createProfileTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Profiles (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
 		role VARCHAR(255) NOT NULL UNIQUE,
 		about TEXT NOT NULL,
-		views INT
+		views INT,
+		version INTEGER NOT NULL DEFAULT 1
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) GetProfile(username string) (*data.Profile, error) {
+func (s *MemoryStorage) GetProfile(c context.Context, username string) (*data.Profile, error) {
+	ctx, cancel := s.queryContext(c, "GetProfile")
+	defer cancel()
 
-	user_id, f_err := s.getUserID(username)
+	user_id, f_err := s.getUserID(ctx, username)
 	if f_err != nil {
 		return nil, f_err
 	}
 
-	profile := new(data.Profile)
-	q := s.db.QueryRow("SELECT user, role, about, views FROM Profiles WHERE user = $1", user_id)
-	err := q.Scan(
-		&profile.User,
-		&profile.Role,
-		&profile.About,
-		&profile.Views,
-	)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+profileColumns+" FROM Profiles WHERE user_id = $1", user_id)
 	if err != nil {
 		return nil, err
 	}
-	return profile, nil
-}
 
-func (s *MemoryStorage) GetProfileByRole(role string) ([]*data.Profile, error) {
-	rows, err := s.db.Query("SELECT user, role, views FROM Profiles WHERE role = $1", role)
+	profiles, err := s.scanProfiles(ctx, rows)
 	if err != nil {
 		return nil, err
 	}
+	if len(profiles) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return profiles[0], nil
+}
 
-	var profiles []*data.Profile
-	for rows.Next() {
-		profile := new(data.Profile)
-		err := rows.Scan(
-			profile.User,
-			profile.Role,
-			profile.About,
-			profile.Views,
-		)
-		if err != nil {
-			return nil, err
-		}
-		profiles = append(profiles, profile)
+func (s *MemoryStorage) GetProfileByRole(c context.Context, role string, page Page) ([]*data.Profile, string, error) {
+	ctx, cancel := s.queryContext(c, "GetProfileByRole")
+	defer cancel()
+
+	query := "SELECT " + profileColumns + " FROM Profiles WHERE role = $1"
+	page_query, page_args, err := page.clause(profileSortKeys, "id", 1, true)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return profiles, nil
+	rows, err := s.conn(ctx).QueryContext(ctx, query+page_query, append([]any{role}, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	profiles, err := s.scanProfiles(ctx, rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	profiles, next := nextCursor(page, profiles, profileSortValue(page))
+	return profiles, next, nil
+}
+
+func (s *MemoryStorage) scanProfiles(c context.Context, rows *sql.Rows) ([]*data.Profile, error) {
+	profiles, user_ids, err := scanProfileRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		profiles[i].User = u
+	})
+	return profiles, err
 }
 
-func (s *MemoryStorage) CreateProfile(p data.Profile) error {
+func (s *MemoryStorage) CreateProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
 	query := `INSERT INTO Profiles (user_id, role, about, views)
-	VALUES ($1, $2, $3);`
+	VALUES ($1, $2, $3, $4);`
 
-	_, err := s.db.Query(
+	id, err := s.insert(ctx,
 		query,
 		user_id,
 		p.Role,
 		p.About,
 		p.Views,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	p.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "profile", id, p.User.Username, nil, p)
+}
+
+func (s *MemoryStorage) UpdateProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	before, err := s.GetProfile(ctx, p.User.Username)
+	if err != nil {
+		return err
+	}
+
+	if before.Version != p.Version {
+		return &ConflictError{Entity: "profile", Id: before.Id, Version: p.Version, Current: before}
+	}
+
+	q := "UPDATE Profiles SET role = $1, about = $2, version = version + 1 WHERE id = $3 AND version = $4"
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, p.Role, p.About, before.Id, p.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "profile", Id: before.Id, Version: p.Version}); err != nil {
+		return err
+	}
+
+	p.Id = before.Id
+	p.Version++
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "profile", p.Id, p.User.Username, before, p)
 }
 
-func (s *MemoryStorage) DeleteProfile(p data.Profile) error {
-	q := "DELETE FROM Profiles WHERE User = $1 AND role = $2"
+func (s *MemoryStorage) DeleteProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "DELETE FROM Profiles WHERE user_id = $1 AND role = $2"
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Exec(q, user_id, p.Role)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, user_id, p.Role)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "profile", p.Id, p.User.Username, p, nil)
 }
 
 // Profile
 
 // Session
 
-func (s *MemoryStorage) createSessionTable() error {
+func (s *MemoryStorage) createSessionTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Sessions (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
@@ -338,59 +663,115 @@ func (s *MemoryStorage) createSessionTable() error {
 		expires_on TIMESTAMP,
 		expired BOOLEAN DEFAULT FALSE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) CreateSession(session data.Session) error {
-	query := "INSERT INTO Sessions (user_id, key, expires) VALUES ($1, $2, $3)"
+func (s *MemoryStorage) CreateSession(c context.Context, session data.Session) error {
+	ctx, cancel := s.queryContext(c, "CreateSession")
+	defer cancel()
 
-	user_id, f_err := s.getUserID(session.User.Username)
+	user_id, f_err := s.getUserID(ctx, session.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(query, user_id, session.Key)
+	// delete existing active sessions
+	_, delete_err := s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE user_id = $1", user_id)
+	if delete_err != nil {
+		return delete_err
+	}
+
+	query := "INSERT INTO Sessions (user_id, key, expires_on, expired) VALUES ($1, $2, $3, $4)"
+
+	_, err := s.conn(ctx).ExecContext(ctx, query, user_id, session.Key, session.Expires_on, session.Expired)
 	return err
 }
 
-func (s *MemoryStorage) GetSession(key string) (*data.Session, error) {
+func (s *MemoryStorage) GetSession(c context.Context, key string) (*data.Session, error) {
+	ctx, cancel := s.queryContext(c, "GetSession")
+	defer cancel()
+
+	var user_id int
 
 	session := new(data.Session)
-	q := s.db.QueryRow("SELECT Key, expires_on FROM Sessions WHERE Key = $1", key)
+	q := s.conn(ctx).QueryRowContext(ctx, "SELECT id, user_id, key, expires_on, expired FROM Sessions WHERE key = $1", key)
 	err := q.Scan(
+		&session.Id,
+		&user_id,
 		&session.Key,
 		&session.Expires_on,
+		&session.Expired,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	users, err := s.GetUsers(ctx, map[string]string{"id": fmt.Sprintf("%d", user_id)})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	session.User = *users[0]
 	return session, nil
 }
 
-func (s *MemoryStorage) DeleteSession(ss data.Session) error {
+func (s *MemoryStorage) DeleteSession(c context.Context, ss data.Session) error {
+	ctx, cancel := s.queryContext(c, "DeleteSession")
+	defer cancel()
+
 	q := "DELETE FROM Session WHERE User = $1 AND expired = True"
 
-	user_id, f_err := s.getUserID(ss.User.Username)
+	user_id, f_err := s.getUserID(ctx, ss.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Exec(q, user_id)
+	_, err := s.conn(ctx).ExecContext(ctx, q, user_id)
 	return err
 }
 
-func (s *MemoryStorage) CancelSession(session data.Session) error {
+func (s *MemoryStorage) CancelSession(c context.Context, session data.Session) error {
+	ctx, cancel := s.queryContext(c, "CancelSession")
+	defer cancel()
+
 	q := "UPDATE Sessions SET expired = $1 WHERE key = $2"
 
-	_, err := s.db.Exec(q, true, session.Key)
+	_, err := s.conn(ctx).ExecContext(ctx, q, true, session.Key)
 	return err
 }
 
+// counts sessions that are neither cancelled nor expired at the given time
+func (s *MemoryStorage) CountActiveSessions(c context.Context, at time.Time) (int64, error) {
+	ctx, cancel := s.queryContext(c, "CountActiveSessions")
+	defer cancel()
+
+	var count int64
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM Sessions WHERE expired = $1 AND expires_on > $2", false, at).Scan(&count)
+	return count, err
+}
+
+// deletes cancelled sessions and sessions that expired before the given time
+func (s *MemoryStorage) PurgeSessions(c context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.queryContext(c, "PurgeSessions")
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE expired = $1 OR expires_on < $2", true, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Session
 
 // Projects
-func (s *MemoryStorage) createProjectTable() error {
+func (s *MemoryStorage) createProjectTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Projects (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
@@ -403,210 +784,206 @@ func (s *MemoryStorage) createProjectTable() error {
 		prod_link VARCHAR(255) NULL,
 		description VARCHAR(255) NOT NULL,
 		created_on TIMESTAMP,
-		updated_on TIMESTAMP
+		updated_on TIMESTAMP,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) CreateProject(p data.Project) error {
+func (s *MemoryStorage) CreateProject(c context.Context, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
 	q := `INSERT INTO Projects (user_id, name, duration, start_date, end_date, status, github, prod_link, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Created_on, p.Updated_on)
-	return err
+	id, err := s.insert(ctx, q, user_id, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Created_on, p.Updated_on)
+	if err != nil {
+		return err
+	}
+
+	p.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "project", id, p.User.Username, nil, p)
 }
 
-func (s *MemoryStorage) GetProjects(keys map[string]string) ([]*data.Project, error) {
+func (s *MemoryStorage) GetProjects(c context.Context, keys map[string]string, page Page) ([]*data.Project, string, error) {
 	// expects a map with keys: id, username, name, stack
 	// combines keys using and statement
+	ctx, cancel := s.queryContext(c, "GetProjects")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
-	query := "SELECT * FROM Projects WHERE "
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "stack" {
-			continue
-		}
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+		"stack":    "id IN (SELECT pts.project_id FROM ProjectTechStacks pts JOIN TechStacks ts ON ts.id = pts.techstack_id WHERE ts.name = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
 	}
 
-	projects := []*data.Project{}
-	if loop_counter > 0 {
-		rows, err := s.db.Query(query)
-		if err != nil {
-			return nil, err
-		}
-
-		projects, _ = s.scanProjects(rows)
+	page_query, page_args, err := page.clause(projectSortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
 	}
 
-	stack_name, ok := keys["stack"]
-	if ok {
-		keywords := map[string]string{
-			"name": stack_name,
-		}
-		p_id, ok := keys["id"]
-		if ok {
-			keywords["project_id"] = p_id
-		}
-
-		username, ok := keys["username"]
-		if ok {
-			keywords["username"] = username
-		}
-
-		p, err := s.GetProjectsByTechStack(keywords)
-		if err != err {
-			return nil, nil
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+projectColumns+" FROM Projects"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
 
-		// only add record that havent been added yet
-	outer:
-		for _, v := range p {
-			for _, k := range projects {
-				if k.Id == v.Id {
-					// move to the next item in p (the outer loop)
-					continue outer
-				}
-			}
-			projects = append(projects, v)
-		}
+	projects, err := s.scanProjects(ctx, rows)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return projects, nil
+	projects, next := nextCursor(page, projects, projectSortValue(page))
+	return projects, next, nil
 }
 
-func (s *MemoryStorage) GetProjectsByTechStack(keys map[string]string) ([]*data.Project, error) {
+func (s *MemoryStorage) GetProjectsByTechStack(c context.Context, keys map[string]string) ([]*data.Project, error) {
+	ctx, cancel := s.queryContext(c, "GetProjectsByTechStack")
+	defer cancel()
+
 	// expects a map with keys: techstack_id, name, project_id, username
 
 	if len(keys) == 0 {
 		return nil, errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM ProjectTechStacks WHERE "
+	query, args := filterClause(keys, projectsByStackFilters)
+	if query == "" {
+		return nil, nil
+	}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "name" {
-			var stack_id int
-			f_err := s.db.QueryRow("SELECT id FROM TechStacks WHERE name = $1", v).Scan(&stack_id)
-			if f_err != nil {
-				return nil, f_err
-			}
-			k = "techstack_id"
-			v = fmt.Sprintf("%d", stack_id)
-		}
-		if k == "username" {
-			continue
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+projectColumns+" FROM Projects"+notDeleted(query)+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.scanProjects(ctx, rows)
+}
+
+func (s *MemoryStorage) scanProjects(c context.Context, rows *sql.Rows) ([]*data.Project, error) {
+	projects, user_ids, err := scanProjectRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	var projects []*data.Project
+	// owners are loaded in one query rather than one per row
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		projects[i].User = u
+	})
+	return projects, err
+}
 
-	if loop_counter == 0 {
-		return nil, nil
+func (s *MemoryStorage) UpdateProject(c context.Context, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateProject")
+	if err != nil {
+		return err
 	}
+	defer end(&err)
 
-	rows, err := s.db.Query(query)
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", p.Id)}, Page{})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
 	}
 
-	for rows.Next() {
-		record := new(struct {
-			id           string
-			techstack_id string
-			project_id   string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
+	if records[0].Version != p.Version {
+		return &ConflictError{Entity: "project", Id: p.Id, Version: p.Version, Current: records[0]}
+	}
 
-		// get projects with found id
-		p, e := s.GetProjects(map[string]string{"id": record.project_id})
-		if e != nil {
-			return nil, e
-		}
-		username, ok := keys["username"]
-		if ok {
-			if p[0].User.Username != username {
-				continue
-			}
-		}
-		projects = append(projects, p[0])
+	p.Updated_on = time.Now()
+	q := `UPDATE Projects SET name = $1, duration = $2, start_date = $3, end_date = $4, status = $5, github = $6, prod_link = $7, description = $8, updated_on = $9, version = version + 1
+	WHERE id = $10 AND version = $11 AND deleted_on IS NULL`
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Updated_on, p.Id, p.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "project", Id: p.Id, Version: p.Version}); err != nil {
+		return err
 	}
 
-	return projects, nil
+	p.Version++
+
+	p.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "project", p.Id, p.User.Username, records[0], p)
 }
 
-func (s *MemoryStorage) scanProjects(rows *sql.Rows) ([]*data.Project, error) {
-	var projects []*data.Project
-	for rows.Next() {
-		project := new(data.Project)
-		var user_id int
-		err := rows.Scan(
-			project.Id,
-			user_id,
-			project.Name,
-			project.Duration,
-			project.Start_date,
-			project.End_date,
-			project.Status,
-			project.Github,
-			project.Prod_link,
-			project.Description,
-			project.Created_on,
-			project.Updated_on,
-		)
-		if err != nil {
-			return projects, err
-		}
+func (s *MemoryStorage) DeleteProject(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
+	}
 
-		users, _ := s.GetUsers(map[string]string{"id": fmt.Sprintf("%d", user_id)})
-		project.User = *users[0]
+	q := "UPDATE Projects SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
 
-		projects = append(projects, project)
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
 	}
-	return projects, nil
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "project", id, records[0].User.Username, records[0], nil)
 }
 
-func (s *MemoryStorage) DeleteProject(id int) error {
-	q := "DELETE FROM Projects WHERE id = $1"
+func (s *MemoryStorage) RestoreProject(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "UPDATE Projects SET deleted_on = NULL WHERE id = $1"
 
-	_, err := s.db.Exec(q, id)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "project", id, records[0].User.Username, nil, records[0])
 }
 
 // Employment
-func (s *MemoryStorage) createEmploymentTable() error {
+func (s *MemoryStorage) createEmploymentTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Employments (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
@@ -619,537 +996,1391 @@ func (s *MemoryStorage) createEmploymentTable() error {
 		duration VARCHAR(255) NULL,
 		description VARCHAR(255) NOT NULL,
 		created_on TIMESTAMP,
-		updated_on TIMESTAMP
+		updated_on TIMESTAMP,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *MemoryStorage) CreateEmployment(e data.Employment) error {
-	q := `INSERT INTO Employment (user_id, name, employee, start_date, end_date, status, prod_link, duration, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+func (s *MemoryStorage) CreateEmployment(c context.Context, e data.Employment) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := `INSERT INTO Employments (user_id, name, employee, start_date, end_date, status, prod_link, duration, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
-	user_id, f_err := s.getUserID(e.User.Username)
+	user_id, f_err := s.getUserID(ctx, e.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Created_on, e.Updated_on)
-	return err
+	id, err := s.insert(ctx, q, user_id, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Created_on, e.Updated_on)
+	if err != nil {
+		return err
+	}
+
+	e.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "employment", id, e.User.Username, nil, e)
 }
 
-func (s *MemoryStorage) GetEmployments(keys map[string]string) ([]*data.Employment, error) {
+func (s *MemoryStorage) GetEmployments(c context.Context, keys map[string]string, page Page) ([]*data.Employment, string, error) {
 	// expects a map with keys: id, username, name, stack
 	// combines keys using and statement
+	ctx, cancel := s.queryContext(c, "GetEmployments")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
-	query := "SELECT * FROM Employments WHERE "
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "stack" {
-			continue
-		}
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+		"stack":    "id IN (SELECT ets.employment_id FROM EmploymentTechStacks ets JOIN TechStacks ts ON ts.id = ets.techstack_id WHERE ts.name = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
 	}
 
-	employments := []*data.Employment{}
-	if loop_counter > 0 {
-		rows, err := s.db.Query(query)
-		if err != nil {
-			return nil, err
-		}
-
-		employments, _ = s.scanEmployments(rows)
+	page_query, page_args, err := page.clause(employmentSortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
 	}
 
-	stack_name, ok := keys["stack"]
-	if ok {
-		keywords := map[string]string{
-			"name": stack_name,
-		}
-		p_id, ok := keys["id"]
-		if ok {
-			keywords["project_id"] = p_id
-		}
-
-		p, err := s.GetEmploymentsByTechStack(keywords)
-		if err != err {
-			return nil, nil
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+employmentColumns+" FROM Employments"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
 
-		// only add record that havent been added yet
-	outer:
-		for _, v := range p {
-			for _, k := range employments {
-				if k.Id == v.Id {
-					// move to the next item in p (the outer loop)
-					continue outer
-				}
-			}
-			employments = append(employments, v)
-		}
+	employments, err := s.scanEmployments(ctx, rows)
+	if err != nil {
+		return nil, "", err
 	}
 
-	return employments, nil
+	employments, next := nextCursor(page, employments, employmentSortValue(page))
+	return employments, next, nil
 }
 
-func (s *MemoryStorage) GetEmploymentsByTechStack(keys map[string]string) ([]*data.Employment, error) {
-	// expects a map with keys: id, name, employment_id, username
+func (s *MemoryStorage) GetEmploymentsByTechStack(c context.Context, keys map[string]string) ([]*data.Employment, error) {
+	ctx, cancel := s.queryContext(c, "GetEmploymentsByTechStack")
+	defer cancel()
+
+	// expects a map with keys: techstack_id, name, employment_id, username
 
 	if len(keys) == 0 {
 		return nil, errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM EmploymentTechStacks WHERE "
-
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "name" {
-			var stack_id int
-			f_err := s.db.QueryRow("SELECT id FROM TechStacks WHERE name = $1", v).Scan(&stack_id)
-			if f_err != nil {
-				return nil, f_err
-			}
-			k = "techstack_id"
-			v = fmt.Sprintf("%d", stack_id)
-		}
-		if k == "username" {
-			continue
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
-	}
-
-	if loop_counter == 0 {
+	query, args := filterClause(keys, employmentsByStackFilters)
+	if query == "" {
 		return nil, nil
 	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+employmentColumns+" FROM Employments"+notDeleted(query)+" ORDER BY id", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var employments []*data.Employment
-	for rows.Next() {
-		record := new(struct {
-			id            string
-			techstack_id  string
-			employment_id string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
-
-		// get employments with found id
-		p, e := s.GetEmployments(map[string]string{"id": record.employment_id})
-		if e != nil {
-			return nil, e
-		}
+	return s.scanEmployments(ctx, rows)
+}
 
-		username, ok := keys["username"]
-		if ok {
-			// if username was passed, only add employments with this stack and user
-			if p[0].User.Username != username {
-				continue
-			}
-		}
-		employments = append(employments, p[0])
+func (s *MemoryStorage) scanEmployments(c context.Context, rows *sql.Rows) ([]*data.Employment, error) {
+	employments, user_ids, err := scanEmploymentRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	return employments, nil
+	// owners are loaded in one query rather than one per row
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		employments[i].User = u
+	})
+	return employments, err
 }
 
-func (s *MemoryStorage) scanEmployments(rows *sql.Rows) ([]*data.Employment, error) {
-	var Employments []*data.Employment
-	for rows.Next() {
-		Employment := new(data.Employment)
-		var user_id int
-		err := rows.Scan(
-			Employment.Id,
-			user_id,
-			Employment.Name,
-			Employment.Employee,
-			Employment.Start_date,
-			Employment.End_date,
-			Employment.Status,
-			Employment.Prod_link,
-			Employment.Duration,
-			Employment.Description,
-			Employment.Created_on,
-			Employment.Updated_on,
-		)
-		if err != nil {
-			return Employments, err
-		}
-
-		users, _ := s.GetUsers(map[string]string{"id": fmt.Sprintf("%d", user_id)})
-		Employment.User = *users[0]
-
-		Employments = append(Employments, Employment)
+func (s *MemoryStorage) UpdateEmployment(c context.Context, e data.Employment) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateEmployment")
+	if err != nil {
+		return err
 	}
-	return Employments, nil
-}
+	defer end(&err)
 
-func (s *MemoryStorage) DeleteEmployment(id int) error {
-	q := "DELETE FROM Employments WHERE id = $1"
-
-	_, err := s.db.Exec(q, id)
-	return err
-}
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", e.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
+	}
 
-// // Hobby
-func (s *MemoryStorage) createHobbiesTable() error {
-	query := `CREATE TABLE IF NOT EXISTS Hobbies (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
-		name VARCHAR(255) NOT NULL
-	)`
-	_, err := s.db.Exec(query)
-	return err
-}
+	if records[0].Version != e.Version {
+		return &ConflictError{Entity: "employment", Id: e.Id, Version: e.Version, Current: records[0]}
+	}
 
-func (s *MemoryStorage) CreateHobby(h data.Hobby) error {
-	q := `INSERT INTO Hobbies (user_id, name) VALUES ($1, $2)`
+	e.Updated_on = time.Now()
+	q := `UPDATE Employments SET name = $1, employee = $2, start_date = $3, end_date = $4, status = $5, prod_link = $6, duration = $7, description = $8, updated_on = $9, version = version + 1
+	WHERE id = $10 AND version = $11 AND deleted_on IS NULL`
 
-	user_id, f_err := s.getUserID(h.User.Username)
-	if f_err != nil {
-		return f_err
+	result, err := s.conn(ctx).ExecContext(ctx, q, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Updated_on, e.Id, e.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "employment", Id: e.Id, Version: e.Version}); err != nil {
+		return err
 	}
 
-	_, err := s.db.Query(q, user_id, h.Name)
-	return err
+	e.Version++
 
+	e.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "employment", e.Id, e.User.Username, records[0], e)
 }
 
-func (s *MemoryStorage) GetHobbies(keys map[string]string) ([]*data.Hobby, error) {
-	// expects keys: id, username, name
+func (s *MemoryStorage) DeleteEmployment(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
 	}
 
-	query := "SELECT * FROM Hobbies WHERE "
+	q := "UPDATE Employments SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
 	}
 
-	if loop_counter == 0 {
-		return nil, nil
-	}
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "employment", id, records[0].User.Username, records[0], nil)
+}
 
-	rows, err := s.db.Query(query)
+func (s *MemoryStorage) RestoreEmployment(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreEmployment")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer end(&err)
 
-	var hobbies []*data.Hobby
-	for rows.Next() {
-		hobbie := new(data.Hobby)
-		err := rows.Scan(hobbie)
-		if err != nil {
-			continue
-		}
-		hobbies = append(hobbies, hobbie)
-	}
-	return hobbies, nil
-}
+	q := "UPDATE Employments SET deleted_on = NULL WHERE id = $1"
 
-func (s *MemoryStorage) DeleteHobby(id int) error {
-	q := "DELETE FROM Hobbies WHERE id = $1"
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.Exec(q, id)
-	return err
-}
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
 
-// // TechStack
-func (s *MemoryStorage) createTechStackTable() error {
-	query := `CREATE TABLE IF NOT EXISTS TechStacks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
-		name VARCHAR(255) NOT NULL
-	)`
-	_, err := s.db.Exec(query)
-	return err
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "employment", id, records[0].User.Username, nil, records[0])
 }
 
-// TECH STACK RELATIONSHIPS (M:M)
-func (s *MemoryStorage) createProjectTechStackTable() error {
-	query := `CREATE TABLE IF NOT EXISTS ProjectTechStacks (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		techstack_id stack INT REFERENCES TechStacks(id) ON DELETE CASCADE,
-		project_id stack INT REFERENCES Projects(id) ON DELETE CASCADE
-	)`
-	_, err := s.db.Exec(query)
-	return err
-}
+// // Hobby
+func (s *MemoryStorage) createHobbiesTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
 
-func (s *MemoryStorage) createEmploymentTechStackTable() error {
-	query := `CREATE TABLE IF NOT EXISTS EmploymentTechStacks (
+	query := `CREATE TABLE IF NOT EXISTS Hobbies (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		techstack_id stack INT REFERENCES TechStacks(id) ON DELETE CASCADE,
-		employment_id stack INT REFERENCES Employments(id) ON DELETE CASCADE
+		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-// TECH STACK RELATIONSHIPS
+func (s *MemoryStorage) CreateHobby(c context.Context, h data.Hobby) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-func (s *MemoryStorage) CreateTechStack(t data.TechStack) error {
-	q := `INSERT INTO TechStacks (user_id, name) VALUES ($1, $2)`
+	q := `INSERT INTO Hobbies (user_id, name) VALUES ($1, $2)`
 
-	user_id, f_err := s.getUserID(t.User.Username)
+	user_id, f_err := s.getUserID(ctx, h.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, t.Name)
-	return err
+	id, err := s.insert(ctx, q, user_id, h.Name)
+	if err != nil {
+		return err
+	}
+
+	h.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "hobby", id, h.User.Username, nil, h)
 }
 
-func (s *MemoryStorage) GetTechStacks(keys map[string]string) ([]*data.TechStack, error) {
+func (s *MemoryStorage) GetHobbies(c context.Context, keys map[string]string, page Page) ([]*data.Hobby, string, error) {
 	// expects keys: id, username, name
+	ctx, cancel := s.queryContext(c, "GetHobbies")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM TechStacks WHERE "
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
+	}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf("AND %s = %s ", k, v)
-		} else {
-			query = query + fmt.Sprintf("%s = %s ", k, v)
-		}
-		loop_counter++
+	page_query, page_args, err := page.clause(hobbySortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
 	}
 
-	if loop_counter == 0 {
-		return nil, nil
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+hobbyColumns+" FROM Hobbies"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	hobbies, user_ids, err := scanHobbyRows(rows)
+	if err != nil {
+		return nil, "", err
 	}
 
-	rows, err := s.db.Query(query)
+	err = attachUsers(ctx, s.conn(ctx), user_ids, func(i int, u data.User) {
+		hobbies[i].User = u
+	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return s.scanTechStack(rows)
+	hobbies, next := nextCursor(page, hobbies, hobbySortValue(page))
+	return hobbies, next, nil
 }
 
-func (s *MemoryStorage) scanTechStack(rows *sql.Rows) ([]*data.TechStack, error) {
-	var stacks []*data.TechStack
-	for rows.Next() {
-		stack := new(data.TechStack)
-		err := rows.Scan(stack)
-		if err != nil {
-			continue
-		}
-		stacks = append(stacks, stack)
+func (s *MemoryStorage) UpdateHobby(c context.Context, h data.Hobby) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateHobby")
+	if err != nil {
+		return err
 	}
-	return stacks, nil
-}
-
-// returns techstacks for a given project
-func (s *MemoryStorage) GetProjectTechStacks(keys map[string]string) ([]*data.TechStack, error) {
-	// expects keys: project_id, project_name
+	defer end(&err)
 
-	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", h.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
 	}
 
-	query := "SELECT * FROM ProjectTechStacks WHERE "
+	if records[0].Version != h.Version {
+		return &ConflictError{Entity: "hobby", Id: h.Id, Version: h.Version, Current: records[0]}
+	}
 
-	project_id, _ := keys["project_id"]
+	q := "UPDATE Hobbies SET name = $1, version = version + 1 WHERE id = $2 AND version = $3 AND deleted_on IS NULL"
 
-	project_name, ok := keys["project_name"]
-	if ok {
-		// get project id
-		results, err := s.GetProjects(map[string]string{"name": project_name})
-		if err != nil {
-			return nil, err
-		}
-		project_id = fmt.Sprintf("%d", results[0].Id)
+	result, err := s.conn(ctx).ExecContext(ctx, q, h.Name, h.Id, h.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "hobby", Id: h.Id, Version: h.Version}); err != nil {
+		return err
+	}
+
+	h.Version++
+
+	h.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "hobby", h.Id, h.User.Username, records[0], h)
+}
+
+func (s *MemoryStorage) DeleteHobby(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
+	}
+
+	q := "UPDATE Hobbies SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "hobby", id, records[0].User.Username, records[0], nil)
+}
+
+func (s *MemoryStorage) RestoreHobby(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "UPDATE Hobbies SET deleted_on = NULL WHERE id = $1"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "hobby", id, records[0].User.Username, nil, records[0])
+}
+
+// // TechStack
+func (s *MemoryStorage) createTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS TechStacks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INT REFERENCES Users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+// TECH STACK RELATIONSHIPS (M:M)
+func (s *MemoryStorage) createProjectTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS ProjectTechStacks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		techstack_id stack INT REFERENCES TechStacks(id) ON DELETE CASCADE,
+		project_id stack INT REFERENCES Projects(id) ON DELETE CASCADE
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+func (s *MemoryStorage) createEmploymentTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS EmploymentTechStacks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		techstack_id stack INT REFERENCES TechStacks(id) ON DELETE CASCADE,
+		employment_id stack INT REFERENCES Employments(id) ON DELETE CASCADE
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+// TECH STACK RELATIONSHIPS
+
+func (s *MemoryStorage) CreateTechStack(c context.Context, t data.TechStack) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := `INSERT INTO TechStacks (user_id, name) VALUES ($1, $2)`
+
+	user_id, f_err := s.getUserID(ctx, t.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	id, err := s.insert(ctx, q, user_id, t.Name)
+	if err != nil {
+		return err
+	}
+
+	t.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "stack", id, t.User.Username, nil, t)
+}
+
+func (s *MemoryStorage) GetTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	// expects keys: id, username, name
+	ctx, cancel := s.queryContext(c, "GetTechStacks")
+	defer cancel()
+
+	if len(keys) == 0 {
+		return nil, errors.New("provide search keyword")
 	}
 
-	rows, err := s.db.Query(fmt.Sprintf("%s project_id = %s", query, project_id))
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	})
+	if query == "" {
+		return nil, nil
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var stacks []*data.TechStack
+	return s.scanTechStack(ctx, rows)
+}
 
-	for rows.Next() {
-		record := new(struct {
-			id           string
-			techstack_id string
-			project_id   string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
+func (s *MemoryStorage) scanTechStack(c context.Context, rows *sql.Rows) ([]*data.TechStack, error) {
+	stacks, user_ids, err := scanTechStackRows(rows)
+	if err != nil {
+		return nil, err
+	}
 
-		// get techstacks with found id
-		stack, err := s.GetTechStacks(map[string]string{"id": record.techstack_id})
-		if err != nil {
-			return nil, err
-		}
-		username, ok := keys["username"]
-		if ok {
-			if stack[0].User.Username != username {
-				continue
-			}
-		}
-		stacks = append(stacks, stack[0])
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		stacks[i].User = u
+	})
+	return stacks, err
+}
+
+// returns techstacks for a given project
+func (s *MemoryStorage) GetProjectTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	ctx, cancel := s.queryContext(c, "GetProjectTechStacks")
+	defer cancel()
+
+	// expects keys: project_id, project_name, username
+
+	if len(keys) == 0 {
+		return nil, errors.New("provide search keyword")
+	}
+
+	query, args := filterClause(keys, projectStackFilters)
+	if query == "" {
+		return nil, nil
 	}
 
-	return stacks, nil
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
+	if err != nil {
+		return nil, err
+	}
 
+	return s.scanTechStack(ctx, rows)
 }
 
 // returns techstacks for a given employment
-func (s *MemoryStorage) GetEmploymentTechStacks(keys map[string]string) ([]*data.TechStack, error) {
-	// expects keys: employment_id, employment_name
+func (s *MemoryStorage) GetEmploymentTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	ctx, cancel := s.queryContext(c, "GetEmploymentTechStacks")
+	defer cancel()
+
+	// expects keys: employment_id, employment_name, username
 
 	if len(keys) == 0 {
 		return nil, errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM EmploymentTechStacks WHERE "
+	query, args := filterClause(keys, employmentStackFilters)
+	if query == "" {
+		return nil, nil
+	}
 
-	employment_id, _ := keys["employment_id"]
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
+	if err != nil {
+		return nil, err
+	}
 
-	// get id for given username
-	employment_name, ok := keys["employment_name"]
-	if ok {
-		// get employment id
-		results, err := s.GetEmployments(map[string]string{"name": employment_name})
-		if err != nil {
-			return nil, err
-		}
-		employment_id = fmt.Sprintf("%d", results[0].Id)
+	return s.scanTechStack(ctx, rows)
+}
+
+func (s *MemoryStorage) UpdateTechStack(c context.Context, t data.TechStack) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateTechStack")
+	if err != nil {
+		return err
 	}
+	defer end(&err)
 
-	rows, err := s.db.Query(fmt.Sprintf("%s employment_id = %s", query, employment_id))
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", t.Id)})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
 	}
 
-	var stacks []*data.TechStack
+	if records[0].Version != t.Version {
+		return &ConflictError{Entity: "stack", Id: t.Id, Version: t.Version, Current: records[0]}
+	}
 
-	for rows.Next() {
-		record := new(struct {
-			id            string
-			techstack_id  string
-			employment_id string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
+	q := "UPDATE TechStacks SET name = $1, version = version + 1 WHERE id = $2 AND version = $3 AND deleted_on IS NULL"
 
-		// get techstacks with found id
-		stack, e := s.GetTechStacks(map[string]string{"id": record.techstack_id})
-		if e != nil {
-			return nil, e
-		}
-		username, ok := keys["username"]
-		if ok {
-			if stack[0].User.Username != username {
-				continue
-			}
-		}
-		stacks = append(stacks, stack[0])
+	result, err := s.conn(ctx).ExecContext(ctx, q, t.Name, t.Id, t.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "stack", Id: t.Id, Version: t.Version}); err != nil {
+		return err
+	}
+
+	t.Version++
+
+	t.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "stack", t.Id, t.User.Username, records[0], t)
+}
+
+func (s *MemoryStorage) DeleteTechStack(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", id)})
+	if err != nil {
+		return err
 	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
+	}
+
+	q := "UPDATE TechStacks SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
 
-	return stacks, nil
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
 
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "stack", id, records[0].User.Username, records[0], nil)
 }
 
-func (s *MemoryStorage) DeleteTechStack(id int) error {
-	q := "DELETE FROM TechStacks WHERE id = $1"
+func (s *MemoryStorage) RestoreTechStack(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "UPDATE TechStacks SET deleted_on = NULL WHERE id = $1"
 
-	_, err := s.db.Exec(q, id)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", id)})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "stack", id, records[0].User.Username, nil, records[0])
 }
 
-func (s *MemoryStorage) AddTechStackToProject(t data.TechStack, p data.Project) error {
+func (s *MemoryStorage) AddTechStackToProject(c context.Context, t data.TechStack, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "AddTechStackToProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
 	// fetch project
-	projects, err := s.GetProjects(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	projects, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprint(p.Id)}, Page{})
 	if err != nil {
 		return err
 	}
 
 	// fetch tech stack
-	stacks, err := s.GetTechStacks(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	stacks, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprint(t.Id)})
 	if err != nil {
 		return err
 	}
 
+	if len(projects) == 0 || len(stacks) == 0 {
+		return sql.ErrNoRows
+	}
+
 	// save to db
-	_, write_err := s.db.Exec("INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, projects[0].Id)
-	return write_err
+	_, write_err := s.conn(ctx).ExecContext(ctx, "INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, projects[0].Id)
+	if write_err != nil {
+		return write_err
+	}
+
+	link := map[string]int{"project": projects[0].Id, "stack": stacks[0].Id}
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "project_stack", projects[0].Id, projects[0].User.Username, nil, link)
 }
 
-func (s *MemoryStorage) AddTechStackToEmployment(t data.TechStack, p data.Project) error {
+func (s *MemoryStorage) AddTechStackToEmployment(c context.Context, t data.TechStack, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "AddTechStackToEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
 	// fetch employment
-	employments, err := s.GetEmployments(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	employments, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprint(p.Id)}, Page{})
 	if err != nil {
 		return err
 	}
 
 	// fetch tech stack
-	stacks, err := s.GetTechStacks(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	stacks, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprint(t.Id)})
 	if err != nil {
 		return err
 	}
 
+	if len(employments) == 0 || len(stacks) == 0 {
+		return sql.ErrNoRows
+	}
+
 	// save to db
-	_, write_err := s.db.Exec("INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, employments[0].Id)
-	return write_err
+	_, write_err := s.conn(ctx).ExecContext(ctx, "INSERT INTO EmploymentTechStacks (techstack_id, employment_id) VALUES ($1, $2)", stacks[0].Id, employments[0].Id)
+	if write_err != nil {
+		return write_err
+	}
+
+	link := map[string]int{"employment": employments[0].Id, "stack": stacks[0].Id}
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "employment_stack", employments[0].Id, employments[0].User.Username, nil, link)
+}
+
+// Trash
+
+// lists a users soft deleted records, most recently deleted first
+func (s *MemoryStorage) GetTrash(c context.Context, username string) ([]*data.TrashItem, error) {
+	ctx, cancel := s.queryContext(c, "GetTrash")
+	defer cancel()
+
+	var parts []string
+	for _, t := range trashTables {
+		if t.kind == "user" {
+			// a deleted account can not sign in to see its own trash
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(
+			"SELECT '%s', id, %s, deleted_on FROM %s WHERE deleted_on IS NOT NULL AND %s = (SELECT id FROM Users WHERE username = $1)",
+			t.kind, t.name, t.table, t.user,
+		))
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, strings.Join(parts, " UNION ALL ")+" ORDER BY deleted_on DESC", username)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrash(rows)
+}
+
+// permanently removes records deleted before the given time
+func (s *MemoryStorage) PurgeTrash(c context.Context, before time.Time) (_ int64, err error) {
+	ctx, end, err := s.writeContext(c, "PurgeTrash")
+	if err != nil {
+		return 0, err
+	}
+	defer end(&err)
+
+	var purged int64
+	for _, t := range trashTables {
+		result, err := s.conn(ctx).ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE deleted_on IS NOT NULL AND deleted_on < $1", t.table), before)
+		if err != nil {
+			return purged, err
+		}
+		count, _ := result.RowsAffected()
+		purged += count
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, recordAudit(ctx, s.conn(ctx), AuditPurge, "trash", 0, "", nil, map[string]any{"purged": purged, "before": before})
+}
+
+// Audit
+
+func (s *MemoryStorage) createAuditLogTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS AuditLog (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor VARCHAR(255) NOT NULL,
+		owner VARCHAR(255) NOT NULL,
+		entity VARCHAR(50) NOT NULL,
+		entity_id INTEGER NOT NULL,
+		action VARCHAR(20) NOT NULL,
+		before_data TEXT NOT NULL,
+		after_data TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	// the log is append only
+	for _, trigger := range []string{
+		"CREATE TRIGGER IF NOT EXISTS auditlog_no_update BEFORE UPDATE ON AuditLog BEGIN SELECT RAISE(ABORT, 'audit log is append only'); END",
+		"CREATE TRIGGER IF NOT EXISTS auditlog_no_delete BEFORE DELETE ON AuditLog BEGIN SELECT RAISE(ABORT, 'audit log is append only'); END",
+	} {
+		if _, err := s.conn(ctx).ExecContext(ctx, trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lists audit events newest first.
+// expects keys: actor, owner, entity, entity_id, action
+func (s *MemoryStorage) GetAuditLog(c context.Context, keys map[string]string, page Page) ([]*data.AuditEvent, string, error) {
+	ctx, cancel := s.queryContext(c, "GetAuditLog")
+	defer cancel()
+
+	page = auditPage(page)
+	query, args, err := auditListQuery(keys, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	events, next := nextCursor(page, events, auditSortValue)
+	return events, next, nil
+}
+
+// Resume
+
+// loads a users profile, projects, employments, hobbies and stacks in a fixed
+// number of queries, see loadResumeAggregate
+func (s *MemoryStorage) LoadResumeAggregate(c context.Context, user_id int) (*data.Resume, error) {
+	ctx, cancel := s.queryContext(c, "LoadResumeAggregate")
+	defer cancel()
+
+	return loadResumeAggregate(ctx, s.conn(ctx), user_id)
+}
+
+// Snapshots
+
+func (s *MemoryStorage) createResumeSnapshotTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS ResumeSnapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		label VARCHAR(255) NOT NULL,
+		data TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+// saves a frozen copy of the snapshots resume, snapshots are never modified
+func (s *MemoryStorage) CreateResumeSnapshot(c context.Context, snapshot data.ResumeSnapshot) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateResumeSnapshot")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, snapshot.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	resume_json, err := json.Marshal(snapshot.Resume)
+	if err != nil {
+		return err
+	}
+
+	// imported snapshots keep the time they were taken
+	created_on := snapshot.Created_on
+	if created_on.IsZero() {
+		created_on = time.Now()
+	}
+
+	query := `INSERT INTO ResumeSnapshots (user_id, label, data, created_on)
+	VALUES ($1, $2, $3, $4)`
+
+	id, err := s.insert(ctx, query, user_id, snapshot.Label, string(resume_json), created_on)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "snapshot", id, snapshot.User.Username, nil, map[string]any{"label": snapshot.Label})
+}
+
+// lists a users snapshots newest first
+func (s *MemoryStorage) GetResumeSnapshots(c context.Context, username string) ([]*data.ResumeSnapshot, error) {
+	ctx, cancel := s.queryContext(c, "GetResumeSnapshots")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, snapshotQuery+" WHERE u.username = $1 ORDER BY s.created_on DESC, s.id DESC", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSnapshots(rows)
+}
+
+func (s *MemoryStorage) GetResumeSnapshot(c context.Context, id int) (*data.ResumeSnapshot, error) {
+	ctx, cancel := s.queryContext(c, "GetResumeSnapshot")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, snapshotQuery+" WHERE s.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := scanSnapshots(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return snapshots[0], nil
+}
+
+// API tokens
+
+func (s *MemoryStorage) createApiTokenTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS ApiTokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		prefix VARCHAR(20) NOT NULL,
+		hash VARCHAR(64) NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		expires_on TIMESTAMP,
+		last_used TIMESTAMP,
+		created_on TIMESTAMP NOT NULL
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+func (s *MemoryStorage) CreateApiToken(c context.Context, token data.ApiToken) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateApiToken")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, token.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO ApiTokens (user_id, name, prefix, hash, scopes, expires_on, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	id, err := s.insert(ctx, query, user_id, token.Name, token.Prefix, token.Hash, joinScopes(token.Scopes), nullTime(token.Expires_on), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// hashes are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "api_token", id, token.User.Username, nil, map[string]any{"name": token.Name, "scopes": token.Scopes})
+}
+
+// lists a users tokens newest first
+func (s *MemoryStorage) GetApiTokens(c context.Context, username string) ([]*data.ApiToken, error) {
+	ctx, cancel := s.queryContext(c, "GetApiTokens")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, apiTokenQuery+" WHERE u.username = $1 ORDER BY t.created_on DESC, t.id DESC", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanApiTokens(rows)
+}
+
+// finds a token by the hash of its secret along with its user, see data.HashApiToken
+func (s *MemoryStorage) GetApiTokenByHash(c context.Context, hash string) (*data.ApiToken, error) {
+	ctx, cancel := s.queryContext(c, "GetApiTokenByHash")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, apiTokenQuery+" WHERE t.hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := scanApiTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	users, err := s.GetUsers(ctx, map[string]string{"id": tokens[0].User.Id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	tokens[0].User = *users[0]
+	return tokens[0], nil
+}
+
+func (s *MemoryStorage) TouchApiToken(c context.Context, id int, used time.Time) error {
+	ctx, cancel := s.queryContext(c, "TouchApiToken")
+	defer cancel()
+
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE ApiTokens SET last_used = $1 WHERE id = $2", used, id)
+	return err
+}
+
+// revokes one of the users tokens, sql.ErrNoRows when they have no such token
+func (s *MemoryStorage) DeleteApiToken(c context.Context, username string, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteApiToken")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM ApiTokens WHERE id = $1 AND user_id = $2", id, user_id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "api_token", id, username, nil, nil)
+}
+
+// Email tokens
+
+func (s *MemoryStorage) createEmailTokenTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS EmailTokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		purpose VARCHAR(20) NOT NULL,
+		hash VARCHAR(64) NOT NULL UNIQUE,
+		expires_on TIMESTAMP NOT NULL,
+		used_on TIMESTAMP,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	// rate limits count the tokens a user was sent recently
+	_, err := s.conn(ctx).ExecContext(ctx, "CREATE INDEX IF NOT EXISTS email_tokens_sent ON EmailTokens (user_id, purpose, created_on)")
+	return err
+}
+
+func (s *MemoryStorage) CreateEmailToken(c context.Context, token data.EmailToken) error {
+	ctx, cancel := s.queryContext(c, "CreateEmailToken")
+	defer cancel()
+
+	user_id, f_err := s.getUserID(ctx, token.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO EmailTokens (user_id, purpose, hash, expires_on, created_on)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := s.insert(ctx, query, user_id, token.Purpose, token.Hash, token.Expires_on, token.Created_on)
+	return err
+}
+
+// marks an unused and unexpired token as used at now and returns it with its user.
+// the other tokens the user was sent for the same purpose stop working too.
+// sql.ErrNoRows when the token is unknown, used or expired
+func (s *MemoryStorage) UseEmailToken(c context.Context, purpose, hash string, now time.Time) (*data.EmailToken, error) {
+	ctx, cancel := s.queryContext(c, "UseEmailToken")
+	defer cancel()
+
+	// checked and marked in one statement so a token is only ever used once
+	result, err := s.conn(ctx).ExecContext(ctx, "UPDATE EmailTokens SET used_on = $1 WHERE hash = $2 AND purpose = $3 AND used_on IS NULL AND expires_on > $4", now, hash, purpose, now)
+	if err != nil {
+		return nil, err
+	}
+	if used, err := result.RowsAffected(); err != nil || used == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, emailTokenQuery+" WHERE t.hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanEmailTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx, "UPDATE EmailTokens SET used_on = $1 WHERE user_id = $2 AND purpose = $3 AND used_on IS NULL", now, tokens[0].User.Id, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.GetUsers(ctx, map[string]string{"id": tokens[0].User.Id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	tokens[0].User = *users[0]
+	return tokens[0], nil
+}
+
+// how many tokens for purpose the user was sent since the given time
+func (s *MemoryStorage) CountEmailTokens(c context.Context, username, purpose string, since time.Time) (int, error) {
+	ctx, cancel := s.queryContext(c, "CountEmailTokens")
+	defer cancel()
+
+	var count int
+	query := "SELECT COUNT(*) FROM EmailTokens t JOIN Users u ON u.id = t.user_id WHERE u.username = $1 AND t.purpose = $2 AND t.created_on >= $3"
+	err := s.conn(ctx).QueryRowContext(ctx, query, username, purpose, since).Scan(&count)
+	return count, err
+}
+
+// Webhooks
+
+func (s *MemoryStorage) createWebhookTables(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS Webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		url VARCHAR(255) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		events TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS WebhookDeliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER REFERENCES Webhooks(id) ON DELETE CASCADE,
+		event VARCHAR(50) NOT NULL,
+		payload TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		next_attempt TIMESTAMP NOT NULL,
+		created_on TIMESTAMP NOT NULL,
+		delivered_on TIMESTAMP
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	// the queue is polled for due deliveries
+	_, err := s.conn(ctx).ExecContext(ctx, "CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON WebhookDeliveries (status, next_attempt)")
+	return err
+}
+
+func (s *MemoryStorage) CreateWebhook(c context.Context, webhook data.Webhook) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateWebhook")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, webhook.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO Webhooks (user_id, url, secret, events, created_on)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	id, err := s.insert(ctx, query, user_id, webhook.Url, webhook.Secret, strings.Join(webhook.Events, ","), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// secrets are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "webhook", id, webhook.User.Username, nil, map[string]any{"url": webhook.Url, "events": webhook.Events})
+}
+
+// lists webhooks oldest first
+func (s *MemoryStorage) GetWebhooks(c context.Context, keys map[string]string) ([]*data.Webhook, error) {
+	ctx, cancel := s.queryContext(c, "GetWebhooks")
+	defer cancel()
+
+	where, args := filterClause(keys, webhookFilters)
+	rows, err := s.conn(ctx).QueryContext(ctx, webhookQuery+where+" ORDER BY w.id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWebhooks(rows)
+}
+
+// removes one of the users webhooks along with its deliveries, sql.ErrNoRows when they have no such webhook
+func (s *MemoryStorage) DeleteWebhook(c context.Context, username string, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteWebhook")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM WebhookDeliveries WHERE webhook_id IN (SELECT id FROM Webhooks WHERE id = $1 AND user_id = $2)", id, user_id); err != nil {
+		return err
+	}
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM Webhooks WHERE id = $1 AND user_id = $2", id, user_id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "webhook", id, username, nil, nil)
+}
+
+// queues a delivery, it is sent once its Next_attempt is due
+func (s *MemoryStorage) CreateWebhookDelivery(c context.Context, delivery data.WebhookDelivery) error {
+	ctx, cancel := s.queryContext(c, "CreateWebhookDelivery")
+	defer cancel()
+
+	query := `INSERT INTO WebhookDeliveries (webhook_id, event, payload, status, next_attempt, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := s.insert(ctx, query, delivery.Webhook_id, delivery.Event, delivery.Payload, delivery.Status, delivery.Next_attempt, time.Now())
+	return err
+}
+
+// lists at most limit deliveries newest first
+func (s *MemoryStorage) GetWebhookDeliveries(c context.Context, keys map[string]string, limit int) ([]*data.WebhookDelivery, error) {
+	ctx, cancel := s.queryContext(c, "GetWebhookDeliveries")
+	defer cancel()
+
+	where, args := filterClause(keys, deliveryFilters)
+	args = append(args, limit)
+	rows, err := s.conn(ctx).QueryContext(ctx, fmt.Sprintf("%s%s ORDER BY id DESC LIMIT $%d", deliveryQuery, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// pending deliveries whose next attempt is at or before now, oldest first
+func (s *MemoryStorage) GetDueWebhookDeliveries(c context.Context, now time.Time, limit int) ([]*data.WebhookDelivery, error) {
+	ctx, cancel := s.queryContext(c, "GetDueWebhookDeliveries")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, deliveryQuery+" WHERE status = $1 AND next_attempt <= $2 ORDER BY next_attempt, id LIMIT $3", data.Delivery_pending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// records the outcome of an attempt
+func (s *MemoryStorage) UpdateWebhookDelivery(c context.Context, delivery data.WebhookDelivery) error {
+	ctx, cancel := s.queryContext(c, "UpdateWebhookDelivery")
+	defer cancel()
+
+	query := `UPDATE WebhookDeliveries SET status = $1, attempts = $2, response_code = $3, error = $4, next_attempt = $5, delivered_on = $6
+	WHERE id = $7`
+
+	_, err := s.conn(ctx).ExecContext(ctx, query, delivery.Status, delivery.Attempts, delivery.Response_code, delivery.Error, delivery.Next_attempt, nullTime(delivery.Delivered_on), delivery.Id)
+	return err
+}
+
+// Search
+
+// sqlite builds without the fts5 module fall back to LIKE matching,
+// build with -tags sqlite_fts5 to enable ranked full text search
+func (s *MemoryStorage) createSearchIndex(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE VIRTUAL TABLE IF NOT EXISTS SearchIndex USING fts5(
+		kind UNINDEXED,
+		record_id UNINDEXED,
+		user_id UNINDEXED,
+		title,
+		body
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			s.fts = false
+			return nil
+		}
+		return err
+	}
+	s.fts = true
+
+	// keep the index in sync with the source tables
+	for _, src := range searchSources {
+		insert := fmt.Sprintf(
+			"INSERT INTO SearchIndex (kind, record_id, user_id, title, body) SELECT '%s', new.id, new.%s, %s, %s",
+			src.kind, src.user, src.titleExpr("new."), src.bodyExpr("new."),
+		)
+		if src.trash {
+			// trashed rows leave the index and come back when restored
+			insert = insert + " WHERE new.deleted_on IS NULL"
+		}
+		insert = insert + ";"
+		remove := fmt.Sprintf("DELETE FROM SearchIndex WHERE kind = '%s' AND record_id = old.id;", src.kind)
+
+		triggers := []string{
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_search_insert AFTER INSERT ON %s BEGIN %s END", src.kind, src.table, insert),
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_search_update AFTER UPDATE ON %s BEGIN %s %s END", src.kind, src.table, remove, insert),
+			fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_search_delete AFTER DELETE ON %s BEGIN %s END", src.kind, src.table, remove),
+		}
+		for _, t := range triggers {
+			if _, err := s.conn(ctx).ExecContext(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ranks users, profiles, projects, employments and stacks against the query
+func (s *MemoryStorage) Search(c context.Context, query string, limit int) ([]*data.SearchResult, error) {
+	ctx, cancel := s.queryContext(c, "Search")
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, errors.New("provide search keyword")
+	}
+
+	if !s.fts {
+		return s.searchLike(ctx, terms, limit)
+	}
+
+	// quote every term so user input is never parsed as fts5 syntax
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+
+	q := `SELECT si.kind, si.record_id, u.username, si.title,
+			snippet(SearchIndex, 4, $1, $2, '…', 16),
+			-bm25(SearchIndex) AS rank
+		FROM SearchIndex si JOIN Users u ON u.id = si.user_id
+		WHERE SearchIndex MATCH $3 AND u.deleted_on IS NULL
+		ORDER BY rank DESC, si.kind, si.record_id
+		LIMIT $4`
+
+	rows, err := s.conn(ctx).QueryContext(ctx, q, data.HighlightStart, data.HighlightEnd, strings.Join(quoted, " "), searchLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return scanSearchResults(rows)
+}
+
+// substring matching used when fts5 is unavailable, ranked by matched terms
+func (s *MemoryStorage) searchLike(c context.Context, terms []string, limit int) ([]*data.SearchResult, error) {
+	var results []*data.SearchResult
+
+	for _, src := range searchSources {
+		var conditions []string
+		var args []any
+		for _, t := range terms {
+			args = append(args, "%"+t+"%")
+			conditions = append(conditions, fmt.Sprintf("LOWER(%s) LIKE $%d", src.documentExpr("t."), len(args)))
+		}
+
+		q := fmt.Sprintf(
+			"SELECT t.id, u.username, %s, %s FROM %s t JOIN Users u ON u.id = t.%s WHERE %s AND %s",
+			src.titleExpr("t."), src.bodyExpr("t."), src.table, src.user, strings.Join(conditions, " AND "), src.visibleExpr("t."),
+		)
+		rows, err := s.conn(c).QueryContext(c, q, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			result := &data.SearchResult{Kind: src.kind}
+			var body string
+			if err := rows.Scan(&result.Id, &result.Username, &result.Title, &body); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			document := strings.ToLower(result.Title + " " + body)
+			for _, t := range terms {
+				result.Rank += float64(strings.Count(document, t))
+			}
+			result.Snippet = buildSnippet(body, terms, 25)
+			results = append(results, result)
+		}
+		rows.Close()
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	if len(results) > searchLimit(limit) {
+		results = results[:searchLimit(limit)]
+	}
+	return results, nil
 }
@@ -0,0 +1,12 @@
+package storage
+
+import (
+	"github.com/phillipmugisa/go_resume_generator/metrics"
+)
+
+var storageDuration = metrics.NewHistogramVec(
+	"storage_duration_seconds",
+	"Time spent in Storage methods.",
+	metrics.DefBuckets,
+	"backend", "method",
+)
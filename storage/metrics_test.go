@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/metrics"
+)
+
+func TestStorageDurationLabels(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUsers(c, map[string]string{"username": "nobody"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	metrics.Default.WriteText(&out)
+	if !strings.Contains(out.String(), `storage_duration_seconds_count{backend="memory",method="GetUsers"}`) {
+		t.Errorf("Got\n%s\nExpected a series for GetUsers", out.String())
+	}
+	// table creation goes through helpers which are not measured
+	if strings.Contains(out.String(), `method=""`) || strings.Contains(out.String(), `method="createUserTable"`) {
+		t.Errorf("Got\n%s\nExpected no series for helpers", out.String())
+	}
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// layout used to compare timestamps in cursors, understood by both postgres and sqlite
+const cursorTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// Page describes which window of a listing to return.
+// Sort is a column name, prefix with "-" for descending order e.g "-created_on".
+// Cursor is the token returned with the previous page, empty for the first page.
+type Page struct {
+	Cursor string
+	Limit  int
+	Sort   string
+}
+
+// position of the last record of a page
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
+
+func (p Page) size() int {
+	if p.Limit <= 0 {
+		return DefaultPageSize
+	}
+	if p.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return p.Limit
+}
+
+// returns the sort column and direction, falling back to the default
+// when the requested column is not sortable
+func (p Page) order(sortable []string, fallback string) (string, bool) {
+	column := strings.TrimPrefix(p.Sort, "-")
+	desc := strings.HasPrefix(p.Sort, "-")
+
+	for _, s := range sortable {
+		if s == column {
+			return column, desc
+		}
+	}
+	return fallback, false
+}
+
+// builds the keyset condition, ordering and limit for a listing query.
+// id is always used as the tie breaker so the ordering is stable.
+// placeholders start after argCount arguments already in the query.
+func (p Page) clause(sortable []string, fallback string, argCount int, hasWhere bool) (string, []any, error) {
+	column, desc := p.order(sortable, fallback)
+
+	direction, comparison := "ASC", ">"
+	if desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	var (
+		query string
+		args  []any
+	)
+
+	if p.Cursor != "" {
+		c, err := decodeCursor(p.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		if c.Sort != p.Sort {
+			// cursor was issued for a different ordering
+			return "", nil, ErrInvalidCursor
+		}
+
+		joiner := " WHERE "
+		if hasWhere {
+			joiner = " AND "
+		}
+
+		if column == "id" {
+			query = fmt.Sprintf("%s id %s $%d", joiner, comparison, argCount+1)
+			args = append(args, c.Id)
+		} else {
+			query = fmt.Sprintf("%s (%s %s $%d OR (%s = $%d AND id %s $%d))", joiner, column, comparison, argCount+1, column, argCount+2, comparison, argCount+3)
+			args = append(args, c.Value, c.Value, c.Id)
+		}
+	}
+
+	// fetch an extra record to know whether there is a next page
+	query = query + fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %d", column, direction, direction, p.size()+1)
+
+	return query, args, nil
+}
+
+// trims the extra record fetched by clause and returns the cursor for the next page
+func nextCursor[T any](p Page, records []T, sortValue func(T) (string, int)) ([]T, string) {
+	if len(records) <= p.size() {
+		return records, ""
+	}
+	records = records[:p.size()]
+
+	value, id := sortValue(records[len(records)-1])
+	return records, encodeCursor(cursor{Sort: p.Sort, Value: value, Id: id})
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := new(cursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func cursorTime(t time.Time) string {
+	return t.Format(cursorTimeLayout)
+}
+
+// columns listings can be sorted by
+var (
+	projectSortKeys    = []string{"id", "name", "start_date", "created_on", "updated_on"}
+	employmentSortKeys = []string{"id", "name", "start_date", "created_on", "updated_on"}
+	hobbySortKeys      = []string{"id", "name"}
+	profileSortKeys    = []string{"id", "views"}
+)
+
+func projectSortValue(p Page) func(*data.Project) (string, int) {
+	column, _ := p.order(projectSortKeys, "id")
+	return func(project *data.Project) (string, int) {
+		switch column {
+		case "name":
+			return project.Name, project.Id
+		case "start_date":
+			return cursorTime(project.Start_date), project.Id
+		case "created_on":
+			return cursorTime(project.Created_on), project.Id
+		case "updated_on":
+			return cursorTime(project.Updated_on), project.Id
+		}
+		return "", project.Id
+	}
+}
+
+func employmentSortValue(p Page) func(*data.Employment) (string, int) {
+	column, _ := p.order(employmentSortKeys, "id")
+	return func(employment *data.Employment) (string, int) {
+		switch column {
+		case "name":
+			return employment.Name, employment.Id
+		case "start_date":
+			return cursorTime(employment.Start_date), employment.Id
+		case "created_on":
+			return cursorTime(employment.Created_on), employment.Id
+		case "updated_on":
+			return cursorTime(employment.Updated_on), employment.Id
+		}
+		return "", employment.Id
+	}
+}
+
+func hobbySortValue(p Page) func(*data.Hobby) (string, int) {
+	column, _ := p.order(hobbySortKeys, "id")
+	return func(hobby *data.Hobby) (string, int) {
+		if column == "name" {
+			return hobby.Name, hobby.Id
+		}
+		return "", hobby.Id
+	}
+}
+
+func profileSortValue(p Page) func(*data.Profile) (string, int) {
+	column, _ := p.order(profileSortKeys, "id")
+	return func(profile *data.Profile) (string, int) {
+		if column == "views" {
+			return fmt.Sprintf("%d", profile.Views), profile.Id
+		}
+		return "", profile.Id
+	}
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHobbiesPagination(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chess", "hiking", "reading", "cycling", "music"} {
+		if err := s.CreateHobby(c, *user.NewHobby(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	page := Page{Limit: 2, Sort: "-name"}
+	for pages := 0; pages < 5; pages++ {
+		hobbies, next, err := s.GetHobbies(c, map[string]string{"username": user.Username}, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, h := range hobbies {
+			names = append(names, h.Name)
+		}
+		if next == "" {
+			break
+		}
+		page.Cursor = next
+	}
+
+	expected := []string{"reading", "music", "hiking", "cycling", "chess"}
+	if len(names) != len(expected) {
+		t.Fatalf("Got %v, Expected: %v", names, expected)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Got %v, Expected: %v", names, expected)
+			break
+		}
+	}
+
+	// a cursor issued for one ordering can not be reused with another
+	_, _, err = s.GetHobbies(c, map[string]string{"username": user.Username}, Page{Limit: 2, Sort: "name", Cursor: page.Cursor})
+	if err != ErrInvalidCursor {
+		t.Errorf("Got %v, Expected: %v", err, ErrInvalidCursor)
+	}
+}
@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -13,31 +17,81 @@ import (
 )
 
 type PostgresStorage struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-func NewPostgresStorage() (*PostgresStorage, error) {
-	db, err := initPostgresDB()
+// connects using a postgres url or key=value connection string, see PostgresDSNFromEnv
+func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
+	db, err := initPostgresDB(dsn)
 	if err != nil {
 		return nil, err
 	}
 	fmt.Println("Database Connection Successful...")
 	return &PostgresStorage{
-		db: db,
+		db:           db,
+		queryTimeout: queryTimeoutFromEnv(),
 	}, nil
 }
 
-func initPostgresDB() (*sql.DB, error) {
+// sets the maximum duration a single storage call may run for
+func (s *PostgresStorage) SetQueryTimeout(d time.Duration) {
+	s.queryTimeout = d
+}
+
+// checks the database can be reached
+func (s *PostgresStorage) Ping(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "Ping")
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// closes the connection pool, waiting for running queries to finish
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresStorage) Atomic(c context.Context, fn func(context.Context) error) error {
+	return runAtomic(c, s.db, "postgres", fn)
+}
+
+// method names the Storage method for metrics and tracing, empty for helpers
+func (s *PostgresStorage) queryContext(c context.Context, method string) (context.Context, context.CancelFunc) {
+	return withQueryTimeout(c, s.queryTimeout, "postgres", method)
+}
+
+// like queryContext for methods that write, see withTransaction
+func (s *PostgresStorage) writeContext(c context.Context, method string) (context.Context, func(*error), error) {
+	return withTransaction(c, s.db, s.queryTimeout, "postgres", method)
+}
+
+// the transaction ctx runs in, otherwise the connection pool
+func (s *PostgresStorage) conn(ctx context.Context) querier {
+	return txConn(ctx, s.db)
+}
+
+// runs an INSERT and returns the id of the new row
+func (s *PostgresStorage) insert(ctx context.Context, query string, args ...any) (int, error) {
+	var id int
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";") + " RETURNING id"
+	err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&id)
+	return id, err
+}
+
+// builds a connection string from the POSTGRES_* env variables
+func PostgresDSNFromEnv() string {
 	HOST := os.Getenv("POSTGRES_HOST")
 	password := os.Getenv("POSTGRES_PASSWORD")
 	database := os.Getenv("POSTGRES_DB")
 	PORT := os.Getenv("POSTGRES_PORT")
 	username := os.Getenv("POSTGRES_USER")
 
-	// make db connection
-	dbUrl := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", HOST, PORT, username, password, database)
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", HOST, PORT, username, password, database)
+}
 
-	db, err := sql.Open("postgres", dbUrl)
+func initPostgresDB(dsn string) (*sql.DB, error) {
+	// make db connection
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, errors.New("couldnot connect to database")
 	}
@@ -50,45 +104,77 @@ func initPostgresDB() (*sql.DB, error) {
 }
 
 // create required tables in db: Users
-func (s *PostgresStorage) SetUpDB() error {
+func (s *PostgresStorage) SetUpDB(c context.Context) error {
+
+	if err := s.createUserTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createUserImageTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createProfileTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createSessionTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createProjectTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createEmploymentTable(c); err != nil {
+		return err
+	}
+
+	if err := s.createTechStackTable(c); err != nil {
+		return err
+	}
 
-	if err := s.createUserTable(); err != nil {
+	if err := s.createProjectTechStackTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createUserImageTable(); err != nil {
+	if err := s.createEmploymentTechStackTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProfileTable(); err != nil {
+	if err := s.createHobbiesTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createSessionTable(); err != nil {
+	if err := s.createAuditLogTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProjectTable(); err != nil {
+	if err := s.createResumeSnapshotTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createEmploymentTable(); err != nil {
+	if err := s.createApiTokenTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createTechStackTable(); err != nil {
+	if err := s.createEmailTokenTable(c); err != nil {
 		return err
 	}
 
-	if err := s.createProjectTechStackTable(); err != nil {
+	if err := s.createWebhookTables(c); err != nil {
 		return err
 	}
 
-	if err := s.createEmploymentTechStackTable(); err != nil {
+	if err := s.addTrashColumns(c); err != nil {
 		return err
 	}
 
-	if err := s.createHobbiesTable(); err != nil {
+	if err := s.addVersionColumns(c); err != nil {
+		return err
+	}
+
+	if err := s.createSearchIndexes(c); err != nil {
 		return err
 	}
 
@@ -97,7 +183,10 @@ func (s *PostgresStorage) SetUpDB() error {
 
 // Users
 
-func (s *PostgresStorage) createUserTable() error {
+func (s *PostgresStorage) createUserTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Users (
 		id SERIAL PRIMARY KEY,
 		username VARCHAR(255) NOT NULL UNIQUE,
@@ -117,59 +206,55 @@ func (s *PostgresStorage) createUserTable() error {
 		portfolio VARCHAR(255) NULL,
 		github VARCHAR(255) NULL,
 		linkedin VARCHAR(255) NULL,
-		twitter VARCHAR(255) NULL
+		twitter VARCHAR(255) NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) createUserImageTable() error {
+func (s *PostgresStorage) createUserImageTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS UserImages (
 		id SERIAL PRIMARY KEY,
 		filename VARCHAR(255) NOT NULL,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) GetUsers(keys map[string]string) ([]*data.User, error) {
-
-	query := "SELECT id, username, firstname, lastname, email, bio, phone, country, password FROM Users WHERE"
-	if len(keys) > 0 {
-		loop_counter := 0
-		for k, v := range keys {
+func (s *PostgresStorage) GetUsers(c context.Context, keys map[string]string) ([]*data.User, error) {
+	// expects keys: id, username, email
+	ctx, cancel := s.queryContext(c, "GetUsers")
+	defer cancel()
 
-			var query_part string
-			_, err := strconv.Atoi(v)
-			if err != nil {
-				query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-			} else {
-				query_part = fmt.Sprintf(" %s = %s ", k, v)
-			}
-
-			if loop_counter > 0 {
-				query = query + fmt.Sprintf(" AND %s ", query_part)
-			} else {
-				query = query + query_part
-			}
-			loop_counter++
-		}
-	}
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"username": "username = $%d",
+		"email":    "email = $%d",
+	})
 
-	rows, err := s.db.Query(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+userColumns+" FROM Users"+notDeleted(query), args...)
 	if err != nil {
 		return nil, err
 	}
-
 	return scanUsers(rows)
 }
-func (s *PostgresStorage) CreateUser(u data.User) error {
+func (s *PostgresStorage) CreateUser(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
 	query := `INSERT INTO Users (username, firstname, lastname, email, password, phone, country, created_on, updated_on, bio, start_date, years_of_work)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12);`
 
-	_, err := s.db.Query(
+	id, err := s.insert(ctx,
 		query,
 		u.Username,
 		u.Firstname,
@@ -184,57 +269,232 @@ func (s *PostgresStorage) CreateUser(u data.User) error {
 		u.Start_date,
 		u.Years_of_work,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	u.Id = fmt.Sprintf("%d", id)
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "user", id, u.Username, nil, u)
 }
 
-func (s *PostgresStorage) CreateUserimage(u data.User, filaname string) error {
+func (s *PostgresStorage) CreateUserimage(c context.Context, u data.User, filaname string) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateUserimage")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(u.Username)
+	user_id, f_err := s.getUserID(ctx, u.Username)
 	if f_err != nil {
 		return f_err
 	}
 
 	query := `INSERT INTO UserImages (filename, user_id) VALUES ($1, $2);`
 
-	_, err := s.db.Query(
+	id, err := s.insert(ctx,
 		query,
 		filaname,
 		user_id,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "user_image", id, u.Username, nil, map[string]string{"filename": filaname})
+}
+
+// returns the filenames of a users uploaded images, oldest first
+func (s *PostgresStorage) GetUserImages(c context.Context, username string) ([]string, error) {
+	ctx, cancel := s.queryContext(c, "GetUserImages")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT i.filename FROM UserImages i JOIN Users u ON u.id = i.user_id WHERE u.username = $1 ORDER BY i.id", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	filenames := []string{}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames, rows.Err()
 }
 
-func (s *PostgresStorage) SetUserSocials(u data.User) error {
+func (s *PostgresStorage) SetUserSocials(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "SetUserSocials")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(u.Username)
+	user_id, f_err := s.getUserID(ctx, u.Username)
 	if f_err != nil {
 		return f_err
 	}
 
+	before, err := userSocials(ctx, s.conn(ctx), user_id)
+	if err != nil {
+		return err
+	}
+
 	q := "UPDATE Users SET portfolio = $1, github = $2, linkedin = $3, twitter = $4 WHERE id = $5"
 
-	_, err := s.db.Exec(q, u.Portfolio, u.Github, u.Linkedin, u.Twitter, user_id)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, u.Portfolio, u.Github, u.Linkedin, u.Twitter, user_id)
+	if err != nil {
+		return err
+	}
+
+	after := map[string]string{"portfolio": u.Portfolio, "github": u.Github, "linkedin": u.Linkedin, "twitter": u.Twitter}
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user_socials", user_id, u.Username, before, after)
+}
+
+// replaces a users password hash and signs them out everywhere,
+// the password change, the end of the sessions and the audit event happen together
+func (s *PostgresStorage) SetUserPassword(c context.Context, username, password_hash string) (err error) {
+	ctx, end, err := s.writeContext(c, "SetUserPassword")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx, "UPDATE Users SET password = $1 WHERE id = $2", password_hash, user_id)
+	if err != nil {
+		return err
+	}
+
+	// sessions started with the old password end
+	_, err = s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE user_id = $1", user_id)
+	if err != nil {
+		return err
+	}
+
+	// hashes are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user_password", user_id, username, nil, map[string]bool{"password_changed": true})
 }
 
-func (s *PostgresStorage) VerifyUserEmail(username string) ([]*data.User, error) {
+func (s *PostgresStorage) VerifyUserEmail(c context.Context, username string) (_ []*data.User, err error) {
+	ctx, end, err := s.writeContext(c, "VerifyUserEmail")
+	if err != nil {
+		return nil, err
+	}
+	defer end(&err)
+
 	query := `UPDATE Users SET email_verified = TRUE  WHERE username = $1`
-	_, err := s.db.Exec(query, username)
+	_, err = s.conn(ctx).ExecContext(ctx, query, username)
 	if err != nil {
 		return nil, err
 	}
-	return s.GetUsers(map[string]string{"username": username})
+	users, err := s.GetUsers(ctx, map[string]string{"username": username})
+	if err != nil || len(users) == 0 {
+		return users, err
+	}
+
+	user_id, _ := strconv.Atoi(users[0].Id)
+	audit_err := recordAudit(ctx, s.conn(ctx), AuditUpdate, "user", user_id, username, map[string]bool{"email_verified": false}, map[string]bool{"email_verified": true})
+	return users, audit_err
 }
 
-func (s *PostgresStorage) DeleteUser(u data.User) error {
-	query := `DELETE FROM Users WHERE username = $1`
-	_, err := s.db.Exec(query, u.Username)
-	return err
+// updates a users personal details, credentials are changed separately
+func (s *PostgresStorage) UpdateUser(c context.Context, u data.User) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	users, err := s.GetUsers(ctx, map[string]string{"username": u.Username})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return sql.ErrNoRows
+	}
+
+	user_id, _ := strconv.Atoi(users[0].Id)
+	if users[0].Version != u.Version {
+		return &ConflictError{Entity: "user", Id: user_id, Version: u.Version, Current: users[0]}
+	}
+
+	u.Updated_on = time.Now()
+	q := `UPDATE Users SET firstname = $1, lastname = $2, bio = $3, phone = $4, country = $5, updated_on = $6, version = version + 1
+	WHERE username = $7 AND version = $8 AND deleted_on IS NULL`
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, u.Firstname, u.Lastname, u.Bio, u.Phone, u.Country, u.Updated_on, u.Username, u.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "user", Id: user_id, Version: u.Version}); err != nil {
+		return err
+	}
+
+	u.Version++
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "user", user_id, u.Username, users[0], u)
+}
+
+func (s *PostgresStorage) DeleteUser(c context.Context, u data.User) (err error) {
+	// moves the account to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, u.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `UPDATE Users SET deleted_on = $1 WHERE username = $2 AND deleted_on IS NULL`
+	_, err = s.conn(ctx).ExecContext(ctx, query, time.Now(), u.Username)
+	if err != nil {
+		return err
+	}
+
+	// a trashed account is signed out everywhere
+	_, err = s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE user_id = $1", user_id)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "user", user_id, u.Username, u, nil)
+}
+
+func (s *PostgresStorage) RestoreUser(c context.Context, username string) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreUser")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	query := `UPDATE Users SET deleted_on = NULL WHERE username = $1`
+	_, err = s.conn(ctx).ExecContext(ctx, query, username)
+	if err != nil {
+		return err
+	}
+
+	user_id, err := s.getUserID(ctx, username)
+	if err != nil {
+		return err
+	}
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "user", user_id, username, nil, map[string]string{"username": username})
 }
 
-func (s *PostgresStorage) getUserID(username string) (int, error) {
+func (s *PostgresStorage) getUserID(c context.Context, username string) (int, error) {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	var user_id int
-	f_err := s.db.QueryRow("SELECT id FROM Users WHERE username = $1", username).Scan(&user_id)
+	f_err := s.conn(ctx).QueryRowContext(ctx, "SELECT id FROM Users WHERE username = $1 AND deleted_on IS NULL", username).Scan(&user_id)
 	if f_err != nil {
 		return 0, f_err
 	}
@@ -245,100 +505,173 @@ func (s *PostgresStorage) getUserID(username string) (int, error) {
 
 // Profile
 
-func (s *PostgresStorage) createProfileTable() error {
+func (s *PostgresStorage) createProfileTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Profiles (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
 		role VARCHAR(255) NOT NULL UNIQUE,
 		about TEXT NOT NULL,
-		views INTEGER
+		views INTEGER,
+		version INTEGER NOT NULL DEFAULT 1
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) GetProfile(username string) (*data.Profile, error) {
+func (s *PostgresStorage) GetProfile(c context.Context, username string) (*data.Profile, error) {
+	ctx, cancel := s.queryContext(c, "GetProfile")
+	defer cancel()
 
-	user_id, f_err := s.getUserID(username)
+	user_id, f_err := s.getUserID(ctx, username)
 	if f_err != nil {
 		return nil, f_err
 	}
 
-	profile := new(data.Profile)
-	q := s.db.QueryRow("SELECT user, role, about, views FROM Profiles WHERE user = $1", user_id)
-	err := q.Scan(
-		&profile.User,
-		&profile.Role,
-		&profile.About,
-		&profile.Views,
-	)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+profileColumns+" FROM Profiles WHERE user_id = $1", user_id)
 	if err != nil {
 		return nil, err
 	}
-	return profile, nil
-}
 
-func (s *PostgresStorage) GetProfileByRole(role string) ([]*data.Profile, error) {
-	rows, err := s.db.Query("SELECT user, role, views FROM Profiles WHERE role = $1", role)
+	profiles, err := s.scanProfiles(ctx, rows)
 	if err != nil {
 		return nil, err
 	}
+	if len(profiles) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return profiles[0], nil
+}
 
-	var profiles []*data.Profile
-	for rows.Next() {
-		profile := new(data.Profile)
-		err := rows.Scan(
-			profile.User,
-			profile.Role,
-			profile.About,
-			profile.Views,
-		)
-		if err != nil {
-			return nil, err
-		}
-		profiles = append(profiles, profile)
+func (s *PostgresStorage) GetProfileByRole(c context.Context, role string, page Page) ([]*data.Profile, string, error) {
+	ctx, cancel := s.queryContext(c, "GetProfileByRole")
+	defer cancel()
+
+	query := "SELECT " + profileColumns + " FROM Profiles WHERE role = $1"
+	page_query, page_args, err := page.clause(profileSortKeys, "id", 1, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query+page_query, append([]any{role}, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	profiles, err := s.scanProfiles(ctx, rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	profiles, next := nextCursor(page, profiles, profileSortValue(page))
+	return profiles, next, nil
+}
+
+func (s *PostgresStorage) scanProfiles(c context.Context, rows *sql.Rows) ([]*data.Profile, error) {
+	profiles, user_ids, err := scanProfileRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	return profiles, nil
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		profiles[i].User = u
+	})
+	return profiles, err
 }
 
-func (s *PostgresStorage) CreateProfile(p data.Profile) error {
+func (s *PostgresStorage) CreateProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
 	query := `INSERT INTO Profiles (user_id, role, about, views)
-	VALUES ($1, $2, $3);`
+	VALUES ($1, $2, $3, $4);`
 
-	_, err := s.db.Query(
+	id, err := s.insert(ctx,
 		query,
 		user_id,
 		p.Role,
 		p.About,
 		p.Views,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	p.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "profile", id, p.User.Username, nil, p)
+}
+
+func (s *PostgresStorage) UpdateProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	before, err := s.GetProfile(ctx, p.User.Username)
+	if err != nil {
+		return err
+	}
+
+	if before.Version != p.Version {
+		return &ConflictError{Entity: "profile", Id: before.Id, Version: p.Version, Current: before}
+	}
+
+	q := "UPDATE Profiles SET role = $1, about = $2, version = version + 1 WHERE id = $3 AND version = $4"
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, p.Role, p.About, before.Id, p.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "profile", Id: before.Id, Version: p.Version}); err != nil {
+		return err
+	}
+
+	p.Id = before.Id
+	p.Version++
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "profile", p.Id, p.User.Username, before, p)
 }
 
-func (s *PostgresStorage) DeleteProfile(p data.Profile) error {
-	q := "DELETE FROM Profiles WHERE User = $1 AND role = $2"
+func (s *PostgresStorage) DeleteProfile(c context.Context, p data.Profile) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteProfile")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "DELETE FROM Profiles WHERE user_id = $1 AND role = $2"
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Exec(q, user_id, p.Role)
-	return err
+	_, err = s.conn(ctx).ExecContext(ctx, q, user_id, p.Role)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "profile", p.Id, p.User.Username, p, nil)
 }
 
 // Profile
 
 // Session
 
-func (s *PostgresStorage) createSessionTable() error {
+func (s *PostgresStorage) createSessionTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Sessions (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
@@ -346,19 +679,22 @@ func (s *PostgresStorage) createSessionTable() error {
 		expires_on TIMESTAMP,
 		expired BOOLEAN DEFAULT FALSE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) CreateSession(session data.Session) error {
-	user_id, f_err := s.getUserID(session.User.Username)
+func (s *PostgresStorage) CreateSession(c context.Context, session data.Session) error {
+	ctx, cancel := s.queryContext(c, "CreateSession")
+	defer cancel()
+
+	user_id, f_err := s.getUserID(ctx, session.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
 	// delete existing active sessions
 	delete_query := "DELETE FROM Sessions WHERE user_id = $1"
-	_, delete_err := s.db.Exec(delete_query, user_id)
+	_, delete_err := s.conn(ctx).ExecContext(ctx, delete_query, user_id)
 	if delete_err != nil {
 		return delete_err
 	}
@@ -366,15 +702,18 @@ func (s *PostgresStorage) CreateSession(session data.Session) error {
 	// create new session
 	query := "INSERT INTO Sessions (user_id, key, expires_on, expired) VALUES ($1, $2, $3, $4)"
 
-	_, err := s.db.Query(query, user_id, session.Key, session.Expires_on, session.Expired)
+	_, err := s.conn(ctx).ExecContext(ctx, query, user_id, session.Key, session.Expires_on, session.Expired)
 	return err
 }
 
-func (s *PostgresStorage) GetSession(key string) (*data.Session, error) {
+func (s *PostgresStorage) GetSession(c context.Context, key string) (*data.Session, error) {
+	ctx, cancel := s.queryContext(c, "GetSession")
+	defer cancel()
+
 	var user_id int
 
 	session := new(data.Session)
-	q := s.db.QueryRow("SELECT * FROM Sessions WHERE Key = $1", key)
+	q := s.conn(ctx).QueryRowContext(ctx, "SELECT * FROM Sessions WHERE Key = $1", key)
 	err := q.Scan(
 		&session.Id,
 		&user_id,
@@ -387,37 +726,71 @@ func (s *PostgresStorage) GetSession(key string) (*data.Session, error) {
 		return nil, err
 	}
 
-	users, err := s.GetUsers(map[string]string{"id": fmt.Sprintf("%d", user_id)})
+	users, err := s.GetUsers(ctx, map[string]string{"id": fmt.Sprintf("%d", user_id)})
 	if err != nil {
 		return nil, err
 	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
 	session.User = *users[0]
 	return session, nil
 }
 
-func (s *PostgresStorage) DeleteSession(ss data.Session) error {
+func (s *PostgresStorage) DeleteSession(c context.Context, ss data.Session) error {
+	ctx, cancel := s.queryContext(c, "DeleteSession")
+	defer cancel()
+
 	q := "DELETE FROM Session WHERE User = $1 AND expired = True"
 
-	user_id, f_err := s.getUserID(ss.User.Username)
+	user_id, f_err := s.getUserID(ctx, ss.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Exec(q, user_id)
+	_, err := s.conn(ctx).ExecContext(ctx, q, user_id)
 	return err
 }
 
-func (s *PostgresStorage) CancelSession(session data.Session) error {
+func (s *PostgresStorage) CancelSession(c context.Context, session data.Session) error {
+	ctx, cancel := s.queryContext(c, "CancelSession")
+	defer cancel()
+
 	q := "UPDATE Sessions SET expired = $1 WHERE key = $2"
 
-	_, err := s.db.Exec(q, true, session.Key)
+	_, err := s.conn(ctx).ExecContext(ctx, q, true, session.Key)
 	return err
 }
 
+// counts sessions that are neither cancelled nor expired at the given time
+func (s *PostgresStorage) CountActiveSessions(c context.Context, at time.Time) (int64, error) {
+	ctx, cancel := s.queryContext(c, "CountActiveSessions")
+	defer cancel()
+
+	var count int64
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM Sessions WHERE expired = $1 AND expires_on > $2", false, at).Scan(&count)
+	return count, err
+}
+
+// deletes cancelled sessions and sessions that expired before the given time
+func (s *PostgresStorage) PurgeSessions(c context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.queryContext(c, "PurgeSessions")
+	defer cancel()
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM Sessions WHERE expired = $1 OR expires_on < $2", true, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // Session
 
 // Projects
-func (s *PostgresStorage) createProjectTable() error {
+func (s *PostgresStorage) createProjectTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Projects (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
@@ -430,230 +803,206 @@ func (s *PostgresStorage) createProjectTable() error {
 		prod_link VARCHAR(255) NULL,
 		description VARCHAR(255) NOT NULL,
 		created_on TIMESTAMP,
-		updated_on TIMESTAMP
+		updated_on TIMESTAMP,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) CreateProject(p data.Project) error {
+func (s *PostgresStorage) CreateProject(c context.Context, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
 	q := `INSERT INTO Projects (user_id, name, duration, start_date, end_date, status, github, prod_link, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
-	user_id, f_err := s.getUserID(p.User.Username)
+	user_id, f_err := s.getUserID(ctx, p.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Created_on, p.Updated_on)
-	return err
+	id, err := s.insert(ctx, q, user_id, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Created_on, p.Updated_on)
+	if err != nil {
+		return err
+	}
+
+	p.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "project", id, p.User.Username, nil, p)
 }
 
-func (s *PostgresStorage) GetProjects(keys map[string]string) ([]*data.Project, error) {
+func (s *PostgresStorage) GetProjects(c context.Context, keys map[string]string, page Page) ([]*data.Project, string, error) {
 	// expects a map with keys: id, username, name, stack
 	// combines keys using and statement
+	ctx, cancel := s.queryContext(c, "GetProjects")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
-	query := "SELECT * FROM Projects WHERE "
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "stack" {
-			continue
-		}
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+		"stack":    "id IN (SELECT pts.project_id FROM ProjectTechStacks pts JOIN TechStacks ts ON ts.id = pts.techstack_id WHERE ts.name = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
+	}
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	page_query, page_args, err := page.clause(projectSortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
+	}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+projectColumns+" FROM Projects"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
 
-		loop_counter++
+	projects, err := s.scanProjects(ctx, rows)
+	if err != nil {
+		return nil, "", err
 	}
 
-	projects := []*data.Project{}
-	if loop_counter > 0 {
-		rows, err := s.db.Query(query)
-		if err != nil {
-			return nil, err
-		}
+	projects, next := nextCursor(page, projects, projectSortValue(page))
+	return projects, next, nil
+}
 
-		projects, _ = s.scanProjects(rows)
-	}
+func (s *PostgresStorage) GetProjectsByTechStack(c context.Context, keys map[string]string) ([]*data.Project, error) {
+	ctx, cancel := s.queryContext(c, "GetProjectsByTechStack")
+	defer cancel()
 
-	stack_name, ok := keys["stack"]
-	if ok {
-		keywords := map[string]string{
-			"name": stack_name,
-		}
-		p_id, ok := keys["id"]
-		if ok {
-			keywords["project_id"] = p_id
-		}
+	// expects a map with keys: techstack_id, name, project_id, username
 
-		username, ok := keys["username"]
-		if ok {
-			keywords["username"] = username
-		}
+	if len(keys) == 0 {
+		return nil, errors.New("provide search keyword")
+	}
 
-		p, err := s.GetProjectsByTechStack(keywords)
-		if err != err {
-			return nil, nil
-		}
+	query, args := filterClause(keys, projectsByStackFilters)
+	if query == "" {
+		return nil, nil
+	}
 
-		// only add record that havent been added yet
-	outer:
-		for _, v := range p {
-			for _, k := range projects {
-				if k.Id == v.Id {
-					// move to the next item in p (the outer loop)
-					continue outer
-				}
-			}
-			projects = append(projects, v)
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+projectColumns+" FROM Projects"+notDeleted(query)+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
 	}
 
-	return projects, nil
+	return s.scanProjects(ctx, rows)
 }
 
-func (s *PostgresStorage) GetProjectsByTechStack(keys map[string]string) ([]*data.Project, error) {
-	// expects a map with keys: techstack_id, name, project_id, username
-
-	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+func (s *PostgresStorage) scanProjects(c context.Context, rows *sql.Rows) ([]*data.Project, error) {
+	projects, user_ids, err := scanProjectRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	query := "SELECT * FROM ProjectTechStacks WHERE "
+	// owners are loaded in one query rather than one per row
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		projects[i].User = u
+	})
+	return projects, err
+}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "name" {
-			var stack_id int
-			f_err := s.db.QueryRow("SELECT id FROM TechStacks WHERE name = $1", v).Scan(&stack_id)
-			if f_err != nil {
-				return nil, f_err
-			}
-			k = "techstack_id"
-			v = fmt.Sprintf("%d", stack_id)
-		}
-		if k == "username" {
-			continue
-		}
+func (s *PostgresStorage) UpdateProject(c context.Context, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", p.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
+	}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+	if records[0].Version != p.Version {
+		return &ConflictError{Entity: "project", Id: p.Id, Version: p.Version, Current: records[0]}
+	}
+
+	p.Updated_on = time.Now()
+	q := `UPDATE Projects SET name = $1, duration = $2, start_date = $3, end_date = $4, status = $5, github = $6, prod_link = $7, description = $8, updated_on = $9, version = version + 1
+	WHERE id = $10 AND version = $11 AND deleted_on IS NULL`
 
-		loop_counter++
+	result, err := s.conn(ctx).ExecContext(ctx, q, p.Name, p.Duration, p.Start_date, p.End_date, p.Status, p.Github, p.Prod_link, p.Description, p.Updated_on, p.Id, p.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "project", Id: p.Id, Version: p.Version}); err != nil {
+		return err
 	}
 
-	var projects []*data.Project
+	p.Version++
 
-	if loop_counter == 0 {
-		return nil, nil
+	p.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "project", p.Id, p.User.Username, records[0], p)
+}
+
+func (s *PostgresStorage) DeleteProject(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteProject")
+	if err != nil {
+		return err
 	}
+	defer end(&err)
 
-	rows, err := s.db.Query(query)
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
 	}
 
-	for rows.Next() {
-		record := new(struct {
-			id           string
-			techstack_id string
-			project_id   string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
+	q := "UPDATE Projects SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
 
-		// get projects with found id
-		p, e := s.GetProjects(map[string]string{"id": record.project_id})
-		if e != nil {
-			return nil, e
-		}
-		username, ok := keys["username"]
-		if ok {
-			if p[0].User.Username != username {
-				continue
-			}
-		}
-		projects = append(projects, p[0])
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
 	}
 
-	return projects, nil
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "project", id, records[0].User.Username, records[0], nil)
 }
 
-func (s *PostgresStorage) scanProjects(rows *sql.Rows) ([]*data.Project, error) {
-	var projects []*data.Project
-	for rows.Next() {
-		project := new(data.Project)
-		var user_id int
-		err := rows.Scan(
-			project.Id,
-			user_id,
-			project.Name,
-			project.Duration,
-			project.Start_date,
-			project.End_date,
-			project.Status,
-			project.Github,
-			project.Prod_link,
-			project.Description,
-			project.Created_on,
-			project.Updated_on,
-		)
-		if err != nil {
-			return projects, err
-		}
+func (s *PostgresStorage) RestoreProject(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-		users, _ := s.GetUsers(map[string]string{"id": fmt.Sprintf("%d", user_id)})
-		project.User = *users[0]
+	q := "UPDATE Projects SET deleted_on = NULL WHERE id = $1"
 
-		projects = append(projects, project)
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
 	}
-	return projects, nil
-}
 
-func (s *PostgresStorage) DeleteProject(id int) error {
-	q := "DELETE FROM Projects WHERE id = $1"
+	records, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
 
-	_, err := s.db.Exec(q, id)
-	return err
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "project", id, records[0].User.Username, nil, records[0])
 }
 
 // Employment
-func (s *PostgresStorage) createEmploymentTable() error {
+func (s *PostgresStorage) createEmploymentTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Employments (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
@@ -666,577 +1015,1342 @@ func (s *PostgresStorage) createEmploymentTable() error {
 		duration VARCHAR(255) NULL,
 		description VARCHAR(255) NOT NULL,
 		created_on TIMESTAMP,
-		updated_on TIMESTAMP
+		updated_on TIMESTAMP,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) CreateEmployment(e data.Employment) error {
-	q := `INSERT INTO Employment (user_id, name, employee, start_date, end_date, status, prod_link, duration, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+func (s *PostgresStorage) CreateEmployment(c context.Context, e data.Employment) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := `INSERT INTO Employments (user_id, name, employee, start_date, end_date, status, prod_link, duration, description, created_on, updated_on) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
-	user_id, f_err := s.getUserID(e.User.Username)
+	user_id, f_err := s.getUserID(ctx, e.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Created_on, e.Updated_on)
-	return err
+	id, err := s.insert(ctx, q, user_id, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Created_on, e.Updated_on)
+	if err != nil {
+		return err
+	}
+
+	e.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "employment", id, e.User.Username, nil, e)
 }
 
-func (s *PostgresStorage) GetEmployments(keys map[string]string) ([]*data.Employment, error) {
+func (s *PostgresStorage) GetEmployments(c context.Context, keys map[string]string, page Page) ([]*data.Employment, string, error) {
 	// expects a map with keys: id, username, name, stack
 	// combines keys using and statement
+	ctx, cancel := s.queryContext(c, "GetEmployments")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
-	query := "SELECT * FROM Employments WHERE "
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "stack" {
-			continue
-		}
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+		"stack":    "id IN (SELECT ets.employment_id FROM EmploymentTechStacks ets JOIN TechStacks ts ON ts.id = ets.techstack_id WHERE ts.name = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
+	}
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	page_query, page_args, err := page.clause(employmentSortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
+	}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+employmentColumns+" FROM Employments"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
 
-		loop_counter++
+	employments, err := s.scanEmployments(ctx, rows)
+	if err != nil {
+		return nil, "", err
 	}
 
-	employments := []*data.Employment{}
-	if loop_counter > 0 {
-		rows, err := s.db.Query(query)
-		if err != nil {
-			return nil, err
-		}
+	employments, next := nextCursor(page, employments, employmentSortValue(page))
+	return employments, next, nil
+}
+
+func (s *PostgresStorage) GetEmploymentsByTechStack(c context.Context, keys map[string]string) ([]*data.Employment, error) {
+	ctx, cancel := s.queryContext(c, "GetEmploymentsByTechStack")
+	defer cancel()
+
+	// expects a map with keys: techstack_id, name, employment_id, username
+
+	if len(keys) == 0 {
+		return nil, errors.New("provide search keyword")
+	}
 
-		employments, _ = s.scanEmployments(rows)
+	query, args := filterClause(keys, employmentsByStackFilters)
+	if query == "" {
+		return nil, nil
 	}
 
-	stack_name, ok := keys["stack"]
-	if ok {
-		keywords := map[string]string{
-			"name": stack_name,
-		}
-		p_id, ok := keys["id"]
-		if ok {
-			keywords["project_id"] = p_id
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+employmentColumns+" FROM Employments"+notDeleted(query)+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
 
-		p, err := s.GetEmploymentsByTechStack(keywords)
-		if err != err {
-			return nil, nil
-		}
+	return s.scanEmployments(ctx, rows)
+}
 
-		// only add record that havent been added yet
-	outer:
-		for _, v := range p {
-			for _, k := range employments {
-				if k.Id == v.Id {
-					// move to the next item in p (the outer loop)
-					continue outer
-				}
-			}
-			employments = append(employments, v)
-		}
+func (s *PostgresStorage) scanEmployments(c context.Context, rows *sql.Rows) ([]*data.Employment, error) {
+	employments, user_ids, err := scanEmploymentRows(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	return employments, nil
+	// owners are loaded in one query rather than one per row
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		employments[i].User = u
+	})
+	return employments, err
 }
 
-func (s *PostgresStorage) GetEmploymentsByTechStack(keys map[string]string) ([]*data.Employment, error) {
-	// expects a map with keys: id, name, employment_id, username
+func (s *PostgresStorage) UpdateEmployment(c context.Context, e data.Employment) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", e.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
 	}
 
-	query := "SELECT * FROM EmploymentTechStacks WHERE "
+	if records[0].Version != e.Version {
+		return &ConflictError{Entity: "employment", Id: e.Id, Version: e.Version, Current: records[0]}
+	}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "name" {
-			var stack_id int
-			f_err := s.db.QueryRow("SELECT id FROM TechStacks WHERE name = $1", v).Scan(&stack_id)
-			if f_err != nil {
-				return nil, f_err
-			}
-			k = "techstack_id"
-			v = fmt.Sprintf("%d", stack_id)
-		}
-		if k == "username" {
-			continue
-		}
+	e.Updated_on = time.Now()
+	q := `UPDATE Employments SET name = $1, employee = $2, start_date = $3, end_date = $4, status = $5, prod_link = $6, duration = $7, description = $8, updated_on = $9, version = version + 1
+	WHERE id = $10 AND version = $11 AND deleted_on IS NULL`
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	result, err := s.conn(ctx).ExecContext(ctx, q, e.Name, e.Employee, e.Start_date, e.End_date, e.Status, e.Prod_link, e.Duration, e.Description, e.Updated_on, e.Id, e.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "employment", Id: e.Id, Version: e.Version}); err != nil {
+		return err
+	}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+	e.Version++
 
-		loop_counter++
-	}
+	e.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "employment", e.Id, e.User.Username, records[0], e)
+}
 
-	if loop_counter == 0 {
-		return nil, nil
+func (s *PostgresStorage) DeleteEmployment(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteEmployment")
+	if err != nil {
+		return err
 	}
+	defer end(&err)
 
-	rows, err := s.db.Query(query)
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
 	}
 
-	var employments []*data.Employment
-	for rows.Next() {
-		record := new(struct {
-			id            string
-			techstack_id  string
-			employment_id string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
-
-		// get employments with found id
-		p, e := s.GetEmployments(map[string]string{"id": record.employment_id})
-		if e != nil {
-			return nil, e
-		}
+	q := "UPDATE Employments SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
 
-		username, ok := keys["username"]
-		if ok {
-			// if username was passed, only add employments with this stack and user
-			if p[0].User.Username != username {
-				continue
-			}
-		}
-		employments = append(employments, p[0])
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
 	}
 
-	return employments, nil
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "employment", id, records[0].User.Username, records[0], nil)
 }
 
-func (s *PostgresStorage) scanEmployments(rows *sql.Rows) ([]*data.Employment, error) {
-	var Employments []*data.Employment
-	for rows.Next() {
-		Employment := new(data.Employment)
-		var user_id int
-		err := rows.Scan(
-			Employment.Id,
-			user_id,
-			Employment.Name,
-			Employment.Employee,
-			Employment.Start_date,
-			Employment.End_date,
-			Employment.Status,
-			Employment.Prod_link,
-			Employment.Duration,
-			Employment.Description,
-			Employment.Created_on,
-			Employment.Updated_on,
-		)
-		if err != nil {
-			return Employments, err
-		}
+func (s *PostgresStorage) RestoreEmployment(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-		users, _ := s.GetUsers(map[string]string{"id": fmt.Sprintf("%d", user_id)})
-		Employment.User = *users[0]
+	q := "UPDATE Employments SET deleted_on = NULL WHERE id = $1"
 
-		Employments = append(Employments, Employment)
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
 	}
-	return Employments, nil
-}
 
-func (s *PostgresStorage) DeleteEmployment(id int) error {
-	q := "DELETE FROM Employments WHERE id = $1"
+	records, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
 
-	_, err := s.db.Exec(q, id)
-	return err
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "employment", id, records[0].User.Username, nil, records[0])
 }
 
 // // Hobby
-func (s *PostgresStorage) createHobbiesTable() error {
+func (s *PostgresStorage) createHobbiesTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS Hobbies (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
-		name VARCHAR(255) NOT NULL
+		name VARCHAR(255) NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) CreateHobby(h data.Hobby) error {
+func (s *PostgresStorage) CreateHobby(c context.Context, h data.Hobby) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
 	q := `INSERT INTO Hobbies (user_id, name) VALUES ($1, $2)`
 
-	user_id, f_err := s.getUserID(h.User.Username)
+	user_id, f_err := s.getUserID(ctx, h.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, h.Name)
-	return err
+	id, err := s.insert(ctx, q, user_id, h.Name)
+	if err != nil {
+		return err
+	}
 
+	h.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "hobby", id, h.User.Username, nil, h)
 }
 
-func (s *PostgresStorage) GetHobbies(keys map[string]string) ([]*data.Hobby, error) {
+func (s *PostgresStorage) GetHobbies(c context.Context, keys map[string]string, page Page) ([]*data.Hobby, string, error) {
 	// expects keys: id, username, name
+	ctx, cancel := s.queryContext(c, "GetHobbies")
+	defer cancel()
 
 	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+		return nil, "", errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM Hobbies WHERE "
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	})
+	if query == "" {
+		return nil, "", errors.New("provide search keyword")
+	}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
+	page_query, page_args, err := page.clause(hobbySortKeys, "id", len(args), true)
+	if err != nil {
+		return nil, "", err
+	}
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+hobbyColumns+" FROM Hobbies"+notDeleted(query)+page_query, append(args, page_args...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	hobbies, user_ids, err := scanHobbyRows(rows)
+	if err != nil {
+		return nil, "", err
+	}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+	err = attachUsers(ctx, s.conn(ctx), user_ids, func(i int, u data.User) {
+		hobbies[i].User = u
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	hobbies, next := nextCursor(page, hobbies, hobbySortValue(page))
+	return hobbies, next, nil
+}
 
-		loop_counter++
+func (s *PostgresStorage) UpdateHobby(c context.Context, h data.Hobby) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateHobby")
+	if err != nil {
+		return err
 	}
+	defer end(&err)
 
-	if loop_counter == 0 {
-		return nil, nil
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", h.Id)}, Page{})
+	if err != nil {
+		return err
 	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
+	}
+
+	if records[0].Version != h.Version {
+		return &ConflictError{Entity: "hobby", Id: h.Id, Version: h.Version, Current: records[0]}
+	}
+
+	q := "UPDATE Hobbies SET name = $1, version = version + 1 WHERE id = $2 AND version = $3 AND deleted_on IS NULL"
 
-	rows, err := s.db.Query(query)
+	result, err := s.conn(ctx).ExecContext(ctx, q, h.Name, h.Id, h.Version)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "hobby", Id: h.Id, Version: h.Version}); err != nil {
+		return err
 	}
 
-	var hobbies []*data.Hobby
-	for rows.Next() {
-		hobbie := new(data.Hobby)
-		err := rows.Scan(hobbie)
-		if err != nil {
-			continue
-		}
-		hobbies = append(hobbies, hobbie)
+	h.Version++
+
+	h.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "hobby", h.Id, h.User.Username, records[0], h)
+}
+
+func (s *PostgresStorage) DeleteHobby(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
+	}
+
+	q := "UPDATE Hobbies SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
 	}
-	return hobbies, nil
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "hobby", id, records[0].User.Username, records[0], nil)
 }
 
-func (s *PostgresStorage) DeleteHobby(id int) error {
-	q := "DELETE FROM Hobbies WHERE id = $1"
+func (s *PostgresStorage) RestoreHobby(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreHobby")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
 
-	_, err := s.db.Exec(q, id)
-	return err
+	q := "UPDATE Hobbies SET deleted_on = NULL WHERE id = $1"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	records, _, err := s.GetHobbies(ctx, map[string]string{"id": fmt.Sprintf("%d", id)}, Page{})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "hobby", id, records[0].User.Username, nil, records[0])
 }
 
 // // TechStack
-func (s *PostgresStorage) createTechStackTable() error {
+func (s *PostgresStorage) createTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS TechStacks (
 		id SERIAL PRIMARY KEY,
 		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
-		name VARCHAR(255) NOT NULL
+		name VARCHAR(255) NOT NULL,
+		version INTEGER NOT NULL DEFAULT 1,
+		deleted_on TIMESTAMP NULL
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
 // TECH STACK RELATIONSHIPS (M:M)
-func (s *PostgresStorage) createProjectTechStackTable() error {
+func (s *PostgresStorage) createProjectTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS ProjectTechStacks (
 		id SERIAL PRIMARY KEY,
 		techstack_id INTEGER REFERENCES TechStacks(id) ON DELETE CASCADE,
 		project_id INTEGER REFERENCES Projects(id) ON DELETE CASCADE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
-func (s *PostgresStorage) createEmploymentTechStackTable() error {
+func (s *PostgresStorage) createEmploymentTechStackTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
 	query := `CREATE TABLE IF NOT EXISTS EmploymentTechStacks (
 		id SERIAL PRIMARY KEY,
 		techstack_id INTEGER REFERENCES TechStacks(id) ON DELETE CASCADE,
 		employment_id INTEGER REFERENCES Employments(id) ON DELETE CASCADE
 	)`
-	_, err := s.db.Exec(query)
+	_, err := s.conn(ctx).ExecContext(ctx, query)
 	return err
 }
 
 // TECH STACK RELATIONSHIPS
 
-func (s *PostgresStorage) CreateTechStack(t data.TechStack) error {
-	q := `INSERT INTO TechStacks (user_id, name) VALUES ($1, $2)`
-
-	user_id, f_err := s.getUserID(t.User.Username)
+func (s *PostgresStorage) CreateTechStack(c context.Context, t data.TechStack) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := `INSERT INTO TechStacks (user_id, name) VALUES ($1, $2)`
+
+	user_id, f_err := s.getUserID(ctx, t.User.Username)
 	if f_err != nil {
 		return f_err
 	}
 
-	_, err := s.db.Query(q, user_id, t.Name)
-	return err
+	id, err := s.insert(ctx, q, user_id, t.Name)
+	if err != nil {
+		return err
+	}
+
+	t.Id = id
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "stack", id, t.User.Username, nil, t)
 }
 
-func (s *PostgresStorage) GetTechStacks(keys map[string]string) ([]*data.TechStack, error) {
+func (s *PostgresStorage) GetTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
 	// expects keys: id, username, name
+	ctx, cancel := s.queryContext(c, "GetTechStacks")
+	defer cancel()
 
 	if len(keys) == 0 {
 		return nil, errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM TechStacks WHERE "
+	query, args := filterClause(keys, map[string]string{
+		"id":       "id = $%d",
+		"name":     "name = $%d",
+		"username": "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	})
+	if query == "" {
+		return nil, nil
+	}
 
-	loop_counter := 0
-	for k, v := range keys {
-		if k == "username" {
-			user_id, err := s.getUserID(v)
-			if err != nil {
-				continue
-			}
-			k = "user"
-			v = fmt.Sprintf("%d", user_id)
-		}
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
+	if err != nil {
+		return nil, err
+	}
 
-		var query_part string
-		_, err := strconv.Atoi(v)
-		if err != nil {
-			query_part = fmt.Sprintf(" %s = '%s' ", k, v)
-		} else {
-			query_part = fmt.Sprintf(" %s = %s ", k, v)
-		}
+	return s.scanTechStack(ctx, rows)
+}
 
-		if loop_counter > 0 {
-			query = query + fmt.Sprintf(" AND %s ", query_part)
-		} else {
-			query = query + query_part
-		}
+func (s *PostgresStorage) scanTechStack(c context.Context, rows *sql.Rows) ([]*data.TechStack, error) {
+	stacks, user_ids, err := scanTechStackRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachUsers(c, s.conn(c), user_ids, func(i int, u data.User) {
+		stacks[i].User = u
+	})
+	return stacks, err
+}
+
+// returns techstacks for a given project
+func (s *PostgresStorage) GetProjectTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	ctx, cancel := s.queryContext(c, "GetProjectTechStacks")
+	defer cancel()
+
+	// expects keys: project_id, project_name, username
 
-		loop_counter++
+	if len(keys) == 0 {
+		return nil, errors.New("provide search keyword")
 	}
 
-	if loop_counter == 0 {
+	query, args := filterClause(keys, projectStackFilters)
+	if query == "" {
 		return nil, nil
 	}
 
-	rows, err := s.db.Query(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.scanTechStack(rows)
+	return s.scanTechStack(ctx, rows)
 }
 
-func (s *PostgresStorage) scanTechStack(rows *sql.Rows) ([]*data.TechStack, error) {
-	var stacks []*data.TechStack
-	for rows.Next() {
-		stack := new(data.TechStack)
-		err := rows.Scan(stack)
-		if err != nil {
-			continue
-		}
-		stacks = append(stacks, stack)
-	}
-	return stacks, nil
-}
+// returns techstacks for a given employment
+func (s *PostgresStorage) GetEmploymentTechStacks(c context.Context, keys map[string]string) ([]*data.TechStack, error) {
+	ctx, cancel := s.queryContext(c, "GetEmploymentTechStacks")
+	defer cancel()
 
-// returns techstacks for a given project
-func (s *PostgresStorage) GetProjectTechStacks(keys map[string]string) ([]*data.TechStack, error) {
-	// expects keys: project_id, project_name
+	// expects keys: employment_id, employment_name, username
 
 	if len(keys) == 0 {
 		return nil, errors.New("provide search keyword")
 	}
 
-	query := "SELECT * FROM ProjectTechStacks WHERE "
+	query, args := filterClause(keys, employmentStackFilters)
+	if query == "" {
+		return nil, nil
+	}
 
-	project_id, _ := keys["project_id"]
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+stackColumns+" FROM TechStacks"+notDeleted(query), args...)
+	if err != nil {
+		return nil, err
+	}
 
-	project_name, ok := keys["project_name"]
-	if ok {
-		// get project id
-		results, err := s.GetProjects(map[string]string{"name": project_name})
-		if err != nil {
-			return nil, err
+	return s.scanTechStack(ctx, rows)
+}
+
+func (s *PostgresStorage) UpdateTechStack(c context.Context, t data.TechStack) (err error) {
+	ctx, end, err := s.writeContext(c, "UpdateTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", t.Id)})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return sql.ErrNoRows
+	}
+
+	if records[0].Version != t.Version {
+		return &ConflictError{Entity: "stack", Id: t.Id, Version: t.Version, Current: records[0]}
+	}
+
+	q := "UPDATE TechStacks SET name = $1, version = version + 1 WHERE id = $2 AND version = $3 AND deleted_on IS NULL"
+
+	result, err := s.conn(ctx).ExecContext(ctx, q, t.Name, t.Id, t.Version)
+	if err != nil {
+		return err
+	}
+	if err := versionUpdated(result, &ConflictError{Entity: "stack", Id: t.Id, Version: t.Version}); err != nil {
+		return err
+	}
+
+	t.Version++
+
+	t.User = records[0].User
+	return recordAudit(ctx, s.conn(ctx), AuditUpdate, "stack", t.Id, t.User.Username, records[0], t)
+}
+
+func (s *PostgresStorage) DeleteTechStack(c context.Context, id int) (err error) {
+	// moves the record to the trash, see PurgeTrash
+	ctx, end, err := s.writeContext(c, "DeleteTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", id)})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		// not found or already in the trash
+		return nil
+	}
+
+	q := "UPDATE TechStacks SET deleted_on = $1 WHERE id = $2 AND deleted_on IS NULL"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "stack", id, records[0].User.Username, records[0], nil)
+}
+
+func (s *PostgresStorage) RestoreTechStack(c context.Context, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "RestoreTechStack")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	q := "UPDATE TechStacks SET deleted_on = NULL WHERE id = $1"
+
+	_, err = s.conn(ctx).ExecContext(ctx, q, id)
+	if err != nil {
+		return err
+	}
+
+	records, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprintf("%d", id)})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditRestore, "stack", id, records[0].User.Username, nil, records[0])
+}
+
+func (s *PostgresStorage) AddTechStackToProject(c context.Context, t data.TechStack, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "AddTechStackToProject")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	// fetch project
+	projects, _, err := s.GetProjects(ctx, map[string]string{"id": fmt.Sprint(p.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+
+	// fetch tech stack
+	stacks, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprint(t.Id)})
+	if err != nil {
+		return err
+	}
+
+	if len(projects) == 0 || len(stacks) == 0 {
+		return sql.ErrNoRows
+	}
+
+	// save to db
+	_, write_err := s.conn(ctx).ExecContext(ctx, "INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, projects[0].Id)
+	if write_err != nil {
+		return write_err
+	}
+
+	link := map[string]int{"project": projects[0].Id, "stack": stacks[0].Id}
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "project_stack", projects[0].Id, projects[0].User.Username, nil, link)
+}
+
+func (s *PostgresStorage) AddTechStackToEmployment(c context.Context, t data.TechStack, p data.Project) (err error) {
+	ctx, end, err := s.writeContext(c, "AddTechStackToEmployment")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	// fetch employment
+	employments, _, err := s.GetEmployments(ctx, map[string]string{"id": fmt.Sprint(p.Id)}, Page{})
+	if err != nil {
+		return err
+	}
+
+	// fetch tech stack
+	stacks, err := s.GetTechStacks(ctx, map[string]string{"id": fmt.Sprint(t.Id)})
+	if err != nil {
+		return err
+	}
+
+	if len(employments) == 0 || len(stacks) == 0 {
+		return sql.ErrNoRows
+	}
+
+	// save to db
+	_, write_err := s.conn(ctx).ExecContext(ctx, "INSERT INTO EmploymentTechStacks (techstack_id, employment_id) VALUES ($1, $2)", stacks[0].Id, employments[0].Id)
+	if write_err != nil {
+		return write_err
+	}
+
+	link := map[string]int{"employment": employments[0].Id, "stack": stacks[0].Id}
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "employment_stack", employments[0].Id, employments[0].User.Username, nil, link)
+}
+
+// Trash
+
+// adds deleted_on to tables created before soft deletes existed
+func (s *PostgresStorage) addTrashColumns(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	for _, t := range trashTables {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_on TIMESTAMP NULL", t.table)
+		if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+			return err
 		}
-		project_id = fmt.Sprintf("%d", results[0].Id)
 	}
+	return nil
+}
+
+// lists a users soft deleted records, most recently deleted first
+func (s *PostgresStorage) GetTrash(c context.Context, username string) ([]*data.TrashItem, error) {
+	ctx, cancel := s.queryContext(c, "GetTrash")
+	defer cancel()
 
-	rows, err := s.db.Query(fmt.Sprintf("%s project_id = %s", query, project_id))
+	var parts []string
+	for _, t := range trashTables {
+		if t.kind == "user" {
+			// a deleted account can not sign in to see its own trash
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(
+			"SELECT '%s', id, %s, deleted_on FROM %s WHERE deleted_on IS NOT NULL AND %s = (SELECT id FROM Users WHERE username = $1)",
+			t.kind, t.name, t.table, t.user,
+		))
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, strings.Join(parts, " UNION ALL ")+" ORDER BY deleted_on DESC", username)
 	if err != nil {
 		return nil, err
 	}
+	return scanTrash(rows)
+}
 
-	var stacks []*data.TechStack
+// permanently removes records deleted before the given time
+func (s *PostgresStorage) PurgeTrash(c context.Context, before time.Time) (_ int64, err error) {
+	ctx, end, err := s.writeContext(c, "PurgeTrash")
+	if err != nil {
+		return 0, err
+	}
+	defer end(&err)
 
-	for rows.Next() {
-		record := new(struct {
-			id           string
-			techstack_id string
-			project_id   string
-		})
-		err := rows.Scan(record)
+	var purged int64
+	for _, t := range trashTables {
+		result, err := s.conn(ctx).ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE deleted_on IS NOT NULL AND deleted_on < $1", t.table), before)
 		if err != nil {
-			continue
+			return purged, err
 		}
+		count, _ := result.RowsAffected()
+		purged += count
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+	return purged, recordAudit(ctx, s.conn(ctx), AuditPurge, "trash", 0, "", nil, map[string]any{"purged": purged, "before": before})
+}
 
-		// get techstacks with found id
-		stack, err := s.GetTechStacks(map[string]string{"id": record.techstack_id})
-		if err != nil {
-			return nil, err
+// adds version to tables created before optimistic locking existed
+func (s *PostgresStorage) addVersionColumns(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	for _, t := range versionTables {
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1", t)
+		if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+			return err
 		}
-		username, ok := keys["username"]
-		if ok {
-			if stack[0].User.Username != username {
-				continue
-			}
+	}
+	return nil
+}
+
+// Audit
+
+func (s *PostgresStorage) createAuditLogTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS AuditLog (
+		id SERIAL PRIMARY KEY,
+		actor VARCHAR(255) NOT NULL,
+		owner VARCHAR(255) NOT NULL,
+		entity VARCHAR(50) NOT NULL,
+		entity_id INTEGER NOT NULL,
+		action VARCHAR(20) NOT NULL,
+		before_data TEXT NOT NULL,
+		after_data TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	// the log is append only
+	for _, rule := range []string{
+		"CREATE OR REPLACE RULE auditlog_no_update AS ON UPDATE TO AuditLog DO INSTEAD NOTHING",
+		"CREATE OR REPLACE RULE auditlog_no_delete AS ON DELETE TO AuditLog DO INSTEAD NOTHING",
+	} {
+		if _, err := s.conn(ctx).ExecContext(ctx, rule); err != nil {
+			return err
 		}
-		stacks = append(stacks, stack[0])
 	}
+	return nil
+}
 
-	return stacks, nil
+// lists audit events newest first.
+// expects keys: actor, owner, entity, entity_id, action
+func (s *PostgresStorage) GetAuditLog(c context.Context, keys map[string]string, page Page) ([]*data.AuditEvent, string, error) {
+	ctx, cancel := s.queryContext(c, "GetAuditLog")
+	defer cancel()
 
+	page = auditPage(page)
+	query, args, err := auditListQuery(keys, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	events, err := scanAuditEvents(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	events, next := nextCursor(page, events, auditSortValue)
+	return events, next, nil
 }
 
-// returns techstacks for a given employment
-func (s *PostgresStorage) GetEmploymentTechStacks(keys map[string]string) ([]*data.TechStack, error) {
-	// expects keys: employment_id, employment_name
+// Resume
 
-	if len(keys) == 0 {
-		return nil, errors.New("provide search keyword")
+// loads a users profile, projects, employments, hobbies and stacks in a fixed
+// number of queries, see loadResumeAggregate
+func (s *PostgresStorage) LoadResumeAggregate(c context.Context, user_id int) (*data.Resume, error) {
+	ctx, cancel := s.queryContext(c, "LoadResumeAggregate")
+	defer cancel()
+
+	return loadResumeAggregate(ctx, s.conn(ctx), user_id)
+}
+
+// Snapshots
+
+func (s *PostgresStorage) createResumeSnapshotTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS ResumeSnapshots (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		label VARCHAR(255) NOT NULL,
+		data TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+// saves a frozen copy of the snapshots resume, snapshots are never modified
+func (s *PostgresStorage) CreateResumeSnapshot(c context.Context, snapshot data.ResumeSnapshot) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateResumeSnapshot")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, snapshot.User.Username)
+	if f_err != nil {
+		return f_err
 	}
 
-	query := "SELECT * FROM EmploymentTechStacks WHERE "
+	resume_json, err := json.Marshal(snapshot.Resume)
+	if err != nil {
+		return err
+	}
 
-	employment_id, _ := keys["employment_id"]
+	// imported snapshots keep the time they were taken
+	created_on := snapshot.Created_on
+	if created_on.IsZero() {
+		created_on = time.Now()
+	}
 
-	// get id for given username
-	employment_name, ok := keys["employment_name"]
-	if ok {
-		// get employment id
-		results, err := s.GetEmployments(map[string]string{"name": employment_name})
-		if err != nil {
-			return nil, err
-		}
-		employment_id = fmt.Sprintf("%d", results[0].Id)
+	query := `INSERT INTO ResumeSnapshots (user_id, label, data, created_on)
+	VALUES ($1, $2, $3, $4)`
+
+	id, err := s.insert(ctx, query, user_id, snapshot.Label, string(resume_json), created_on)
+	if err != nil {
+		return err
 	}
 
-	rows, err := s.db.Query(fmt.Sprintf("%s employment_id = %s", query, employment_id))
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "snapshot", id, snapshot.User.Username, nil, map[string]any{"label": snapshot.Label})
+}
+
+// lists a users snapshots newest first
+func (s *PostgresStorage) GetResumeSnapshots(c context.Context, username string) ([]*data.ResumeSnapshot, error) {
+	ctx, cancel := s.queryContext(c, "GetResumeSnapshots")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, snapshotQuery+" WHERE u.username = $1 ORDER BY s.created_on DESC, s.id DESC", username)
 	if err != nil {
 		return nil, err
 	}
 
-	var stacks []*data.TechStack
+	return scanSnapshots(rows)
+}
 
-	for rows.Next() {
-		record := new(struct {
-			id            string
-			techstack_id  string
-			employment_id string
-		})
-		err := rows.Scan(record)
-		if err != nil {
-			continue
-		}
+func (s *PostgresStorage) GetResumeSnapshot(c context.Context, id int) (*data.ResumeSnapshot, error) {
+	ctx, cancel := s.queryContext(c, "GetResumeSnapshot")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, snapshotQuery+" WHERE s.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := scanSnapshots(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return snapshots[0], nil
+}
+
+// API tokens
+
+func (s *PostgresStorage) createApiTokenTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS ApiTokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		prefix VARCHAR(20) NOT NULL,
+		hash VARCHAR(64) NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		expires_on TIMESTAMP,
+		last_used TIMESTAMP,
+		created_on TIMESTAMP NOT NULL
+	)`
+	_, err := s.conn(ctx).ExecContext(ctx, query)
+	return err
+}
+
+func (s *PostgresStorage) CreateApiToken(c context.Context, token data.ApiToken) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateApiToken")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, token.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO ApiTokens (user_id, name, prefix, hash, scopes, expires_on, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	id, err := s.insert(ctx, query, user_id, token.Name, token.Prefix, token.Hash, joinScopes(token.Scopes), nullTime(token.Expires_on), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// hashes are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "api_token", id, token.User.Username, nil, map[string]any{"name": token.Name, "scopes": token.Scopes})
+}
+
+// lists a users tokens newest first
+func (s *PostgresStorage) GetApiTokens(c context.Context, username string) ([]*data.ApiToken, error) {
+	ctx, cancel := s.queryContext(c, "GetApiTokens")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, apiTokenQuery+" WHERE u.username = $1 ORDER BY t.created_on DESC, t.id DESC", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanApiTokens(rows)
+}
+
+// finds a token by the hash of its secret along with its user, see data.HashApiToken
+func (s *PostgresStorage) GetApiTokenByHash(c context.Context, hash string) (*data.ApiToken, error) {
+	ctx, cancel := s.queryContext(c, "GetApiTokenByHash")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, apiTokenQuery+" WHERE t.hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := scanApiTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	users, err := s.GetUsers(ctx, map[string]string{"id": tokens[0].User.Id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	tokens[0].User = *users[0]
+	return tokens[0], nil
+}
+
+func (s *PostgresStorage) TouchApiToken(c context.Context, id int, used time.Time) error {
+	ctx, cancel := s.queryContext(c, "TouchApiToken")
+	defer cancel()
 
-		// get techstacks with found id
-		stack, e := s.GetTechStacks(map[string]string{"id": record.techstack_id})
-		if e != nil {
-			return nil, e
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE ApiTokens SET last_used = $1 WHERE id = $2", used, id)
+	return err
+}
+
+// revokes one of the users tokens, sql.ErrNoRows when they have no such token
+func (s *PostgresStorage) DeleteApiToken(c context.Context, username string, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteApiToken")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM ApiTokens WHERE id = $1 AND user_id = $2", id, user_id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
 		}
-		username, ok := keys["username"]
-		if ok {
-			if stack[0].User.Username != username {
-				continue
-			}
+		return err
+	}
+
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "api_token", id, username, nil, nil)
+}
+
+// Email tokens
+
+func (s *PostgresStorage) createEmailTokenTable(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS EmailTokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		purpose VARCHAR(20) NOT NULL,
+		hash VARCHAR(64) NOT NULL UNIQUE,
+		expires_on TIMESTAMP NOT NULL,
+		used_on TIMESTAMP,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	// rate limits count the tokens a user was sent recently
+	_, err := s.conn(ctx).ExecContext(ctx, "CREATE INDEX IF NOT EXISTS email_tokens_sent ON EmailTokens (user_id, purpose, created_on)")
+	return err
+}
+
+func (s *PostgresStorage) CreateEmailToken(c context.Context, token data.EmailToken) error {
+	ctx, cancel := s.queryContext(c, "CreateEmailToken")
+	defer cancel()
+
+	user_id, f_err := s.getUserID(ctx, token.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO EmailTokens (user_id, purpose, hash, expires_on, created_on)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := s.insert(ctx, query, user_id, token.Purpose, token.Hash, token.Expires_on, token.Created_on)
+	return err
+}
+
+// marks an unused and unexpired token as used at now and returns it with its user.
+// the other tokens the user was sent for the same purpose stop working too.
+// sql.ErrNoRows when the token is unknown, used or expired
+func (s *PostgresStorage) UseEmailToken(c context.Context, purpose, hash string, now time.Time) (*data.EmailToken, error) {
+	ctx, cancel := s.queryContext(c, "UseEmailToken")
+	defer cancel()
+
+	// checked and marked in one statement so a token is only ever used once
+	result, err := s.conn(ctx).ExecContext(ctx, "UPDATE EmailTokens SET used_on = $1 WHERE hash = $2 AND purpose = $3 AND used_on IS NULL AND expires_on > $4", now, hash, purpose, now)
+	if err != nil {
+		return nil, err
+	}
+	if used, err := result.RowsAffected(); err != nil || used == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
 		}
-		stacks = append(stacks, stack[0])
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, emailTokenQuery+" WHERE t.hash = $1", hash)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := scanEmailTokens(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, sql.ErrNoRows
 	}
 
-	return stacks, nil
+	_, err = s.conn(ctx).ExecContext(ctx, "UPDATE EmailTokens SET used_on = $1 WHERE user_id = $2 AND purpose = $3 AND used_on IS NULL", now, tokens[0].User.Id, purpose)
+	if err != nil {
+		return nil, err
+	}
 
+	users, err := s.GetUsers(ctx, map[string]string{"id": tokens[0].User.Id})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	tokens[0].User = *users[0]
+	return tokens[0], nil
+}
+
+// how many tokens for purpose the user was sent since the given time
+func (s *PostgresStorage) CountEmailTokens(c context.Context, username, purpose string, since time.Time) (int, error) {
+	ctx, cancel := s.queryContext(c, "CountEmailTokens")
+	defer cancel()
+
+	var count int
+	query := "SELECT COUNT(*) FROM EmailTokens t JOIN Users u ON u.id = t.user_id WHERE u.username = $1 AND t.purpose = $2 AND t.created_on >= $3"
+	err := s.conn(ctx).QueryRowContext(ctx, query, username, purpose, since).Scan(&count)
+	return count, err
 }
 
-func (s *PostgresStorage) DeleteTechStack(id int) error {
-	q := "DELETE FROM TechStacks WHERE id = $1"
+// Webhooks
+
+func (s *PostgresStorage) createWebhookTables(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	query := `CREATE TABLE IF NOT EXISTS Webhooks (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER REFERENCES Users(id) ON DELETE CASCADE,
+		url VARCHAR(255) NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		events TEXT NOT NULL,
+		created_on TIMESTAMP NOT NULL
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	query = `CREATE TABLE IF NOT EXISTS WebhookDeliveries (
+		id SERIAL PRIMARY KEY,
+		webhook_id INTEGER REFERENCES Webhooks(id) ON DELETE CASCADE,
+		event VARCHAR(50) NOT NULL,
+		payload TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		next_attempt TIMESTAMP NOT NULL,
+		created_on TIMESTAMP NOT NULL,
+		delivered_on TIMESTAMP
+	)`
+	if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+		return err
+	}
 
-	_, err := s.db.Exec(q, id)
+	// the queue is polled for due deliveries
+	_, err := s.conn(ctx).ExecContext(ctx, "CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON WebhookDeliveries (status, next_attempt)")
 	return err
 }
 
-func (s *PostgresStorage) AddTechStackToProject(t data.TechStack, p data.Project) error {
-	// fetch project
-	projects, err := s.GetProjects(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+func (s *PostgresStorage) CreateWebhook(c context.Context, webhook data.Webhook) (err error) {
+	ctx, end, err := s.writeContext(c, "CreateWebhook")
 	if err != nil {
 		return err
 	}
+	defer end(&err)
 
-	// fetch tech stack
-	stacks, err := s.GetTechStacks(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	user_id, f_err := s.getUserID(ctx, webhook.User.Username)
+	if f_err != nil {
+		return f_err
+	}
+
+	query := `INSERT INTO Webhooks (user_id, url, secret, events, created_on)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	id, err := s.insert(ctx, query, user_id, webhook.Url, webhook.Secret, strings.Join(webhook.Events, ","), time.Now())
 	if err != nil {
 		return err
 	}
 
-	// save to db
-	_, write_err := s.db.Exec("INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, projects[0].Id)
-	return write_err
+	// secrets are never written to the audit log
+	return recordAudit(ctx, s.conn(ctx), AuditCreate, "webhook", id, webhook.User.Username, nil, map[string]any{"url": webhook.Url, "events": webhook.Events})
 }
 
-func (s *PostgresStorage) AddTechStackToEmployment(t data.TechStack, p data.Project) error {
-	// fetch employment
-	employments, err := s.GetEmployments(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+// lists webhooks oldest first
+func (s *PostgresStorage) GetWebhooks(c context.Context, keys map[string]string) ([]*data.Webhook, error) {
+	ctx, cancel := s.queryContext(c, "GetWebhooks")
+	defer cancel()
+
+	where, args := filterClause(keys, webhookFilters)
+	rows, err := s.conn(ctx).QueryContext(ctx, webhookQuery+where+" ORDER BY w.id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWebhooks(rows)
+}
+
+// removes one of the users webhooks along with its deliveries, sql.ErrNoRows when they have no such webhook
+func (s *PostgresStorage) DeleteWebhook(c context.Context, username string, id int) (err error) {
+	ctx, end, err := s.writeContext(c, "DeleteWebhook")
 	if err != nil {
 		return err
 	}
+	defer end(&err)
 
-	// fetch tech stack
-	stacks, err := s.GetTechStacks(map[string]string{"name": p.Name, "id": fmt.Sprint(p.Id)})
+	user_id, f_err := s.getUserID(ctx, username)
+	if f_err != nil {
+		return f_err
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM WebhookDeliveries WHERE webhook_id IN (SELECT id FROM Webhooks WHERE id = $1 AND user_id = $2)", id, user_id); err != nil {
+		return err
+	}
+	result, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM Webhooks WHERE id = $1 AND user_id = $2", id, user_id)
 	if err != nil {
 		return err
 	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
 
-	// save to db
-	_, write_err := s.db.Exec("INSERT INTO ProjectTechStacks (techstack_id, project_id) VALUES ($1, $2)", stacks[0].Id, employments[0].Id)
-	return write_err
+	return recordAudit(ctx, s.conn(ctx), AuditDelete, "webhook", id, username, nil, nil)
+}
+
+// queues a delivery, it is sent once its Next_attempt is due
+func (s *PostgresStorage) CreateWebhookDelivery(c context.Context, delivery data.WebhookDelivery) error {
+	ctx, cancel := s.queryContext(c, "CreateWebhookDelivery")
+	defer cancel()
+
+	query := `INSERT INTO WebhookDeliveries (webhook_id, event, payload, status, next_attempt, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := s.insert(ctx, query, delivery.Webhook_id, delivery.Event, delivery.Payload, delivery.Status, delivery.Next_attempt, time.Now())
+	return err
+}
+
+// lists at most limit deliveries newest first
+func (s *PostgresStorage) GetWebhookDeliveries(c context.Context, keys map[string]string, limit int) ([]*data.WebhookDelivery, error) {
+	ctx, cancel := s.queryContext(c, "GetWebhookDeliveries")
+	defer cancel()
+
+	where, args := filterClause(keys, deliveryFilters)
+	args = append(args, limit)
+	rows, err := s.conn(ctx).QueryContext(ctx, fmt.Sprintf("%s%s ORDER BY id DESC LIMIT $%d", deliveryQuery, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// pending deliveries whose next attempt is at or before now, oldest first
+func (s *PostgresStorage) GetDueWebhookDeliveries(c context.Context, now time.Time, limit int) ([]*data.WebhookDelivery, error) {
+	ctx, cancel := s.queryContext(c, "GetDueWebhookDeliveries")
+	defer cancel()
+
+	rows, err := s.conn(ctx).QueryContext(ctx, deliveryQuery+" WHERE status = $1 AND next_attempt <= $2 ORDER BY next_attempt, id LIMIT $3", data.Delivery_pending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// records the outcome of an attempt
+func (s *PostgresStorage) UpdateWebhookDelivery(c context.Context, delivery data.WebhookDelivery) error {
+	ctx, cancel := s.queryContext(c, "UpdateWebhookDelivery")
+	defer cancel()
+
+	query := `UPDATE WebhookDeliveries SET status = $1, attempts = $2, response_code = $3, error = $4, next_attempt = $5, delivered_on = $6
+	WHERE id = $7`
+
+	_, err := s.conn(ctx).ExecContext(ctx, query, delivery.Status, delivery.Attempts, delivery.Response_code, delivery.Error, delivery.Next_attempt, nullTime(delivery.Delivered_on), delivery.Id)
+	return err
+}
+
+// Search
+
+// expression indexes so full text matches do not scan whole tables
+func (s *PostgresStorage) createSearchIndexes(c context.Context) error {
+	ctx, cancel := s.queryContext(c, "")
+	defer cancel()
+
+	for _, src := range searchSources {
+		// indexes from before names were null safe no longer match the search expressions
+		drop := fmt.Sprintf("DROP INDEX IF EXISTS %s_search_idx", strings.ToLower(src.table))
+		if _, err := s.conn(ctx).ExecContext(ctx, drop); err != nil {
+			return err
+		}
+
+		query := fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS %s_search_v2_idx ON %s USING GIN (to_tsvector('english', %s))",
+			strings.ToLower(src.table), src.table, src.documentExpr(""),
+		)
+		if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ranks users, profiles, projects, employments and stacks against the query
+func (s *PostgresStorage) Search(c context.Context, query string, limit int) ([]*data.SearchResult, error) {
+	ctx, cancel := s.queryContext(c, "Search")
+	defer cancel()
+
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, errors.New("provide search keyword")
+	}
+
+	headline_options := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=25, MinWords=10", data.HighlightStart, data.HighlightEnd)
+
+	var parts []string
+	for _, src := range searchSources {
+		parts = append(parts, fmt.Sprintf(
+			`SELECT '%s' AS kind, t.id, u.username, %s AS title,
+				ts_headline('english', %s, q, $2) AS snippet,
+				ts_rank(to_tsvector('english', %s), q) AS rank
+			FROM %s t JOIN Users u ON u.id = t.%s, websearch_to_tsquery('english', $1) q
+			WHERE to_tsvector('english', %s) @@ q AND %s`,
+			src.kind, src.titleExpr("t."), src.bodyExpr("t."), src.documentExpr("t."),
+			src.table, src.user, src.documentExpr("t."), src.visibleExpr("t."),
+		))
+	}
+	q := strings.Join(parts, " UNION ALL ") + " ORDER BY rank DESC, kind, id LIMIT $3"
+
+	rows, err := s.conn(ctx).QueryContext(ctx, q, strings.Join(terms, " "), headline_options, searchLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return scanSearchResults(rows)
 }
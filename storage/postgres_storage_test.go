@@ -1,31 +1,38 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+
 	"github.com/phillipmugisa/go_resume_generator/data"
 )
 
 type UserTestData struct {
-	user data.User
+	user  *data.User
 	error error
 }
 
-var database_test_data = map[string]any {
+func newTestUser(firstname, lastname, username, email, password, phone, bio, country, start_date string) *data.User {
+	user, _ := data.NewUser(firstname, lastname, username, email, password, phone, bio, country, start_date)
+	return user
+}
+
+var database_test_data = map[string]any{
 	"users": []UserTestData{
-		UserTestData{data.NewUser("phillip","mugisa","phillipmugisa","test@gmail.com","testpassword","+256782047612","This is a test bio","Uganda","01/01/2019",), nil},
-		UserTestData{data.NewUser("alex","mark","alexmark","alexmark@gmail.com","testpassword","+256782047612","This is a test bio 2","Uganda","01/01/2020",), nil},
-		UserTestData{data.NewUser("alex","mark","alexmark","alexmark@gmail.com","testpassword","+256782047612","This is a test bio 2","Uganda","01/01/2020",), "error"},
+		{newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01"), nil},
+		{newTestUser("alex", "mark", "alexmark", "alexmark@gmail.com", "testpassword", "+256782047612", "This is a test bio 2", "Uganda", "2020-01-01"), nil},
+		{newTestUser("alex", "mark", "alexmark", "alexmark@gmail.com", "testpassword", "+256782047612", "This is a test bio 2", "Uganda", "2020-01-01"), errors.New("error")},
 	},
 }
 
 func TestDB(t *testing.T) {
-	_, err := NewPostgresStorage()
+	_, err := NewPostgresStorage(PostgresDSNFromEnv())
 	if err != nil {
-		t.Error(err)
+		// requires a running postgres instance configured through POSTGRES_* env variables
+		t.Skipf("postgres not available: %v", err)
 	}
 
-
 	// test user db functionality
 	for key, val := range database_test_data {
 		if key == "users" {
@@ -39,5 +46,5 @@ func TestDB(t *testing.T) {
 			// }
 		}
 	}
-	
+
 }
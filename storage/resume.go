@@ -0,0 +1,491 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
+)
+
+const snapshotQuery = "SELECT s.id, u.id, u.username, s.label, s.data, s.created_on FROM ResumeSnapshots s JOIN Users u ON u.id = s.user_id"
+
+func scanSnapshots(rows *sql.Rows) ([]*data.ResumeSnapshot, error) {
+	defer rows.Close()
+
+	snapshots := []*data.ResumeSnapshot{}
+	for rows.Next() {
+		snapshot := new(data.ResumeSnapshot)
+		var resume_json string
+		err := rows.Scan(
+			&snapshot.Id,
+			&snapshot.User.Id,
+			&snapshot.User.Username,
+			&snapshot.Label,
+			&resume_json,
+			&snapshot.Created_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(resume_json), &snapshot.Resume); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// owner reference kept on resume items, the full user is stored once on the resume
+func resumeOwner(u data.User) data.User {
+	return data.User{Id: u.Id, Username: u.Username}
+}
+
+// collects everything a users resume is rendered from
+func LoadResume(c context.Context, s Storage, username string) (*data.Resume, error) {
+	c, span := tracing.Start(c, "storage.LoadResume", tracing.String("username", username))
+	defer span.End()
+
+	users, err := s.GetUsers(c, map[string]string{"username": username})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	user_id, err := strconv.Atoi(users[0].Id)
+	if err != nil {
+		return nil, err
+	}
+	return s.LoadResumeAggregate(c, user_id)
+}
+
+func resumeStacks(stacks []*data.TechStack, owner data.User) []data.TechStack {
+	result := make([]data.TechStack, 0, len(stacks))
+	for _, t := range stacks {
+		t.User = owner
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+	return result
+}
+
+// RollbackResume changes a users live records to match the given resume.
+// Records missing from the resume are moved to the trash, trashed records in the
+// resume are restored and records that were purged are created again.
+// Stack links missing from the live records are added, extra links are kept.
+// Changes are audited as usual and made in one transaction, when one fails none are kept.
+func RollbackResume(c context.Context, s Storage, username string, target data.Resume) error {
+	return s.Atomic(c, func(c context.Context) error {
+		return rollbackResume(c, s, username, target)
+	})
+}
+
+func rollbackResume(c context.Context, s Storage, username string, target data.Resume) error {
+	current, err := LoadResume(c, s, username)
+	if err != nil {
+		return err
+	}
+	owner := resumeOwner(current.User)
+
+	// user details
+	target.User.Username = username
+	// updates are based on the live versions, the snapshot replaces whatever is stored
+	target.User.Version = current.User.Version
+	if !sameRecord(userDetails(current.User), userDetails(target.User)) {
+		if err := s.UpdateUser(c, target.User); err != nil {
+			return err
+		}
+	}
+	if !sameRecord(userSocialLinks(current.User), userSocialLinks(target.User)) {
+		if err := s.SetUserSocials(c, target.User); err != nil {
+			return err
+		}
+	}
+
+	// profile
+	switch {
+	case target.Profile == nil && current.Profile != nil:
+		err = s.DeleteProfile(c, *current.Profile)
+	case target.Profile != nil && current.Profile == nil:
+		profile := *target.Profile
+		profile.User = owner
+		err = s.CreateProfile(c, profile)
+	case target.Profile != nil && (target.Profile.Role != current.Profile.Role || target.Profile.About != current.Profile.About):
+		profile := *target.Profile
+		profile.User = owner
+		profile.Version = current.Profile.Version
+		err = s.UpdateProfile(c, profile)
+	}
+	if err != nil {
+		return err
+	}
+
+	items, err := s.GetTrash(c, username)
+	if err != nil {
+		return err
+	}
+	trashed := map[string]bool{}
+	for _, item := range items {
+		trashed[trashKey(item.Kind, item.Id)] = true
+	}
+
+	// tech stacks first so links below can refer to them
+	stack_ids, err := rollbackStacks(c, s, owner, current.Stacks, target.Stacks, trashed)
+	if err != nil {
+		return err
+	}
+
+	if err := rollbackProjects(c, s, owner, current.Projects, target.Projects, stack_ids, trashed); err != nil {
+		return err
+	}
+	if err := rollbackEmployments(c, s, owner, current.Employments, target.Employments, stack_ids, trashed); err != nil {
+		return err
+	}
+	return rollbackHobbies(c, s, owner, current.Hobbies, target.Hobbies, trashed)
+}
+
+// returns a map of snapshot stack ids to live stack ids
+func rollbackStacks(c context.Context, s Storage, owner data.User, current, target []data.TechStack, trashed map[string]bool) (map[int]int, error) {
+	live := map[int]data.TechStack{}
+	for _, t := range current {
+		live[t.Id] = t
+	}
+	wanted := map[int]bool{}
+	for _, t := range target {
+		wanted[t.Id] = true
+	}
+
+	for _, t := range current {
+		if !wanted[t.Id] {
+			if err := s.DeleteTechStack(c, t.Id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := map[int]int{}
+	for _, t := range target {
+		t.User = owner
+
+		existing, ok := live[t.Id]
+		if !ok {
+			// only records in this users trash are restored, others are created again
+			if trashed[trashKey("stack", t.Id)] {
+				if err := s.RestoreTechStack(c, t.Id); err != nil {
+					return nil, err
+				}
+			}
+			restored, err := s.GetTechStacks(c, map[string]string{"id": fmt.Sprint(t.Id), "username": owner.Username})
+			if err != nil {
+				return nil, err
+			}
+			if len(restored) == 0 {
+				// purged, create it again
+				if err := s.CreateTechStack(c, t); err != nil {
+					return nil, err
+				}
+				created, err := s.GetTechStacks(c, map[string]string{"name": t.Name, "username": owner.Username})
+				if err != nil {
+					return nil, err
+				}
+				if len(created) == 0 {
+					return nil, sql.ErrNoRows
+				}
+				ids[t.Id] = latestId(created)
+				continue
+			}
+			existing = *restored[0]
+		}
+
+		ids[t.Id] = t.Id
+		t.Version = existing.Version
+		if existing.Name != t.Name {
+			if err := s.UpdateTechStack(c, t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, nil
+}
+
+func rollbackProjects(c context.Context, s Storage, owner data.User, current, target []data.Project, stack_ids map[int]int, trashed map[string]bool) error {
+	live := map[int]data.Project{}
+	for _, p := range current {
+		live[p.Id] = p
+	}
+	wanted := map[int]bool{}
+	for _, p := range target {
+		wanted[p.Id] = true
+	}
+
+	for _, p := range current {
+		if !wanted[p.Id] {
+			if err := s.DeleteProject(c, p.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range target {
+		p.User = owner
+
+		existing, ok := live[p.Id]
+		if !ok {
+			// only records in this users trash are restored, others are created again
+			if trashed[trashKey("project", p.Id)] {
+				if err := s.RestoreProject(c, p.Id); err != nil {
+					return err
+				}
+			}
+			restored, _, err := s.GetProjects(c, map[string]string{"id": fmt.Sprint(p.Id), "username": owner.Username}, Page{})
+			if err != nil {
+				return err
+			}
+			if len(restored) == 0 {
+				if err := s.CreateProject(c, p); err != nil {
+					return err
+				}
+				created, _, err := s.GetProjects(c, map[string]string{"name": p.Name, "username": owner.Username}, Page{Sort: "-id", Limit: 1})
+				if err != nil {
+					return err
+				}
+				if len(created) == 0 {
+					return sql.ErrNoRows
+				}
+				existing = *created[0]
+				existing.Stack = nil
+			} else {
+				existing = *restored[0]
+				stacks, err := s.GetProjectTechStacks(c, map[string]string{"project_id": fmt.Sprint(p.Id)})
+				if err != nil {
+					return err
+				}
+				existing.Stack = resumeStacks(stacks, owner)
+			}
+		}
+
+		p.Id = existing.Id
+		p.Version = existing.Version
+		if !sameRecord(projectFields(existing), projectFields(p)) {
+			if err := s.UpdateProject(c, p); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range missingStacks(existing.Stack, p.Stack, stack_ids) {
+			if err := s.AddTechStackToProject(c, t, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rollbackEmployments(c context.Context, s Storage, owner data.User, current, target []data.Employment, stack_ids map[int]int, trashed map[string]bool) error {
+	live := map[int]data.Employment{}
+	for _, e := range current {
+		live[e.Id] = e
+	}
+	wanted := map[int]bool{}
+	for _, e := range target {
+		wanted[e.Id] = true
+	}
+
+	for _, e := range current {
+		if !wanted[e.Id] {
+			if err := s.DeleteEmployment(c, e.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range target {
+		e.User = owner
+
+		existing, ok := live[e.Id]
+		if !ok {
+			// only records in this users trash are restored, others are created again
+			if trashed[trashKey("employment", e.Id)] {
+				if err := s.RestoreEmployment(c, e.Id); err != nil {
+					return err
+				}
+			}
+			restored, _, err := s.GetEmployments(c, map[string]string{"id": fmt.Sprint(e.Id), "username": owner.Username}, Page{})
+			if err != nil {
+				return err
+			}
+			if len(restored) == 0 {
+				if err := s.CreateEmployment(c, e); err != nil {
+					return err
+				}
+				created, _, err := s.GetEmployments(c, map[string]string{"name": e.Name, "username": owner.Username}, Page{Sort: "-id", Limit: 1})
+				if err != nil {
+					return err
+				}
+				if len(created) == 0 {
+					return sql.ErrNoRows
+				}
+				existing = *created[0]
+				existing.Stack = nil
+			} else {
+				existing = *restored[0]
+				stacks, err := s.GetEmploymentTechStacks(c, map[string]string{"employment_id": fmt.Sprint(e.Id)})
+				if err != nil {
+					return err
+				}
+				existing.Stack = resumeStacks(stacks, owner)
+			}
+		}
+
+		e.Id = existing.Id
+		e.Version = existing.Version
+		if !sameRecord(employmentFields(existing), employmentFields(e)) {
+			if err := s.UpdateEmployment(c, e); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range missingStacks(existing.Stack, e.Stack, stack_ids) {
+			// employment links are keyed by the records id
+			if err := s.AddTechStackToEmployment(c, t, data.Project{Id: e.Id}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rollbackHobbies(c context.Context, s Storage, owner data.User, current, target []data.Hobby, trashed map[string]bool) error {
+	live := map[int]data.Hobby{}
+	for _, h := range current {
+		live[h.Id] = h
+	}
+	wanted := map[int]bool{}
+	for _, h := range target {
+		wanted[h.Id] = true
+	}
+
+	for _, h := range current {
+		if !wanted[h.Id] {
+			if err := s.DeleteHobby(c, h.Id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, h := range target {
+		h.User = owner
+
+		existing, ok := live[h.Id]
+		if !ok {
+			// only records in this users trash are restored, others are created again
+			if trashed[trashKey("hobby", h.Id)] {
+				if err := s.RestoreHobby(c, h.Id); err != nil {
+					return err
+				}
+			}
+			restored, _, err := s.GetHobbies(c, map[string]string{"id": fmt.Sprint(h.Id), "username": owner.Username}, Page{})
+			if err != nil {
+				return err
+			}
+			if len(restored) == 0 {
+				if err := s.CreateHobby(c, h); err != nil {
+					return err
+				}
+				continue
+			}
+			existing = *restored[0]
+		}
+
+		h.Version = existing.Version
+		if existing.Name != h.Name {
+			if err := s.UpdateHobby(c, h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func trashKey(kind string, id int) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// stacks linked in target but not in current, with ids mapped to live records
+func missingStacks(current, target []data.TechStack, stack_ids map[int]int) []data.TechStack {
+	linked := map[int]bool{}
+	for _, t := range current {
+		linked[t.Id] = true
+	}
+
+	missing := []data.TechStack{}
+	for _, t := range target {
+		id, ok := stack_ids[t.Id]
+		if !ok || linked[id] {
+			continue
+		}
+		t.Id = id
+		missing = append(missing, t)
+	}
+	return missing
+}
+
+func latestId(stacks []*data.TechStack) int {
+	id := 0
+	for _, t := range stacks {
+		if t.Id > id {
+			id = t.Id
+		}
+	}
+	return id
+}
+
+// fields compared when deciding whether a record needs updating
+
+func userDetails(u data.User) []string {
+	return []string{u.Firstname, u.Lastname, u.Bio, u.Phone, u.Country}
+}
+
+func userSocialLinks(u data.User) []string {
+	return []string{u.Portfolio, u.Github, u.Linkedin, u.Twitter}
+}
+
+func projectFields(p data.Project) data.Project {
+	return data.Project{
+		Name:        p.Name,
+		Duration:    p.Duration,
+		Start_date:  p.Start_date,
+		End_date:    p.End_date,
+		Status:      p.Status,
+		Github:      p.Github,
+		Prod_link:   p.Prod_link,
+		Description: p.Description,
+	}
+}
+
+func employmentFields(e data.Employment) data.Employment {
+	return data.Employment{
+		Name:        e.Name,
+		Employee:    e.Employee,
+		Start_date:  e.Start_date,
+		End_date:    e.End_date,
+		Status:      e.Status,
+		Prod_link:   e.Prod_link,
+		Duration:    e.Duration,
+		Description: e.Description,
+	}
+}
+
+func sameRecord(a, b any) bool {
+	a_json, a_err := json.Marshal(a)
+	b_json, b_err := json.Marshal(b)
+	return a_err == nil && b_err == nil && string(a_json) == string(b_json)
+}
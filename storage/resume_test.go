@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+func TestResumeSnapshotRollback(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	s.CreateHobby(c, *user.NewHobby("chess"))
+	s.CreateTechStack(c, *user.NewTechStack("go"))
+	s.CreateProject(c, data.Project{User: *user, Name: "resume generator", Status: "active", Description: "builds resumes"})
+
+	stacks, _ := s.GetTechStacks(c, map[string]string{"username": user.Username})
+	projects, _, _ := s.GetProjects(c, map[string]string{"username": user.Username}, Page{})
+	if err := s.AddTechStackToProject(c, *stacks[0], *projects[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	resume, err := LoadResume(c, s, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume.User.Password != "" || len(resume.Projects) != 1 || len(resume.Projects[0].Stack) != 1 {
+		t.Fatalf("Got %+v, Expected resume with one linked project and no password", resume)
+	}
+
+	if err := s.CreateResumeSnapshot(c, data.ResumeSnapshot{User: *user, Label: "client a", Resume: *resume}); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := s.GetResumeSnapshots(c, user.Username)
+	if err != nil || len(snapshots) != 1 || snapshots[0].Label != "client a" {
+		t.Fatalf("Got %v %v, Expected a single snapshot", snapshots, err)
+	}
+
+	// change the live records
+	hobbies, _, _ := s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	s.UpdateHobby(c, data.Hobby{Id: hobbies[0].Id, Name: "go", Version: hobbies[0].Version})
+	s.DeleteProject(c, projects[0].Id)
+	s.CreateHobby(c, *user.NewHobby("hiking"))
+
+	current, _ := LoadResume(c, s, user.Username)
+	changes, err := data.DiffResumes(snapshots[0].Resume, *current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, change := range changes {
+		if change.Before == "chess" && change.After == "go" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Got %v, Expected renamed hobby in diff", changes)
+	}
+
+	// a rollback failing partway leaves the live records alone
+	if _, err := s.db.Exec("CREATE TRIGGER hobbies_down BEFORE UPDATE ON Hobbies BEGIN SELECT RAISE(ABORT, 'hobbies unavailable'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackResume(c, s, user.Username, snapshots[0].Resume); err == nil {
+		t.Fatal("Expected the rollback to fail")
+	}
+	after, _ := LoadResume(c, s, user.Username)
+	if unchanged, _ := data.DiffResumes(*current, *after); len(unchanged) != 0 {
+		t.Errorf("Got %v, Expected a failed rollback to change nothing", unchanged)
+	}
+	if _, err := s.db.Exec("DROP TRIGGER hobbies_down"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RollbackResume(c, s, user.Username, snapshots[0].Resume); err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ = LoadResume(c, s, user.Username)
+	changes, _ = data.DiffResumes(snapshots[0].Resume, *current)
+	if len(changes) != 0 {
+		t.Errorf("Got %v, Expected live data to match snapshot", changes)
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// a table whose text is included in search results.
+// expressions use %[1]s as the row prefix e.g "t." or "new.",
+// nullable columns must be wrapped in COALESCE, concatenating a NULL gives NULL
+type searchSource struct {
+	kind  string
+	table string
+	title string
+	body  string
+	user  string // column holding the owners user id
+	trash bool   // has a deleted_on column
+}
+
+var searchSources = []searchSource{
+	{"user", "Users", "COALESCE(%[1]sfirstname, '') || ' ' || COALESCE(%[1]slastname, '')", "COALESCE(%[1]sbio, '')", "id", true},
+	{"profile", "Profiles", "%[1]srole", "%[1]sabout", "user_id", false},
+	{"project", "Projects", "%[1]sname", "%[1]sdescription", "user_id", true},
+	{"employment", "Employments", "%[1]sname", "%[1]sdescription", "user_id", true},
+	{"stack", "TechStacks", "%[1]sname", "%[1]sname", "user_id", true},
+}
+
+func (src searchSource) titleExpr(prefix string) string {
+	return fmt.Sprintf(src.title, prefix)
+}
+
+func (src searchSource) bodyExpr(prefix string) string {
+	return fmt.Sprintf(src.body, prefix)
+}
+
+// text indexed for a row, title and body combined
+func (src searchSource) documentExpr(prefix string) string {
+	return src.titleExpr(prefix) + " || ' ' || " + src.bodyExpr(prefix)
+}
+
+// condition excluding trashed rows and rows of deleted accounts
+func (src searchSource) visibleExpr(prefix string) string {
+	if src.trash {
+		return fmt.Sprintf("%[1]sdeleted_on IS NULL AND u.deleted_on IS NULL", prefix)
+	}
+	return "u.deleted_on IS NULL"
+}
+
+// splits free text into plain search terms, dropping query syntax characters
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '+' && r != '#' && r != '.'
+	})
+}
+
+func searchLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return limit
+}
+
+// builds a highlighted snippet around the first matching term.
+// used where the database can not produce one
+func buildSnippet(text string, terms []string, words int) string {
+	fields := strings.Fields(text)
+
+	first := -1
+	for i, f := range fields {
+		if matchesTerm(f, terms) {
+			first = i
+			break
+		}
+	}
+
+	start := 0
+	if first > words/2 {
+		start = first - words/2
+	}
+	end := start + words
+	if end > len(fields) {
+		end = len(fields)
+	}
+
+	snippet := make([]string, 0, end-start)
+	for _, f := range fields[start:end] {
+		if matchesTerm(f, terms) {
+			f = data.HighlightStart + f + data.HighlightEnd
+		}
+		snippet = append(snippet, f)
+	}
+
+	result := strings.Join(snippet, " ")
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(fields) {
+		result = result + "…"
+	}
+	return result
+}
+
+func matchesTerm(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, t := range terms {
+		if strings.Contains(word, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanSearchResults(rows *sql.Rows) ([]*data.SearchResult, error) {
+	defer rows.Close()
+
+	results := []*data.SearchResult{}
+	for rows.Next() {
+		result := new(data.SearchResult)
+		err := rows.Scan(
+			&result.Kind,
+			&result.Id,
+			&result.Username,
+			&result.Title,
+			&result.Snippet,
+			&result.Rank,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
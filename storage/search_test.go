@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "Backend developer writing <b>golang</b> services", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	results, err := s.Search(c, "golang", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Kind != "user" || results[0].Username != user.Username {
+		t.Fatalf("Got %v, Expected a single user result", results)
+	}
+
+	// user content is escaped, only the highlight is markup
+	highlighted := string(results[0].Highlighted())
+	if strings.Contains(highlighted, "<b>") || !strings.Contains(highlighted, "<mark>") {
+		t.Errorf("Got %s, Expected escaped snippet with highlighted term", highlighted)
+	}
+
+	// users missing a name are still found
+	if _, err := s.db.ExecContext(c, "UPDATE Users SET lastname = NULL WHERE username = $1", user.Username); err != nil {
+		t.Fatal(err)
+	}
+	results, err = s.Search(c, "phillip", 10)
+	if err != nil || len(results) != 1 || results[0].Username != user.Username {
+		t.Errorf("Got %v %v, Expected the user without a lastname", results, err)
+	}
+
+	if _, err := s.Search(c, "  ", 10); err == nil {
+		t.Errorf("Expected error for empty query")
+	}
+}
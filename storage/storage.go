@@ -1,61 +1,135 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/tracing"
 )
 
 type Storage interface {
 	// user data
-	CreateUser(data.User) error
-	CreateUserimage(data.User, string) error
-	GetUsers(map[string]string) ([]*data.User, error)
-	DeleteUser(data.User) error
-	VerifyUserEmail(string) ([]*data.User, error)
-	SetUserSocials(u data.User) error
+	CreateUser(context.Context, data.User) error
+	CreateUserimage(context.Context, data.User, string) error
+	GetUserImages(context.Context, string) ([]string, error)
+	GetUsers(context.Context, map[string]string) ([]*data.User, error)
+	UpdateUser(context.Context, data.User) error
+	DeleteUser(context.Context, data.User) error
+	RestoreUser(context.Context, string) error
+	VerifyUserEmail(context.Context, string) ([]*data.User, error)
+	SetUserSocials(context.Context, data.User) error
+	SetUserPassword(context.Context, string, string) error
 
 	// profile
-	CreateProfile(data.Profile) error
-	GetProfile(string) (*data.Profile, error)
-	GetProfileByRole(string) ([]*data.Profile, error)
-	DeleteProfile(data.Profile) error
+	CreateProfile(context.Context, data.Profile) error
+	GetProfile(context.Context, string) (*data.Profile, error)
+	GetProfileByRole(context.Context, string, Page) ([]*data.Profile, string, error)
+	UpdateProfile(context.Context, data.Profile) error
+	DeleteProfile(context.Context, data.Profile) error
 
 	// Session
-	CreateSession(data.Session) error
-	GetSession(string) (*data.Session, error)
-	DeleteSession(data.Session) error
-	CancelSession(data.Session) error
+	CreateSession(context.Context, data.Session) error
+	GetSession(context.Context, string) (*data.Session, error)
+	DeleteSession(context.Context, data.Session) error
+	CancelSession(context.Context, data.Session) error
+	PurgeSessions(context.Context, time.Time) (int64, error)
+	CountActiveSessions(context.Context, time.Time) (int64, error)
+
+	// listings take a Page and return the cursor for the next page, empty on the last page
 
 	// Projects
-	CreateProject(data.Project) error
-	GetProjects(map[string]string) ([]*data.Project, error)
-	GetProjectsByTechStack(map[string]string) ([]*data.Project, error)
-	DeleteProject(int) error
+	CreateProject(context.Context, data.Project) error
+	GetProjects(context.Context, map[string]string, Page) ([]*data.Project, string, error)
+	GetProjectsByTechStack(context.Context, map[string]string) ([]*data.Project, error)
+	UpdateProject(context.Context, data.Project) error
+	DeleteProject(context.Context, int) error
+	RestoreProject(context.Context, int) error
 
 	// Employment
-	CreateEmployment(data.Employment) error
-	GetEmployments(map[string]string) ([]*data.Employment, error)
-	GetEmploymentsByTechStack(map[string]string) ([]*data.Employment, error)
-	DeleteEmployment(int) error
+	CreateEmployment(context.Context, data.Employment) error
+	GetEmployments(context.Context, map[string]string, Page) ([]*data.Employment, string, error)
+	GetEmploymentsByTechStack(context.Context, map[string]string) ([]*data.Employment, error)
+	UpdateEmployment(context.Context, data.Employment) error
+	DeleteEmployment(context.Context, int) error
+	RestoreEmployment(context.Context, int) error
 
 	// Hobby
-	CreateHobby(data.Hobby) error
-	GetHobbies(map[string]string) ([]*data.Hobby, error)
-	DeleteHobby(int) error
+	CreateHobby(context.Context, data.Hobby) error
+	GetHobbies(context.Context, map[string]string, Page) ([]*data.Hobby, string, error)
+	UpdateHobby(context.Context, data.Hobby) error
+	DeleteHobby(context.Context, int) error
+	RestoreHobby(context.Context, int) error
 
 	// TechStack
-	CreateTechStack(data.TechStack) error
-	GetTechStacks(map[string]string) ([]*data.TechStack, error)
-	GetProjectTechStacks(map[string]string) ([]*data.TechStack, error)
-	GetEmploymentTechStacks(map[string]string) ([]*data.TechStack, error)
-	AddTechStackToProject(data.TechStack, data.Project) error
-	AddTechStackToEmployment(data.TechStack, data.Project) error
-	DeleteTechStack(int) error
+	CreateTechStack(context.Context, data.TechStack) error
+	GetTechStacks(context.Context, map[string]string) ([]*data.TechStack, error)
+	GetProjectTechStacks(context.Context, map[string]string) ([]*data.TechStack, error)
+	GetEmploymentTechStacks(context.Context, map[string]string) ([]*data.TechStack, error)
+	AddTechStackToProject(context.Context, data.TechStack, data.Project) error
+	AddTechStackToEmployment(context.Context, data.TechStack, data.Project) error
+	UpdateTechStack(context.Context, data.TechStack) error
+	DeleteTechStack(context.Context, int) error
+	RestoreTechStack(context.Context, int) error
+
+	// Trash, Delete* methods soft delete records until they are purged
+	GetTrash(context.Context, string) ([]*data.TrashItem, error)
+	PurgeTrash(context.Context, time.Time) (int64, error)
+
+	// Audit, every write above appends an event attributed to the actor set with WithActor
+	GetAuditLog(context.Context, map[string]string, Page) ([]*data.AuditEvent, string, error)
+
+	// Resume, loads everything a users resume is rendered from in a fixed number of queries
+	LoadResumeAggregate(context.Context, int) (*data.Resume, error)
+
+	// Snapshots
+	CreateResumeSnapshot(context.Context, data.ResumeSnapshot) error
+	GetResumeSnapshots(context.Context, string) ([]*data.ResumeSnapshot, error)
+	GetResumeSnapshot(context.Context, int) (*data.ResumeSnapshot, error)
+
+	// API tokens, looked up by the hash of their secret
+	CreateApiToken(context.Context, data.ApiToken) error
+	GetApiTokens(context.Context, string) ([]*data.ApiToken, error)
+	GetApiTokenByHash(context.Context, string) (*data.ApiToken, error)
+	TouchApiToken(context.Context, int, time.Time) error
+	DeleteApiToken(context.Context, string, int) error
+
+	// Email tokens, single use and looked up by the hash of their secret
+	CreateEmailToken(context.Context, data.EmailToken) error
+	UseEmailToken(context.Context, string, string, time.Time) (*data.EmailToken, error)
+	CountEmailTokens(context.Context, string, string, time.Time) (int, error)
+
+	// Webhooks, deliveries are queued until they are sent or given up on
+	CreateWebhook(context.Context, data.Webhook) error
+	GetWebhooks(context.Context, map[string]string) ([]*data.Webhook, error)
+	DeleteWebhook(context.Context, string, int) error
+	CreateWebhookDelivery(context.Context, data.WebhookDelivery) error
+	GetWebhookDeliveries(context.Context, map[string]string, int) ([]*data.WebhookDelivery, error)
+	GetDueWebhookDeliveries(context.Context, time.Time, int) ([]*data.WebhookDelivery, error)
+	UpdateWebhookDelivery(context.Context, data.WebhookDelivery) error
+
+	// Search
+	Search(context.Context, string, int) ([]*data.SearchResult, error)
+
+	// Transactions, calls made with the context given to the function either all
+	// take effect or none do. a failed call should end the function, some databases
+	// refuse further statements in the transaction
+	Atomic(context.Context, func(context.Context) error) error
+
+	// Lifecycle
+	Ping(context.Context) error
+	Close() error
 }
 
 func scanUsers(rows *sql.Rows) ([]*data.User, error) {
+	defer rows.Close()
+
 	users := []*data.User{}
 	for rows.Next() {
 		user := new(data.User)
@@ -69,6 +143,12 @@ func scanUsers(rows *sql.Rows) ([]*data.User, error) {
 			&user.Phone,
 			&user.Country,
 			&user.Password,
+			&user.Version,
+			&user.Portfolio,
+			&user.Github,
+			&user.Linkedin,
+			&user.Twitter,
+			&user.Email_verified,
 		)
 
 		if err != nil {
@@ -79,8 +159,130 @@ func scanUsers(rows *sql.Rows) ([]*data.User, error) {
 	return users, nil
 }
 
+// columns selected when loading records, in scan order
+const (
+	projectColumns    = "id, user_id, name, duration, start_date, end_date, status, github, prod_link, description, created_on, updated_on, version"
+	employmentColumns = "id, user_id, name, employee, start_date, end_date, status, prod_link, duration, description, created_on, updated_on, version"
+	profileColumns    = "id, user_id, role, about, views, version"
+	hobbyColumns      = "id, user_id, name, version"
+	stackColumns      = "id, user_id, name, version"
+)
+
 func GenerateRecordId() string {
 
 	uuid := uuid.New()
 	return uuid.String()
 }
+
+// default time a single storage call is allowed to run for
+// override with DB_QUERY_TIMEOUT (e.g 500ms, 10s) or SetQueryTimeout
+const DefaultQueryTimeout = 5 * time.Second
+
+func queryTimeoutFromEnv() time.Duration {
+	timeout, err := time.ParseDuration(os.Getenv("DB_QUERY_TIMEOUT"))
+	if err != nil {
+		return DefaultQueryTimeout
+	}
+	return timeout
+}
+
+// derives a context for a single storage call
+// a zero or negative timeout only inherits the callers deadline
+// the returned cancel records how long the storage method took, see storage_duration_seconds,
+// and ends its trace span. calls without a method are not measured
+func withQueryTimeout(c context.Context, timeout time.Duration, backend, method string) (context.Context, context.CancelFunc) {
+	start := time.Now()
+
+	var span *tracing.Span
+	if method != "" {
+		c, span = tracing.Start(c, "storage."+method, tracing.String("db.system", backend))
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout <= 0 {
+		ctx, cancel = context.WithCancel(c)
+	} else {
+		ctx, cancel = context.WithTimeout(c, timeout)
+	}
+
+	return ctx, func() {
+		// checked before cancelling, afterwards the context always reports cancelled
+		if err := ctx.Err(); err != nil {
+			span.SetError(err)
+		}
+		cancel()
+		if method != "" {
+			storageDuration.Observe(time.Since(start).Seconds(), backend, method)
+			span.End()
+		}
+	}
+}
+
+// builds a parameterised WHERE clause from lookup keys.
+// filters maps each supported key to an sql condition with a single %d placeholder,
+// unsupported keys are ignored. conditions are combined using AND
+func filterClause(keys map[string]string, filters map[string]string) (string, []any) {
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		if _, ok := filters[k]; ok {
+			names = append(names, k)
+		}
+	}
+	// keep placeholder numbering deterministic
+	sort.Strings(names)
+
+	var (
+		conditions []string
+		args       []any
+	)
+	for _, k := range names {
+		args = append(args, keys[k])
+		conditions = append(conditions, fmt.Sprintf(filters[k], len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// restricts a WHERE clause built by filterClause to records not in the trash
+func notDeleted(query string) string {
+	if query == "" {
+		return " WHERE deleted_on IS NULL"
+	}
+	return query + " AND deleted_on IS NULL"
+}
+
+// filters accepted by GetProjectsByTechStack and GetEmploymentsByTechStack
+var (
+	projectsByStackFilters = map[string]string{
+		"techstack_id": "id IN (SELECT project_id FROM ProjectTechStacks WHERE techstack_id = $%d)",
+		"name":         "id IN (SELECT l.project_id FROM ProjectTechStacks l JOIN TechStacks t ON t.id = l.techstack_id WHERE t.name = $%d AND t.deleted_on IS NULL)",
+		"project_id":   "id = $%d",
+		"username":     "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	}
+	employmentsByStackFilters = map[string]string{
+		"techstack_id":  "id IN (SELECT employment_id FROM EmploymentTechStacks WHERE techstack_id = $%d)",
+		"name":          "id IN (SELECT l.employment_id FROM EmploymentTechStacks l JOIN TechStacks t ON t.id = l.techstack_id WHERE t.name = $%d AND t.deleted_on IS NULL)",
+		"employment_id": "id = $%d",
+		"username":      "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	}
+)
+
+// filters accepted by GetProjectTechStacks and GetEmploymentTechStacks
+var (
+	projectStackFilters = map[string]string{
+		"project_id":   "id IN (SELECT techstack_id FROM ProjectTechStacks WHERE project_id = $%d)",
+		"project_name": "id IN (SELECT l.techstack_id FROM ProjectTechStacks l JOIN Projects p ON p.id = l.project_id WHERE p.name = $%d AND p.deleted_on IS NULL)",
+		"username":     "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	}
+	employmentStackFilters = map[string]string{
+		"employment_id":   "id IN (SELECT techstack_id FROM EmploymentTechStacks WHERE employment_id = $%d)",
+		"employment_name": "id IN (SELECT l.techstack_id FROM EmploymentTechStacks l JOIN Employments e ON e.id = l.employment_id WHERE e.name = $%d AND e.deleted_on IS NULL)",
+		"username":        "user_id = (SELECT id FROM Users WHERE username = $%d)",
+	}
+)
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+const apiTokenQuery = "SELECT t.id, u.id, u.username, t.name, t.prefix, t.hash, t.scopes, t.expires_on, t.last_used, t.created_on FROM ApiTokens t JOIN Users u ON u.id = t.user_id"
+
+// scopes are stored comma separated
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func scanApiTokens(rows *sql.Rows) ([]*data.ApiToken, error) {
+	defer rows.Close()
+
+	tokens := []*data.ApiToken{}
+	for rows.Next() {
+		token := new(data.ApiToken)
+		var (
+			scopes     string
+			expires_on sql.NullTime
+			last_used  sql.NullTime
+		)
+		err := rows.Scan(
+			&token.Id,
+			&token.User.Id,
+			&token.User.Username,
+			&token.Name,
+			&token.Prefix,
+			&token.Hash,
+			&scopes,
+			&expires_on,
+			&last_used,
+			&token.Created_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if scopes != "" {
+			token.Scopes = strings.Split(scopes, ",")
+		}
+		token.Expires_on = expires_on.Time
+		token.Last_used = last_used.Time
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// zero times are stored as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+const emailTokenQuery = "SELECT t.id, u.id, u.username, t.purpose, t.hash, t.expires_on, t.used_on, t.created_on FROM EmailTokens t JOIN Users u ON u.id = t.user_id"
+
+func scanEmailTokens(rows *sql.Rows) ([]*data.EmailToken, error) {
+	defer rows.Close()
+
+	tokens := []*data.EmailToken{}
+	for rows.Next() {
+		token := new(data.EmailToken)
+		var used_on sql.NullTime
+		err := rows.Scan(
+			&token.Id,
+			&token.User.Id,
+			&token.User.Username,
+			&token.Purpose,
+			&token.Hash,
+			&token.Expires_on,
+			&used_on,
+			&token.Created_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		token.Used_on = used_on.Time
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+func TestApiTokens(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	token, secret, err := user.NewApiToken("ci", []string{"projects:write", "user:read"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateApiToken(c, *token); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := s.GetApiTokenByHash(c, data.HashApiToken(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.User.Username != user.Username || found.User.Email != user.Email || len(found.Scopes) != 2 || !found.Expires_on.IsZero() || !found.Last_used.IsZero() {
+		t.Errorf("Got %+v, Expected the token with its user and scopes", found)
+	}
+	if !found.Allows("projects", true) || !found.Allows("projects", false) || !found.Allows("user", false) || found.Allows("user", true) || found.Allows("hobbies", false) {
+		t.Errorf("Got scopes %v, Expected write to include read and nothing else to be allowed", found.Scopes)
+	}
+
+	used := time.Now().Truncate(time.Second)
+	if err := s.TouchApiToken(c, found.Id, used); err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ := s.GetApiTokens(c, user.Username)
+	if len(tokens) != 1 || !tokens[0].Last_used.Equal(used) || tokens[0].Hash != found.Hash {
+		t.Errorf("Got %+v, Expected the token to record when it was used", tokens)
+	}
+
+	if err := s.DeleteApiToken(c, "someone", found.Id); err == nil {
+		t.Error("Expected tokens of other users to not be revoked")
+	}
+	if err := s.DeleteApiToken(c, user.Username, found.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetApiTokenByHash(c, data.HashApiToken(secret)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Got %v, Expected revoked tokens to be gone", err)
+	}
+
+	if _, _, err := user.NewApiToken("bad", []string{"passwords:write"}, time.Time{}); err == nil {
+		t.Error("Expected unknown scopes to be refused")
+	}
+}
+
+func TestEmailTokens(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	first, first_secret, _ := user.NewEmailToken(data.Email_token_verify, time.Hour, now.Add(-time.Minute))
+	second, second_secret, _ := user.NewEmailToken(data.Email_token_verify, time.Hour, now)
+	expired, expired_secret, _ := user.NewEmailToken(data.Email_token_verify, time.Hour, now.Add(-2*time.Hour))
+	for _, token := range []*data.EmailToken{first, second, expired} {
+		if err := s.CreateEmailToken(c, *token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count, err := s.CountEmailTokens(c, user.Username, data.Email_token_verify, now.Add(-time.Hour)); err != nil || count != 2 {
+		t.Errorf("Got %d %v, Expected the two tokens sent in the last hour", count, err)
+	}
+
+	if _, err := s.UseEmailToken(c, data.Email_token_verify, data.HashEmailToken(expired_secret), now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Got %v, Expected expired tokens to be refused", err)
+	}
+	if _, err := s.UseEmailToken(c, "reset_password", data.HashEmailToken(second_secret), now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Got %v, Expected tokens to only be used for their purpose", err)
+	}
+
+	used, err := s.UseEmailToken(c, data.Email_token_verify, data.HashEmailToken(second_secret), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used.User.Email != user.Email || used.Used_on.IsZero() {
+		t.Errorf("Got %+v, Expected the used token with its user", used)
+	}
+	if _, err := s.UseEmailToken(c, data.Email_token_verify, data.HashEmailToken(second_secret), now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Got %v, Expected tokens to be used once", err)
+	}
+	if _, err := s.UseEmailToken(c, data.Email_token_verify, data.HashEmailToken(first_secret), now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Got %v, Expected earlier tokens to stop working once one is used", err)
+	}
+}
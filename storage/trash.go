@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"database/sql"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+// tables that support soft deletes, in the order they are purged
+var trashTables = []struct {
+	kind  string
+	table string
+	name  string // sql expression naming the record
+	user  string // column holding the owners user id
+}{
+	{"hobby", "Hobbies", "name", "user_id"},
+	{"stack", "TechStacks", "name", "user_id"},
+	{"employment", "Employments", "name", "user_id"},
+	{"project", "Projects", "name", "user_id"},
+	{"user", "Users", "username", "id"},
+}
+
+func scanTrash(rows *sql.Rows) ([]*data.TrashItem, error) {
+	defer rows.Close()
+
+	items := []*data.TrashItem{}
+	for rows.Next() {
+		item := new(data.TrashItem)
+		err := rows.Scan(&item.Kind, &item.Id, &item.Name, &item.Deleted_on)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateHobby(c, *user.NewHobby("chess")); err != nil {
+		t.Fatal(err)
+	}
+
+	hobbies, _, err := s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	if err != nil || len(hobbies) != 1 {
+		t.Fatalf("Got %v %v, Expected a single hobby", hobbies, err)
+	}
+
+	if err := s.DeleteHobby(c, hobbies[0].Id); err != nil {
+		t.Fatal(err)
+	}
+
+	hobbies, _, _ = s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	if len(hobbies) != 0 {
+		t.Errorf("Got %d hobbies, Expected deleted hobby to be hidden", len(hobbies))
+	}
+
+	trash, err := s.GetTrash(c, user.Username)
+	if err != nil || len(trash) != 1 || trash[0].Kind != "hobby" || trash[0].Name != "chess" {
+		t.Fatalf("Got %v %v, Expected hobby in trash", trash, err)
+	}
+
+	// restore brings the record back
+	if err := s.RestoreHobby(c, trash[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	hobbies, _, _ = s.GetHobbies(c, map[string]string{"username": user.Username}, Page{})
+	if len(hobbies) != 1 {
+		t.Errorf("Got %d hobbies, Expected restored hobby", len(hobbies))
+	}
+
+	// purge only removes records older than the cut off
+	s.DeleteHobby(c, hobbies[0].Id)
+	if purged, _ := s.PurgeTrash(c, time.Now().Add(-time.Hour)); purged != 0 {
+		t.Errorf("Got %d purged, Expected: 0", purged)
+	}
+	if purged, _ := s.PurgeTrash(c, time.Now().Add(time.Second)); purged != 1 {
+		t.Errorf("Got %d purged, Expected: 1", purged)
+	}
+	if trash, _ := s.GetTrash(c, user.Username); len(trash) != 0 {
+		t.Errorf("Got %v, Expected empty trash", trash)
+	}
+}
+
+func TestTrashUserEndsSessions(t *testing.T) {
+	s, err := NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user := newTestUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+	users, _ := s.GetUsers(c, map[string]string{"username": user.Username})
+	session, _ := users[0].NewSession(time.Hour)
+	if err := s.CreateSession(c, *session); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUser(c, *users[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSession(c, session.Key); err == nil {
+		t.Errorf("Expected the session of a trashed user to end")
+	}
+
+	// sessions left from before are refused too
+	if err := s.RestoreUser(c, user.Username); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(c, *session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(c, "UPDATE Users SET deleted_on = $1 WHERE username = $2", time.Now(), user.Username); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSession(c, session.Key); err == nil {
+		t.Errorf("Expected sessions of trashed users to be refused")
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// the query methods shared by *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// the transaction ctx runs in, otherwise db
+func txConn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+func inTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return ok
+}
+
+// derives a context for a storage call whose writes must all happen or none, e.g a
+// change and its audit event. the call joins the transaction c already runs in,
+// otherwise one is started on db. end must be deferred with the methods error,
+// a started transaction is committed when it is nil and rolled back otherwise
+func withTransaction(c context.Context, db *sql.DB, timeout time.Duration, backend, method string) (context.Context, func(*error), error) {
+	ctx, cancel := withQueryTimeout(c, timeout, backend, method)
+	if inTransaction(ctx) {
+		return ctx, func(*error) { cancel() }, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	end := func(err *error) {
+		// finished before cancelling, a cancelled context rolls the transaction back
+		defer cancel()
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if *err != nil {
+			tx.Rollback()
+			return
+		}
+		*err = tx.Commit()
+	}
+	return context.WithValue(ctx, txKey{}, tx), end, nil
+}
+
+// runs fn in one transaction, see Storage.Atomic. the calls fn makes have their
+// own timeouts so the transaction only inherits the callers deadline
+func runAtomic(c context.Context, db *sql.DB, backend string, fn func(context.Context) error) (err error) {
+	ctx, end, err := withTransaction(c, db, 0, backend, "Atomic")
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+	return fn(ctx)
+}
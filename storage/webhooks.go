@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+)
+
+const (
+	webhookQuery  = "SELECT w.id, u.id, u.username, w.url, w.secret, w.events, w.created_on FROM Webhooks w JOIN Users u ON u.id = w.user_id"
+	deliveryQuery = "SELECT id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt, created_on, delivered_on FROM WebhookDeliveries"
+)
+
+// filters accepted by GetWebhooks and GetWebhookDeliveries
+var (
+	webhookFilters = map[string]string{
+		"id":       "w.id = $%d",
+		"username": "u.username = $%d",
+	}
+	deliveryFilters = map[string]string{
+		"id":         "id = $%d",
+		"webhook_id": "webhook_id = $%d",
+		"status":     "status = $%d",
+	}
+)
+
+func scanWebhooks(rows *sql.Rows) ([]*data.Webhook, error) {
+	defer rows.Close()
+
+	webhooks := []*data.Webhook{}
+	for rows.Next() {
+		webhook := new(data.Webhook)
+		var events string
+		err := rows.Scan(
+			&webhook.Id,
+			&webhook.User.Id,
+			&webhook.User.Username,
+			&webhook.Url,
+			&webhook.Secret,
+			&events,
+			&webhook.Created_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if events != "" {
+			webhook.Events = strings.Split(events, ",")
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*data.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*data.WebhookDelivery{}
+	for rows.Next() {
+		delivery := new(data.WebhookDelivery)
+		var delivered_on sql.NullTime
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.Webhook_id,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.Response_code,
+			&delivery.Error,
+			&delivery.Next_attempt,
+			&delivery.Created_on,
+			&delivered_on,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Delivered_on = delivered_on.Time
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
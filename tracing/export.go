@@ -0,0 +1,221 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// name reported as service.name in otlp files
+const ServiceName = "go_resume_generator"
+
+// TextExporter prints each trace as an indented tree of spans with their durations,
+// meant for reading while debugging a slow request
+type TextExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewTextExporter(w io.Writer) *TextExporter {
+	return &TextExporter{w: w}
+}
+
+func (e *TextExporter) ExportSpans(spans []SpanData) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	start := spans[0].Start
+
+	children := map[SpanID][]SpanData{}
+	ids := map[SpanID]bool{}
+	for _, s := range spans {
+		ids[s.SpanID] = true
+	}
+	roots := []SpanData{}
+	for _, s := range spans {
+		// spans whose parent is in another process or was dropped are printed as roots
+		if !s.ParentID.IsValid() || !ids[s.ParentID] {
+			roots = append(roots, s)
+			continue
+		}
+		children[s.ParentID] = append(children[s.ParentID], s)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "trace %s\n", spans[0].TraceID)
+
+	var write func(s SpanData, depth int)
+	write = func(s SpanData, depth int) {
+		fmt.Fprintf(&buf, "%s%-*s %10s  +%s", strings.Repeat("  ", depth+1), max(40-2*depth, 0), s.Name,
+			roundDuration(s.Duration()), roundDuration(s.Start.Sub(start)))
+		for _, a := range s.Attributes {
+			fmt.Fprintf(&buf, " %s=%v", a.Key, a.Value)
+		}
+		if s.Status == StatusError {
+			fmt.Fprintf(&buf, " error=%q", s.StatusMessage)
+		}
+		buf.WriteByte('\n')
+
+		for _, child := range children[s.SpanID] {
+			write(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		write(root, 0)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+func (e *TextExporter) Close() error {
+	return nil
+}
+
+// keeps three significant digits so the tree stays readable
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	}
+	return d
+}
+
+// OTLPExporter writes each trace as a line of otlp json (an ExportTraceServiceRequest),
+// the format of the opentelemetry collector file exporter, so traces can be loaded
+// into tools that read it
+type OTLPExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewOTLPExporter(w io.Writer) *OTLPExporter {
+	return &OTLPExporter{w: w}
+}
+
+// appends to the file at path, creating it when missing
+func OpenOTLPFile(path string) (*OTLPExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &OTLPExporter{w: f, closer: f}, nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+// ids are hex and times are nanosecond strings as in the otlp json encoding
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    Status `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	list := []otlpAttribute{}
+	for _, a := range attrs {
+		var value map[string]any
+		switch v := a.Value.(type) {
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		list = append(list, otlpAttribute{Key: a.Key, Value: value})
+	}
+	return list
+}
+
+func (e *OTLPExporter) ExportSpans(spans []SpanData) error {
+	converted := []otlpSpan{}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: s.Status, Message: s.StatusMessage},
+		}
+		if s.ParentID.IsValid() {
+			span.ParentSpanID = s.ParentID.String()
+		}
+		converted = append(converted, span)
+	}
+
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otlpAttributes([]Attribute{String("service.name", ServiceName)})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/phillipmugisa/go_resume_generator/tracing"},
+			Spans: converted,
+		}},
+	}}}
+
+	line, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+func (e *OTLPExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
@@ -0,0 +1,311 @@
+// Package tracing records spans, the timed steps of a request such as the storage
+// calls and render steps it makes, and exports each finished trace for local debugging.
+//
+// Tracing is off until SetExporter is called, until then Start returns a nil span
+// whose methods do nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// values follow the otlp span kinds
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+)
+
+// values follow the otlp status codes
+type Status int
+
+const (
+	StatusUnset Status = 0
+	StatusOK    Status = 1
+	StatusError Status = 2
+)
+
+type Attribute struct {
+	Key   string
+	Value any // string, int64 or bool
+}
+
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+func Int(key string, value int) Attribute { return Attribute{key, int64(value)} }
+
+func Bool(key string, value bool) Attribute { return Attribute{key, value} }
+
+// SpanData is a finished span as handed to an Exporter
+type SpanData struct {
+	TraceID       TraceID
+	SpanID        SpanID
+	ParentID      SpanID // zero for the root of a trace
+	Name          string
+	Kind          Kind
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        Status
+	StatusMessage string
+}
+
+func (s SpanData) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Exporter writes finished traces
+type Exporter interface {
+	// receives every span of a trace recorded in this process, in start order,
+	// once the last of them ends
+	ExportSpans(spans []SpanData) error
+	Close() error
+}
+
+// spans kept per trace, later spans are dropped so a runaway loop can not exhaust memory
+const maxSpansPerTrace = 2000
+
+type tracer struct {
+	exporter Exporter
+
+	mu     sync.Mutex
+	traces map[TraceID]*pendingTrace
+}
+
+// a trace with spans still running
+type pendingTrace struct {
+	open    int
+	spans   []SpanData
+	dropped int
+}
+
+var active atomic.Pointer[tracer]
+
+// SetExporter turns tracing on, nil turns it off.
+// traces still running when the exporter changes are not exported
+func SetExporter(e Exporter) {
+	if e == nil {
+		active.Store(nil)
+		return
+	}
+	active.Store(&tracer{exporter: e, traces: map[TraceID]*pendingTrace{}})
+}
+
+// Enabled reports whether spans are being recorded
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// a parent started in another process, see Extract
+type remoteParent struct {
+	trace TraceID
+	span  SpanID
+}
+
+// Span is one timed step of a trace. a nil span is valid and records nothing
+type Span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Start begins a span that is a child of the span in ctx, or of the remote parent
+// added by Extract, or else the root of a new trace. End must be called on it
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	t := active.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	data := SpanData{
+		SpanID:     newSpanID(),
+		Name:       name,
+		Kind:       KindInternal,
+		Start:      time.Now(),
+		Attributes: attrs,
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		data.TraceID, data.ParentID = parent.data.TraceID, parent.data.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		data.TraceID, data.ParentID = remote.trace, remote.span
+	} else {
+		data.TraceID = newTraceID()
+	}
+
+	t.mu.Lock()
+	pending, ok := t.traces[data.TraceID]
+	if !ok {
+		pending = &pendingTrace{}
+		t.traces[data.TraceID] = pending
+	}
+	pending.open++
+	t.mu.Unlock()
+
+	span := &Span{tracer: t, data: data}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// the span running in ctx, nil when there is none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// the id of the trace running in ctx, empty when there is none
+func TraceIDFromContext(ctx context.Context) string {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+	return span.data.TraceID.String()
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+func (s *Span) SetKind(kind Kind) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Kind = kind
+}
+
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// marks the span failed, a nil error leaves it unchanged
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = StatusError
+	s.data.StatusMessage = err.Error()
+}
+
+// End records the span, the trace is exported once its last span ends.
+// calls after the first are ignored
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.finish(data)
+}
+
+func (t *tracer) finish(data SpanData) {
+	t.mu.Lock()
+	pending := t.traces[data.TraceID]
+	if len(pending.spans) < maxSpansPerTrace {
+		pending.spans = append(pending.spans, data)
+	} else {
+		pending.dropped++
+	}
+	pending.open--
+	if pending.open > 0 {
+		t.mu.Unlock()
+		return
+	}
+	delete(t.traces, data.TraceID)
+	t.mu.Unlock()
+
+	if pending.dropped > 0 {
+		slog.Warn("trace has too many spans", "trace_id", data.TraceID.String(), "dropped", pending.dropped)
+	}
+	sortSpans(pending.spans)
+	if err := t.exporter.ExportSpans(pending.spans); err != nil {
+		slog.Error("could not export trace", "trace_id", data.TraceID.String(), "error", err)
+	}
+}
+
+func sortSpans(spans []SpanData) {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start.Before(spans[j].Start)
+	})
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// Extract continues a trace from a w3c traceparent header,
+// e.g 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+// an invalid header returns ctx unchanged
+func Extract(ctx context.Context, traceparent string) context.Context {
+	if len(traceparent) != 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return ctx
+	}
+	if traceparent[:2] == "ff" {
+		return ctx
+	}
+
+	var parent remoteParent
+	if _, err := hex.Decode(parent.trace[:], []byte(traceparent[3:35])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(parent.span[:], []byte(traceparent[36:52])); err != nil {
+		return ctx
+	}
+	if !parent.trace.IsValid() || !parent.span.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, parent)
+}
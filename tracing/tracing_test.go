@@ -0,0 +1,157 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// keeps exported traces for inspection
+type recordingExporter struct {
+	mu     sync.Mutex
+	traces [][]SpanData
+}
+
+func (r *recordingExporter) ExportSpans(spans []SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.traces = append(r.traces, spans)
+	return nil
+}
+
+func (r *recordingExporter) Close() error { return nil }
+
+func TestDisabled(t *testing.T) {
+	SetExporter(nil)
+
+	ctx, span := Start(context.Background(), "request")
+	if span != nil {
+		t.Fatal("span recorded with tracing off")
+	}
+	// nil spans are safe to use
+	span.SetAttributes(String("k", "v"))
+	span.SetError(errors.New("failed"))
+	span.End()
+	if TraceIDFromContext(ctx) != "" {
+		t.Error("trace id without a span")
+	}
+}
+
+func TestTraceExportedWhenLastSpanEnds(t *testing.T) {
+	recorder := &recordingExporter{}
+	SetExporter(recorder)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "GET /profiles/")
+	child_ctx, query := Start(ctx, "storage.GetUsers", String("db.system", "postgres"))
+	_, nested := Start(child_ctx, "nested")
+	nested.End()
+	query.SetError(errors.New("timeout"))
+	query.End()
+
+	// a span outliving its parent keeps the trace open
+	_, late := Start(ctx, "late")
+	root.End()
+	if len(recorder.traces) != 0 {
+		t.Fatal("trace exported while a span is running")
+	}
+	late.End()
+
+	if len(recorder.traces) != 1 {
+		t.Fatalf("exported %d traces", len(recorder.traces))
+	}
+	spans := recorder.traces[0]
+	if len(spans) != 4 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+
+	names := []string{}
+	for _, s := range spans {
+		names = append(names, s.Name)
+		if s.TraceID != spans[0].TraceID {
+			t.Error("spans of one trace have different trace ids")
+		}
+	}
+	if got := strings.Join(names, ","); got != "GET /profiles/,storage.GetUsers,nested,late" {
+		t.Errorf("spans not in start order: %s", got)
+	}
+	if spans[0].ParentID.IsValid() {
+		t.Error("root has a parent")
+	}
+	if spans[1].ParentID != spans[0].SpanID || spans[2].ParentID != spans[1].SpanID {
+		t.Error("children not linked to their parents")
+	}
+	if spans[1].Status != StatusError || spans[1].StatusMessage != "timeout" {
+		t.Errorf("error not recorded: %+v", spans[1])
+	}
+	if TraceIDFromContext(ctx) != spans[0].TraceID.String() {
+		t.Error("trace id from context does not match")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	recorder := &recordingExporter{}
+	SetExporter(recorder)
+	defer SetExporter(nil)
+
+	ctx := Extract(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span := Start(ctx, "request")
+	span.End()
+
+	got := recorder.traces[0][0]
+	if got.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || got.ParentID.String() != "00f067aa0ba902b7" {
+		t.Errorf("remote parent not continued: %s %s", got.TraceID, got.ParentID)
+	}
+
+	for _, header := range []string{"", "garbage", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01"} {
+		if Extract(context.Background(), header) != context.Background() {
+			t.Errorf("accepted traceparent %q", header)
+		}
+	}
+}
+
+func TestExporters(t *testing.T) {
+	var text, otlp bytes.Buffer
+	recorder := &recordingExporter{}
+	SetExporter(recorder)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "GET /profiles/", Int("http.status_code", 200))
+	_, query := Start(ctx, "storage.GetUsers", String("db.system", "postgres"))
+	query.End()
+	root.End()
+
+	spans := recorder.traces[0]
+	if err := NewTextExporter(&text).ExportSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "trace "+spans[0].TraceID.String()) {
+		t.Fatalf("unexpected text trace:\n%s", text.String())
+	}
+	if !strings.HasPrefix(lines[1], "  GET /profiles/") || !strings.Contains(lines[1], "http.status_code=200") {
+		t.Errorf("root line: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "    storage.GetUsers") {
+		t.Errorf("child not indented under root: %q", lines[2])
+	}
+
+	if err := NewOTLPExporter(&otlp).ExportSpans(spans); err != nil {
+		t.Fatal(err)
+	}
+	var request otlpRequest
+	if err := json.Unmarshal(otlp.Bytes(), &request); err != nil {
+		t.Fatal(err)
+	}
+	exported := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(exported) != 2 || exported[1].ParentSpanID != exported[0].SpanID || exported[0].TraceID != spans[0].TraceID.String() {
+		t.Errorf("unexpected otlp spans: %+v", exported)
+	}
+	if exported[0].Attributes[0].Value["intValue"] != "200" {
+		t.Errorf("int attribute not encoded as otlp: %+v", exported[0].Attributes)
+	}
+}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrInternalAddress = errors.New("webhook receiver is not a public address")
+
+// ranges that are neither loopback, private nor link local but still not
+// reachable on the internet, e.g 100.100.100.200 answers cloud metadata requests
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// reports whether addr is on the public internet, deliveries are only sent there
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		// covers loopback, link local, multicast and unspecified addresses too
+		return false
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// a net.Dialer Control refusing connections to addresses PublicAddress rejects.
+// it runs after the name is resolved, so a receiver whose name later resolves to
+// an internal address is refused as well
+func PublicOnly(network, address string, _ syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil || !PublicAddress(addr.Addr()) {
+		return ErrInternalAddress
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. connections are checked
+// with control, nil allows any address, and redirects are not followed so a
+// receiver can not send deliveries on to another address
+func NewClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, control would only see the address of the proxy
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,306 @@
+// Package webhooks sends users events to the urls they registered.
+//
+// Emit queues a delivery per subscribed webhook, the Dispatcher sends due
+// deliveries and retries failed ones with a growing delay until MaxAttempts.
+// Every request is signed so receivers can check it came from us, see Verify
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// headers sent with every delivery
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature" // sha256=<hex hmac of "timestamp.body">
+)
+
+// attempts made before a delivery is marked failed
+const MaxAttempts = 6
+
+// delay before the given retry, 1 being the first retry
+func Backoff(retry int) time.Duration {
+	delays := []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+	return delays[min(retry, len(delays))-1]
+}
+
+// the json body of every delivery
+type Payload struct {
+	Id         string    `json:"id"` // the same when a delivery is sent again
+	Event      string    `json:"event"`
+	Username   string    `json:"username"`
+	Created_on time.Time `json:"created_on"`
+	Data       any       `json:"data"`
+}
+
+// Signature of a request body sent at timestamp, in unix seconds
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	ErrInvalidSignature = errors.New("webhook signature does not match")
+	ErrStaleTimestamp   = errors.New("webhook timestamp is too old")
+)
+
+// checks a received delivery was signed with secret within tolerance of now,
+// for receivers written in go and for tests
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Signature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	if sent := time.Unix(timestamp, 0); now.Sub(sent) > tolerance || sent.Sub(now) > tolerance {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+// Dispatcher queues and sends webhook deliveries
+type Dispatcher struct {
+	store  storage.Storage
+	client *http.Client
+	logger *slog.Logger
+	wake   chan struct{}
+
+	// replaced in tests
+	now func() time.Time
+}
+
+// client should have a timeout, receivers that do not answer in time are retried.
+// use NewClient with PublicOnly outside of tests
+func NewDispatcher(s storage.Storage, client *http.Client, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:  s,
+		client: client,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// queues event for every webhook of the user subscribed to it
+func (d *Dispatcher) Emit(c context.Context, username, event string, event_data any) error {
+	webhooks, err := d.store.GetWebhooks(c, map[string]string{"username": username})
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(Payload{
+		Id:         storage.GenerateRecordId(),
+		Event:      event,
+		Username:   username,
+		Created_on: d.now().UTC(),
+		Data:       event_data,
+	})
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(event) {
+			continue
+		}
+		delivery := data.WebhookDelivery{
+			Webhook_id:   webhook.Id,
+			Event:        event,
+			Payload:      string(body),
+			Status:       data.Delivery_pending,
+			Next_attempt: d.now(),
+		}
+		if err := d.store.CreateWebhookDelivery(c, delivery); err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		d.notify()
+	}
+	return nil
+}
+
+// queues the payload of an earlier delivery of the users webhook again, the earlier
+// delivery stays in the log as it was. sql.ErrNoRows when the user has no such delivery
+func (d *Dispatcher) Redeliver(c context.Context, username string, delivery_id int) error {
+	deliveries, err := d.store.GetWebhookDeliveries(c, map[string]string{"id": strconv.Itoa(delivery_id)}, 1)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		return sql.ErrNoRows
+	}
+
+	webhooks, err := d.store.GetWebhooks(c, map[string]string{"id": strconv.Itoa(deliveries[0].Webhook_id), "username": username})
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return sql.ErrNoRows
+	}
+
+	delivery := *deliveries[0]
+	delivery.Status = data.Delivery_pending
+	delivery.Next_attempt = d.now()
+	if err := d.store.CreateWebhookDelivery(c, delivery); err != nil {
+		return err
+	}
+	d.notify()
+	return nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sends due deliveries as they are queued and every interval for retries, until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			d.logger.Error("sending webhooks failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// how many deliveries are loaded at a time
+const batchSize = 50
+
+// sends every delivery that is due, returning how many were attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		due, err := d.store.GetDueWebhookDeliveries(ctx, d.now(), batchSize)
+		if err != nil {
+			return attempted, err
+		}
+		if len(due) == 0 {
+			return attempted, nil
+		}
+
+		for _, delivery := range due {
+			if err := d.attempt(ctx, delivery); err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+	}
+}
+
+// sends a delivery once and records the outcome, only storage errors are returned
+func (d *Dispatcher) attempt(ctx context.Context, delivery *data.WebhookDelivery) error {
+	webhooks, err := d.store.GetWebhooks(ctx, map[string]string{"id": strconv.Itoa(delivery.Webhook_id)})
+	if err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	if len(webhooks) == 0 {
+		// the webhook was removed after the delivery was queued
+		delivery.Status = data.Delivery_failed
+		delivery.Error = "webhook was removed"
+		return d.store.UpdateWebhookDelivery(ctx, *delivery)
+	}
+
+	code, send_err := d.send(ctx, webhooks[0], delivery)
+	delivery.Response_code = code
+	delivery.Error = ""
+
+	switch {
+	case send_err == nil:
+		delivery.Status = data.Delivery_delivered
+		delivery.Delivered_on = d.now()
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = data.Delivery_failed
+		delivery.Error = failureReason(code)
+	default:
+		delivery.Error = failureReason(code)
+		delivery.Next_attempt = d.now().Add(Backoff(delivery.Attempts))
+	}
+
+	d.logger.Info("webhook attempt",
+		"webhook", delivery.Webhook_id, "delivery", delivery.Id, "event", delivery.Event,
+		"attempt", delivery.Attempts, "status", delivery.Status, "response_code", code,
+	)
+	if send_err != nil {
+		d.logger.Warn("webhook attempt failed", "webhook", delivery.Webhook_id, "delivery", delivery.Id, "error", send_err)
+	}
+	return d.store.UpdateWebhookDelivery(ctx, *delivery)
+}
+
+// the error shown to the user for a failed attempt. transport errors can describe
+// the network the request went through, so they are only logged
+func failureReason(code int) string {
+	if code == 0 {
+		return "receiver could not be reached"
+	}
+	return fmt.Sprintf("receiver answered %d %s", code, http.StatusText(code))
+}
+
+// posts the payload, anything but a 2xx response is an error
+func (d *Dispatcher) send(ctx context.Context, webhook *data.Webhook, delivery *data.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := d.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-resume-generator-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.Id))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Signature(webhook.Secret, timestamp, body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver answered %s", strings.TrimSpace(res.Status))
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/phillipmugisa/go_resume_generator/data"
+	"github.com/phillipmugisa/go_resume_generator/storage"
+)
+
+// a stand-in receiver answering with the queued status codes, then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, storage.Storage, *data.User) {
+	s, err := storage.NewMemoryStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.SetUpDB(c); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := data.NewUser("phillip", "mugisa", "phillipmugisa", "test@gmail.com", "testpassword", "+256782047612", "This is a test bio", "Uganda", "2019-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser(c, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(s, NewClient(time.Second, nil), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return d, s, user
+}
+
+func registerWebhook(t *testing.T, s storage.Storage, user *data.User, url string, events ...string) *data.Webhook {
+	webhook, err := user.NewWebhook(url, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateWebhook(context.Background(), *webhook); err != nil {
+		t.Fatal(err)
+	}
+	webhooks, _ := s.GetWebhooks(context.Background(), map[string]string{"username": user.Username})
+	return webhooks[len(webhooks)-1]
+}
+
+func TestDeliveryRetriesAndRedelivery(t *testing.T) {
+	d, s, user := newTestDispatcher(t)
+	c := context.Background()
+
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	rc := &receiver{statuses: []int{http.StatusInternalServerError}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	webhook := registerWebhook(t, s, user, server.URL, data.Event_project_added)
+
+	if err := d.Emit(c, user.Username, data.Event_profile_viewed, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Emit(c, user.Username, data.Event_project_added, map[string]any{"name": "resume api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent, err := d.DeliverDue(c); err != nil || sent != 1 {
+		t.Fatalf("Got %d %v, Expected only the subscribed event to be sent", sent, err)
+	}
+	deliveries, _ := s.GetWebhookDeliveries(c, map[string]string{"webhook_id": strconv.Itoa(webhook.Id)}, 10)
+	if len(deliveries) != 1 || deliveries[0].Status != data.Delivery_pending || deliveries[0].Attempts != 1 || deliveries[0].Response_code != 500 || deliveries[0].Error == "" {
+		t.Fatalf("Got %+v, Expected the failed attempt to be queued for a retry", deliveries)
+	}
+
+	// retries wait for their backoff
+	if sent, _ := d.DeliverDue(c); sent != 0 {
+		t.Errorf("Got %d, Expected the retry to wait", sent)
+	}
+	now = now.Add(Backoff(1))
+	if sent, _ := d.DeliverDue(c); sent != 1 {
+		t.Fatalf("Got %d, Expected the retry once due", sent)
+	}
+	deliveries, _ = s.GetWebhookDeliveries(c, map[string]string{"webhook_id": strconv.Itoa(webhook.Id)}, 10)
+	if deliveries[0].Status != data.Delivery_delivered || deliveries[0].Attempts != 2 || deliveries[0].Delivered_on.IsZero() {
+		t.Errorf("Got %+v, Expected the retry to be delivered", deliveries[0])
+	}
+
+	if err := d.Redeliver(c, "someone", deliveries[0].Id); err == nil {
+		t.Error("Expected deliveries of other users to not be redelivered")
+	}
+	if err := d.Redeliver(c, user.Username, deliveries[0].Id); err != nil {
+		t.Fatal(err)
+	}
+	if sent, _ := d.DeliverDue(c); sent != 1 {
+		t.Fatalf("Got %d, Expected the redelivery to be sent", sent)
+	}
+
+	if len(rc.requests) != 3 {
+		t.Fatalf("Got %d requests, Expected 3", len(rc.requests))
+	}
+	var first, last Payload
+	json.Unmarshal(rc.bodies[0], &first)
+	json.Unmarshal(rc.bodies[2], &last)
+	if first.Event != data.Event_project_added || first.Username != user.Username || first.Id == "" || first.Id != last.Id {
+		t.Errorf("Got %+v and %+v, Expected the same payload on every attempt", first, last)
+	}
+	for i, r := range rc.requests {
+		if r.Header.Get(EventHeader) != data.Event_project_added {
+			t.Errorf("Got event header %q", r.Header.Get(EventHeader))
+		}
+		if err := Verify(webhook.Secret, r.Header, rc.bodies[i], 5*time.Minute, now); err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	if err := Verify(webhook.Secret, rc.requests[0].Header, []byte(`{"event": "forged"}`), 5*time.Minute, now); err != ErrInvalidSignature {
+		t.Errorf("Got %v, Expected a changed body to fail verification", err)
+	}
+	if err := Verify(webhook.Secret, rc.requests[0].Header, rc.bodies[0], time.Minute, now.Add(time.Hour)); err != ErrStaleTimestamp {
+		t.Errorf("Got %v, Expected old deliveries to fail verification", err)
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	d, s, user := newTestDispatcher(t)
+	c := context.Background()
+
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	registerWebhook(t, s, user, server.URL, data.Webhook_events...)
+
+	if err := d.Emit(c, user.Username, data.Event_resume_published, nil); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		if sent, err := d.DeliverDue(c); err != nil || sent != 1 {
+			t.Fatalf("attempt %d: got %d %v", attempt, sent, err)
+		}
+		now = now.Add(Backoff(attempt))
+	}
+	if sent, _ := d.DeliverDue(c); sent != 0 {
+		t.Errorf("Got %d, Expected no attempts after the last one", sent)
+	}
+
+	failed, _ := s.GetWebhookDeliveries(c, map[string]string{"status": data.Delivery_failed}, 10)
+	if len(failed) != 1 || failed[0].Attempts != MaxAttempts || failed[0].Response_code != http.StatusBadGateway {
+		t.Errorf("Got %+v, Expected the delivery to be failed after %d attempts", failed, MaxAttempts)
+	}
+}
+
+func TestDeliveryToInternalAddress(t *testing.T) {
+	d, s, user := newTestDispatcher(t)
+	c := context.Background()
+	d.client = NewClient(time.Second, PublicOnly)
+
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	webhook := registerWebhook(t, s, user, server.URL, data.Event_project_added)
+
+	if err := d.Emit(c, user.Username, data.Event_project_added, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DeliverDue(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.requests) != 0 {
+		t.Fatalf("Got %d requests, Expected the loopback receiver to be refused", len(rc.requests))
+	}
+	deliveries, _ := s.GetWebhookDeliveries(c, map[string]string{"webhook_id": strconv.Itoa(webhook.Id)}, 10)
+	if deliveries[0].Response_code != 0 || deliveries[0].Error != "receiver could not be reached" {
+		t.Errorf("Got %d %q, Expected only a generic error to be kept", deliveries[0].Response_code, deliveries[0].Error)
+	}
+
+	addresses := map[string]bool{
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.100.100.200": false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+	}
+	for address, public := range addresses {
+		if got := PublicAddress(netip.MustParseAddr(address)); got != public {
+			t.Errorf("Got %v for %s, Expected %v", got, address, public)
+		}
+	}
+}
+
+func TestDeliveryDoesNotFollowRedirects(t *testing.T) {
+	d, s, user := newTestDispatcher(t)
+	c := context.Background()
+
+	target := &receiver{}
+	internal := httptest.NewServer(target)
+	defer internal.Close()
+	server := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+	webhook := registerWebhook(t, s, user, server.URL, data.Event_project_added)
+
+	if err := d.Emit(c, user.Username, data.Event_project_added, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.DeliverDue(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(target.requests) != 0 {
+		t.Errorf("Expected the redirect to not be followed")
+	}
+	deliveries, _ := s.GetWebhookDeliveries(c, map[string]string{"webhook_id": strconv.Itoa(webhook.Id)}, 10)
+	if deliveries[0].Status != data.Delivery_pending || deliveries[0].Response_code != http.StatusTemporaryRedirect {
+		t.Errorf("Got %s %d, Expected the redirect to fail the attempt", deliveries[0].Status, deliveries[0].Response_code)
+	}
+}